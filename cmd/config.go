@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"blockchain-node/config"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configuration commands",
+	Long:  `Commands for inspecting the node configuration.`,
+}
+
+var configDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print the effective configuration",
+	Long: `Load the configuration the way the node does, defaults overridden by the config
+file and BLOCKCHAIN_* environment variables, and print the result as YAML.
+Secret values are redacted.`,
+	RunE: runConfigDump,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configDumpCmd)
+}
+
+func runConfigDump(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	data, err := cfg.Dump()
+	if err != nil {
+		return fmt.Errorf("failed to dump config: %v", err)
+	}
+	fmt.Print(string(data))
+	return nil
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigDumpEnvOverride(t *testing.T) {
+	useTempDir(t)
+	t.Setenv("BLOCKCHAIN_RPCPORT", "9999")
+	t.Setenv("BLOCKCHAIN_RPC_AUTH_TOKEN", "hunter2")
+
+	var err error
+	output := captureStdout(t, func() { err = runConfigDump(configDumpCmd, nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "rpcport: 9999\n") {
+		t.Errorf("environment override missing from the dump:\n%s", output)
+	}
+	if strings.Contains(output, "hunter2") || !strings.Contains(output, "rpc_auth_token: <redacted>") {
+		t.Errorf("auth token not redacted:\n%s", output)
+	}
+}
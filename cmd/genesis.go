@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"blockchain-node/config"
+	"blockchain-node/core"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var genesisCmd = &cobra.Command{
+	Use:   "genesis",
+	Short: "Print the genesis state root and hash",
+	Long: `Build the genesis block of the current config and genesis file in memory and
+print its state root and hash. With --check they are compared with the golden
+values in the --golden file and a difference is an error, so a refactoring
+that changes the genesis block, and with it the network identity, is noticed.
+--update writes the current values to the golden file, for intended changes.`,
+	RunE: runGenesis,
+}
+
+func init() {
+	rootCmd.AddCommand(genesisCmd)
+
+	genesisCmd.Flags().String("genesis", "genesis.json", "Path to genesis configuration file")
+	genesisCmd.Flags().String("golden", "genesis.golden.json", "Path to the file with the expected genesis values")
+	genesisCmd.Flags().Bool("check", false, "Fail if the genesis differs from the golden values")
+	genesisCmd.Flags().Bool("update", false, "Write the genesis values to the golden file")
+}
+
+// genesisGolden are the values that identify a genesis block
+type genesisGolden struct {
+	StateRoot string `json:"stateRoot"`
+	Hash      string `json:"hash"`
+}
+
+func runGenesis(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	genesisPath, _ := cmd.Flags().GetString("genesis")
+	goldenPath, _ := cmd.Flags().GetString("golden")
+	check, _ := cmd.Flags().GetBool("check")
+	update, _ := cmd.Flags().GetBool("update")
+	if check && update {
+		return fmt.Errorf("--check and --update can't be combined")
+	}
+
+	blockchainConfig := newBlockchainConfig(cfg, genesisPath)
+	genesis, err := core.GenesisBlock(blockchainConfig)
+	if err != nil {
+		return err
+	}
+
+	current := genesisGolden{
+		StateRoot: fmt.Sprintf("0x%x", genesis.Header.StateRoot),
+		Hash:      fmt.Sprintf("0x%x", genesis.Header.Hash),
+	}
+	fmt.Printf("State root: %s\n", current.StateRoot)
+	fmt.Printf("Hash:       %s\n", current.Hash)
+
+	switch {
+	case update:
+		data, err := json.MarshalIndent(current, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(goldenPath, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write golden file: %v", err)
+		}
+		fmt.Printf("Golden values written to %s\n", goldenPath)
+	case check:
+		data, err := os.ReadFile(goldenPath)
+		if err != nil {
+			return fmt.Errorf("failed to read golden file: %v", err)
+		}
+		var golden genesisGolden
+		if err := json.Unmarshal(data, &golden); err != nil {
+			return fmt.Errorf("failed to parse golden file: %v", err)
+		}
+		if current != golden {
+			return fmt.Errorf("genesis differs from %s: state root %s, hash %s, expected state root %s, hash %s (run with --update if the change is intended)",
+				goldenPath, current.StateRoot, current.Hash, golden.StateRoot, golden.Hash)
+		}
+		fmt.Printf("Genesis matches %s\n", goldenPath)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"blockchain-node/logger"
+	"time"
+)
+
+// subsystem is a named part of the node that is stopped on shutdown
+type subsystem struct {
+	name string
+	stop func() error
+}
+
+// shutdownSubsystems stops all subsystems concurrently and waits for them
+// until the timeout expires. It returns the names of the subsystems that did
+// not stop in time, shutdown carries on without them.
+func shutdownSubsystems(subsystems []subsystem, timeout time.Duration) []string {
+	done := make(chan string, len(subsystems))
+	for _, sub := range subsystems {
+		go func(sub subsystem) {
+			if err := sub.stop(); err != nil {
+				logger.Errorf("Failed to stop %s: %v", sub.name, err)
+			}
+			done <- sub.name
+		}(sub)
+	}
+
+	pending := make(map[string]bool, len(subsystems))
+	for _, sub := range subsystems {
+		pending[sub.name] = true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for len(pending) > 0 {
+		select {
+		case name := <-done:
+			delete(pending, name)
+		case <-timer.C:
+			var names []string
+			for _, sub := range subsystems {
+				if pending[sub.name] {
+					logger.Warningf("%s did not stop within %v", sub.name, timeout)
+					names = append(names, sub.name)
+				}
+			}
+			return names
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShutdownSubsystemsTimeout(t *testing.T) {
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	stopped := false
+	subsystems := []subsystem{
+		{name: "fast", stop: func() error { stopped = true; return nil }},
+		{name: "failing", stop: func() error { return errors.New("failed") }},
+		{name: "stuck", stop: func() error { <-stuck; return nil }},
+	}
+
+	start := time.Now()
+	late := shutdownSubsystems(subsystems, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("shutdown took %v", elapsed)
+	}
+	if !reflect.DeepEqual(late, []string{"stuck"}) {
+		t.Errorf("subsystems %v reported late, expected [stuck]", late)
+	}
+	if !stopped {
+		t.Error("fast subsystem not stopped")
+	}
+}
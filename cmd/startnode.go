@@ -1,4 +1,3 @@
-
 package cmd
 
 import (
@@ -13,6 +12,7 @@ import (
 	"blockchain-node/rpc"
 	"blockchain-node/security"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -33,7 +33,7 @@ var startNodeCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(startNodeCmd)
-	
+
 	startNodeCmd.Flags().Bool("mining", false, "Enable mining")
 	startNodeCmd.Flags().String("miner", "", "Miner address for block rewards")
 	startNodeCmd.Flags().Bool("enable-metrics", true, "Enable metrics collection")
@@ -47,61 +47,118 @@ func runStartNode(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to load config: %v", err)
 	}
-	
+
 	// Get genesis path from flag
 	genesisPath, _ := cmd.Flags().GetString("genesis")
-	
+
 	// Set logging level based on config
 	logger.SetLevel(logger.LogLevel(cfg.GetLogLevel()))
-	
+	for module, name := range cfg.LogModules {
+		level, err := logger.ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("invalid log level for module %s: %v", module, err)
+		}
+		logger.SetModuleLevel(module, level)
+	}
+
 	logger.Info("Starting custom blockchain node...")
 	logger.Infof("Configuration loaded: DataDir=%s, Port=%d, RPCPort=%d", cfg.DataDir, cfg.Port, cfg.RPCPort)
 	logger.Infof("Using genesis file: %s", genesisPath)
-	
+
 	// Initialize security manager
 	securityManager := security.NewSecurityManager()
-	
-	// Initialize blockchain with custom configuration
-	blockchainConfig := &core.Config{
-		DataDir:       cfg.DataDir,
-		ChainID:       cfg.ChainID,
-		BlockGasLimit: cfg.BlockGasLimit,
-		GenesisPath:   genesisPath,
+	if err := securityManager.SetTrustedPeers(cfg.TrustedPeers); err != nil {
+		logger.Fatalf("Failed to set trusted peers: %v", err)
+		return err
 	}
-	
+	if len(cfg.TrustedPeers) > 0 {
+		logger.Infof("Private network mode: accepting only %d trusted peers", len(cfg.TrustedPeers))
+	}
+	securityManager.SetAuthFailureLimit(cfg.MaxAuthFailures, cfg.AuthFailureWindow)
+
+	// Initialize blockchain with custom configuration
+	blockchainConfig := newBlockchainConfig(cfg, genesisPath)
+
 	blockchain, err := core.NewBlockchain(blockchainConfig)
 	if err != nil {
 		logger.Fatalf("Failed to initialize blockchain: %v", err)
 		return err
 	}
+	// Closed explicitly on shutdown, this covers the early returns
 	defer func() {
 		if err := blockchain.Close(); err != nil {
 			logger.Errorf("Failed to close blockchain: %v", err)
 		}
 	}()
-	
+
+	// Keep blacklisted IPs blocked across restarts
+	if err := securityManager.SetDatabase(blockchain.GetDatabase()); err != nil {
+		logger.Errorf("Failed to restore IP blacklist: %v", err)
+	}
+
 	// Initialize and set consensus engine
 	consensusEngine := consensus.NewProofOfWork()
+	consensusEngine.SetHasher(blockchain.PoWHasher())
 	blockchain.SetConsensus(consensusEngine)
-	
+	logger.Infof("Using %s proof of work", blockchain.PoWHasher().Name())
+
 	// Initialize and set virtual machine
-	vm := execution.NewVirtualMachine(blockchain.GetStateDB())
+	vm, err := execution.New(cfg.VMType, blockchain)
+	if err != nil {
+		logger.Fatalf("Failed to create virtual machine: %v", err)
+		return err
+	}
 	blockchain.SetVirtualMachine(vm)
-	
+	logger.Infof("Using %s virtual machine", cfg.VMType)
+
+	// Execute the blocks whose state was not flushed before the last stop
+	if err := blockchain.ReplayBlocks(); err != nil {
+		logger.Fatalf("Failed to replay blocks: %v", err)
+		return err
+	}
+
 	// Initialize health checker
 	var healthChecker *health.HealthChecker
 	if cfg.EnableMetrics {
 		healthChecker = health.NewHealthChecker(blockchain, blockchain.GetDatabase())
 	}
-	
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	
+
 	var wg sync.WaitGroup
-	
+
 	// Start P2P server
 	p2pServer := network.NewServer(cfg.Port, blockchain)
+	p2pServer.SetBindAddr(cfg.P2PBindAddr)
+	p2pServer.SetAdvertiseAddr(cfg.P2PAdvertiseAddr)
+	p2pServer.SetCompression(cfg.P2PCompression)
+	p2pServer.SetTxAnnounceLimit(cfg.TxAnnounceLimit)
+	p2pServer.SetMaxInvalidMessages(cfg.MaxInvalidMessages)
+	if err := p2pServer.SetTxBroadcast(cfg.TxBroadcast); err != nil {
+		logger.Fatalf("Failed to configure P2P server: %v", err)
+		return err
+	}
+	p2pServer.SetSecurityManager(securityManager)
+	p2pServer.SetMaxConnsPerIP(cfg.MaxConnsPerIP)
+	p2pServer.SetMaxHandshakes(cfg.MaxHandshakes)
+	p2pServer.SetBootNodes(cfg.BootNodes)
+	p2pServer.SetDialBackoff(cfg.DialBackoff, cfg.DialBackoffMax)
+	p2pServer.SetHandshakeTimeout(cfg.HandshakeTimeout)
+	p2pServer.SetSyncMode(cfg.SyncMode, cfg.FastSyncPivot)
+	blockchain.SetNodeFetcher(p2pServer.FetchTrieNode)
+	if err := p2pServer.LoadNodeKey(cfg.GetDataSubDir("nodekey.pem")); err != nil {
+		logger.Fatalf("Failed to load node key: %v", err)
+		return err
+	}
+	logger.Infof("Node identity: %s", p2pServer.Enode())
+	if cfg.P2PTLS {
+		if err := p2pServer.EnableTLS(cfg.P2PTLSRequired); err != nil {
+			logger.Fatalf("Failed to enable P2P TLS: %v", err)
+			return err
+		}
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -110,74 +167,97 @@ func runStartNode(cmd *cobra.Command, args []string) error {
 			logger.Errorf("P2P server error: %v", err)
 		}
 	}()
-	
+
 	// Start RPC server
 	rpcConfig := &rpc.Config{
-		Host: cfg.RPCAddr,
-		Port: cfg.RPCPort,
+		Host:            cfg.RPCAddr,
+		Port:            cfg.RPCPort,
+		WalletDir:       cfg.GetDataSubDir("wallet"),
+		ShutdownTimeout: cfg.ShutdownTimeout,
+		MaxBodySize:     cfg.RPCMaxBodySize,
+		RequestTimeout:  cfg.RPCTimeout,
+		AuthToken:       cfg.RPCAuthToken,
+		GasPrice: rpc.GasPriceConfig{
+			Blocks:     cfg.GPOBlocks,
+			Percentile: cfg.GPOPercentile,
+			MinPrice:   cfg.GPOMinPrice,
+			MaxPrice:   cfg.GPOMaxPrice,
+		},
+		MaxExpensive:  cfg.RPCMaxExpensive,
+		ExpensiveWait: cfg.RPCExpensiveWait,
 	}
 	rpcServer := rpc.NewServer(rpcConfig, blockchain)
+	rpcServer.SetSecurityManager(securityManager)
+
+	mining, _ := cmd.Flags().GetBool("mining")
+	minerAddr, _ := cmd.Flags().GetString("miner")
+	if minerAddr == "" {
+		minerAddr = cfg.Miner
+	}
+	rpcServer.SetNodeInfo(rpc.NodeInfo{
+		ID:            p2pServer.NodeID(),
+		Enode:         p2pServer.Enode(),
+		Protocol:      network.ProtocolVersion,
+		P2PBindAddr:   cfg.P2PBindAddr,
+		P2PPort:       cfg.Port,
+		MaxPeers:      cfg.MaxPeers,
+		MaxConnsPerIP: cfg.MaxConnsPerIP,
+		SyncMode:      cfg.SyncMode,
+		VMType:        cfg.VMType,
+		Mining:        (mining || cfg.Mining) && (minerAddr != "" || len(cfg.RewardAddresses) > 0),
+		Miner:         minerAddr,
+	})
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		logger.Infof("Starting RPC server on %s:%d", cfg.RPCAddr, cfg.RPCPort)
-		if err := rpcServer.Start(); err != nil {
+		if err := rpcServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.Errorf("RPC server error: %v", err)
 		}
 	}()
-	
+
 	// Start health check server if enabled
+	var healthServer *http.Server
 	if cfg.EnableMetrics && healthChecker != nil {
+		healthPort := cfg.RPCPort + 1000 // Health port is RPC port + 1000
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/health", healthChecker.HealthHandler)
+		mux.HandleFunc("/ready", healthChecker.ReadinessHandler)
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			metricsData := metrics.GetMetrics().ToMap()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(metricsData)
+		})
+		mux.HandleFunc("/metrics/prometheus", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, metrics.GetMetrics().ToPrometheus())
+		})
+
+		healthServer = &http.Server{
+			Addr:    fmt.Sprintf(":%d", healthPort),
+			Handler: mux,
+		}
+
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			healthPort := cfg.RPCPort + 1000 // Health port is RPC port + 1000
-			
-			mux := http.NewServeMux()
-			mux.HandleFunc("/health", healthChecker.HealthHandler)
-			mux.HandleFunc("/ready", healthChecker.ReadinessHandler)
-			mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-				metricsData := metrics.GetMetrics().ToMap()
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusOK)
-				
-				// Simple JSON response
-				fmt.Fprintf(w, `{`)
-				first := true
-				for key, value := range metricsData {
-					if !first {
-						fmt.Fprintf(w, ",")
-					}
-					fmt.Fprintf(w, `"%s":%v`, key, value)
-					first = false
-				}
-				fmt.Fprintf(w, `}`)
-			})
-			
-			server := &http.Server{
-				Addr:    fmt.Sprintf(":%d", healthPort),
-				Handler: mux,
-			}
-			
 			logger.Infof("Starting health check server on port %d", healthPort)
-			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				logger.Errorf("Health server error: %v", err)
 			}
 		}()
 	}
-	
+
 	// Start miner if enabled
-	mining, _ := cmd.Flags().GetBool("mining")
-	minerAddr, _ := cmd.Flags().GetString("miner")
-	
+	var miner *core.Miner
 	if mining || cfg.Mining {
-		if minerAddr == "" {
-			minerAddr = cfg.Miner
-		}
-		if minerAddr == "" {
+		if minerAddr == "" && len(cfg.RewardAddresses) == 0 {
 			logger.Warning("Mining enabled but no miner address specified")
 		} else {
-			miner := core.NewMiner(blockchain, minerAddr)
+			miner = core.NewMiner(blockchain, minerAddr)
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -186,7 +266,7 @@ func runStartNode(cmd *cobra.Command, args []string) error {
 			}()
 		}
 	}
-	
+
 	// Start metrics collection goroutine
 	if cfg.EnableMetrics {
 		wg.Add(1)
@@ -194,7 +274,7 @@ func runStartNode(cmd *cobra.Command, args []string) error {
 			defer wg.Done()
 			ticker := time.NewTicker(cfg.HealthCheckInterval)
 			defer ticker.Stop()
-			
+
 			for {
 				select {
 				case <-ctx.Done():
@@ -203,46 +283,79 @@ func runStartNode(cmd *cobra.Command, args []string) error {
 					// Update system metrics
 					memUsed, memSys := getMemoryUsage()
 					metrics.GetMetrics().SetMemoryUsage(memUsed)
-					
+
 					// Update peer count
 					metrics.GetMetrics().SetPeerCount(uint32(p2pServer.GetPeerCount()))
-					
+
 					// Update connection count
 					metrics.GetMetrics().SetConnectionCount(uint32(p2pServer.GetConnectionCount()))
 				}
 			}
 		}()
 	}
-	
+
 	logger.Info("Custom blockchain node started successfully")
 	logger.Infof("Chain ID: %d", blockchain.GetChainID())
 	logger.Infof("Genesis Hash: %x", blockchain.GetGenesisHash())
 	logger.Info("Press Ctrl+C to stop the node")
-	
+
 	// Wait for interrupt signal
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	
+
 	<-sigCh
 	logger.Info("Received shutdown signal, stopping node...")
-	
+
 	// Cancel context to stop all goroutines
 	cancel()
-	
-	// Wait for all goroutines to finish with timeout
+	deadline := time.Now().Add(cfg.ShutdownTimeout)
+
+	// Shut down in order: first stop producing and receiving blocks, then
+	// the APIs, then wait for the remaining goroutines. The blockchain is
+	// closed last, it finishes the block being inserted before flushing the
+	// state and closing the database.
+	var producers []subsystem
+	if miner != nil {
+		producers = append(producers, subsystem{name: "miner", stop: func() error {
+			miner.Stop()
+			return nil
+		}})
+	}
+	producers = append(producers, subsystem{name: "P2P server", stop: p2pServer.Stop})
+	stuck := shutdownSubsystems(producers, time.Until(deadline))
+
+	apis := []subsystem{
+		{name: "RPC server", stop: rpcServer.Stop},
+	}
+	if healthServer != nil {
+		apis = append(apis, subsystem{name: "health server", stop: func() error {
+			ctx, cancel := context.WithDeadline(context.Background(), deadline)
+			defer cancel()
+			return healthServer.Shutdown(ctx)
+		}})
+	}
+	stuck = append(stuck, shutdownSubsystems(apis, time.Until(deadline))...)
+
+	// Wait for the remaining goroutines with what is left of the budget
 	done := make(chan struct{})
 	go func() {
 		wg.Wait()
 		close(done)
 	}()
-	
+
 	select {
 	case <-done:
-		logger.Info("All services stopped gracefully")
-	case <-time.After(30 * time.Second):
-		logger.Warning("Timeout waiting for services to stop")
+		if len(stuck) == 0 {
+			logger.Info("All services stopped gracefully")
+		}
+	case <-time.After(time.Until(deadline)):
+		logger.Warningf("Timeout waiting for services to stop after %v", cfg.ShutdownTimeout)
 	}
-	
+
+	if err := blockchain.Close(); err != nil {
+		logger.Errorf("Failed to close blockchain: %v", err)
+	}
+
 	logger.Info("Custom blockchain node stopped")
 	return nil
 }
@@ -251,3 +364,50 @@ func getMemoryUsage() (uint64, uint64) {
 	// Placeholder implementation
 	return 100 * 1024 * 1024, 200 * 1024 * 1024 // 100MB used, 200MB system
 }
+
+// newBlockchainConfig returns the core configuration of the node's chain
+func newBlockchainConfig(cfg *config.Config, genesisPath string) *core.Config {
+	preimageLimit := 0
+	if cfg.EnablePreimages {
+		preimageLimit = cfg.PreimageLimit
+	}
+	var slowThreshold time.Duration
+	if cfg.DBSlowLog {
+		slowThreshold = cfg.DBSlowThreshold
+	}
+	// Entries were checked when the config was loaded
+	var rewardRecipients []core.RewardRecipient
+	for _, entry := range cfg.RewardAddresses {
+		address, weight, _ := config.ParseRewardAddress(entry)
+		rewardRecipients = append(rewardRecipients, core.RewardRecipient{Address: address, Weight: weight})
+	}
+	return &core.Config{
+		DataDir:               cfg.DataDir,
+		ChainID:               cfg.ChainID,
+		BlockGasLimit:         cfg.BlockGasLimit,
+		GenesisPath:           genesisPath,
+		MaxBlockTxs:           cfg.MaxBlockTxs,
+		TxSelectionPolicy:     core.SelectionPolicy(cfg.TxSelectionPolicy),
+		MinBlockInterval:      cfg.MinBlockInterval,
+		MineEmptyBlocks:       cfg.MineEmptyBlocks,
+		MaxEmptyInterval:      cfg.MaxEmptyInterval,
+		RewardRecipients:      rewardRecipients,
+		RewardPolicy:          core.RewardPolicy(cfg.RewardPolicy),
+		MaxTxDataSize:         cfg.MaxTxDataSize,
+		MaxBlockDrift:         cfg.MaxBlockDrift,
+		MaxTxsPerAccount:      cfg.MaxTxsPerAccount,
+		MaxFutureNonceGap:     cfg.MaxFutureNonceGap,
+		PreimageLimit:         preimageLimit,
+		DatabaseCache:         cfg.Cache,
+		DatabaseHandles:       cfg.Handles,
+		DatabaseSlowThreshold: slowThreshold,
+		GenesisDifficulty:     cfg.GenesisDifficulty,
+		GenesisTimestamp:      cfg.GenesisTimestamp,
+		GenesisGasLimit:       cfg.GenesisGasLimit,
+		GenesisExtraData:      cfg.GenesisExtraData,
+		ChainName:             cfg.ChainName,
+		PoWAlgorithm:          cfg.PoWAlgorithm,
+		StateFlushInterval:    cfg.StateFlushInterval,
+		PruneBlocks:           cfg.PruneBlocks,
+	}
+}
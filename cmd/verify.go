@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"blockchain-node/config"
+	"blockchain-node/consensus"
+	"blockchain-node/core"
+	"blockchain-node/execution"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the integrity of the chain data",
+	Long: `Walk the stored blocks from genesis to the head, checking parent links, block
+hashes, proof of work and transactions roots, and report the first inconsistency.
+With --reexecute every block is executed again and its state root, receipts root
+and gas used are compared with the header. The node must be stopped first.`,
+	RunE: runVerify,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().Bool("reexecute", false, "Re-execute every block to check state and receipts roots (slow)")
+	verifyCmd.Flags().String("genesis", "genesis.json", "Path to genesis configuration file")
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	genesisPath, _ := cmd.Flags().GetString("genesis")
+	reexecute, _ := cmd.Flags().GetBool("reexecute")
+
+	blockchain, err := core.NewBlockchain(newBlockchainConfig(cfg, genesisPath))
+	if err != nil {
+		return fmt.Errorf("failed to open blockchain: %v", err)
+	}
+	defer blockchain.Close()
+
+	consensusEngine := consensus.NewProofOfWork()
+	consensusEngine.SetHasher(blockchain.PoWHasher())
+	blockchain.SetConsensus(consensusEngine)
+	vm, err := execution.New(cfg.VMType, blockchain)
+	if err != nil {
+		return fmt.Errorf("failed to create virtual machine: %v", err)
+	}
+	blockchain.SetVirtualMachine(vm)
+	if err := blockchain.ReplayBlocks(); err != nil {
+		return fmt.Errorf("failed to replay blocks: %v", err)
+	}
+
+	head := blockchain.GetCurrentBlock()
+	if head == nil {
+		return errors.New("chain has no blocks")
+	}
+
+	fmt.Printf("Verifying blocks 0-%d in %s (re-execution: %v)\n", head.Header.Number, cfg.DataDir, reexecute)
+	start := time.Now()
+
+	err = blockchain.VerifyChain(reexecute, func(number uint64) {
+		if number > 0 && number%1000 == 0 {
+			fmt.Printf("Verified %d blocks...\n", number)
+		}
+	})
+
+	var fault *core.ChainFault
+	if errors.As(err, &fault) {
+		fmt.Printf("Chain verification failed at block %d: %s\n", fault.Number, fault.Reason)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Verified %d blocks in %v, no inconsistencies found\n", head.Header.Number+1, time.Since(start).Round(time.Millisecond))
+	return nil
+}
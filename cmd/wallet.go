@@ -1,19 +1,71 @@
-
 package cmd
 
 import (
+	"blockchain-node/config"
 	"blockchain-node/wallet"
+	"bufio"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/cobra"
 )
 
 var createwalletCmd = &cobra.Command{
 	Use:   "createwallet",
 	Short: "Create a new wallet",
-	Long:  `Create a new wallet with private/public key pair`,
+	Long: `Create a new wallet with private/public key pair. With --keystore the private
+key is encrypted with a password and saved to the wallet directory instead of
+being printed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		useKeystore, _ := cmd.Flags().GetBool("keystore")
+		passwordFile, _ := cmd.Flags().GetString("password")
+
+		createWallet(useKeystore, passwordFile)
+	},
+}
+
+var migratewalletCmd = &cobra.Command{
+	Use:   "migratewallet [address]",
+	Short: "Show the secp256k1 address of a legacy wallet",
+	Long: `Decrypt the key file of a P256 account in the wallet directory and print the
+address its private key has under the Ethereum compatible secp256k1 scheme.
+The key file and the funds at the old address are left untouched.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passwordFile, _ := cmd.Flags().GetString("password")
+
+		migrateWallet(args[0], passwordFile)
+	},
+}
+
+var accountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Manage the accounts in the wallet directory",
+}
+
+var accountListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the accounts in the wallet directory",
+	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		createWallet()
+		listAccounts()
+	},
+}
+
+var accountDeleteCmd = &cobra.Command{
+	Use:   "delete [address]",
+	Short: "Delete the key file of an account",
+	Long: `Delete the key file of an account from the wallet directory. The password
+of the key file must be given to confirm. The private key can't be recovered
+afterwards unless it was backed up, move funds away first.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passwordFile, _ := cmd.Flags().GetString("password")
+
+		deleteAccount(args[0], passwordFile)
 	},
 }
 
@@ -38,38 +90,215 @@ var sendCmd = &cobra.Command{
 		data, _ := cmd.Flags().GetString("data")
 		gasLimit, _ := cmd.Flags().GetUint64("gaslimit")
 		gasPrice, _ := cmd.Flags().GetString("gasprice")
-		
+
 		sendTransaction(from, to, amount, data, gasLimit, gasPrice)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(createwalletCmd)
+	rootCmd.AddCommand(migratewalletCmd)
+	rootCmd.AddCommand(accountCmd)
+	accountCmd.AddCommand(accountListCmd)
+	accountCmd.AddCommand(accountDeleteCmd)
 	rootCmd.AddCommand(getbalanceCmd)
 	rootCmd.AddCommand(sendCmd)
 
+	createwalletCmd.Flags().Bool("keystore", false, "Save the key encrypted in the wallet directory instead of printing it")
+	createwalletCmd.Flags().String("password", "", "File holding the keystore password, prompted for if not set")
+	migratewalletCmd.Flags().String("password", "", "File holding the keystore password, prompted for if not set")
+	accountDeleteCmd.Flags().String("password", "", "File holding the keystore password, prompted for if not set")
+
 	sendCmd.Flags().StringP("from", "f", "", "From address")
 	sendCmd.Flags().StringP("to", "t", "", "To address")
 	sendCmd.Flags().StringP("amount", "a", "0", "Amount to send")
 	sendCmd.Flags().StringP("data", "d", "", "Transaction data (hex)")
 	sendCmd.Flags().Uint64P("gaslimit", "g", 21000, "Gas limit")
 	sendCmd.Flags().StringP("gasprice", "p", "20000000000", "Gas price in wei")
-	
+
 	sendCmd.MarkFlagRequired("from")
 	sendCmd.MarkFlagRequired("to")
 }
 
-func createWallet() {
+func createWallet(useKeystore bool, passwordFile string) {
 	w, err := wallet.NewWallet()
 	if err != nil {
 		fmt.Printf("Failed to create wallet: %v\n", err)
 		return
 	}
 
+	if !useKeystore {
+		fmt.Printf("New wallet created!\n")
+		fmt.Printf("Address: %s\n", w.GetAddress())
+		fmt.Printf("Private Key: %s\n", w.GetPrivateKeyHex())
+		fmt.Printf("Public Key: %s\n", w.GetPublicKeyHex())
+		return
+	}
+
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		return
+	}
+
+	password, err := readPassword(passwordFile, true)
+	if err != nil {
+		fmt.Printf("Failed to read password: %v\n", err)
+		return
+	}
+
+	path, err := wallet.NewKeyStore(cfg.GetDataSubDir("wallet")).StoreKey(w, password)
+	if err != nil {
+		fmt.Printf("Failed to save wallet: %v\n", err)
+		return
+	}
+
 	fmt.Printf("New wallet created!\n")
 	fmt.Printf("Address: %s\n", w.GetAddress())
-	fmt.Printf("Private Key: %s\n", w.GetPrivateKeyHex())
-	fmt.Printf("Public Key: %s\n", w.GetPublicKeyHex())
+	fmt.Printf("Key file: %s\n", path)
+}
+
+func migrateWallet(addressHex, passwordFile string) {
+	if !common.IsHexAddress(addressHex) {
+		fmt.Printf("Invalid address: %s\n", addressHex)
+		return
+	}
+	address := common.HexToAddress(addressHex)
+
+	ks, err := loadKeyStore()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	password, err := readPassword(passwordFile, false)
+	if err != nil {
+		fmt.Printf("Failed to read password: %v\n", err)
+		return
+	}
+
+	migration, err := ks.Migrate(address, password)
+	if err != nil {
+		fmt.Printf("Failed to migrate wallet: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Legacy (p256) address: 0x%x\n", migration.OldAddress)
+	fmt.Printf("New (secp256k1) address: 0x%x\n", migration.NewAddress)
+}
+
+// loadKeyStore opens the key store of the configured wallet directory
+func loadKeyStore() (*wallet.KeyStore, error) {
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+
+	ks := wallet.NewKeyStore(cfg.GetDataSubDir("wallet"))
+	if err := ks.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load wallet directory: %v", err)
+	}
+	return ks, nil
+}
+
+func listAccounts() {
+	ks, err := loadKeyStore()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	accounts := ks.Accounts()
+	if len(accounts) == 0 {
+		fmt.Printf("No accounts in the wallet directory\n")
+		return
+	}
+	for i, address := range accounts {
+		fmt.Printf("Account #%d: 0x%x\n", i, address)
+	}
+}
+
+func deleteAccount(addressHex, passwordFile string) {
+	if !common.IsHexAddress(addressHex) {
+		fmt.Printf("Invalid address: %s\n", addressHex)
+		return
+	}
+	address := common.HexToAddress(addressHex)
+
+	ks, err := loadKeyStore()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if !ks.HasAccount(address) {
+		fmt.Printf("No key file for account %s\n", addressHex)
+		return
+	}
+
+	password, err := readPassword(passwordFile, false)
+	if err != nil {
+		fmt.Printf("Failed to read password: %v\n", err)
+		return
+	}
+
+	if err := ks.Delete(address, password); err != nil {
+		fmt.Printf("Failed to delete account: %v\n", err)
+		return
+	}
+	fmt.Printf("Deleted account 0x%x\n", address)
+}
+
+// readPassword reads the keystore password from file, or asks for it on
+// stdin if file is empty, twice if confirm is set
+func readPassword(file string, confirm bool) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		password := strings.TrimRight(string(data), "\r\n")
+		if password == "" {
+			return "", errors.New("password file is empty")
+		}
+		return password, nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	prompt := func(label string) (string, error) {
+		fmt.Print(label)
+		// Don't show the password as it is typed on a terminal
+		if restore, err := disableEcho(os.Stdin); err == nil {
+			defer func() {
+				restore()
+				fmt.Println()
+			}()
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	password, err := prompt("Password: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	if !confirm {
+		return password, nil
+	}
+
+	confirmation, err := prompt("Repeat password: ")
+	if err != nil {
+		return "", err
+	}
+	if confirmation != password {
+		return "", errors.New("passwords do not match")
+	}
+	return password, nil
 }
 
 func getBalance(address string) {
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"blockchain-node/wallet"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+	fn()
+	w.Close()
+	return string(<-output)
+}
+
+// useTempDir runs the test in a temporary directory with the default config,
+// so the data directory is in dir. It returns dir and a password file
+// holding "secret".
+func useTempDir(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir, passwordFile
+}
+
+func TestCreateWalletKeystore(t *testing.T) {
+	dir, passwordFile := useTempDir(t)
+
+	output := captureStdout(t, func() { createWallet(true, passwordFile) })
+	if regexp.MustCompile(`[0-9a-fA-F]{64}`).MatchString(output) {
+		t.Errorf("private key printed:\n%s", output)
+	}
+
+	ks := wallet.NewKeyStore(filepath.Join(dir, "data", "wallet"))
+	if err := ks.Load(); err != nil {
+		t.Fatal(err)
+	}
+	accounts := ks.Accounts()
+	if len(accounts) != 1 {
+		t.Fatalf("%d key files, expected 1", len(accounts))
+	}
+	if err := ks.Unlock(accounts[0], "secret", 0); err != nil {
+		t.Errorf("key file can't be decrypted: %v", err)
+	}
+}
+
+func TestAccountListAndDelete(t *testing.T) {
+	dir, passwordFile := useTempDir(t)
+
+	if output := captureStdout(t, listAccounts); !strings.Contains(output, "No accounts") {
+		t.Errorf("empty wallet directory listed:\n%s", output)
+	}
+
+	for i := 0; i < 2; i++ {
+		captureStdout(t, func() { createWallet(true, passwordFile) })
+	}
+	ks := wallet.NewKeyStore(filepath.Join(dir, "data", "wallet"))
+	if err := ks.Load(); err != nil {
+		t.Fatal(err)
+	}
+	accounts := ks.Accounts()
+	if len(accounts) != 2 {
+		t.Fatalf("%d key files, expected 2", len(accounts))
+	}
+
+	output := captureStdout(t, listAccounts)
+	for _, address := range accounts {
+		if !strings.Contains(output, fmt.Sprintf("0x%x", address)) {
+			t.Errorf("account 0x%x not listed:\n%s", address, output)
+		}
+	}
+
+	// A wrong password keeps the key file
+	deleted := fmt.Sprintf("0x%x", accounts[0])
+	wrongPassword := filepath.Join(dir, "wrong")
+	if err := os.WriteFile(wrongPassword, []byte("wrong\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	captureStdout(t, func() { deleteAccount(deleted, wrongPassword) })
+	if output := captureStdout(t, listAccounts); !strings.Contains(output, deleted) {
+		t.Fatalf("account deleted with a wrong password:\n%s", output)
+	}
+
+	captureStdout(t, func() { deleteAccount(deleted, passwordFile) })
+	output = captureStdout(t, listAccounts)
+	if strings.Contains(output, deleted) {
+		t.Errorf("deleted account listed:\n%s", output)
+	}
+	if kept := fmt.Sprintf("0x%x", accounts[1]); !strings.Contains(output, kept) {
+		t.Errorf("account %s not listed after deleting another:\n%s", kept, output)
+	}
+}
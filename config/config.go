@@ -1,51 +1,114 @@
-
 package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
 	// Node configuration
-	DataDir    string `mapstructure:"datadir"`
-	Port       int    `mapstructure:"port"`
-	RPCPort    int    `mapstructure:"rpcport"`
-	RPCAddr    string `mapstructure:"rpcaddr"`
-	
+	DataDir          string        `mapstructure:"datadir"`
+	Port             int           `mapstructure:"port"`
+	RPCPort          int           `mapstructure:"rpcport"`
+	RPCAddr          string        `mapstructure:"rpcaddr"`
+	RPCMaxBodySize   int64         `mapstructure:"rpc_max_body_size"`
+	RPCTimeout       time.Duration `mapstructure:"rpc_timeout"`
+	RPCMaxExpensive  int           `mapstructure:"rpc_max_expensive"` // 0 for no limit
+	RPCExpensiveWait time.Duration `mapstructure:"rpc_expensive_wait"`
+
+	// Gas price oracle configuration
+	GPOBlocks     int    `mapstructure:"gpo_blocks"`
+	GPOPercentile int    `mapstructure:"gpo_percentile"`
+	GPOMinPrice   uint64 `mapstructure:"gpo_min_price"` // wei, 0 for no bound
+	GPOMaxPrice   uint64 `mapstructure:"gpo_max_price"` // wei, 0 for no bound
+
 	// Mining configuration
-	Mining   bool   `mapstructure:"mining"`
-	Miner    string `mapstructure:"miner"`
-	
+	Mining            bool          `mapstructure:"mining"`
+	Miner             string        `mapstructure:"miner"`
+	MaxBlockTxs       int           `mapstructure:"maxblocktxs"`
+	TxSelectionPolicy string        `mapstructure:"tx_selection_policy"`
+	MinBlockInterval  time.Duration `mapstructure:"min_block_interval"`
+	MineEmptyBlocks   bool          `mapstructure:"mine_empty_blocks"`
+	MaxEmptyInterval  time.Duration `mapstructure:"max_empty_interval"`
+	RewardAddresses   []string      `mapstructure:"reward_addresses"`
+	RewardPolicy      string        `mapstructure:"reward_policy"`
+
+	// Transaction pool configuration
+	MaxTxsPerAccount  int    `mapstructure:"max_txs_per_account"`
+	MaxFutureNonceGap uint64 `mapstructure:"max_future_nonce_gap"`
+
 	// Network configuration
-	MaxPeers  int      `mapstructure:"maxpeers"`
-	BootNodes []string `mapstructure:"bootnode"`
-	
+	P2PBindAddr        string        `mapstructure:"p2p_bind_addr"`
+	P2PAdvertiseAddr   string        `mapstructure:"p2p_advertise_addr"` // host:port announced to peers, empty for the bind address
+	MaxPeers           int           `mapstructure:"maxpeers"`
+	MaxConnsPerIP      int           `mapstructure:"max_conns_per_ip"`
+	MaxHandshakes      int           `mapstructure:"max_handshakes"`
+	HandshakeTimeout   time.Duration `mapstructure:"handshake_timeout"`
+	BootNodes          []string      `mapstructure:"bootnode"`
+	DialBackoff        time.Duration `mapstructure:"dial_backoff"`
+	DialBackoffMax     time.Duration `mapstructure:"dial_backoff_max"`
+	TrustedPeers       []string      `mapstructure:"trusted_peers"`
+	P2PCompression     bool          `mapstructure:"p2p_compression"`
+	P2PTLS             bool          `mapstructure:"p2p_tls"`
+	P2PTLSRequired     bool          `mapstructure:"p2p_tls_required"` // with p2p_tls, reject peers that don't use TLS
+	TxBroadcast        string        `mapstructure:"tx_broadcast"`
+	TxAnnounceLimit    int           `mapstructure:"tx_announce_limit"`        // pending transactions announced to new peers, 0 disables
+	MaxInvalidMessages int           `mapstructure:"p2p_max_invalid_messages"` // 0 never drops peers for them
+	SyncMode           string        `mapstructure:"sync_mode"`
+	FastSyncPivot      uint64        `mapstructure:"fast_sync_pivot"`
+
 	// Chain configuration
-	ChainID        uint64 `mapstructure:"chainid"`
-	BlockGasLimit  uint64 `mapstructure:"blockgaslimit"`
-	
+	ChainID       uint64        `mapstructure:"chainid"`
+	BlockGasLimit uint64        `mapstructure:"blockgaslimit"`
+	MaxTxDataSize uint64        `mapstructure:"max_tx_data_size"`
+	MaxBlockDrift time.Duration `mapstructure:"max_block_drift"`
+	VMType        string        `mapstructure:"vm_type"`
+	PoWAlgorithm  string        `mapstructure:"pow_algorithm"`
+
+	// Genesis overrides, unset values are taken from the genesis file
+	GenesisDifficulty string `mapstructure:"genesis_difficulty"`
+	GenesisTimestamp  int64  `mapstructure:"genesis_timestamp"`
+	GenesisGasLimit   uint64 `mapstructure:"genesis_gaslimit"`
+	GenesisExtraData  string `mapstructure:"genesis_extradata"`
+	ChainName         string `mapstructure:"chain_name"`
+
 	// Database configuration
-	Cache   int `mapstructure:"cache"`
-	Handles int `mapstructure:"handles"`
-	
+	Cache              int           `mapstructure:"cache"`
+	Handles            int           `mapstructure:"handles"`
+	DBSlowLog          bool          `mapstructure:"db_slow_log"`
+	DBSlowThreshold    time.Duration `mapstructure:"db_slow_threshold"`
+	StateFlushInterval uint64        `mapstructure:"state_flush_interval"` // blocks between state writes to disk
+	PruneBlocks        uint64        `mapstructure:"prune_blocks"`         // recent blocks keeping transactions and receipts, 0 keeps all
+
 	// Logging configuration
-	Verbosity int `mapstructure:"verbosity"`
-	
+	Verbosity  int               `mapstructure:"verbosity"`
+	LogModules map[string]string `mapstructure:"log_modules"` // module name to level, e.g. network: debug
+
 	// Security configuration
-	EnableRateLimit bool          `mapstructure:"enable_rate_limit"`
-	RateLimit       int           `mapstructure:"rate_limit"`
-	RateLimitWindow time.Duration `mapstructure:"rate_limit_window"`
-	
+	EnableRateLimit   bool          `mapstructure:"enable_rate_limit"`
+	RateLimit         int           `mapstructure:"rate_limit"`
+	RateLimitWindow   time.Duration `mapstructure:"rate_limit_window"`
+	RPCAuthToken      string        `mapstructure:"rpc_auth_token"`
+	MaxAuthFailures   int           `mapstructure:"max_auth_failures"`
+	AuthFailureWindow time.Duration `mapstructure:"auth_failure_window"`
+
 	// Performance configuration
 	EnableCache       bool          `mapstructure:"enable_cache"`
 	CacheSize         int           `mapstructure:"cache_size"`
 	ConnectionTimeout time.Duration `mapstructure:"connection_timeout"`
-	
+	EnablePreimages   bool          `mapstructure:"enable_preimages"`
+	PreimageLimit     int           `mapstructure:"preimage_limit"`
+	ShutdownTimeout   time.Duration `mapstructure:"shutdown_timeout"`
+
 	// Health check configuration
 	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
 	EnableMetrics       bool          `mapstructure:"enable_metrics"`
@@ -56,28 +119,72 @@ var defaultConfig = Config{
 	Port:                8080,
 	RPCPort:             8545,
 	RPCAddr:             "127.0.0.1",
+	RPCMaxBodySize:      1024 * 1024,
+	RPCTimeout:          30 * time.Second,
+	RPCMaxExpensive:     16,
+	RPCExpensiveWait:    time.Second,
+	GPOBlocks:           20,
+	GPOPercentile:       60,
+	GPOMaxPrice:         500000000000,
 	Mining:              false,
 	Miner:               "",
+	MaxBlockTxs:         100,
+	TxSelectionPolicy:   "price",
+	MinBlockInterval:    15 * time.Second,
+	MineEmptyBlocks:     true,
+	MaxEmptyInterval:    0,
+	RewardPolicy:        "round-robin",
+	MaxTxsPerAccount:    64,
+	MaxFutureNonceGap:   64,
+	P2PBindAddr:         "",
+	P2PAdvertiseAddr:    "",
 	MaxPeers:            50,
+	MaxConnsPerIP:       5,
+	MaxHandshakes:       32,
+	HandshakeTimeout:    30 * time.Second,
 	BootNodes:           []string{},
+	DialBackoff:         5 * time.Second,
+	DialBackoffMax:      5 * time.Minute,
+	TrustedPeers:        []string{},
+	P2PCompression:      true,
+	P2PTLS:              false,
+	P2PTLSRequired:      false,
+	TxBroadcast:         "sqrt",
+	TxAnnounceLimit:     1024,
+	MaxInvalidMessages:  10,
+	SyncMode:            "full",
+	FastSyncPivot:       64,
 	ChainID:             1337,
 	BlockGasLimit:       8000000,
+	MaxTxDataSize:       64 * 1024,
+	MaxBlockDrift:       15 * time.Minute,
+	VMType:              "custom",
+	PoWAlgorithm:        "sha256",
 	Cache:               256,
 	Handles:             256,
+	DBSlowThreshold:     100 * time.Millisecond,
+	StateFlushInterval:  1,
 	Verbosity:           3,
+	LogModules:          map[string]string{},
 	EnableRateLimit:     true,
 	RateLimit:           100,
 	RateLimitWindow:     time.Minute,
+	RPCAuthToken:        "",
+	MaxAuthFailures:     5,
+	AuthFailureWindow:   time.Minute,
 	EnableCache:         true,
 	CacheSize:           1000,
 	ConnectionTimeout:   30 * time.Second,
+	EnablePreimages:     false,
+	PreimageLimit:       100000,
+	ShutdownTimeout:     30 * time.Second,
 	HealthCheckInterval: 30 * time.Second,
 	EnableMetrics:       true,
 }
 
 func LoadConfig(configPath string) (*Config, error) {
 	config := defaultConfig
-	
+
 	if configPath != "" {
 		// Set config file path
 		viper.SetConfigFile(configPath)
@@ -88,11 +195,14 @@ func LoadConfig(configPath string) (*Config, error) {
 		viper.SetConfigName("config")
 		viper.SetConfigType("yaml")
 	}
-	
+
 	// Set environment variable prefix
 	viper.SetEnvPrefix("BLOCKCHAIN")
 	viper.AutomaticEnv()
-	
+	if err := bindEnv(); err != nil {
+		return nil, err
+	}
+
 	// Read config file
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -100,68 +210,248 @@ func LoadConfig(configPath string) (*Config, error) {
 		}
 		// Config file not found, use defaults
 	}
-	
+
 	// Unmarshal config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %v", err)
 	}
-	
+
 	// Validate and create directories
 	if err := validateAndCreateDirs(&config); err != nil {
 		return nil, fmt.Errorf("config validation failed: %v", err)
 	}
-	
+
 	return &config, nil
 }
 
+// bindEnv binds every setting to its BLOCKCHAIN_* environment variable.
+// AutomaticEnv alone only applies to settings viper already knows, so those
+// missing from the config file couldn't be set from the environment.
+func bindEnv() error {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		if err := viper.BindEnv(key); err != nil {
+			return fmt.Errorf("failed to bind environment variable of %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
 func validateAndCreateDirs(config *Config) error {
 	// Create data directory if it doesn't exist
 	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
 		return fmt.Errorf("failed to create data directory: %v", err)
 	}
-	
+
 	// Create chaindata subdirectory
 	chaindataDir := filepath.Join(config.DataDir, "chaindata")
 	if err := os.MkdirAll(chaindataDir, 0755); err != nil {
 		return fmt.Errorf("failed to create chaindata directory: %v", err)
 	}
-	
+
 	// Create wallet directory
 	walletDir := filepath.Join(config.DataDir, "wallet")
 	if err := os.MkdirAll(walletDir, 0755); err != nil {
 		return fmt.Errorf("failed to create wallet directory: %v", err)
 	}
-	
+
 	// Validate ports
 	if config.Port <= 0 || config.Port > 65535 {
 		return fmt.Errorf("invalid port: %d", config.Port)
 	}
-	
+
 	if config.RPCPort <= 0 || config.RPCPort > 65535 {
 		return fmt.Errorf("invalid RPC port: %d", config.RPCPort)
 	}
-	
+
 	if config.Port == config.RPCPort {
 		return fmt.Errorf("port and RPC port cannot be the same")
 	}
-	
+
+	if config.P2PAdvertiseAddr != "" {
+		if _, port, err := net.SplitHostPort(config.P2PAdvertiseAddr); err != nil || port == "" {
+			return fmt.Errorf("invalid p2p_advertise_addr %q: expected host:port", config.P2PAdvertiseAddr)
+		}
+	}
+
+	if config.RPCMaxBodySize <= 0 {
+		config.RPCMaxBodySize = 1024 * 1024
+	}
+
+	if config.RPCTimeout <= 0 {
+		config.RPCTimeout = 30 * time.Second
+	}
+
+	if config.RPCMaxExpensive < 0 {
+		config.RPCMaxExpensive = 0
+	}
+	if config.RPCExpensiveWait < 0 {
+		config.RPCExpensiveWait = 0
+	}
+
+	if config.GPOBlocks <= 0 {
+		config.GPOBlocks = 20
+	}
+	if config.GPOPercentile <= 0 || config.GPOPercentile > 100 {
+		return fmt.Errorf("gpo_percentile must be between 1 and 100, got %d", config.GPOPercentile)
+	}
+	if config.GPOMaxPrice > 0 && config.GPOMaxPrice < config.GPOMinPrice {
+		return fmt.Errorf("gpo_max_price %d is below gpo_min_price %d", config.GPOMaxPrice, config.GPOMinPrice)
+	}
+
+	if config.MaxAuthFailures <= 0 {
+		config.MaxAuthFailures = 5
+	}
+
+	if config.AuthFailureWindow <= 0 {
+		config.AuthFailureWindow = time.Minute
+	}
+
 	// Validate other parameters
 	if config.MaxPeers <= 0 {
 		config.MaxPeers = 50
 	}
-	
+
 	if config.BlockGasLimit == 0 {
 		config.BlockGasLimit = 8000000
 	}
-	
+
+	if config.MaxTxDataSize == 0 {
+		config.MaxTxDataSize = 64 * 1024
+	}
+
+	if config.MaxBlockTxs <= 0 {
+		config.MaxBlockTxs = 100
+	}
+
+	if config.MinBlockInterval < 0 {
+		config.MinBlockInterval = 0
+	}
+
+	if config.MaxEmptyInterval < 0 {
+		config.MaxEmptyInterval = 0
+	}
+
+	switch config.TxSelectionPolicy {
+	case "":
+		config.TxSelectionPolicy = "price"
+	case "price", "fair":
+	default:
+		return fmt.Errorf("invalid tx selection policy: %s", config.TxSelectionPolicy)
+	}
+
+	switch config.RewardPolicy {
+	case "":
+		config.RewardPolicy = "round-robin"
+	case "round-robin", "weighted":
+	default:
+		return fmt.Errorf("invalid reward policy: %s", config.RewardPolicy)
+	}
+	for _, entry := range config.RewardAddresses {
+		if _, _, err := ParseRewardAddress(entry); err != nil {
+			return err
+		}
+	}
+
+	switch config.SyncMode {
+	case "":
+		config.SyncMode = "full"
+	case "full", "fast":
+	default:
+		return fmt.Errorf("invalid sync mode: %s", config.SyncMode)
+	}
+
+	if config.FastSyncPivot == 0 {
+		config.FastSyncPivot = 64
+	}
+
+	if config.MaxTxsPerAccount <= 0 {
+		config.MaxTxsPerAccount = 64
+	}
+
+	if config.MaxFutureNonceGap == 0 {
+		config.MaxFutureNonceGap = 64
+	}
+
+	if config.MaxBlockDrift <= 0 {
+		config.MaxBlockDrift = 15 * time.Minute
+	}
+
+	switch config.VMType {
+	case "":
+		config.VMType = "custom"
+	case "custom", "evm":
+	default:
+		return fmt.Errorf("invalid vm type: %s", config.VMType)
+	}
+
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = 30 * time.Second
+	}
+
+	if config.DialBackoff <= 0 {
+		config.DialBackoff = 5 * time.Second
+	}
+	if config.DialBackoffMax < config.DialBackoff {
+		config.DialBackoffMax = config.DialBackoff
+	}
+
+	switch config.TxBroadcast {
+	case "":
+		config.TxBroadcast = "sqrt"
+	case "all", "sqrt":
+	default:
+		return fmt.Errorf("invalid tx broadcast policy: %s", config.TxBroadcast)
+	}
+	if config.MaxInvalidMessages < 0 {
+		config.MaxInvalidMessages = 0
+	}
+
+	if config.TxAnnounceLimit < 0 {
+		config.TxAnnounceLimit = 0
+	}
+
+	switch config.PoWAlgorithm {
+	case "":
+		config.PoWAlgorithm = "sha256"
+	case "sha256", "keccak256", "scrypt":
+	default:
+		return fmt.Errorf("invalid proof of work algorithm: %s", config.PoWAlgorithm)
+	}
+
+	if config.PreimageLimit <= 0 {
+		config.PreimageLimit = 100000
+	}
+
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = 30 * time.Second
+	}
+
 	if config.Cache <= 0 {
 		config.Cache = 256
 	}
-	
+
 	if config.Handles <= 0 {
 		config.Handles = 256
 	}
-	
+
+	if config.DBSlowThreshold <= 0 {
+		config.DBSlowThreshold = 100 * time.Millisecond
+	}
+
+	if config.StateFlushInterval == 0 {
+		config.StateFlushInterval = 1
+	}
+
+	// Matches core.MinPruneDistance
+	if config.PruneBlocks != 0 && config.PruneBlocks < 128 {
+		return fmt.Errorf("prune_blocks must be 0 or at least 128, got %d", config.PruneBlocks)
+	}
+
 	return nil
 }
 
@@ -193,3 +483,21 @@ func (c *Config) IsTestnet() bool {
 func (c *Config) GetDataSubDir(subdir string) string {
 	return filepath.Join(c.DataDir, subdir)
 }
+
+// ParseRewardAddress parses a reward_addresses entry, an address optionally
+// followed by ":<weight>". The weight defaults to 1.
+func ParseRewardAddress(entry string) (common.Address, uint64, error) {
+	address, weight := entry, uint64(1)
+	if i := strings.LastIndex(entry, ":"); i >= 0 {
+		address = entry[:i]
+		parsed, err := strconv.ParseUint(entry[i+1:], 10, 64)
+		if err != nil || parsed == 0 {
+			return common.Address{}, 0, fmt.Errorf("invalid reward address weight: %s", entry)
+		}
+		weight = parsed
+	}
+	if !common.IsHexAddress(address) {
+		return common.Address{}, 0, fmt.Errorf("invalid reward address: %s", entry)
+	}
+	return common.HexToAddress(address), weight, nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the values of secret settings in a dump
+const redacted = "<redacted>"
+
+// secretKeys are the settings whose values are never dumped
+var secretKeys = map[string]bool{
+	"rpc_auth_token": true,
+}
+
+// Dump returns the configuration as YAML, with the keys of the config file in
+// the order of the Config struct. Durations are written like in the config
+// file and secret values are redacted, so the output can be shared.
+func (c *Config) Dump() ([]byte, error) {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+
+	v := reflect.ValueOf(*c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+
+		var value interface{} = v.Field(i).Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		if secretKeys[key] && !v.Field(i).IsZero() {
+			value = redacted
+		}
+
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(value); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %v", key, err)
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, valueNode)
+	}
+
+	return yaml.Marshal(doc)
+}
@@ -0,0 +1,80 @@
+package consensus
+
+import (
+	"blockchain-node/crypto"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Proof of work algorithms. All nodes of a chain must use the same one, a
+// block sealed with one algorithm does not validate under another.
+const (
+	PoWSHA256    = "sha256"
+	PoWKeccak256 = "keccak256"
+	PoWScrypt    = "scrypt"
+)
+
+// PoWHasher computes the proof of work hash of a block from its sealed header
+// encoding. The hash must not exceed the target of the block's difficulty.
+type PoWHasher interface {
+	Name() string
+	Hash(data []byte) [32]byte
+}
+
+// NewPoWHasher returns the hasher of the named algorithm, empty for the
+// default SHA-256
+func NewPoWHasher(algorithm string) (PoWHasher, error) {
+	switch algorithm {
+	case "", PoWSHA256:
+		return sha256Hasher{}, nil
+	case PoWKeccak256:
+		return keccak256Hasher{}, nil
+	case PoWScrypt:
+		return scryptHasher{}, nil
+	default:
+		return nil, fmt.Errorf("unknown proof of work algorithm: %s", algorithm)
+	}
+}
+
+// sha256Hasher hashes with SHA-256. Its proof of work hash is the block hash
+// itself, which is what chains created before the hasher was configurable use.
+type sha256Hasher struct{}
+
+func (sha256Hasher) Name() string { return PoWSHA256 }
+
+func (sha256Hasher) Hash(data []byte) [32]byte {
+	return crypto.SHA256Hash(data)
+}
+
+type keccak256Hasher struct{}
+
+func (keccak256Hasher) Name() string { return PoWKeccak256 }
+
+func (keccak256Hasher) Hash(data []byte) [32]byte {
+	return crypto.Keccak256Hash(data)
+}
+
+// scrypt parameters, each hash needs 128 * scryptN * scryptR bytes of memory
+const (
+	scryptN = 1024
+	scryptR = 1
+	scryptP = 1
+)
+
+// scryptHasher is a memory-hard hasher, which makes mining on specialized
+// hardware less of an advantage than with plain hash functions
+type scryptHasher struct{}
+
+func (scryptHasher) Name() string { return PoWScrypt }
+
+func (scryptHasher) Hash(data []byte) [32]byte {
+	var hash [32]byte
+	key, err := scrypt.Key(data, data, scryptN, scryptR, scryptP, len(hash))
+	if err != nil {
+		// Only invalid parameters make scrypt fail, the constants are valid
+		panic(fmt.Sprintf("scrypt failed: %v", err))
+	}
+	copy(hash[:], key)
+	return hash
+}
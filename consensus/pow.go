@@ -15,50 +15,61 @@ const (
 	TargetBlockTime    = 15 * time.Second // Target 15 seconds per block
 	DifficultyWindow   = 10               // Adjust difficulty every 10 blocks
 	MaxDifficultyShift = 4                // Maximum 4x difficulty change
+	MinElapsedTime     = 1                // Minimum seconds counted between blocks
 )
 
 // ProofOfWork implements custom Proof of Work consensus algorithm
 type ProofOfWork struct {
 	minDifficulty *big.Int
 	maxDifficulty *big.Int
+	hasher        PoWHasher
 }
 
 // NewProofOfWork creates a new PoW consensus engine
 func NewProofOfWork() *ProofOfWork {
 	return &ProofOfWork{
-		minDifficulty: big.NewInt(1000),                          // Minimum difficulty
-		maxDifficulty: new(big.Int).Lsh(big.NewInt(1), 240),     // Maximum difficulty
+		minDifficulty: big.NewInt(1000),                     // Minimum difficulty
+		maxDifficulty: new(big.Int).Lsh(big.NewInt(1), 240), // Maximum difficulty
+		hasher:        sha256Hasher{},
 	}
 }
 
+// SetHasher sets the proof of work algorithm used for mining and validation
+func (pow *ProofOfWork) SetHasher(hasher PoWHasher) {
+	pow.hasher = hasher
+}
+
 // MineBlock performs proof of work mining on a block
 func (pow *ProofOfWork) MineBlock(block interfaces.Block) error {
 	header := block.GetHeader()
+	if err := CheckDifficulty(header.GetDifficulty()); err != nil {
+		return err
+	}
 	target := pow.calculateTarget(header.GetDifficulty())
-	
+
 	// Initialize nonce with random value to prevent mining collisions
 	randomBytes := make([]byte, 8)
 	rand.Read(randomBytes)
 	header.SetNonce(binary.BigEndian.Uint64(randomBytes))
-	
+
 	startTime := time.Now()
 	hashCount := uint64(0)
-	
+
 	for {
-		// Calculate block hash
-		hash := block.CalculateHash()
+		// Calculate proof of work hash
+		powHash := pow.hasher.Hash(block.SealData())
 		hashCount++
-		
+
 		// Check if hash meets difficulty target
-		hashInt := new(big.Int).SetBytes(hash[:])
+		hashInt := new(big.Int).SetBytes(powHash[:])
 		if hashInt.Cmp(target) <= 0 {
-			header.SetHash(hash)
+			header.SetHash(block.CalculateHash())
 			return nil
 		}
-		
+
 		// Increment nonce and continue
 		header.SetNonce(header.GetNonce() + 1)
-		
+
 		// Prevent infinite loop - check every 100k iterations
 		if hashCount%100000 == 0 {
 			elapsed := time.Since(startTime)
@@ -72,19 +83,25 @@ func (pow *ProofOfWork) MineBlock(block interfaces.Block) error {
 // ValidateProofOfWork validates the proof of work for a block
 func (pow *ProofOfWork) ValidateProofOfWork(block interfaces.Block) bool {
 	header := block.GetHeader()
-	
+
+	// A block without a positive difficulty has no valid target
+	if CheckDifficulty(header.GetDifficulty()) != nil {
+		return false
+	}
+
 	// Recalculate block hash
 	hash := block.CalculateHash()
-	
+
 	// Verify hash matches block header
 	if hash != header.GetHash() {
 		return false
 	}
-	
-	// Check if hash meets difficulty target
+
+	// Check if the proof of work hash meets difficulty target
+	powHash := pow.hasher.Hash(block.SealData())
 	target := pow.calculateTarget(header.GetDifficulty())
-	hashInt := new(big.Int).SetBytes(hash[:])
-	
+	hashInt := new(big.Int).SetBytes(powHash[:])
+
 	return hashInt.Cmp(target) <= 0
 }
 
@@ -92,19 +109,35 @@ func (pow *ProofOfWork) ValidateProofOfWork(block interfaces.Block) bool {
 func (pow *ProofOfWork) CalculateDifficulty(currentBlock interfaces.Block, parentBlock interfaces.Block) *big.Int {
 	currentHeader := currentBlock.GetHeader()
 	parentHeader := parentBlock.GetHeader()
-	
-	// For genesis block or first few blocks, use minimum difficulty
+
+	// For genesis block or first few blocks, use minimum difficulty. This
+	// also keeps window arithmetic on block numbers from underflowing.
 	if currentHeader.GetNumber() < DifficultyWindow {
 		return new(big.Int).Set(pow.minDifficulty)
 	}
-	
-	// Calculate actual time taken for last DifficultyWindow blocks
-	actualTime := time.Duration(currentHeader.GetTimestamp()-parentHeader.GetTimestamp()) * time.Second
-	expectedTime := TargetBlockTime * DifficultyWindow
-	
+
+	if parentHeader.GetDifficulty() == nil {
+		return new(big.Int).Set(pow.minDifficulty)
+	}
+
 	// Calculate difficulty adjustment
 	currentDifficulty := new(big.Int).Set(parentHeader.GetDifficulty())
-	
+
+	// Only adjust against a parent that really precedes the current block
+	if parentHeader.GetNumber() >= currentHeader.GetNumber() {
+		return pow.clampDifficulty(currentDifficulty)
+	}
+
+	// Calculate actual time taken for last DifficultyWindow blocks. Equal or
+	// out of order timestamps are clamped so they read as "very fast" rather
+	// than producing a negative duration.
+	elapsed := currentHeader.GetTimestamp() - parentHeader.GetTimestamp()
+	if elapsed < MinElapsedTime {
+		elapsed = MinElapsedTime
+	}
+	actualTime := time.Duration(elapsed) * time.Second
+	expectedTime := TargetBlockTime * DifficultyWindow
+
 	// If blocks are coming too fast, increase difficulty
 	if actualTime < expectedTime/2 {
 		// Increase difficulty by at most MaxDifficultyShift
@@ -115,27 +148,50 @@ func (pow *ProofOfWork) CalculateDifficulty(currentBlock interfaces.Block, paren
 		adjustment := new(big.Int).Div(currentDifficulty, big.NewInt(MaxDifficultyShift))
 		currentDifficulty.Sub(currentDifficulty, adjustment)
 	}
-	
-	// Ensure difficulty stays within bounds
-	if currentDifficulty.Cmp(pow.minDifficulty) < 0 {
-		currentDifficulty.Set(pow.minDifficulty)
+
+	return pow.clampDifficulty(currentDifficulty)
+}
+
+// clampDifficulty ensures difficulty stays within bounds
+func (pow *ProofOfWork) clampDifficulty(difficulty *big.Int) *big.Int {
+	if difficulty.Cmp(pow.minDifficulty) < 0 {
+		difficulty.Set(pow.minDifficulty)
 	}
-	if currentDifficulty.Cmp(pow.maxDifficulty) > 0 {
-		currentDifficulty.Set(pow.maxDifficulty)
+	if difficulty.Cmp(pow.maxDifficulty) > 0 {
+		difficulty.Set(pow.maxDifficulty)
 	}
-	
-	return currentDifficulty
+
+	return difficulty
 }
 
 // calculateTarget calculates the target hash value for given difficulty
 func (pow *ProofOfWork) calculateTarget(difficulty *big.Int) *big.Int {
+	return CalculateTarget(difficulty)
+}
+
+// CheckDifficulty returns ErrInvalidDifficulty unless difficulty is positive.
+// Headers from peers may carry any value, which must be rejected before a
+// target is derived from it.
+func CheckDifficulty(difficulty *big.Int) error {
+	if difficulty == nil || difficulty.Sign() <= 0 {
+		return ErrInvalidDifficulty
+	}
+	return nil
+}
+
+// CalculateTarget returns the value a block hash must not exceed at the
+// given difficulty
+func CalculateTarget(difficulty *big.Int) *big.Int {
+	if difficulty == nil || difficulty.Sign() <= 0 {
+		return new(big.Int).Set(crypto.MaxTarget)
+	}
 	// Target = 2^256 / difficulty
-	target := new(big.Int).Div(crypto.MaxTarget, difficulty)
-	return target
+	return new(big.Int).Div(crypto.MaxTarget, difficulty)
 }
 
 // Consensus errors
 var (
-	ErrMiningTimeout = errors.New("mining timeout exceeded")
-	ErrInvalidProof  = errors.New("invalid proof of work")
+	ErrMiningTimeout     = errors.New("mining timeout exceeded")
+	ErrInvalidProof      = errors.New("invalid proof of work")
+	ErrInvalidDifficulty = errors.New("block difficulty must be positive")
 )
@@ -0,0 +1,120 @@
+package consensus
+
+import (
+	"blockchain-node/crypto"
+	"blockchain-node/interfaces"
+	"encoding/binary"
+	"math/big"
+	"testing"
+)
+
+type testHeader struct {
+	number     uint64
+	timestamp  int64
+	difficulty *big.Int
+}
+
+func (h *testHeader) GetNumber() uint64        { return h.number }
+func (h *testHeader) GetParentHash() [32]byte  { return [32]byte{} }
+func (h *testHeader) GetTimestamp() int64      { return h.timestamp }
+func (h *testHeader) GetDifficulty() *big.Int  { return h.difficulty }
+func (h *testHeader) SetDifficulty(d *big.Int) { h.difficulty = d }
+func (h *testHeader) GetHash() [32]byte        { return [32]byte{} }
+func (h *testHeader) SetHash([32]byte)         {}
+func (h *testHeader) GetNonce() uint64         { return 0 }
+func (h *testHeader) SetNonce(uint64)          {}
+
+type testBlock struct{ header *testHeader }
+
+func (b *testBlock) GetHeader() interfaces.BlockHeader { return b.header }
+func (b *testBlock) GetTransactions() []interface{}    { return nil }
+func (b *testBlock) CalculateHash() [32]byte           { return [32]byte{} }
+func (b *testBlock) SealData() []byte                  { return nil }
+
+func newTestBlock(number uint64, timestamp int64, difficulty int64) *testBlock {
+	return &testBlock{header: &testHeader{number: number, timestamp: timestamp, difficulty: big.NewInt(difficulty)}}
+}
+
+func TestCalculateDifficultyTimestamps(t *testing.T) {
+	pow := NewProofOfWork()
+	const parentDifficulty = 100000
+	// The fastest possible window raises the difficulty by a quarter
+	expected := big.NewInt(parentDifficulty + parentDifficulty/MaxDifficultyShift)
+
+	tests := []struct {
+		name      string
+		timestamp int64
+	}{
+		{"equal timestamps", 1000},
+		{"out of order timestamps", 900},
+	}
+	for _, test := range tests {
+		parent := newTestBlock(10, 1000, parentDifficulty)
+		current := newTestBlock(20, test.timestamp, 0)
+		if difficulty := pow.CalculateDifficulty(current, parent); difficulty.Cmp(expected) != 0 {
+			t.Errorf("%s: difficulty %v, expected %v", test.name, difficulty, expected)
+		}
+	}
+
+	// A parent that doesn't precede the block keeps its difficulty
+	parent := newTestBlock(20, 1000, parentDifficulty)
+	if difficulty := pow.CalculateDifficulty(newTestBlock(20, 2000, 0), parent); difficulty.Int64() != parentDifficulty {
+		t.Errorf("difficulty %v against a non-preceding parent, expected %d", difficulty, parentDifficulty)
+	}
+}
+
+// sealHeader is a test header that keeps the nonce and hash set by mining
+type sealHeader struct {
+	testHeader
+	nonce uint64
+	hash  [32]byte
+}
+
+func (h *sealHeader) GetHash() [32]byte     { return h.hash }
+func (h *sealHeader) SetHash(hash [32]byte) { h.hash = hash }
+func (h *sealHeader) GetNonce() uint64      { return h.nonce }
+func (h *sealHeader) SetNonce(nonce uint64) { h.nonce = nonce }
+
+// sealBlock is a test block whose seal data covers the nonce of its header
+type sealBlock struct{ header *sealHeader }
+
+func (b *sealBlock) GetHeader() interfaces.BlockHeader { return b.header }
+func (b *sealBlock) GetTransactions() []interface{}    { return nil }
+func (b *sealBlock) CalculateHash() [32]byte           { return crypto.SHA256Hash(b.SealData()) }
+func (b *sealBlock) SealData() []byte {
+	return binary.BigEndian.AppendUint64([]byte("block"), b.header.nonce)
+}
+
+func TestHasherMismatch(t *testing.T) {
+	hashers := []PoWHasher{sha256Hasher{}, keccak256Hasher{}}
+	for i, miner := range hashers {
+		block := &sealBlock{header: &sealHeader{testHeader: testHeader{number: 1, difficulty: big.NewInt(1 << 20)}}}
+		pow := NewProofOfWork()
+		pow.SetHasher(miner)
+		if err := pow.MineBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		if !pow.ValidateProofOfWork(block) {
+			t.Fatalf("block mined with %s invalid under %s", miner.Name(), miner.Name())
+		}
+
+		other := hashers[(i+1)%len(hashers)]
+		pow.SetHasher(other)
+		if pow.ValidateProofOfWork(block) {
+			t.Errorf("block mined with %s valid under %s", miner.Name(), other.Name())
+		}
+	}
+}
+
+func TestNonPositiveDifficulty(t *testing.T) {
+	pow := NewProofOfWork()
+	for _, difficulty := range []*big.Int{nil, big.NewInt(0), big.NewInt(-1)} {
+		block := &sealBlock{header: &sealHeader{testHeader: testHeader{number: 1, difficulty: difficulty}}}
+		if err := pow.MineBlock(block); err != ErrInvalidDifficulty {
+			t.Errorf("difficulty %v: mining error %v, expected %v", difficulty, err, ErrInvalidDifficulty)
+		}
+		if pow.ValidateProofOfWork(block) {
+			t.Errorf("difficulty %v: block valid", difficulty)
+		}
+	}
+}
@@ -1,4 +1,3 @@
-
 package core
 
 import (
@@ -8,40 +7,51 @@ import (
 	"encoding/json"
 	"math/big"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 type BlockHeader struct {
-	Number       uint64      `json:"number"`
-	ParentHash   [32]byte    `json:"parentHash"`
-	Timestamp    int64       `json:"timestamp"`
-	StateRoot    [32]byte    `json:"stateRoot"`
-	TxHash       [32]byte    `json:"transactionsRoot"`
-	ReceiptHash  [32]byte    `json:"receiptsRoot"`
-	LogsBloom    []byte      `json:"logsBloom"`
-	GasLimit     uint64      `json:"gasLimit"`
-	GasUsed      uint64      `json:"gasUsed"`
-	Difficulty   *big.Int    `json:"difficulty"`
-	Nonce        uint64      `json:"nonce"`
-	Hash         [32]byte    `json:"hash"`
+	Number      uint64         `json:"number"`
+	ParentHash  [32]byte       `json:"parentHash"`
+	Timestamp   int64          `json:"timestamp"`
+	StateRoot   [32]byte       `json:"stateRoot"`
+	TxHash      [32]byte       `json:"transactionsRoot"`
+	ReceiptHash [32]byte       `json:"receiptsRoot"`
+	LogsBloom   []byte         `json:"logsBloom"`
+	GasLimit    uint64         `json:"gasLimit"`
+	GasUsed     uint64         `json:"gasUsed"`
+	Difficulty  *big.Int       `json:"difficulty"`
+	Nonce       uint64         `json:"nonce"`
+	ExtraData   []byte         `json:"extraData,omitempty"`
+	Coinbase    common.Address `json:"miner"` // receives the block reward, zero for none
+	Hash        [32]byte       `json:"hash"`
 }
 
 // Implement interfaces.BlockHeader
-func (bh *BlockHeader) GetNumber() uint64 { return bh.Number }
-func (bh *BlockHeader) GetParentHash() [32]byte { return bh.ParentHash }
-func (bh *BlockHeader) GetTimestamp() int64 { return bh.Timestamp }
-func (bh *BlockHeader) GetDifficulty() *big.Int { return bh.Difficulty }
+func (bh *BlockHeader) GetNumber() uint64        { return bh.Number }
+func (bh *BlockHeader) GetParentHash() [32]byte  { return bh.ParentHash }
+func (bh *BlockHeader) GetTimestamp() int64      { return bh.Timestamp }
+func (bh *BlockHeader) GetDifficulty() *big.Int  { return bh.Difficulty }
 func (bh *BlockHeader) SetDifficulty(d *big.Int) { bh.Difficulty = d }
-func (bh *BlockHeader) GetHash() [32]byte { return bh.Hash }
-func (bh *BlockHeader) SetHash(h [32]byte) { bh.Hash = h }
-func (bh *BlockHeader) GetNonce() uint64 { return bh.Nonce }
-func (bh *BlockHeader) SetNonce(n uint64) { bh.Nonce = n }
-func (bh *BlockHeader) GetGasLimit() uint64 { return bh.GasLimit }
-func (bh *BlockHeader) GetGasUsed() uint64 { return bh.GasUsed }
+func (bh *BlockHeader) GetHash() [32]byte        { return bh.Hash }
+func (bh *BlockHeader) SetHash(h [32]byte)       { bh.Hash = h }
+func (bh *BlockHeader) GetNonce() uint64         { return bh.Nonce }
+func (bh *BlockHeader) SetNonce(n uint64)        { bh.Nonce = n }
+func (bh *BlockHeader) GetGasLimit() uint64      { return bh.GasLimit }
+func (bh *BlockHeader) GetGasUsed() uint64       { return bh.GasUsed }
+func (bh *BlockHeader) GetExtraData() []byte     { return bh.ExtraData }
 
 type Block struct {
-	Header       *BlockHeader           `json:"header"`
-	Transactions []*Transaction         `json:"transactions"`
-	Receipts     []*TransactionReceipt  `json:"receipts"`
+	Header       *BlockHeader          `json:"header"`
+	Transactions []*Transaction        `json:"transactions"`
+	Receipts     []*TransactionReceipt `json:"receipts"`
+
+	// Set instead of Transactions and Receipts once the block is pruned.
+	// Local bookkeeping, never taken from or sent to peers: saveBlock stores
+	// them next to the block, see storedBlock.
+	TxHashes [][32]byte `json:"-"`
+	Pruned   bool       `json:"-"`
 }
 
 // Implement interfaces.Block
@@ -82,76 +92,76 @@ func NewBlock(parentHash [32]byte, number uint64, transactions []*Transaction) *
 	return block
 }
 
+// CalculateHash returns the block hash, the SHA-256 hash of SealData
 func (b *Block) CalculateHash() [32]byte {
+	return crypto.SHA256Hash(b.SealData())
+}
+
+// SealData returns the header encoding the block hash and the proof of work
+// hash are computed from
+func (b *Block) SealData() []byte {
 	// Create hash data from header fields
 	data := make([]byte, 0, 256)
-	
+
 	// Number (8 bytes)
 	numberBytes := make([]byte, 8)
 	for i := 0; i < 8; i++ {
 		numberBytes[7-i] = byte(b.Header.Number >> (i * 8))
 	}
 	data = append(data, numberBytes...)
-	
+
 	// Parent hash
 	data = append(data, b.Header.ParentHash[:]...)
-	
+
 	// Timestamp (8 bytes)
 	timestampBytes := make([]byte, 8)
 	for i := 0; i < 8; i++ {
 		timestampBytes[7-i] = byte(b.Header.Timestamp >> (i * 8))
 	}
 	data = append(data, timestampBytes...)
-	
+
 	// State root
 	data = append(data, b.Header.StateRoot[:]...)
-	
+
 	// Transactions root
 	data = append(data, b.Header.TxHash[:]...)
-	
+
 	// Receipts root
 	data = append(data, b.Header.ReceiptHash[:]...)
-	
+
 	// Gas limit (8 bytes)
 	gasLimitBytes := make([]byte, 8)
 	for i := 0; i < 8; i++ {
 		gasLimitBytes[7-i] = byte(b.Header.GasLimit >> (i * 8))
 	}
 	data = append(data, gasLimitBytes...)
-	
+
 	// Gas used (8 bytes)
 	gasUsedBytes := make([]byte, 8)
 	for i := 0; i < 8; i++ {
 		gasUsedBytes[7-i] = byte(b.Header.GasUsed >> (i * 8))
 	}
 	data = append(data, gasUsedBytes...)
-	
+
 	// Difficulty
 	data = append(data, b.Header.Difficulty.Bytes()...)
-	
+
 	// Nonce (8 bytes)
 	nonceBytes := make([]byte, 8)
 	for i := 0; i < 8; i++ {
 		nonceBytes[7-i] = byte(b.Header.Nonce >> (i * 8))
 	}
 	data = append(data, nonceBytes...)
-	
-	return crypto.SHA256Hash(data)
-}
 
-func (b *Block) MineBlock(difficulty *big.Int) {
-	target := new(big.Int).Div(crypto.MaxTarget, difficulty)
-	
-	for {
-		b.Header.Nonce++
-		hash := b.CalculateHash()
-		hashInt := new(big.Int).SetBytes(hash[:])
-		
-		if hashInt.Cmp(target) == -1 {
-			b.Header.Hash = hash
-			break
-		}
+	// Extra data, empty for all but a branded genesis block
+	data = append(data, b.Header.ExtraData...)
+
+	// Coinbase, only if set so blocks without one keep their hash
+	if b.Header.Coinbase != (common.Address{}) {
+		data = append(data, b.Header.Coinbase[:]...)
 	}
+
+	return data
 }
 
 func (bh *BlockHeader) ToJSON() ([]byte, error) {
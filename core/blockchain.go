@@ -2,26 +2,66 @@ package core
 
 import (
 	"blockchain-node/cache"
-	"blockchain-node/crypto"
+	"blockchain-node/consensus"
 	"blockchain-node/database"
 	"blockchain-node/interfaces"
 	"blockchain-node/logger"
 	"blockchain-node/metrics"
 	"blockchain-node/state"
+	"blockchain-node/trie"
 	"blockchain-node/validation"
+	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
+var log = logger.Module("core")
+
+// errorCountKey is the database key of the persisted metrics error count
+const errorCountKey = "metrics_error_count"
+
+// ErrChainClosed is returned for blocks added after Close was called
+var ErrChainClosed = errors.New("blockchain is closed")
+
 type Config struct {
-	DataDir       string
-	ChainID       uint64
-	BlockGasLimit uint64
-	GenesisPath   string
+	DataDir               string
+	ChainID               uint64
+	BlockGasLimit         uint64
+	GenesisPath           string
+	MaxBlockTxs           int
+	TxSelectionPolicy     SelectionPolicy
+	MinBlockInterval      time.Duration     // minimum time between the head block and the next mined block
+	MineEmptyBlocks       bool              // mine blocks without transactions instead of waiting for some
+	MaxEmptyInterval      time.Duration     // without MineEmptyBlocks, mine an empty block once the head is this old, 0 never does
+	RewardRecipients      []RewardRecipient // addresses block rewards rotate among, empty pays the miner address
+	RewardPolicy          RewardPolicy
+	MaxTxDataSize         uint64
+	MaxTxsPerAccount      int           // 0 uses the default
+	MaxFutureNonceGap     uint64        // how far a nonce may be ahead of the account nonce, 0 uses the default
+	DatabaseCache         int           // MiB of database block cache
+	DatabaseHandles       int           // open files the database may use
+	DatabaseSlowThreshold time.Duration // log database operations slower than this, 0 disables
+	MaxBlockDrift         time.Duration // how far ahead of the clock block timestamps may be, 0 uses the default
+	PreimageLimit         int           // 0 disables the preimage store
+	PoWAlgorithm          string        // proof of work hasher, see consensus.NewPoWHasher
+	StateFlushInterval    uint64        // flush the state to disk every this many blocks, 0 or 1 writes it with every block
+	PruneBlocks           uint64        // keep transactions and receipts of this many recent blocks only, 0 keeps all
+
+	// Genesis overrides, zero values fall back to the genesis file
+	GenesisDifficulty string
+	GenesisTimestamp  int64
+	GenesisGasLimit   uint64
+	GenesisExtraData  string
+	ChainName         string
 }
 
 type GenesisConfig struct {
@@ -35,70 +75,167 @@ type GenesisConfig struct {
 	Difficulty string `json:"difficulty"`
 	GasLimit   string `json:"gasLimit"`
 	Timestamp  string `json:"timestamp"`
+	ExtraData  string `json:"extraData"`
+	ChainName  string `json:"chainName"`
 }
 
 type Blockchain struct {
-	config      *Config
-	db          database.Database
-	stateDB     *state.StateDB
-	currentBlock *Block
-	blocks      map[[32]byte]*Block
+	config        *Config
+	db            database.Database
+	stateDB       *state.StateDB
+	stateStore    database.Database // db, or stateBuffer with periodic state flushing
+	stateBuffer   *database.BufferedDB
+	lastFlushed   uint64   // last block whose state was flushed, guarded by insertMu
+	replay        []*Block // stored blocks whose state was not flushed, see ReplayBlocks
+	lastPruned    uint64   // last block whose body was pruned, written with insertMu and mu held
+	currentBlock  *Block
+	blocks        map[[32]byte]*Block
 	blockByNumber map[uint64]*Block
-	mempool     *Mempool
-	vm          interfaces.VirtualMachine
-	consensus   interfaces.Engine
-	validator   *validation.Validator
-	cache       *cache.Cache
-	mu          sync.RWMutex
-	shutdownCh  chan struct{}
+	mempool       *Mempool
+	vm            interfaces.VirtualMachine
+	consensus     interfaces.Engine
+	powHasher     consensus.PoWHasher
+	validator     *validation.Validator
+	cache         *cache.Cache
+	mu            sync.RWMutex
+	insertMu      sync.Mutex // serializes block insertion, held without mu during execution
+	closed        bool       // set by Close under insertMu, no blocks are inserted afterwards
+	shutdownCh    chan struct{}
 	genesisConfig *GenesisConfig
+	preimages     *state.PreimageStore
+	nodeFetcher   trie.NodeFetcher // fetches state trie nodes missing from the database, guarded by mu
+	dirLock       *dataDirLock
+	highestBlock  uint64
+	blockTimes    blockTimes // timestamps of the recent blocks, guarded by mu
+	orphans       *orphanPool
+	newBlockFeed  feed[*Block]
+	newTxFeed     feed[*Transaction]
+	minedTxFeed   feed[*Transaction]
+	pending       *pendingState
+	pendingMu     sync.Mutex // serializes building the pending state
 }
 
 func NewBlockchain(config *Config) (*Blockchain, error) {
-	logger.Infof("Initializing custom blockchain with ChainID: %d", config.ChainID)
-	
+	log.Infof("Initializing custom blockchain with ChainID: %d", config.ChainID)
+
+	// Make sure no other process is using this data directory
+	dirLock, err := lockDataDir(config.DataDir)
+	if err != nil {
+		log.Errorf("Failed to lock data directory: %v", err)
+		return nil, err
+	}
+
 	// Initialize database
-	db, err := database.NewLevelDB(config.DataDir + "/chaindata")
+	levelDB, err := database.NewLevelDB(config.DataDir+"/chaindata", config.DatabaseCache, config.DatabaseHandles)
 	if err != nil {
-		logger.Errorf("Failed to open database: %v", err)
+		dirLock.Release()
+		log.Errorf("Failed to open database: %v", err)
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
+	var db database.Database = levelDB
+	if config.DatabaseSlowThreshold > 0 {
+		db = database.NewSlowLogDB(levelDB, config.DatabaseSlowThreshold)
+	}
+
+	// Release the database and lock again if initialization fails below
+	initialized := false
+	defer func() {
+		if !initialized {
+			db.Close()
+			dirLock.Release()
+		}
+	}()
+
+	// With periodic flushing the state is kept in memory and written to the
+	// database every StateFlushInterval blocks
+	var stateStore database.Database = db
+	var stateBuffer *database.BufferedDB
+	if config.StateFlushInterval > 1 {
+		stateBuffer = database.NewBufferedDB(db)
+		stateStore = stateBuffer
+	}
 
 	// Initialize state database with empty root
-	stateDB, err := state.NewStateDB([32]byte{}, db)
+	stateDB, err := state.NewStateDB([32]byte{}, stateStore)
 	if err != nil {
-		logger.Errorf("Failed to create state database: %v", err)
+		log.Errorf("Failed to create state database: %v", err)
 		return nil, fmt.Errorf("failed to create state database: %v", err)
 	}
 
 	bc := &Blockchain{
 		config:        config,
 		db:            db,
+		dirLock:       dirLock,
 		stateDB:       stateDB,
+		stateStore:    stateStore,
+		stateBuffer:   stateBuffer,
 		blocks:        make(map[[32]byte]*Block),
 		blockByNumber: make(map[uint64]*Block),
 		mempool:       NewMempool(),
 		validator:     validation.NewValidator(),
 		cache:         cache.NewCache(),
+		orphans:       newOrphanPool(),
 		shutdownCh:    make(chan struct{}),
+		newBlockFeed:  feed[*Block]{name: "New block"},
+		newTxFeed:     feed[*Transaction]{name: "New transaction"},
+		minedTxFeed:   feed[*Transaction]{name: "Mined transaction"},
+	}
+
+	if config.MaxTxDataSize > 0 {
+		bc.validator.SetMaxTxDataSize(config.MaxTxDataSize)
+	}
+
+	if config.MaxTxsPerAccount > 0 {
+		bc.mempool.SetMaxPerAccount(config.MaxTxsPerAccount)
+	}
+
+	if config.MaxBlockDrift > 0 {
+		bc.validator.SetMaxFutureDrift(config.MaxBlockDrift)
+	}
+
+	powHasher, err := consensus.NewPoWHasher(config.PoWAlgorithm)
+	if err != nil {
+		log.Errorf("Invalid proof of work algorithm: %v", err)
+		return nil, err
+	}
+	bc.powHasher = powHasher
+
+	if config.PreimageLimit > 0 {
+		bc.preimages = state.NewPreimageStore(config.PreimageLimit)
+		stateDB.SetPreimageStore(bc.preimages)
 	}
 
 	// Load genesis config from file
 	if err := bc.loadGenesisConfig(config.GenesisPath); err != nil {
-		logger.Errorf("Failed to load genesis config: %v", err)
+		log.Errorf("Failed to load genesis config: %v", err)
 		return nil, fmt.Errorf("failed to load genesis config: %v", err)
 	}
 
+	// Signatures are bound to the chain id (EIP-155), 0 would leave them
+	// valid on any chain that also uses 0
+	if bc.config.ChainID == 0 {
+		log.Error("Chain id is 0, set chainid in the config or the genesis file")
+		return nil, ErrZeroChainID
+	}
+
 	// VM will be set later to avoid circular dependency
 	bc.vm = nil
 
+	// Restore blocks saved by a previous run
+	if err := bc.loadChain(); err != nil {
+		log.Errorf("Failed to load chain: %v", err)
+		return nil, fmt.Errorf("failed to load chain: %v", err)
+	}
+
 	// Load or create genesis block
 	if err := bc.initGenesis(); err != nil {
-		logger.Errorf("Failed to initialize genesis: %v", err)
+		log.Errorf("Failed to initialize genesis: %v", err)
 		return nil, fmt.Errorf("failed to initialize genesis: %v", err)
 	}
 
-	logger.Info("Custom blockchain initialized successfully")
+	initialized = true
+	reportSyncStatus(bc.GetSyncStatus())
+	log.Info("Custom blockchain initialized successfully")
 	return bc, nil
 }
 
@@ -118,13 +255,13 @@ func (bc *Blockchain) loadGenesisConfig(genesisPath string) error {
 	}
 
 	bc.genesisConfig = &genesis
-	
+
 	// Update blockchain config from genesis
 	if genesis.Config.ChainID != 0 {
 		bc.config.ChainID = genesis.Config.ChainID
 	}
 
-	logger.Infof("Loaded genesis config for ChainID: %d", bc.config.ChainID)
+	log.Infof("Loaded genesis config for ChainID: %d", bc.config.ChainID)
 	return nil
 }
 
@@ -138,95 +275,167 @@ func (bc *Blockchain) SetConsensus(consensus interfaces.Engine) {
 	bc.consensus = consensus
 }
 
+// SetNodeFetcher makes reads of the head state and of states opened with
+// StateAt fetch trie nodes missing from the database with fetcher. Blocks
+// are executed on copies, which never fetch.
+func (bc *Blockchain) SetNodeFetcher(fetcher trie.NodeFetcher) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.nodeFetcher = fetcher
+	bc.stateDB.SetNodeFetcher(fetcher)
+}
+
+// PoWHasher returns the proof of work algorithm of the chain. Every engine
+// mining or validating its blocks must use it.
+func (bc *Blockchain) PoWHasher() consensus.PoWHasher {
+	return bc.powHasher
+}
+
 func (bc *Blockchain) initGenesis() error {
-	logger.Info("Initializing genesis block")
-	
+	log.Info("Initializing genesis block")
+
 	// Check if genesis block already exists
 	if block := bc.GetBlockByNumber(0); block != nil {
-		bc.currentBlock = block
-		logger.Infof("Genesis block already exists: %x", block.Header.Hash)
-		
+		log.Infof("Genesis block already exists: %x", block.Header.Hash)
+
 		// Verify genesis matches config
 		if err := bc.verifyGenesisBlock(block); err != nil {
-			logger.Errorf("Genesis block verification failed: %v", err)
+			log.Errorf("Genesis block verification failed: %v", err)
 			return fmt.Errorf("genesis block verification failed: %v", err)
 		}
-		
-		return nil
-	}
 
-	// Parse difficulty from genesis config
-	difficulty := big.NewInt(1000)
-	if bc.genesisConfig != nil && bc.genesisConfig.Difficulty != "" {
-		if diffInt, ok := new(big.Int).SetString(bc.genesisConfig.Difficulty, 0); ok {
-			difficulty = diffInt
-		}
-	}
-
-	// Create genesis block
-	genesis := &Block{
-		Header: &BlockHeader{
-			Number:       0,
-			ParentHash:   [32]byte{},
-			Timestamp:    1640995200, // Jan 1, 2022
-			StateRoot:    [32]byte{},
-			TxHash:       [32]byte{},
-			ReceiptHash:  [32]byte{},
-			GasLimit:     bc.config.BlockGasLimit,
-			GasUsed:      0,
-			Difficulty:   difficulty,
-		},
-		Transactions: []*Transaction{},
-		Receipts:     []*TransactionReceipt{},
-	}
-
-	// Set up genesis state from config
-	if bc.genesisConfig != nil {
-		for addrStr, account := range bc.genesisConfig.Alloc {
-			var addr [20]byte
-			addrBytes := crypto.HexToBytes(addrStr)
-			copy(addr[:], addrBytes)
-			
-			balance := big.NewInt(0)
-			if balanceInt, ok := new(big.Int).SetString(account.Balance, 10); ok {
-				balance = balanceInt
-			}
-			
-			bc.stateDB.SetBalance(addr, balance)
-			logger.Debugf("Genesis allocation: %x -> %s", addr, balance.String())
-		}
-	} else {
-		// Default allocation if no genesis config
-		defaultAddr := [20]byte{0x74, 0x2d, 0x35, 0xcc, 0x66, 0x35, 0xc0, 0x53, 0x29, 0x25, 0xa3, 0xb8, 0xd5, 0xc6, 0xc1, 0xc8, 0xb1, 0xc5, 0xc6, 0xc}
-		bc.stateDB.SetBalance(defaultAddr, big.NewInt(1e18))
+		return nil
 	}
 
-	// Commit state and get state root
-	stateRoot, err := bc.stateDB.Commit()
+	genesis, err := bc.buildGenesis(bc.stateDB)
 	if err != nil {
-		logger.Errorf("Failed to commit genesis state: %v", err)
-		return fmt.Errorf("failed to commit genesis state: %v", err)
+		return err
 	}
 
-	genesis.Header.StateRoot = stateRoot
-	genesis.Header.Hash = genesis.CalculateHash()
-
 	// Save genesis block
 	bc.blocks[genesis.Header.Hash] = genesis
 	bc.blockByNumber[0] = genesis
 	bc.currentBlock = genesis
+	bc.blockTimes.add(genesis)
 
-	// Update metrics
-	metrics.GetMetrics().IncrementBlockCount()
-	
 	logger.BlockEvent(0, fmt.Sprintf("%x", genesis.Header.Hash), 0, "genesis")
-	
+
 	if err := bc.saveBlock(genesis); err != nil {
-		logger.Errorf("Failed to save genesis block: %v", err)
+		log.Errorf("Failed to save genesis block: %v", err)
+		return err
+	}
+	if err := bc.writeChainHead(genesis); err != nil {
+		log.Errorf("Failed to save chain head: %v", err)
+		return err
+	}
+	if err := bc.flushState(genesis, true); err != nil {
+		log.Errorf("Failed to flush genesis state: %v", err)
 		return err
 	}
-	
-	logger.Info("Genesis block created successfully")
+
+	log.Info("Genesis block created successfully")
+	return nil
+}
+
+// loadChain reads the blocks saved in the database up to the stored chain
+// head, reopens the state at the chain head and seeds the block and
+// transaction counters from them. Blocks stored above the head by an
+// interrupted insertion are discarded.
+func (bc *Blockchain) loadChain() error {
+	head, err := bc.readChainHead()
+	if err != nil {
+		return err
+	}
+	flushed, err := bc.readBlockPointer(stateFlushedKey)
+	if err != nil {
+		return err
+	}
+	pruned, err := bc.readBlockPointer(prunedKey)
+	if err != nil {
+		return err
+	}
+	if pruned != nil {
+		bc.lastPruned = pruned.Number
+	}
+
+	var txCount uint64
+	var last *Block
+	for number := uint64(0); head == nil || number <= head.Number; number++ {
+		data, err := bc.db.Get([]byte(fmt.Sprintf("block_%d", number)))
+		if err != nil {
+			return fmt.Errorf("failed to read block %d: %v", number, err)
+		}
+		if data == nil {
+			// Below the head only blocks skipped by a state snapshot import
+			// are missing
+			if head != nil {
+				continue
+			}
+			break
+		}
+
+		block, err := decodeStoredBlock(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode block %d: %v", number, err)
+		}
+		last = block
+
+		// The state of blocks after the last flush was lost, they are
+		// executed again by ReplayBlocks
+		if flushed != nil && number > flushed.Number {
+			bc.replay = append(bc.replay, block)
+			continue
+		}
+
+		bc.blocks[block.Header.Hash] = block
+		bc.blockByNumber[number] = block
+		bc.currentBlock = block
+		bc.blockTimes.add(block)
+		txCount += uint64(len(block.Transactions))
+	}
+
+	// Cumulative error count is kept across restarts
+	if data, err := bc.db.Get([]byte(errorCountKey)); err == nil && len(data) == 8 {
+		metrics.GetMetrics().SetErrorCount(binary.BigEndian.Uint64(data))
+	}
+
+	if head != nil {
+		if last == nil || last.Header.Hash != head.Hash {
+			return fmt.Errorf("stored block %d does not match the chain head %x", head.Number, head.Hash)
+		}
+		if err := bc.discardBlocksAbove(head.Number); err != nil {
+			return err
+		}
+	}
+	if len(bc.replay) > 0 && (bc.currentBlock == nil || bc.currentBlock.Header.Hash != flushed.Hash) {
+		return fmt.Errorf("stored block %d does not match the flushed state %x", flushed.Number, flushed.Hash)
+	}
+
+	if bc.currentBlock == nil {
+		return nil
+	}
+
+	// Databases written before the head pointer existed get one now
+	if head == nil {
+		if err := bc.writeChainHead(bc.currentBlock); err != nil {
+			return err
+		}
+	}
+
+	stateDB, err := state.NewStateDB(bc.currentBlock.Header.StateRoot, bc.stateStore)
+	if err != nil {
+		return fmt.Errorf("failed to open state at block %d: %v", bc.currentBlock.Header.Number, err)
+	}
+	stateDB.SetPreimageStore(bc.preimages)
+	bc.stateDB = stateDB
+	bc.lastFlushed = bc.currentBlock.Header.Number
+
+	// Genesis is not counted, so the block count is the head number
+	metrics.GetMetrics().SetBlockCount(bc.currentBlock.Header.Number)
+	metrics.GetMetrics().SetTransactionCount(txCount)
+	reportBlockTimes(bc.blockTimes.stats())
+
+	log.Infof("Loaded %d blocks from database, head at block %d", len(bc.blockByNumber), bc.currentBlock.Header.Number)
 	return nil
 }
 
@@ -237,11 +446,33 @@ func (bc *Blockchain) verifyGenesisBlock(block *Block) error {
 
 	// Verify chain ID matches
 	if bc.genesisConfig.Config.ChainID != bc.config.ChainID {
-		return fmt.Errorf("genesis chain ID mismatch: expected %d, got %d", 
+		return fmt.Errorf("genesis chain ID mismatch: expected %d, got %d",
 			bc.genesisConfig.Config.ChainID, bc.config.ChainID)
 	}
 
-	logger.Info("Genesis block verification passed")
+	// A genesis block built from other parameters has a different hash. The
+	// stored genesis is kept, so only warn that the config no longer matches.
+	params, err := bc.resolveGenesisParams()
+	if err != nil {
+		return err
+	}
+	header := block.Header
+	if header.Difficulty == nil || header.Difficulty.Cmp(params.Difficulty) != 0 {
+		log.Warningf("Stored genesis difficulty %v differs from configured %v", header.Difficulty, params.Difficulty)
+	}
+	if header.Timestamp != params.Timestamp {
+		log.Warningf("Stored genesis timestamp %d differs from configured %d", header.Timestamp, params.Timestamp)
+	}
+	if header.GasLimit != params.GasLimit {
+		log.Warningf("Stored genesis gas limit %d differs from configured %d", header.GasLimit, params.GasLimit)
+	}
+	// The extra data identifies the chain, a node configured for another
+	// chain must not run on this one
+	if !bytes.Equal(header.ExtraData, params.ExtraData) {
+		return fmt.Errorf("genesis extra data mismatch: stored %x, configured %x", header.ExtraData, params.ExtraData)
+	}
+
+	log.Info("Genesis block verification passed")
 	return nil
 }
 
@@ -256,11 +487,51 @@ func (bc *Blockchain) GetChainID() uint64 {
 	return bc.config.ChainID
 }
 
+// GetChainName returns the human-readable name of the chain from the node
+// config, or from the genesis file if the config doesn't set one
+func (bc *Blockchain) GetChainName() string {
+	if bc.config.ChainName != "" {
+		return bc.config.ChainName
+	}
+	if bc.genesisConfig != nil {
+		return bc.genesisConfig.ChainName
+	}
+	return ""
+}
+
+// GetGenesisExtraData returns the extra data stored in the genesis header
+func (bc *Blockchain) GetGenesisExtraData() []byte {
+	if genesis := bc.GetBlockByNumber(0); genesis != nil {
+		return genesis.Header.ExtraData
+	}
+	return nil
+}
+
 func (bc *Blockchain) GetConfig() *Config {
 	return bc.config
 }
 
+// GetPreimage returns the preimage of a hashed address or storage key. The
+// second result is false if the preimage store is disabled.
+func (bc *Blockchain) GetPreimage(hash [32]byte) ([]byte, bool) {
+	if bc.preimages == nil {
+		return nil, false
+	}
+	return bc.preimages.Get(hash), true
+}
+
+// GetStateDB returns a copy of the state at the current head. Reads on it
+// don't block or race with block insertion, and changes to it are discarded.
 func (bc *Blockchain) GetStateDB() *state.StateDB {
+	return bc.headState().Copy()
+}
+
+// headState returns the state of the head block. A new block replaces the
+// head state instead of modifying it, so it can be read and copied without
+// holding bc.mu, but must not be written to.
+func (bc *Blockchain) headState() *state.StateDB {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 	return bc.stateDB
 }
 
@@ -282,37 +553,204 @@ func (bc *Blockchain) GetBlockByNumber(number uint64) *Block {
 	return bc.blockByNumber[number]
 }
 
+// GetTransactionReceipt returns the receipt of an included transaction, or
+// nil if the transaction is not in the chain
+func (bc *Blockchain) GetTransactionReceipt(hash [32]byte) *TransactionReceipt {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.currentBlock == nil {
+		return nil
+	}
+	for number := bc.currentBlock.Header.Number; ; number-- {
+		if block := bc.blockByNumber[number]; block != nil {
+			for _, receipt := range block.Receipts {
+				if receipt.TxHash == hash {
+					return receipt
+				}
+			}
+		}
+		if number == 0 {
+			return nil
+		}
+	}
+}
+
+// GetTransaction returns an included transaction with its block and index in
+// the block, or nil if the transaction is not in the chain
+func (bc *Blockchain) GetTransaction(hash [32]byte) (*Transaction, *Block, int) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.currentBlock == nil {
+		return nil, nil, 0
+	}
+	for number := bc.currentBlock.Header.Number; ; number-- {
+		if block := bc.blockByNumber[number]; block != nil {
+			for i, tx := range block.Transactions {
+				if tx.Hash == hash {
+					return tx, block, i
+				}
+			}
+		}
+		if number == 0 {
+			return nil, nil, 0
+		}
+	}
+}
+
+// AddBlock validates, executes and stores block as the new head. Blocks are
+// inserted one at a time, but bc.mu is only taken to read the parent and to
+// publish the result, so readers see the previous head until the new block
+// is fully processed. A block whose parent is unknown is kept as an orphan
+// and ErrOrphanBlock returned, it is added once the parent is.
 func (bc *Blockchain) AddBlock(block *Block) error {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
+	return bc.AddBlockFrom(block, "")
+}
+
+// AddBlockFrom adds block like AddBlock, counting it against the orphan
+// limit of source if its parent is unknown
+func (bc *Blockchain) AddBlockFrom(block *Block, source string) error {
+	bc.insertMu.Lock()
+	defer bc.insertMu.Unlock()
+	if bc.closed {
+		return ErrChainClosed
+	}
+
+	if err := bc.insertBlock(block, source); err != nil {
+		return err
+	}
+	bc.connectOrphans(block)
+	return nil
+}
+
+// insertBlock adds block from source on top of the chain head. Must be
+// called with bc.insertMu held.
+func (bc *Blockchain) insertBlock(block *Block, source string) error {
+	log.Debugf("Adding block %d to blockchain", block.Header.Number)
+
+	bc.mu.RLock()
+	parent := bc.currentBlock
+	parentState := bc.stateDB
+	_, parentKnown := bc.blocks[block.Header.ParentHash]
+	bc.mu.RUnlock()
+	parentState = parentState.Copy()
+
+	if block.Header.ParentHash != parent.Header.Hash {
+		if parentKnown || block.Header.Number <= parent.Header.Number {
+			log.Debugf("Stale block %d (%x), head is block %d", block.Header.Number, block.Header.Hash, parent.Header.Number)
+			return ErrStaleBlock
+		}
+		return bc.addOrphan(block, source)
+	}
+
+	stateDB, err := bc.processBlock(block, parent, parentState)
+	if err != nil {
+		return err
+	}
+
+	// Save to database, the head pointer last so a crash in between leaves
+	// the chain at the parent
+	if err := bc.saveBlock(block); err != nil {
+		log.Errorf("Failed to save block: %v", err)
+		return err
+	}
+	if err := bc.writeChainHead(block); err != nil {
+		log.Errorf("Failed to save chain head: %v", err)
+		return err
+	}
 
-	logger.Debugf("Adding block %d to blockchain", block.Header.Number)
+	bc.publishBlock(block, stateDB)
 
+	// A failed flush leaves the previous flush as the state to recover from
+	if err := bc.flushState(block, false); err != nil {
+		log.Errorf("Failed to flush state at block %d: %v", block.Header.Number, err)
+	}
+	if err := bc.pruneBlocks(block); err != nil {
+		log.Errorf("Failed to prune blocks: %v", err)
+	}
+	return nil
+}
+
+// processBlock validates block and executes it on top of parent, whose state
+// is parentState, and returns the resulting state. Neither the chain nor the
+// stored blocks are modified.
+func (bc *Blockchain) processBlock(block *Block, parent *Block, parentState *state.StateDB) (*state.StateDB, error) {
 	// Validate block using custom validator
-	if err := bc.validator.ValidateBlock(block); err != nil {
-		logger.Errorf("Block validation failed: %v", err)
+	if err := bc.validator.ValidateBlock(block, parentState); err != nil {
+		log.Errorf("Block validation failed: %v", err)
 		metrics.GetMetrics().IncrementErrorCount()
-		return err
+		return nil, err
+	}
+
+	if err := consensus.CheckDifficulty(block.Header.Difficulty); err != nil {
+		log.Errorf("Invalid difficulty %v for block %d", block.Header.Difficulty, block.Header.Number)
+		metrics.GetMetrics().IncrementErrorCount()
+		return nil, err
 	}
 
 	// Validate proof of work if consensus engine is available
 	if bc.consensus != nil && !bc.consensus.ValidateProofOfWork(block) {
-		logger.Errorf("Invalid proof of work for block %d", block.Header.Number)
+		log.Errorf("Invalid proof of work for block %d", block.Header.Number)
 		metrics.GetMetrics().IncrementErrorCount()
-		return errors.New("invalid proof of work")
+		return nil, errors.New("invalid proof of work")
 	}
 
-	// Execute transactions using custom VM
-	if err := bc.executeBlock(block); err != nil {
-		logger.Errorf("Block execution failed: %v", err)
+	txRoot, err := DeriveTxRoot(block.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	if txRoot != block.Header.TxHash {
+		log.Errorf("Block %d transactions root mismatch: header %x, computed %x", block.Header.Number, block.Header.TxHash, txRoot)
 		metrics.GetMetrics().IncrementErrorCount()
-		return err
+		return nil, ErrTxRootMismatch
+	}
+
+	// Execute transactions using custom VM. Execution fills in the gas used,
+	// so the header's value is kept to check the receipts against.
+	headerGasUsed := block.Header.GasUsed
+	stateDB, err := bc.executeBlock(block, parent)
+	if err != nil {
+		log.Errorf("Block execution failed: %v", err)
+		metrics.GetMetrics().IncrementErrorCount()
+		return nil, err
+	}
+
+	if err := checkGasUsed(block.Receipts, headerGasUsed); err != nil {
+		log.Errorf("Block %d %v", block.Header.Number, err)
+		metrics.GetMetrics().IncrementErrorCount()
+		return nil, err
+	}
+
+	receiptRoot, err := DeriveReceiptRoot(block.Receipts)
+	if err != nil {
+		return nil, err
 	}
+	if receiptRoot != block.Header.ReceiptHash {
+		log.Errorf("Block %d receipts root mismatch: header %x, computed %x", block.Header.Number, block.Header.ReceiptHash, receiptRoot)
+		metrics.GetMetrics().IncrementErrorCount()
+		return nil, ErrReceiptRootMismatch
+	}
+
+	return stateDB, nil
+}
 
+// publishBlock makes the stored block the new head with state stateDB and
+// notifies subscribers
+func (bc *Blockchain) publishBlock(block *Block, stateDB *state.StateDB) {
 	// Add to blockchain
+	bc.mu.Lock()
 	bc.blocks[block.Header.Hash] = block
 	bc.blockByNumber[block.Header.Number] = block
 	bc.currentBlock = block
+	stateDB.SetNodeFetcher(bc.nodeFetcher)
+	bc.stateDB = stateDB
+	bc.blockTimes.add(block)
+	syncStatus := bc.syncStatus()
+	blockTimes := bc.blockTimes.stats()
+	bc.mu.Unlock()
+	reportSyncStatus(syncStatus)
+	reportBlockTimes(blockTimes)
 
 	// Update metrics
 	metrics.GetMetrics().IncrementBlockCount()
@@ -320,25 +758,72 @@ func (bc *Blockchain) AddBlock(block *Block) error {
 
 	// Log block event
 	logger.LogBlockEvent(block.Header.Number, fmt.Sprintf("%x", block.Header.Hash), len(block.Transactions), "miner")
+	for i, tx := range block.Transactions {
+		metrics.GetMetrics().IncrementTransactionCount()
+		logTransaction(tx, block.Receipts[i])
+	}
 
-	// Save to database
-	if err := bc.saveBlock(block); err != nil {
-		logger.Errorf("Failed to save block: %v", err)
+	bc.newBlockFeed.send(block)
+	for _, tx := range block.Transactions {
+		bc.minedTxFeed.send(tx)
+	}
+
+	log.Infof("Block %d added successfully", block.Header.Number)
+}
+
+// FinalizeBlock executes block on top of its parent and fills in the header
+// fields that depend on the result: gas used, the state root and the
+// transactions and receipts roots. The chain itself is not modified. Miners
+// call it before sealing a block.
+func (bc *Blockchain) FinalizeBlock(block *Block) error {
+	parent := bc.GetBlockByHash(block.Header.ParentHash)
+	if parent == nil {
+		return fmt.Errorf("unknown parent block %x", block.Header.ParentHash)
+	}
+
+	txRoot, err := DeriveTxRoot(block.Transactions)
+	if err != nil {
 		return err
 	}
 
-	logger.Infof("Block %d added successfully", block.Header.Number)
+	if _, err := bc.executeBlock(block, parent); err != nil {
+		return err
+	}
+
+	receiptRoot, err := DeriveReceiptRoot(block.Receipts)
+	if err != nil {
+		return err
+	}
+
+	block.Header.TxHash = txRoot
+	block.Header.ReceiptHash = receiptRoot
 	return nil
 }
 
-func (bc *Blockchain) executeBlock(block *Block) error {
-	logger.Debugf("Executing block %d with %d transactions", block.Header.Number, len(block.Transactions))
-	
+// logTransaction logs a transaction event for tx, executed with receipt
+func logTransaction(tx *Transaction, receipt *TransactionReceipt) {
+	to := "contract_creation"
+	if tx.To != nil {
+		to = fmt.Sprintf("%x", *tx.To)
+	}
+	status := "success"
+	if receipt.Status == 0 {
+		status = "failed"
+	}
+	logger.LogTransactionEvent(fmt.Sprintf("%x", tx.Hash), fmt.Sprintf("%x", tx.From), to, tx.Value.String(), status)
+}
+
+// executeBlock runs the transactions of block on top of the state of parent
+// and returns the resulting state. It doesn't modify the chain.
+func (bc *Blockchain) executeBlock(block *Block, parent *Block) (*state.StateDB, error) {
+	log.Debugf("Executing block %d with %d transactions", block.Header.Number, len(block.Transactions))
+
 	// Create new state database for this block
-	stateDB, err := state.NewStateDB(bc.currentBlock.Header.StateRoot, bc.db)
+	stateDB, err := state.NewStateDB(parent.Header.StateRoot, bc.stateStore)
 	if err != nil {
-		return fmt.Errorf("failed to create state database: %v", err)
+		return nil, fmt.Errorf("failed to create state database: %v", err)
 	}
+	stateDB.SetPreimageStore(bc.preimages)
 
 	var receipts []*TransactionReceipt
 	var logs []*Log
@@ -346,15 +831,18 @@ func (bc *Blockchain) executeBlock(block *Block) error {
 
 	// Execute each transaction using custom VM if available
 	for i, tx := range block.Transactions {
-		logger.Debugf("Executing transaction %d: %x", i, tx.Hash)
-		
+		log.Debugf("Executing transaction %d: %x", i, tx.Hash)
+
 		// Create execution context
 		ctx := &interfaces.ExecutionContext{
 			Transaction: tx,
 			BlockHeader: block.Header,
+			StateDB:     stateDB,
 			From:        tx.From,
-			To:          tx.To,
+			To:          (*[20]byte)(tx.To),
 			Value:       tx.Value,
+			GasPrice:    tx.GasPrice,
+			Coinbase:    block.Header.Coinbase,
 			Data:        tx.Data,
 		}
 
@@ -363,8 +851,16 @@ func (bc *Blockchain) executeBlock(block *Block) error {
 			// Execute transaction with VM
 			result, err = bc.vm.ExecuteTransaction(ctx)
 			if err != nil {
-				logger.Errorf("Failed to execute transaction %d: %v", i, err)
-				return fmt.Errorf("failed to execute transaction %d: %v", i, err)
+				log.Errorf("Failed to execute transaction %d: %v", i, err)
+				return nil, fmt.Errorf("failed to execute transaction %d: %v", i, err)
+			}
+			// A failed transaction stays in the block and pays for its gas,
+			// but none of its logs are kept
+			if result.Error != nil || result.Status == 0 {
+				log.Debugf("Transaction %x failed: %v", tx.Hash, result.Error)
+				result.Status = 0
+				result.Logs = nil
+				result.ContractAddress = nil
 			}
 		} else {
 			// Simple execution without VM (for basic transactions)
@@ -377,27 +873,34 @@ func (bc *Blockchain) executeBlock(block *Block) error {
 
 		// Create receipt
 		receipt := &TransactionReceipt{
-			TxHash:          tx.Hash,
-			TxIndex:         uint64(i),
-			BlockHash:       block.Header.Hash,
-			BlockNumber:     block.Header.Number,
-			From:            tx.From,
-			To:              tx.To,
-			GasUsed:         result.GasUsed,
+			TxHash:            tx.Hash,
+			TxIndex:           uint64(i),
+			BlockHash:         block.Header.Hash,
+			BlockNumber:       block.Header.Number,
+			From:              tx.From,
+			To:                tx.To,
+			GasUsed:           result.GasUsed,
 			CumulativeGasUsed: gasUsed + result.GasUsed,
-			Status:          1, // Success
-			Logs:            make([]*Log, len(result.Logs)),
+			EffectiveGasPrice: tx.EffectiveGasPrice(),
+			Type:              tx.Type(),
+			Status:            result.Status,
+			Logs:              make([]*Log, len(result.Logs)),
 		}
 
 		if result.ContractAddress != nil {
-			receipt.ContractAddress = result.ContractAddress
+			contractAddress := common.Address(*result.ContractAddress)
+			receipt.ContractAddress = &contractAddress
 		}
 
 		// Convert execution logs to receipt logs
 		for j, execLog := range result.Logs {
+			topics := make([]common.Hash, len(execLog.Topics))
+			for k, topic := range execLog.Topics {
+				topics[k] = topic
+			}
 			receipt.Logs[j] = &Log{
 				Address:     execLog.Address,
-				Topics:      execLog.Topics,
+				Topics:      topics,
 				Data:        execLog.Data,
 				BlockNumber: block.Header.Number,
 				TxHash:      tx.Hash,
@@ -406,33 +909,22 @@ func (bc *Blockchain) executeBlock(block *Block) error {
 				Index:       uint64(j),
 			}
 		}
+		receipt.LogsBloom = CreateLogsBloom(receipt.Logs)
 
 		receipts = append(receipts, receipt)
 		logs = append(logs, receipt.Logs...)
 		gasUsed += result.GasUsed
-		
-		// Update transaction metrics
-		metrics.GetMetrics().IncrementTransactionCount()
-		
-		// Log transaction event
-		logger.LogTransactionEvent(
-			fmt.Sprintf("%x", tx.Hash),
-			fmt.Sprintf("%x", tx.From),
-			func() string {
-				if tx.To != nil {
-					return fmt.Sprintf("%x", *tx.To)
-				}
-				return "contract_creation"
-			}(),
-			tx.Value.String(),
-			"success",
-		)
 
 		if gasUsed > block.Header.GasLimit {
-			return errors.New("block gas limit exceeded")
+			return nil, errors.New("block gas limit exceeded")
 		}
 	}
 
+	// Pay the block reward
+	if block.Header.Coinbase != (common.Address{}) {
+		stateDB.AddBalance(block.Header.Coinbase, new(big.Int).Set(blockReward))
+	}
+
 	// Update block with receipts
 	block.Receipts = receipts
 	block.Header.GasUsed = gasUsed
@@ -440,90 +932,174 @@ func (bc *Blockchain) executeBlock(block *Block) error {
 	// Commit state changes
 	stateRoot, err := stateDB.Commit()
 	if err != nil {
-		return fmt.Errorf("failed to commit state: %v", err)
+		return nil, fmt.Errorf("failed to commit state: %v", err)
 	}
 
 	block.Header.StateRoot = stateRoot
-	bc.stateDB = stateDB
-	
-	logger.Debugf("Block %d executed successfully", block.Header.Number)
-	return nil
+
+	log.Debugf("Block %d executed successfully", block.Header.Number)
+	return stateDB, nil
 }
 
 func (bc *Blockchain) saveBlock(block *Block) error {
 	// Implement block serialization and storage
-	blockData, err := block.ToJSON()
+	blockData, err := encodeStoredBlock(block)
 	if err != nil {
 		return fmt.Errorf("failed to serialize block: %v", err)
 	}
-	
+
 	blockKey := fmt.Sprintf("block_%d", block.Header.Number)
 	if err := bc.db.Put([]byte(blockKey), blockData); err != nil {
 		return fmt.Errorf("failed to save block: %v", err)
 	}
-	
+
 	// Cache the block
 	bc.cache.Set(blockKey, block, cache.DefaultTTL)
-	
+
 	return nil
 }
 
 func (bc *Blockchain) AddTransaction(tx *Transaction) error {
-	logger.Debugf("Adding transaction to mempool: %s", tx.Hash.Hex())
-	
+	log.Debugf("Adding transaction to mempool: %x", tx.Hash)
+
 	// Validate transaction
 	if err := bc.validator.ValidateTransaction(tx); err != nil {
-		logger.Errorf("Transaction validation failed: %v", err)
+		log.Errorf("Transaction validation failed: %v", err)
 		return err
 	}
-	
+
+	// Transactions far ahead of the account nonce can't be mined for a long
+	// time, without a bound they would let anyone fill the mempool
+	gap := bc.config.MaxFutureNonceGap
+	if gap == 0 {
+		gap = DefaultMaxNonceGap
+	}
+	if stateNonce := bc.GetNonce(tx.From); tx.Nonce > stateNonce+gap {
+		log.Debugf("Rejected transaction %x with nonce %d, account nonce is %d", tx.Hash, tx.Nonce, stateNonce)
+		return fmt.Errorf("%w: nonce %d, account nonce %d, at most %d ahead", ErrNonceTooHigh, tx.Nonce, stateNonce, gap)
+	}
+
 	if err := bc.mempool.AddTransaction(tx); err != nil {
-		logger.Errorf("Failed to add transaction to mempool: %v", err)
+		log.Errorf("Failed to add transaction to mempool: %v", err)
 		return err
 	}
-	
+
 	// Update metrics
 	metrics.GetMetrics().SetTransactionPoolSize(uint32(bc.mempool.GetPendingCount()))
-	
-	logger.Debugf("Transaction added to mempool successfully: %s", tx.Hash.Hex())
+
+	bc.newTxFeed.send(tx)
+
+	log.Debugf("Transaction added to mempool successfully: %x", tx.Hash)
 	return nil
 }
 
+// ResetMetrics resets the metrics counters. The block and transaction
+// counters return to the totals of the loaded chain, as after a restart.
+func (bc *Blockchain) ResetMetrics() {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	var txCount uint64
+	for _, block := range bc.blockByNumber {
+		txCount += uint64(len(block.Transactions))
+	}
+
+	metrics.GetMetrics().Reset()
+	metrics.GetMetrics().SetBlockCount(bc.currentBlock.Header.Number)
+	metrics.GetMetrics().SetTransactionCount(txCount)
+}
+
 func (bc *Blockchain) GetMempool() *Mempool {
 	return bc.mempool
 }
 
+// Close flushes the state and closes the database. A block being inserted
+// is completed first, blocks added afterwards are refused with
+// ErrChainClosed. Calling Close again does nothing.
 func (bc *Blockchain) Close() error {
-	logger.Info("Closing blockchain")
-	
+	bc.insertMu.Lock()
+	defer bc.insertMu.Unlock()
+	if bc.closed {
+		return nil
+	}
+	bc.closed = true
+
+	log.Info("Closing blockchain")
+
 	close(bc.shutdownCh)
-	
+
+	// Write the state kept in memory, so the next start needs no replay
+	if head := bc.GetCurrentBlock(); head != nil {
+		if err := bc.flushState(head, true); err != nil {
+			log.Errorf("Failed to flush state: %v", err)
+		}
+	}
+
+	// Persist the error count so it survives the restart
+	errorCount := make([]byte, 8)
+	binary.BigEndian.PutUint64(errorCount, metrics.GetMetrics().GetErrorCount())
+	if err := bc.db.Put([]byte(errorCountKey), errorCount); err != nil {
+		log.Errorf("Failed to persist error count: %v", err)
+	}
+
 	if err := bc.db.Close(); err != nil {
-		logger.Errorf("Failed to close database: %v", err)
+		bc.dirLock.Release()
+		log.Errorf("Failed to close database: %v", err)
 		return err
 	}
-	
-	logger.Info("Blockchain closed successfully")
+
+	if err := bc.dirLock.Release(); err != nil {
+		log.Errorf("Failed to release data directory lock: %v", err)
+		return err
+	}
+
+	log.Info("Blockchain closed successfully")
 	return nil
 }
 
 func (bc *Blockchain) GetBalance(address [20]byte) *big.Int {
-	return bc.stateDB.GetBalance(address)
+	return bc.headState().GetBalance(address)
 }
 
 func (bc *Blockchain) GetNonce(address [20]byte) uint64 {
-	return bc.stateDB.GetNonce(address)
+	return bc.headState().GetNonce(address)
 }
 
 func (bc *Blockchain) GetCode(address [20]byte) []byte {
-	return bc.stateDB.GetCode(address)
+	return bc.headState().GetCode(address)
 }
 
 func (bc *Blockchain) GetStorageAt(address [20]byte, key [32]byte) [32]byte {
-	return bc.stateDB.GetState(address, key)
+	return bc.headState().GetState(address, key)
 }
 
-func (bc *Blockchain) EstimateGas(tx *Transaction) (uint64, error) {
+func (bc *Blockchain) EstimateGas(ctx context.Context, tx *Transaction) (uint64, error) {
+	// Run the transaction when a VM is available so reverts are reported.
+	// Without a gas limit it may use up to the block gas limit.
+	if bc.vm != nil {
+		if tx.GasLimit == 0 {
+			capped := *tx
+			capped.GasLimit = bc.config.BlockGasLimit
+			// Don't buy more gas than the sender can pay for
+			if tx.GasPrice != nil && tx.GasPrice.Sign() > 0 {
+				funds := bc.GetBalance(tx.From)
+				if tx.Value != nil {
+					funds.Sub(funds, tx.Value)
+				}
+				allowance := funds.Div(funds, tx.GasPrice)
+				if allowance.IsUint64() && allowance.Uint64() < capped.GasLimit {
+					capped.GasLimit = allowance.Uint64()
+				}
+			}
+			tx = &capped
+		}
+		result, err := bc.Call(ctx, tx)
+		if err != nil {
+			return 0, err
+		}
+		return result.GasUsed, nil
+	}
+
 	// Simple gas estimation - in production this would be more sophisticated
 	baseGas := uint64(21000)
 	if len(tx.Data) > 0 {
@@ -535,3 +1111,7 @@ func (bc *Blockchain) EstimateGas(tx *Transaction) (uint64, error) {
 func (bc *Blockchain) GetDatabase() database.Database {
 	return bc.db
 }
+
+// ErrZeroChainID is returned by NewBlockchain if neither the config nor the
+// genesis file sets a chain id
+var ErrZeroChainID = errors.New("chain id must not be 0")
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"blockchain-node/consensus"
+	"blockchain-node/core/coretest"
+	"blockchain-node/crypto"
+	"blockchain-node/metrics"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// openTestChain opens the chain in dir, creating a genesis block that funds
+// each address of alloc on first use
+func openTestChain(t *testing.T, dir string, alloc map[[20]byte]*big.Int) *Blockchain {
+	t.Helper()
+	blockchain, err := NewBlockchain(&Config{
+		DataDir:       filepath.Join(dir, "data"),
+		ChainID:       coretest.ChainID,
+		BlockGasLimit: coretest.BlockGasLimit,
+		GenesisPath:   coretest.WriteGenesis(t, dir, alloc),
+	})
+	if err != nil {
+		t.Fatalf("failed to open blockchain: %v", err)
+	}
+	return blockchain
+}
+
+// mineTestBlock adds an empty block on top of the chain head
+func mineTestBlock(t *testing.T, bc *Blockchain) *Block {
+	t.Helper()
+	return mineTestTxs(t, bc, []*Transaction{})
+}
+
+// mineTestTxs adds a block of txs on top of the chain head
+func mineTestTxs(t *testing.T, bc *Blockchain, txs []*Transaction) *Block {
+	t.Helper()
+	block := sealTestTxs(t, bc, txs)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatalf("failed to add block %d: %v", block.Header.Number, err)
+	}
+	return block
+}
+
+// sealTestTxs returns a mined block of txs on top of the chain head without
+// adding it
+func sealTestTxs(t *testing.T, bc *Blockchain, txs []*Transaction) *Block {
+	t.Helper()
+	head := bc.GetCurrentBlock()
+	block := NewBlock(head.Header.Hash, head.Header.Number+1, txs)
+	if err := bc.FinalizeBlock(block); err != nil {
+		t.Fatalf("failed to finalize block: %v", err)
+	}
+
+	pow := consensus.NewProofOfWork()
+	pow.SetHasher(bc.PoWHasher())
+	if err := pow.MineBlock(block); err != nil {
+		t.Fatalf("failed to mine block: %v", err)
+	}
+	return block
+}
+
+// signedTransfer returns a transfer of value to 0x01 signed by key
+func signedTransfer(t *testing.T, key *ecdsa.PrivateKey, nonce uint64, value int64) *Transaction {
+	t.Helper()
+	tx := NewTransaction(nonce, &common.Address{0x01}, big.NewInt(value), 21000, big.NewInt(1000), nil)
+	if err := tx.Sign(crypto.FromECDSA(key), 1337); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestBlockCountAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	const blocks = 5
+
+	bc := openTestChain(t, dir, nil)
+	for i := 0; i < blocks; i++ {
+		mineTestBlock(t, bc)
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics.GetMetrics().Reset()
+	bc = openTestChain(t, dir, nil)
+	defer bc.Close()
+
+	if got := metrics.GetMetrics().ToMap()["block_count"]; got != uint64(blocks) {
+		t.Errorf("block_count %v after reloading %d blocks", got, blocks)
+	}
+}
+
+func TestFutureNonceGap(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PrivateKeyToAddress(key)
+	bc := openTestChain(t, t.TempDir(), map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	defer bc.Close()
+
+	transfer := func(nonce uint64) *Transaction {
+		tx := NewTransaction(nonce, &common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1000), nil)
+		if err := tx.Sign(crypto.FromECDSA(key), 1337); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	if err := bc.AddTransaction(transfer(DefaultMaxNonceGap)); err != nil {
+		t.Errorf("transaction just within the nonce gap rejected: %v", err)
+	}
+	if err := bc.AddTransaction(transfer(DefaultMaxNonceGap + 1)); !errors.Is(err, ErrNonceTooHigh) {
+		t.Errorf("transaction beyond the nonce gap: error %v, expected %v", err, ErrNonceTooHigh)
+	}
+	if size := bc.GetMempool().Size(); size != 1 {
+		t.Errorf("%d transactions queued, expected 1", size)
+	}
+}
+
+func TestZeroDifficultyBlockRejected(t *testing.T) {
+	bc := openTestChain(t, t.TempDir(), nil)
+	defer bc.Close()
+
+	head := bc.GetCurrentBlock()
+	block := NewBlock(head.Header.Hash, head.Header.Number+1, []*Transaction{})
+	if err := bc.FinalizeBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	block.Header.Difficulty = big.NewInt(0)
+	block.Header.Hash = block.CalculateHash()
+
+	if err := bc.AddBlock(block); !errors.Is(err, consensus.ErrInvalidDifficulty) {
+		t.Errorf("error %v adding a block of difficulty 0, expected %v", err, consensus.ErrInvalidDifficulty)
+	}
+	if number := bc.GetCurrentBlock().Header.Number; number != 0 {
+		t.Errorf("head moved to block %d", number)
+	}
+}
@@ -0,0 +1,78 @@
+package core
+
+import "blockchain-node/metrics"
+
+// BlockTimeWindow is the number of most recent blocks block time statistics
+// are computed over
+const BlockTimeWindow = 100
+
+// BlockTimeStats summarizes the time between consecutive blocks, in seconds
+// of block timestamps, over the blocks FromBlock to ToBlock
+type BlockTimeStats struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Intervals int // number of block intervals measured
+	Average   float64
+	Min       int64
+	Max       int64
+}
+
+// blockTimes keeps the timestamps of the most recent blocks. It is rebuilt
+// from the stored blocks on startup, so the statistics survive restarts.
+type blockTimes struct {
+	numbers    []uint64
+	timestamps []int64
+}
+
+// add records block as the new head. A block that doesn't follow the last one
+// recorded starts the window over.
+func (bt *blockTimes) add(block *Block) {
+	if n := len(bt.numbers); n > 0 && bt.numbers[n-1]+1 != block.Header.Number {
+		bt.numbers, bt.timestamps = nil, nil
+	}
+	bt.numbers = append(bt.numbers, block.Header.Number)
+	bt.timestamps = append(bt.timestamps, block.Header.Timestamp)
+	if len(bt.numbers) > BlockTimeWindow+1 {
+		bt.numbers = bt.numbers[1:]
+		bt.timestamps = bt.timestamps[1:]
+	}
+}
+
+func (bt *blockTimes) stats() BlockTimeStats {
+	var stats BlockTimeStats
+	if len(bt.numbers) == 0 {
+		return stats
+	}
+	stats.FromBlock = bt.numbers[0]
+	stats.ToBlock = bt.numbers[len(bt.numbers)-1]
+
+	var total int64
+	for i := 1; i < len(bt.timestamps); i++ {
+		interval := bt.timestamps[i] - bt.timestamps[i-1]
+		if stats.Intervals == 0 || interval < stats.Min {
+			stats.Min = interval
+		}
+		if stats.Intervals == 0 || interval > stats.Max {
+			stats.Max = interval
+		}
+		total += interval
+		stats.Intervals++
+	}
+	if stats.Intervals > 0 {
+		stats.Average = float64(total) / float64(stats.Intervals)
+	}
+	return stats
+}
+
+// GetBlockTimeStats returns the block time statistics over the last
+// BlockTimeWindow blocks up to the chain head
+func (bc *Blockchain) GetBlockTimeStats() BlockTimeStats {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.blockTimes.stats()
+}
+
+// reportBlockTimes publishes the block time statistics as metrics
+func reportBlockTimes(stats BlockTimeStats) {
+	metrics.GetMetrics().SetBlockTimeStats(stats.Average, stats.Min, stats.Max)
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"blockchain-node/consensus"
+	"testing"
+	"time"
+)
+
+func TestBlockTimeStats(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestChain(t, dir, nil)
+
+	// Blocks 10, 20 and 30 seconds apart
+	genesis := bc.GetCurrentBlock()
+	start := time.Now().Unix() - 100
+	for _, timestamp := range []int64{start, start + 10, start + 30, start + 60} {
+		head := bc.GetCurrentBlock()
+		block := NewBlock(head.Header.Hash, head.Header.Number+1, []*Transaction{})
+		block.Header.Timestamp = timestamp
+		if err := bc.FinalizeBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		pow := consensus.NewProofOfWork()
+		pow.SetHasher(bc.PoWHasher())
+		if err := pow.MineBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := BlockTimeStats{
+		FromBlock: 0,
+		ToBlock:   4,
+		Intervals: 4,
+		Average:   float64(start+60-genesis.Header.Timestamp) / 4,
+		Min:       10,
+		Max:       start - genesis.Header.Timestamp,
+	}
+	if stats := bc.GetBlockTimeStats(); stats != expected {
+		t.Fatalf("block time stats %+v, expected %+v", stats, expected)
+	}
+
+	// The statistics are rebuilt from the stored blocks after a restart
+	bc.Close()
+	bc = openTestChain(t, dir, nil)
+	defer bc.Close()
+	if stats := bc.GetBlockTimeStats(); stats != expected {
+		t.Errorf("block time stats %+v after a restart, expected %+v", stats, expected)
+	}
+}
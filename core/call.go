@@ -0,0 +1,110 @@
+package core
+
+import (
+	"blockchain-node/interfaces"
+	"blockchain-node/state"
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// RevertError is returned when a call reverts. Data holds the raw revert
+// data and Reason the decoded Error(string) message, if there is one.
+type RevertError struct {
+	Reason string
+	Data   []byte
+}
+
+func newRevertError(data []byte) *RevertError {
+	reason, err := abi.UnpackRevert(data)
+	if err != nil {
+		reason = ""
+	}
+	return &RevertError{Reason: reason, Data: data}
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return "execution reverted"
+	}
+	return "execution reverted: " + e.Reason
+}
+
+// Call executes tx on top of a copy of the current state without committing
+// anything. A reverted execution is reported as a *RevertError. Execution is
+// aborted with ctx.Err() once ctx is done.
+func (bc *Blockchain) Call(ctx context.Context, tx *Transaction) (*interfaces.ExecutionResult, error) {
+	if bc.vm == nil {
+		return nil, ErrNoVirtualMachine
+	}
+
+	bc.mu.RLock()
+	stateDB := bc.stateDB
+	header := bc.currentBlock.Header
+	bc.mu.RUnlock()
+	stateDB = stateDB.Copy()
+
+	return bc.call(ctx, tx, stateDB, header)
+}
+
+// CallPending is like Call but executes tx on top of the pending state, so
+// the effects of the executable mempool transactions are visible to it.
+func (bc *Blockchain) CallPending(ctx context.Context, tx *Transaction) (*interfaces.ExecutionResult, error) {
+	if bc.vm == nil {
+		return nil, ErrNoVirtualMachine
+	}
+
+	stateDB, header, err := bc.PendingState()
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.call(ctx, tx, stateDB, header)
+}
+
+// call executes tx on stateDB in the context of header
+func (bc *Blockchain) call(ctx context.Context, tx *Transaction, stateDB *state.StateDB, header *BlockHeader) (*interfaces.ExecutionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	execCtx := &interfaces.ExecutionContext{
+		Transaction: tx,
+		BlockHeader: header,
+		StateDB:     stateDB,
+		From:        tx.From,
+		To:          (*[20]byte)(tx.To),
+		Value:       tx.Value,
+		GasPrice:    tx.GasPrice,
+		Coinbase:    header.Coinbase,
+		Data:        tx.Data,
+		Done:        ctx.Done(),
+	}
+
+	// An execution aborted by ctx fails with ctx.Err() whatever the VM
+	// reported
+	result, err := bc.vm.ExecuteTransaction(execCtx)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed execution that returned data reverted, anything else is a
+	// plain execution failure
+	if result.Status == 0 {
+		if len(result.ReturnData) > 0 {
+			return result, newRevertError(result.ReturnData)
+		}
+		if result.Error != nil {
+			return result, result.Error
+		}
+		return result, errors.New("execution failed")
+	}
+
+	return result, nil
+}
+
+var ErrNoVirtualMachine = errors.New("no virtual machine configured")
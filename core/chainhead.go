@@ -0,0 +1,84 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// chainHeadKey is the database key of the chain head pointer
+const chainHeadKey = "chainhead"
+
+// chainHead points at the last block that was completely committed: its state
+// was written and the block itself stored. Blocks stored above it are leftovers
+// of an insertion that was interrupted, and are discarded on startup.
+type chainHead struct {
+	Number    uint64   `json:"number"`
+	Hash      [32]byte `json:"hash"`
+	StateRoot [32]byte `json:"stateRoot"`
+}
+
+// writeChainHead makes block the chain head that is loaded on startup. It must
+// only be called once the block and its state are stored.
+func (bc *Blockchain) writeChainHead(block *Block) error {
+	return bc.writeBlockPointer(chainHeadKey, block)
+}
+
+// readChainHead returns the stored chain head pointer, or nil if there is
+// none, as in databases written before it was introduced
+func (bc *Blockchain) readChainHead() (*chainHead, error) {
+	return bc.readBlockPointer(chainHeadKey)
+}
+
+// writeBlockPointer stores a pointer to block under key
+func (bc *Blockchain) writeBlockPointer(key string, block *Block) error {
+	data, err := json.Marshal(&chainHead{
+		Number:    block.Header.Number,
+		Hash:      block.Header.Hash,
+		StateRoot: block.Header.StateRoot,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", key, err)
+	}
+	if err := bc.db.Put([]byte(key), data); err != nil {
+		return fmt.Errorf("failed to save %s: %v", key, err)
+	}
+	return nil
+}
+
+// readBlockPointer returns the block pointer stored under key, or nil if
+// there is none
+func (bc *Blockchain) readBlockPointer(key string) (*chainHead, error) {
+	data, err := bc.db.Get([]byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var head chainHead
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", key, err)
+	}
+	return &head, nil
+}
+
+// discardBlocksAbove deletes the stored blocks above number, left behind by
+// an insertion that didn't complete
+func (bc *Blockchain) discardBlocksAbove(number uint64) error {
+	for n := number + 1; ; n++ {
+		blockKey := fmt.Sprintf("block_%d", n)
+		data, err := bc.db.Get([]byte(blockKey))
+		if err != nil {
+			return fmt.Errorf("failed to read block %d: %v", n, err)
+		}
+		if data == nil {
+			return nil
+		}
+
+		log.Warningf("Discarding block %d stored above the chain head %d", n, number)
+		if err := bc.db.Delete([]byte(blockKey)); err != nil {
+			return fmt.Errorf("failed to delete block %d: %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package core
+
+import "testing"
+
+func TestRecoverToChainHead(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestChain(t, dir, nil)
+	consistent := mineTestBlock(t, bc)
+	head, err := bc.db.Get([]byte(chainHeadKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash after block 2 was stored but before the head moved to it
+	mineTestBlock(t, bc)
+	if err := bc.db.Put([]byte(chainHeadKey), head); err != nil {
+		t.Fatal(err)
+	}
+	bc.Close()
+
+	bc = openTestChain(t, dir, nil)
+	defer bc.Close()
+	if current := bc.GetCurrentBlock(); current.Header.Hash != consistent.Header.Hash {
+		t.Fatalf("restarted at block %d %x, expected block 1 %x", current.Header.Number, current.Header.Hash, consistent.Header.Hash)
+	}
+	if data, err := bc.db.Get([]byte("block_2")); err != nil || data != nil {
+		t.Errorf("block above the head kept: %d bytes, %v", len(data), err)
+	}
+
+	// The chain continues from the recovered head
+	if block := mineTestBlock(t, bc); block.Header.Number != 2 {
+		t.Errorf("next block numbered %d, expected 2", block.Header.Number)
+	}
+}
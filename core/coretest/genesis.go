@@ -0,0 +1,43 @@
+// Package coretest provides the genesis file shared by the tests of core and
+// the packages built on it. It doesn't import core, so core's own tests can
+// use it too.
+package coretest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ChainID is the chain ID of the test genesis
+const ChainID = 1337
+
+// BlockGasLimit matches the gas limit of the test genesis
+const BlockGasLimit = 8000000
+
+// WriteGenesis writes a genesis file to dir that funds each address of alloc
+// with its balance in wei and returns its path
+func WriteGenesis(t testing.TB, dir string, alloc map[[20]byte]*big.Int) string {
+	t.Helper()
+	accounts := make(map[string]map[string]string, len(alloc))
+	for address, balance := range alloc {
+		accounts[fmt.Sprintf("0x%x", address)] = map[string]string{"balance": balance.String()}
+	}
+	genesis, err := json.Marshal(map[string]interface{}{
+		"config":     map[string]interface{}{"chainId": ChainID},
+		"alloc":      accounts,
+		"difficulty": "0x1",
+		"gasLimit":   fmt.Sprintf("0x%X", BlockGasLimit),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisPath := filepath.Join(dir, "genesis.json")
+	if err := os.WriteFile(genesisPath, genesis, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return genesisPath
+}
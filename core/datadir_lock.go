@@ -0,0 +1,36 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// dataDirLock is an exclusive lock on a node data directory, held for the
+// lifetime of the blockchain so two processes never share one database.
+type dataDirLock struct {
+	file *os.File
+}
+
+// lockDataDir acquires the LOCK file in dir, failing with ErrDataDirInUse if
+// another process holds it.
+func lockDataDir(dir string) (*dataDirLock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %v", err)
+	}
+
+	file, err := lockFile(filepath.Join(dir, "LOCK"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDataDirInUse, dir)
+	}
+
+	return &dataDirLock{file: file}, nil
+}
+
+// Release unlocks the data directory, closing the file drops the lock
+func (l *dataDirLock) Release() error {
+	return l.file.Close()
+}
+
+var ErrDataDirInUse = errors.New("datadir in use by another process")
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataDirLocked(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestChain(t, dir, nil)
+
+	second, err := NewBlockchain(&Config{DataDir: filepath.Join(dir, "data"), ChainID: 1337})
+	if !errors.Is(err, ErrDataDirInUse) {
+		if second != nil {
+			second.Close()
+		}
+		t.Fatalf("second blockchain on an open datadir: %v, expected %v", err, ErrDataDirInUse)
+	}
+
+	// Closing the first releases the datadir
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bc = openTestChain(t, dir, nil)
+	bc.Close()
+}
@@ -0,0 +1,76 @@
+package core
+
+import "sync"
+
+// feedChanSize is the buffer of each subscription. Events sent to a
+// subscriber whose buffer is full are dropped.
+const feedChanSize = 16
+
+// feed fans out events to any number of subscribers without blocking the
+// sender. The zero value is ready to use.
+type feed[T any] struct {
+	name   string // used in log messages
+	mu     sync.Mutex
+	subs   map[int]chan T
+	nextID int
+}
+
+func (f *feed[T]) subscribe() (<-chan T, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.subs == nil {
+		f.subs = make(map[int]chan T)
+	}
+
+	id := f.nextID
+	f.nextID++
+	ch := make(chan T, feedChanSize)
+	f.subs[id] = ch
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			delete(f.subs, id)
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
+
+// send delivers event to every subscriber without blocking
+func (f *feed[T]) send(event T) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id, ch := range f.subs {
+		select {
+		case ch <- event:
+		default:
+			log.Warningf("%s subscriber %d is not keeping up, dropped an event", f.name, id)
+		}
+	}
+}
+
+// SubscribeNewBlock returns a channel receiving every block added with
+// AddBlock, and a function to cancel the subscription, which closes the
+// channel. Subscribers that fall behind miss blocks rather than stall the
+// chain.
+func (bc *Blockchain) SubscribeNewBlock() (<-chan *Block, func()) {
+	return bc.newBlockFeed.subscribe()
+}
+
+// SubscribeNewTx returns a channel receiving every transaction accepted into
+// the mempool by AddTransaction, and a function to cancel the subscription.
+func (bc *Blockchain) SubscribeNewTx() (<-chan *Transaction, func()) {
+	return bc.newTxFeed.subscribe()
+}
+
+// SubscribeMinedTx returns a channel receiving the transactions of every
+// block added with AddBlock, in block order, and a function to cancel the
+// subscription.
+func (bc *Blockchain) SubscribeMinedTx() (<-chan *Transaction, func()) {
+	return bc.minedTxFeed.subscribe()
+}
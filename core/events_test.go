@@ -0,0 +1,84 @@
+package core
+
+import (
+	"blockchain-node/crypto"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// receive returns the next event of ch, failing the test if none arrives
+func receive[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %s received", what)
+	}
+	var zero T
+	return zero
+}
+
+func TestSubscribeNewBlock(t *testing.T) {
+	bc := openTestChain(t, t.TempDir(), nil)
+	defer bc.Close()
+
+	first, unsubscribeFirst := bc.SubscribeNewBlock()
+	defer unsubscribeFirst()
+	second, unsubscribeSecond := bc.SubscribeNewBlock()
+	defer unsubscribeSecond()
+
+	block := mineTestBlock(t, bc)
+	for i, ch := range []<-chan *Block{first, second} {
+		if got := receive(t, ch, "block"); got.Header.Hash != block.Header.Hash {
+			t.Errorf("subscriber %d received block %x, expected %x", i, got.Header.Hash, block.Header.Hash)
+		}
+	}
+
+	// An unsubscribed channel is closed and no longer receives blocks
+	unsubscribeSecond()
+	mineTestBlock(t, bc)
+	if _, ok := <-second; ok {
+		t.Error("block received after unsubscribing")
+	}
+	receive(t, first, "second block")
+}
+
+func TestTransactionEvents(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PrivateKeyToAddress(key)
+	bc := openTestChain(t, t.TempDir(), map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	defer bc.Close()
+
+	newTxs, unsubscribeNew := bc.SubscribeNewTx()
+	defer unsubscribeNew()
+	minedTxs, unsubscribeMined := bc.SubscribeMinedTx()
+	defer unsubscribeMined()
+
+	tx := NewTransaction(0, &common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1000), nil)
+	if err := tx.Sign(crypto.FromECDSA(key), 1337); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, newTxs, "new transaction"); got.Hash != tx.Hash {
+		t.Errorf("new transaction %x, expected %x", got.Hash, tx.Hash)
+	}
+	select {
+	case got := <-minedTxs:
+		t.Fatalf("transaction %x reported mined before its block", got.Hash)
+	default:
+	}
+
+	mineTestTxs(t, bc, []*Transaction{tx})
+	if got := receive(t, minedTxs, "mined transaction"); got.Hash != tx.Hash {
+		t.Errorf("mined transaction %x, expected %x", got.Hash, tx.Hash)
+	}
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// genesisGolden are the values that identify a genesis block
+type genesisGolden struct {
+	StateRoot string `json:"stateRoot"`
+	Hash      string `json:"hash"`
+}
+
+// TestGenesisGolden guards the network identity. The genesis block of the
+// repository's genesis.json with the default config must keep its state root
+// and hash; run with -update only when a change is intended.
+func TestGenesisGolden(t *testing.T) {
+	genesis, err := GenesisBlock(&Config{
+		ChainID:       1337,
+		BlockGasLimit: 8000000,
+		GenesisPath:   filepath.Join("..", "genesis.json"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := genesisGolden{
+		StateRoot: fmt.Sprintf("0x%x", genesis.Header.StateRoot),
+		Hash:      fmt.Sprintf("0x%x", genesis.Header.Hash),
+	}
+
+	goldenPath := filepath.Join("testdata", "genesis.golden.json")
+	if *update {
+		data, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(goldenPath, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want genesisGolden
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("genesis changed: state root %s, hash %s, expected state root %s, hash %s", got.StateRoot, got.Hash, want.StateRoot, want.Hash)
+	}
+}
+
+func TestGenesisDeterministic(t *testing.T) {
+	config := &Config{
+		ChainID:       1337,
+		BlockGasLimit: 8000000,
+		GenesisPath:   filepath.Join("..", "genesis.json"),
+	}
+	first, err := GenesisBlock(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		genesis, err := GenesisBlock(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if genesis.Header.StateRoot != first.Header.StateRoot || genesis.Header.Hash != first.Header.Hash {
+			t.Fatalf("genesis %x differs from %x", genesis.Header.Hash, first.Header.Hash)
+		}
+	}
+}
+
+func TestGenesisExtraDataMismatch(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestChain(t, dir, nil)
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewBlockchain(&Config{
+		DataDir:          filepath.Join(dir, "data"),
+		ChainID:          1337,
+		BlockGasLimit:    8000000,
+		GenesisPath:      filepath.Join(dir, "genesis.json"),
+		GenesisExtraData: "0x666f726765",
+	})
+	if err == nil || !strings.Contains(err.Error(), "extra data mismatch") {
+		t.Errorf("chain opened with other extra data: %v", err)
+	}
+}
+
+func TestGenesisParams(t *testing.T) {
+	genesisHash := func(configure func(*Config)) [32]byte {
+		t.Helper()
+		config := &Config{
+			ChainID:       1337,
+			BlockGasLimit: 8000000,
+			GenesisPath:   filepath.Join("..", "genesis.json"),
+		}
+		if configure != nil {
+			configure(config)
+		}
+		genesis, err := GenesisBlock(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return genesis.Header.Hash
+	}
+
+	base := genesisHash(nil)
+	if hash := genesisHash(func(c *Config) { c.GenesisDifficulty = "0x800" }); hash != genesisHash(func(c *Config) { c.GenesisDifficulty = "2048" }) {
+		t.Error("the same genesis difficulty derived different hashes")
+	} else if hash == base {
+		t.Error("genesis difficulty doesn't change the hash")
+	}
+
+	overrides := map[string]func(*Config){
+		"timestamp": func(c *Config) { c.GenesisTimestamp = 1700000000 },
+		"gas limit": func(c *Config) { c.GenesisGasLimit = 4000000 },
+	}
+	for name, configure := range overrides {
+		if genesisHash(configure) == base {
+			t.Errorf("genesis %s doesn't change the hash", name)
+		}
+	}
+}
+
+func TestZeroChainIDRefused(t *testing.T) {
+	dir := t.TempDir()
+	genesisPath := filepath.Join(dir, "genesis.json")
+	if err := os.WriteFile(genesisPath, []byte(`{"difficulty": "0x1", "gasLimit": "0x7A1200"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := NewBlockchain(&Config{
+		DataDir:       filepath.Join(dir, "data"),
+		BlockGasLimit: 8000000,
+		GenesisPath:   genesisPath,
+	})
+	if !errors.Is(err, ErrZeroChainID) {
+		if bc != nil {
+			bc.Close()
+		}
+		t.Fatalf("error %v opening a chain without a chain id, expected %v", err, ErrZeroChainID)
+	}
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"blockchain-node/state"
+	"errors"
+	"fmt"
+)
+
+// ImportError reports the block an InsertChain call failed at
+type ImportError struct {
+	Index  int    // position of the block in the imported slice
+	Number uint64 // block number
+	Err    error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("import failed at block %d (index %d): %v", e.Number, e.Index, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// InsertChain adds blocks, which must extend the current head in order, as a
+// unit: either all of them become part of the chain or none do. Every block is
+// validated and executed on a staged head first, and only once all of them
+// pass are they stored and published. If storing fails halfway the blocks
+// stored so far are deleted again, so the chain stays at its original tip.
+// On failure the returned error is an *ImportError naming the block.
+func (bc *Blockchain) InsertChain(blocks []*Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	bc.insertMu.Lock()
+	defer bc.insertMu.Unlock()
+	if bc.closed {
+		return &ImportError{Index: 0, Number: blocks[0].Header.Number, Err: ErrChainClosed}
+	}
+
+	bc.mu.RLock()
+	parent := bc.currentBlock
+	parentState := bc.stateDB
+	bc.mu.RUnlock()
+	parentState = parentState.Copy()
+
+	log.Infof("Importing %d blocks on top of block %d", len(blocks), parent.Header.Number)
+
+	states := make([]*state.StateDB, len(blocks))
+	for i, block := range blocks {
+		if block == nil || block.Header == nil {
+			return &ImportError{Index: i, Number: parent.Header.Number + 1, Err: errors.New("missing block")}
+		}
+		if block.Header.Number != parent.Header.Number+1 || block.Header.ParentHash != parent.Header.Hash {
+			return &ImportError{Index: i, Number: block.Header.Number, Err: fmt.Errorf("block does not extend block %d (%x)", parent.Header.Number, parent.Header.Hash)}
+		}
+
+		stateDB, err := bc.processBlock(block, parent, parentState)
+		if err != nil {
+			log.Errorf("Import of %d blocks rejected at block %d, chain left at block %d", len(blocks), block.Header.Number, blocks[0].Header.Number-1)
+			return &ImportError{Index: i, Number: block.Header.Number, Err: err}
+		}
+		states[i] = stateDB
+		parent = block
+		parentState = stateDB.Copy()
+	}
+
+	for i, block := range blocks {
+		if err := bc.saveBlock(block); err != nil {
+			log.Errorf("Failed to save imported block %d, rolling back: %v", block.Header.Number, err)
+			bc.deleteBlocks(blocks[:i])
+			return &ImportError{Index: i, Number: block.Header.Number, Err: err}
+		}
+	}
+
+	// Only now does the batch become the chain loaded on restart
+	if err := bc.writeChainHead(parent); err != nil {
+		log.Errorf("Failed to save chain head after import, rolling back: %v", err)
+		bc.deleteBlocks(blocks)
+		return &ImportError{Index: len(blocks) - 1, Number: parent.Header.Number, Err: err}
+	}
+
+	for i, block := range blocks {
+		bc.publishBlock(block, states[i])
+	}
+	if err := bc.flushState(parent, false); err != nil {
+		log.Errorf("Failed to flush state at block %d: %v", parent.Header.Number, err)
+	}
+	if err := bc.pruneBlocks(parent); err != nil {
+		log.Errorf("Failed to prune blocks: %v", err)
+	}
+
+	log.Infof("Imported %d blocks, head at block %d", len(blocks), parent.Header.Number)
+
+	// Blocks received ahead of the batch may now extend it
+	bc.connectOrphans(parent)
+	return nil
+}
+
+// deleteBlocks removes stored blocks that were not published yet
+func (bc *Blockchain) deleteBlocks(blocks []*Block) {
+	for _, block := range blocks {
+		blockKey := fmt.Sprintf("block_%d", block.Header.Number)
+		if err := bc.db.Delete([]byte(blockKey)); err != nil {
+			log.Errorf("Failed to delete block %d during rollback: %v", block.Header.Number, err)
+		}
+		bc.cache.Delete(blockKey)
+	}
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// testBlocks mines n empty blocks on a new chain and returns them
+func testBlocks(t *testing.T, n int) []*Block {
+	t.Helper()
+	bc := openTestChain(t, t.TempDir(), nil)
+	defer bc.Close()
+
+	blocks := make([]*Block, n)
+	for i := range blocks {
+		blocks[i] = mineTestBlock(t, bc)
+	}
+	return blocks
+}
+
+func TestInsertChainRollback(t *testing.T) {
+	blocks := testBlocks(t, 3)
+	bc := openTestChain(t, t.TempDir(), nil)
+	defer bc.Close()
+
+	bad := *blocks[1]
+	header := *bad.Header
+	header.TxHash = [32]byte{0x01}
+	bad.Header = &header
+
+	err := bc.InsertChain([]*Block{blocks[0], &bad, blocks[2]})
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || importErr.Index != 1 || !errors.Is(importErr.Err, ErrTxRootMismatch) {
+		t.Fatalf("import error %v, expected one for block 2", err)
+	}
+	if head := bc.GetCurrentBlock().Header.Number; head != 0 {
+		t.Errorf("head at block %d after a failed import, expected genesis", head)
+	}
+	if bc.GetBlockByNumber(1) != nil {
+		t.Error("block 1 of the failed import is stored")
+	}
+}
+
+func TestInsertChainConnectsOrphans(t *testing.T) {
+	blocks := testBlocks(t, 3)
+	bc := openTestChain(t, t.TempDir(), nil)
+	defer bc.Close()
+
+	if err := bc.AddBlock(blocks[2]); !errors.Is(err, ErrOrphanBlock) {
+		t.Fatalf("adding block 3 first: error %v, expected %v", err, ErrOrphanBlock)
+	}
+	if err := bc.InsertChain(blocks[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if head := bc.GetCurrentBlock().Header.Number; head != 3 {
+		t.Errorf("head at block %d, expected the orphan block 3 connected", head)
+	}
+}
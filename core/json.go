@@ -0,0 +1,104 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// hexBig is a big integer encoded as a 0x prefixed hex string in JSON. JSON
+// numbers above 2^53 lose precision in decoders that read them as floats,
+// which includes encoding/json decoding P2P message data into interface{}.
+// Plain JSON numbers are still accepted, blocks stored by older versions use
+// them.
+type hexBig big.Int
+
+func (b *hexBig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("0x%x", (*big.Int)(b)))
+}
+
+func (b *hexBig) UnmarshalJSON(input []byte) error {
+	if len(input) == 0 || input[0] != '"' {
+		return (*big.Int)(b).UnmarshalJSON(input)
+	}
+
+	var s string
+	if err := json.Unmarshal(input, &s); err != nil {
+		return err
+	}
+	if _, ok := (*big.Int)(b).SetString(s, 0); !ok {
+		return fmt.Errorf("invalid big integer: %q", s)
+	}
+	return nil
+}
+
+// transactionFields and headerFields have the fields of Transaction and
+// BlockHeader without their JSON methods
+type (
+	transactionFields Transaction
+	headerFields      BlockHeader
+)
+
+// MarshalJSON encodes the big integer fields of tx as hex strings
+func (tx *Transaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		*transactionFields
+		Value    *hexBig `json:"value"`
+		GasPrice *hexBig `json:"gasPrice"`
+		V        *hexBig `json:"v"`
+		R        *hexBig `json:"r"`
+		S        *hexBig `json:"s"`
+	}{
+		transactionFields: (*transactionFields)(tx),
+		Value:             (*hexBig)(tx.Value),
+		GasPrice:          (*hexBig)(tx.GasPrice),
+		V:                 (*hexBig)(tx.V),
+		R:                 (*hexBig)(tx.R),
+		S:                 (*hexBig)(tx.S),
+	})
+}
+
+func (tx *Transaction) UnmarshalJSON(input []byte) error {
+	dec := struct {
+		*transactionFields
+		Value    *hexBig `json:"value"`
+		GasPrice *hexBig `json:"gasPrice"`
+		V        *hexBig `json:"v"`
+		R        *hexBig `json:"r"`
+		S        *hexBig `json:"s"`
+	}{transactionFields: (*transactionFields)(tx)}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+
+	tx.Value = (*big.Int)(dec.Value)
+	tx.GasPrice = (*big.Int)(dec.GasPrice)
+	tx.V = (*big.Int)(dec.V)
+	tx.R = (*big.Int)(dec.R)
+	tx.S = (*big.Int)(dec.S)
+	return nil
+}
+
+// MarshalJSON encodes the difficulty of bh as a hex string
+func (bh *BlockHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		*headerFields
+		Difficulty *hexBig `json:"difficulty"`
+	}{
+		headerFields: (*headerFields)(bh),
+		Difficulty:   (*hexBig)(bh.Difficulty),
+	})
+}
+
+func (bh *BlockHeader) UnmarshalJSON(input []byte) error {
+	dec := struct {
+		*headerFields
+		Difficulty *hexBig `json:"difficulty"`
+	}{headerFields: (*headerFields)(bh)}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+
+	bh.Difficulty = (*big.Int)(dec.Difficulty)
+	return nil
+}
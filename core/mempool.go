@@ -1,24 +1,54 @@
-
 package core
 
 import (
+	"blockchain-node/validation"
 	"errors"
+	"math/big"
 	"sync"
+	"time"
 )
 
+// DefaultMaxPerAccount is the number of transactions a single sender may
+// have waiting in the mempool unless configured otherwise
+const DefaultMaxPerAccount = 64
+
+// DefaultMaxNonceGap is how far a transaction nonce may be ahead of the
+// sender's state nonce unless configured otherwise
+const DefaultMaxNonceGap = 64
+
+// priceBump is the percentage by which a transaction must raise the gas price
+// of the pending transaction with the same nonce to replace it
+const priceBump = 10
+
 type Mempool struct {
-	transactions map[[32]byte]*Transaction
-	pending      map[[20]byte][]*Transaction
-	mu           sync.RWMutex
+	transactions  map[[32]byte]*Transaction
+	pending       map[[20]byte][]*Transaction
+	addedAt       map[[32]byte]time.Time
+	maxPerAccount int
+	version       uint64 // bumped on every change
+	mu            sync.RWMutex
 }
 
 func NewMempool() *Mempool {
 	return &Mempool{
-		transactions: make(map[[32]byte]*Transaction),
-		pending:      make(map[[20]byte][]*Transaction),
+		transactions:  make(map[[32]byte]*Transaction),
+		pending:       make(map[[20]byte][]*Transaction),
+		addedAt:       make(map[[32]byte]time.Time),
+		maxPerAccount: DefaultMaxPerAccount,
 	}
 }
 
+// SetMaxPerAccount limits the number of transactions a single sender may have
+// waiting in the mempool. Zero or less disables the limit.
+func (mp *Mempool) SetMaxPerAccount(limit int) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.maxPerAccount = limit
+}
+
+// AddTransaction adds a transaction to the mempool. A transaction with the
+// nonce of one already pending from the same sender replaces it if it pays
+// a gas price at least priceBump percent higher.
 func (mp *Mempool) AddTransaction(tx *Transaction) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
@@ -28,13 +58,49 @@ func (mp *Mempool) AddTransaction(tx *Transaction) error {
 		return err
 	}
 
+	pending := mp.pending[tx.From]
+	for i, old := range pending {
+		if old.Nonce != tx.Nonce {
+			continue
+		}
+		if !replaces(tx, old) {
+			return ErrReplacementUnderpriced
+		}
+
+		delete(mp.transactions, old.Hash)
+		delete(mp.addedAt, old.Hash)
+		pending[i] = tx
+		mp.transactions[tx.Hash] = tx
+		mp.addedAt[tx.Hash] = time.Now()
+		mp.version++
+		return nil
+	}
+
+	if mp.maxPerAccount > 0 && len(pending) >= mp.maxPerAccount {
+		return ErrAccountLimitExceeded
+	}
+
 	// Add to mempool
 	mp.transactions[tx.Hash] = tx
-	mp.pending[tx.From] = append(mp.pending[tx.From], tx)
+	mp.pending[tx.From] = append(pending, tx)
+	mp.addedAt[tx.Hash] = time.Now()
+	mp.version++
 
 	return nil
 }
 
+// replaces reports whether tx pays enough more than old to replace it
+func replaces(tx, old *Transaction) bool {
+	if tx.GasPrice == nil || old.GasPrice == nil {
+		return false
+	}
+
+	// tx.GasPrice * 100 >= old.GasPrice * (100 + priceBump)
+	required := new(big.Int).Mul(old.GasPrice, big.NewInt(100+priceBump))
+	offered := new(big.Int).Mul(tx.GasPrice, big.NewInt(100))
+	return offered.Cmp(required) >= 0
+}
+
 func (mp *Mempool) validateTransaction(tx *Transaction) error {
 	// Check if transaction already exists
 	if _, exists := mp.transactions[tx.Hash]; exists {
@@ -43,7 +109,7 @@ func (mp *Mempool) validateTransaction(tx *Transaction) error {
 
 	// Verify signature
 	if !tx.VerifySignature() {
-		return errors.New("invalid transaction signature")
+		return validation.ErrInvalidSignature
 	}
 
 	// Additional validations can be added here
@@ -60,6 +126,14 @@ func (mp *Mempool) GetTransaction(hash [32]byte) *Transaction {
 	return mp.transactions[hash]
 }
 
+// AddedAt returns when a transaction entered the mempool, or the zero time if
+// it isn't in the mempool
+func (mp *Mempool) AddedAt(hash [32]byte) time.Time {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return mp.addedAt[hash]
+}
+
 func (mp *Mempool) GetPendingTransactions() []*Transaction {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
@@ -71,13 +145,30 @@ func (mp *Mempool) GetPendingTransactions() []*Transaction {
 	return txs
 }
 
+// GetPendingNonce returns the next nonce for address, accounting for its
+// transactions that are still waiting in the mempool.
+func (mp *Mempool) GetPendingNonce(address [20]byte, stateNonce uint64) uint64 {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	nonce := stateNonce
+	for _, tx := range mp.pending[address] {
+		if tx.Nonce >= nonce {
+			nonce = tx.Nonce + 1
+		}
+	}
+	return nonce
+}
+
 func (mp *Mempool) RemoveTransaction(hash [32]byte) {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
 	if tx, exists := mp.transactions[hash]; exists {
 		delete(mp.transactions, hash)
-		
+		delete(mp.addedAt, hash)
+		mp.version++
+
 		// Remove from pending
 		if pending := mp.pending[tx.From]; pending != nil {
 			for i, pendingTx := range pending {
@@ -96,6 +187,16 @@ func (mp *Mempool) Clear() {
 
 	mp.transactions = make(map[[32]byte]*Transaction)
 	mp.pending = make(map[[20]byte][]*Transaction)
+	mp.addedAt = make(map[[32]byte]time.Time)
+	mp.version++
+}
+
+// Version returns a counter that changes whenever transactions are added to
+// or removed from the mempool
+func (mp *Mempool) Version() uint64 {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return mp.version
 }
 
 func (mp *Mempool) Size() int {
@@ -103,3 +204,21 @@ func (mp *Mempool) Size() int {
 	defer mp.mu.RUnlock()
 	return len(mp.transactions)
 }
+
+// PendingGas returns the sum of the gas limits of the transactions in the
+// mempool
+func (mp *Mempool) PendingGas() uint64 {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	var gas uint64
+	for _, tx := range mp.transactions {
+		gas += tx.GasLimit
+	}
+	return gas
+}
+
+var (
+	ErrAccountLimitExceeded   = errors.New("too many pending transactions from sender")
+	ErrReplacementUnderpriced = errors.New("replacement transaction underpriced")
+	ErrNonceTooHigh           = errors.New("nonce too far ahead of the account nonce")
+)
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"blockchain-node/crypto"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestMempoolAccountLimit(t *testing.T) {
+	signed := func(key []byte, nonce uint64, gasPrice int64) *Transaction {
+		tx := NewTransaction(nonce, &common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(gasPrice), nil)
+		if err := tx.Sign(key, 1337); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	newKey := func() []byte {
+		key, _, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crypto.FromECDSA(key)
+	}
+	flooder, other := newKey(), newKey()
+
+	mp := NewMempool()
+	mp.SetMaxPerAccount(3)
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		if err := mp.AddTransaction(signed(flooder, nonce, 1000)); err != nil {
+			t.Fatalf("transaction %d rejected: %v", nonce, err)
+		}
+	}
+	if err := mp.AddTransaction(signed(flooder, 3, 1000)); !errors.Is(err, ErrAccountLimitExceeded) {
+		t.Errorf("transaction over the limit: error %v, expected %v", err, ErrAccountLimitExceeded)
+	}
+
+	// Transaction hashes don't cover the sender, so the price tells it apart
+	if err := mp.AddTransaction(signed(other, 0, 2000)); err != nil {
+		t.Errorf("transaction of another sender rejected: %v", err)
+	}
+
+	// A replacement doesn't add to the count of the sender
+	if err := mp.AddTransaction(signed(flooder, 0, 1100)); err != nil {
+		t.Errorf("replacement at the limit rejected: %v", err)
+	}
+	if size := mp.Size(); size != 4 {
+		t.Errorf("%d transactions in the mempool, expected 4", size)
+	}
+}
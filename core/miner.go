@@ -1,12 +1,29 @@
-
 package core
 
 import (
 	"blockchain-node/consensus"
+	"bytes"
 	"fmt"
-	"math/big"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// txStarvationAge is how long a transaction may wait in the mempool before
+// the fair selection policy includes its sender ahead of better paying ones
+const txStarvationAge = 2 * time.Minute
+
+// SelectionPolicy decides how the miner picks mempool transactions for a block
+type SelectionPolicy string
+
+const (
+	// SelectionByPrice packs the best paying transactions first
+	SelectionByPrice SelectionPolicy = "price"
+	// SelectionFair takes one transaction per sender in turn, so a single
+	// sender cannot fill the block
+	SelectionFair SelectionPolicy = "fair"
 )
 
 type Miner struct {
@@ -15,15 +32,19 @@ type Miner struct {
 	running    bool
 	mu         sync.Mutex
 	stopChan   chan struct{}
+	done       chan struct{} // closed when the mining loop returns
 	consensus  *consensus.ProofOfWork
 }
 
 func NewMiner(blockchain *Blockchain, minerAddr string) *Miner {
+	engine := consensus.NewProofOfWork()
+	engine.SetHasher(blockchain.PoWHasher())
 	return &Miner{
 		blockchain: blockchain,
 		minerAddr:  minerAddr,
 		stopChan:   make(chan struct{}),
-		consensus:  consensus.NewProofOfWork(),
+		done:       make(chan struct{}),
+		consensus:  engine,
 	}
 }
 
@@ -34,30 +55,99 @@ func (m *Miner) Start() {
 		return
 	}
 	m.running = true
+	// Fresh channels, a stopped miner can be started again
+	m.stopChan = make(chan struct{})
+	m.done = make(chan struct{})
+	stop, done := m.stopChan, m.done
 	m.mu.Unlock()
+	defer close(done)
 
 	fmt.Println("Starting miner...")
 
 	for {
 		select {
-		case <-m.stopChan:
+		case <-stop:
 			return
 		default:
+			if !m.waitForNextBlock(stop) {
+				return
+			}
 			m.mineBlock()
 		}
 	}
 }
 
+// waitForNextBlock waits until MinBlockInterval has passed since the head
+// block and, unless empty blocks are mined, until the mempool has
+// transactions or MaxEmptyInterval has passed since the head block. It
+// returns false once stop is closed meanwhile. stop is the channel Start
+// captured, a restarted miner replaces m.stopChan.
+func (m *Miner) waitForNextBlock(stop <-chan struct{}) bool {
+	config := m.blockchain.GetConfig()
+
+	// Without empty blocks, new transactions end the wait
+	var newTxs <-chan *Transaction
+	if !config.MineEmptyBlocks {
+		txs, unsubscribe := m.blockchain.SubscribeNewTx()
+		defer unsubscribe()
+		newTxs = txs
+	}
+
+	for {
+		var headTime time.Time
+		var wait time.Duration
+		if head := m.blockchain.GetCurrentBlock(); head != nil {
+			headTime = time.Unix(head.Header.Timestamp, 0)
+			wait = time.Until(headTime.Add(config.MinBlockInterval))
+		}
+		if wait <= 0 {
+			if config.MineEmptyBlocks || m.blockchain.GetMempool().Size() > 0 {
+				return true
+			}
+			if config.MaxEmptyInterval <= 0 {
+				wait = -1 // until a transaction arrives
+			} else if wait = time.Until(headTime.Add(config.MaxEmptyInterval)); wait <= 0 {
+				return true
+			}
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		stopped := false
+		select {
+		case <-stop:
+			stopped = true
+		case <-timeout:
+		case <-newTxs:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if stopped {
+			return false
+		}
+	}
+}
+
+// Stop stops the miner and waits for the block being mined, so no block is
+// added once it returns
 func (m *Miner) Stop() {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	if !m.running {
+		m.mu.Unlock()
 		return
 	}
-
 	m.running = false
 	close(m.stopChan)
+	done := m.done
+	m.mu.Unlock()
+
+	<-done
 	fmt.Println("Miner stopped")
 }
 
@@ -73,10 +163,12 @@ func (m *Miner) mineBlock() {
 	mempool := m.blockchain.GetMempool()
 	pendingTxs := mempool.GetPendingTransactions()
 
-	// Limit transactions per block
-	maxTxs := 100
-	if len(pendingTxs) > maxTxs {
-		pendingTxs = pendingTxs[:maxTxs]
+	// Pack the best paying transactions that fit in the block
+	config := m.blockchain.GetConfig()
+	if config.TxSelectionPolicy == SelectionFair {
+		pendingTxs = selectTransactionsFair(pendingTxs, config.MaxBlockTxs, config.BlockGasLimit, mempool.AddedAt, time.Now())
+	} else {
+		pendingTxs = selectTransactions(pendingTxs, config.MaxBlockTxs, config.BlockGasLimit)
 	}
 
 	// Create new block
@@ -86,30 +178,29 @@ func (m *Miner) mineBlock() {
 		pendingTxs,
 	)
 
-	// Set miner reward transaction
-	minerAddrBytes := [20]byte{}
-	copy(minerAddrBytes[:], []byte(m.minerAddr)[:20])
-	
-	rewardTx := NewTransaction(
-		0, // nonce
-		&minerAddrBytes,
-		big.NewInt(2e18), // 2 ETH reward
-		21000, // gas limit
-		big.NewInt(0), // gas price
-		nil, // data
-	)
-	
-	newBlock.Transactions = append([]*Transaction{rewardTx}, newBlock.Transactions...)
+	// The difficulty follows from the parent, peers reject headers that
+	// don't match it
+	newBlock.Header.Difficulty = m.consensus.CalculateDifficulty(newBlock, currentBlock)
+
+	// The block reward is credited to the coinbase when the block is executed
+	newBlock.Header.Coinbase = m.rewardAddress(newBlock.Header.Number)
+
+	// Execute the block to fill in the roots and gas used before sealing,
+	// the header hash covers them
+	if err := m.blockchain.FinalizeBlock(newBlock); err != nil {
+		fmt.Printf("Failed to finalize block: %v\n", err)
+		return
+	}
 
 	// Mine the block using consensus engine
 	fmt.Printf("Mining block %d with %d transactions...\n", newBlock.Header.Number, len(newBlock.Transactions))
 	start := time.Now()
-	
+
 	if err := m.consensus.MineBlock(newBlock); err != nil {
 		fmt.Printf("Failed to mine block: %v\n", err)
 		return
 	}
-	
+
 	duration := time.Since(start)
 	fmt.Printf("Block %d mined in %v! Hash: %x\n", newBlock.Header.Number, duration, newBlock.Header.Hash)
 
@@ -127,8 +218,129 @@ func (m *Miner) mineBlock() {
 	fmt.Printf("Block %d added to blockchain\n", newBlock.Header.Number)
 }
 
+// rewardAddress returns the address the reward of block number is paid to:
+// one of the configured reward recipients, or the miner address if there are
+// none
+func (m *Miner) rewardAddress(number uint64) common.Address {
+	config := m.blockchain.GetConfig()
+	if len(config.RewardRecipients) > 0 {
+		return selectRewardRecipient(config.RewardRecipients, config.RewardPolicy, number)
+	}
+	return common.HexToAddress(m.minerAddr)
+}
+
 func (m *Miner) IsRunning() bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.running
 }
+
+// selectTransactions greedily picks transactions by gas price until either
+// maxTxs transactions are selected or no remaining transaction fits in the
+// gas budget. Transactions from the same sender keep their nonce order.
+func selectTransactions(txs []*Transaction, maxTxs int, gasBudget uint64) []*Transaction {
+	bySender := groupBySender(txs)
+
+	var selected []*Transaction
+	for len(bySender) > 0 && (maxTxs <= 0 || len(selected) < maxTxs) {
+		// Find the sender whose next transaction pays the most
+		var best *Transaction
+		for _, senderTxs := range bySender {
+			head := senderTxs[0]
+			if best == nil || head.GasPrice.Cmp(best.GasPrice) > 0 ||
+				(head.GasPrice.Cmp(best.GasPrice) == 0 && head.Nonce < best.Nonce) {
+				best = head
+			}
+		}
+
+		// A transaction that doesn't fit blocks the rest of its sender's
+		// transactions, but smaller ones from other senders may still fit
+		if best.GasLimit > gasBudget {
+			delete(bySender, best.From)
+			continue
+		}
+
+		selected = append(selected, best)
+		gasBudget -= best.GasLimit
+
+		if remaining := bySender[best.From][1:]; len(remaining) > 0 {
+			bySender[best.From] = remaining
+		} else {
+			delete(bySender, best.From)
+		}
+	}
+
+	return selected
+}
+
+// selectTransactionsFair picks transactions in rounds, taking the next
+// transaction of every sender per round. Within a round, senders whose next
+// transaction has waited longer than txStarvationAge go first, the others
+// follow by gas price.
+func selectTransactionsFair(txs []*Transaction, maxTxs int, gasBudget uint64, addedAt func([32]byte) time.Time, now time.Time) []*Transaction {
+	bySender := groupBySender(txs)
+
+	starving := func(tx *Transaction) bool {
+		added := addedAt(tx.Hash)
+		return !added.IsZero() && now.Sub(added) > txStarvationAge
+	}
+
+	var selected []*Transaction
+	for len(bySender) > 0 {
+		heads := make([]*Transaction, 0, len(bySender))
+		for _, senderTxs := range bySender {
+			heads = append(heads, senderTxs[0])
+		}
+		sort.Slice(heads, func(i, j int) bool {
+			si, sj := starving(heads[i]), starving(heads[j])
+			if si != sj {
+				return si
+			}
+			if si {
+				return addedAt(heads[i].Hash).Before(addedAt(heads[j].Hash))
+			}
+			if cmp := heads[i].GasPrice.Cmp(heads[j].GasPrice); cmp != 0 {
+				return cmp > 0
+			}
+			return bytes.Compare(heads[i].From[:], heads[j].From[:]) < 0
+		})
+
+		for _, tx := range heads {
+			if maxTxs > 0 && len(selected) >= maxTxs {
+				return selected
+			}
+
+			// A transaction that doesn't fit blocks the rest of its sender's
+			// transactions
+			if tx.GasLimit > gasBudget {
+				delete(bySender, tx.From)
+				continue
+			}
+
+			selected = append(selected, tx)
+			gasBudget -= tx.GasLimit
+
+			if remaining := bySender[tx.From][1:]; len(remaining) > 0 {
+				bySender[tx.From] = remaining
+			} else {
+				delete(bySender, tx.From)
+			}
+		}
+	}
+
+	return selected
+}
+
+// groupBySender groups transactions by sender, each group ordered by nonce
+func groupBySender(txs []*Transaction) map[[20]byte][]*Transaction {
+	bySender := make(map[[20]byte][]*Transaction)
+	for _, tx := range txs {
+		bySender[tx.From] = append(bySender[tx.From], tx)
+	}
+	for _, senderTxs := range bySender {
+		sort.Slice(senderTxs, func(i, j int) bool {
+			return senderTxs[i].Nonce < senderTxs[j].Nonce
+		})
+	}
+	return bySender
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"blockchain-node/crypto"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// senderTxs returns n transactions of sender with consecutive nonces, each
+// with the given gas limit and gas price
+func senderTxs(sender byte, n int, gasLimit uint64, gasPrice int64) []*Transaction {
+	txs := make([]*Transaction, n)
+	for i := range txs {
+		tx := NewTransaction(uint64(i), &common.Address{0xee}, big.NewInt(1), gasLimit, big.NewInt(gasPrice), nil)
+		tx.From = common.Address{sender}
+		tx.Hash = tx.CalculateHash()
+		txs[i] = tx
+	}
+	return txs
+}
+
+func TestSelectTransactionsGasBudget(t *testing.T) {
+	txs := senderTxs(0x01, 10, 21000, 1000)
+
+	selected := selectTransactions(txs, 0, 5*21000+20000)
+	if len(selected) != 5 {
+		t.Fatalf("%d transactions selected for the gas of 5", len(selected))
+	}
+	for i, tx := range selected {
+		if tx.Nonce != uint64(i) {
+			t.Errorf("transaction %d has nonce %d", i, tx.Nonce)
+		}
+	}
+
+	if selected := selectTransactions(txs, 3, 10*21000); len(selected) != 3 {
+		t.Errorf("%d transactions selected with a maximum of 3", len(selected))
+	}
+	if selected := selectTransactions(txs, 0, 20000); len(selected) != 0 {
+		t.Errorf("%d transactions selected without gas for one", len(selected))
+	}
+}
+
+func TestSelectTransactionsFair(t *testing.T) {
+	rich := senderTxs(0x01, 10, 21000, 2000)
+	poor := senderTxs(0x02, 10, 21000, 1000)
+	txs := append(append([]*Transaction{}, rich...), poor...)
+	now := time.Now()
+	fresh := func([32]byte) time.Time { return now }
+
+	// By price the better paying sender fills the block
+	if selected := selectTransactions(txs, 4, 10*21000); countFrom(selected, 0x02) != 0 {
+		t.Fatalf("%d transactions of the other sender selected by price", countFrom(selected, 0x02))
+	}
+
+	selected := selectTransactionsFair(txs, 4, 10*21000, fresh, now)
+	if len(selected) != 4 || countFrom(selected, 0x01) != 2 || countFrom(selected, 0x02) != 2 {
+		t.Fatalf("fair selection took %d of the first and %d of the second sender", countFrom(selected, 0x01), countFrom(selected, 0x02))
+	}
+	if selected[0].From != rich[0].From {
+		t.Error("the better paying sender doesn't lead the round")
+	}
+
+	// A starving transaction goes first whatever it pays
+	starving := func(hash [32]byte) time.Time {
+		if hash == poor[0].Hash {
+			return now.Add(-2 * txStarvationAge)
+		}
+		return now
+	}
+	if selected := selectTransactionsFair(txs, 4, 10*21000, starving, now); selected[0] != poor[0] {
+		t.Errorf("starving transaction selected after %x", selected[0].Hash)
+	}
+}
+
+func TestMinerBlockInterval(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PrivateKeyToAddress(key)
+	bc := openTestChain(t, t.TempDir(), map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	defer bc.Close()
+	miner := NewMiner(bc, "0x0000000000000000000000000000000000000001")
+
+	// With an empty mempool the next block waits for the interval
+	head := mineTestBlock(t, bc)
+	config := bc.GetConfig()
+	config.MinBlockInterval = 2 * time.Second
+	config.MineEmptyBlocks = true
+	if !miner.waitForNextBlock(make(chan struct{})) {
+		t.Fatal("wait for the next block stopped")
+	}
+	if next := time.Unix(head.Header.Timestamp, 0).Add(config.MinBlockInterval); time.Now().Before(next) {
+		t.Errorf("next block allowed %v before the interval passed", time.Until(next))
+	}
+
+	// Without empty blocks the miner waits for a transaction
+	config.MinBlockInterval = 0
+	config.MineEmptyBlocks = false
+	ready := make(chan bool, 1)
+	go func() { ready <- miner.waitForNextBlock(make(chan struct{})) }()
+	select {
+	case <-ready:
+		t.Fatal("empty block allowed")
+	case <-time.After(500 * time.Millisecond):
+	}
+	if err := bc.AddTransaction(signedTransfer(t, key, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ok := <-ready:
+		if !ok {
+			t.Error("wait for a transaction stopped")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no block after a transaction arrived")
+	}
+}
+
+func TestMinerWaitStopsOnCapturedChannel(t *testing.T) {
+	bc := openTestChain(t, t.TempDir(), nil)
+	defer bc.Close()
+	bc.GetConfig().MineEmptyBlocks = false
+	miner := NewMiner(bc, "0x0000000000000000000000000000000000000001")
+
+	// A loop stopped while a restart replaced m.stopChan must still see the
+	// close of the channel it started with
+	stop := make(chan struct{})
+	close(stop)
+	ready := make(chan bool, 1)
+	go func() { ready <- miner.waitForNextBlock(stop) }()
+	select {
+	case ok := <-ready:
+		if ok {
+			t.Error("wait ended without a block to mine")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait ignored the closed stop channel")
+	}
+}
+
+// countFrom returns the number of txs sent by sender
+func countFrom(txs []*Transaction, sender byte) int {
+	count := 0
+	for _, tx := range txs {
+		if tx.From[0] == sender {
+			count++
+		}
+	}
+	return count
+}
+
+func TestMinerWaitsForTransactions(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := openTestChain(t, t.TempDir(), map[[20]byte]*big.Int{crypto.PrivateKeyToAddress(key): big.NewInt(1e18)})
+	defer bc.Close()
+	bc.GetConfig().MineEmptyBlocks = false
+
+	miner := NewMiner(bc, "0x0000000000000000000000000000000000000001")
+	go miner.Start()
+	defer miner.Stop()
+
+	time.Sleep(500 * time.Millisecond)
+	if head := bc.GetCurrentBlock(); head.Header.Number != 0 {
+		t.Fatalf("block %d mined with an empty mempool", head.Header.Number)
+	}
+
+	tx := signedTransfer(t, key, 0, 1)
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); bc.GetCurrentBlock().Header.Number == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no block after a transaction arrived")
+		}
+	}
+	if block := bc.GetCurrentBlock(); len(block.Transactions) != 1 || block.Transactions[0].Hash != tx.Hash {
+		t.Errorf("block %d has %d transactions, expected the new one", block.Header.Number, len(block.Transactions))
+	}
+}
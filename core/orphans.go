@@ -0,0 +1,227 @@
+package core
+
+import (
+	"blockchain-node/consensus"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Orphan pool limits. Orphans are blocks whose parent is not known yet, which
+// happens when blocks arrive out of order. They are kept until the parent is
+// added, and dropped when the pool is full or they get too old.
+// A peer may only fill maxOrphansPerSource slots, and orphans more than
+// maxOrphanDistance blocks above the head are not kept, those are fetched
+// by the regular sync instead.
+const (
+	maxOrphanBlocks     = 256
+	maxOrphansPerSource = 16
+	maxOrphanDistance   = 16
+	orphanExpiry        = 10 * time.Minute
+)
+
+var (
+	// ErrOrphanBlock is returned by AddBlock for a block whose parent is
+	// unknown. The block is kept and added once its parent is.
+	ErrOrphanBlock = errors.New("unknown parent, block kept as orphan")
+	// ErrStaleBlock is returned by AddBlock for a block that doesn't extend
+	// the chain head although its parent is known, or that is not above it
+	ErrStaleBlock = errors.New("block does not extend the chain head")
+	// ErrOrphanTooFar is returned for a block with an unknown parent that is
+	// more than maxOrphanDistance blocks above the chain head
+	ErrOrphanTooFar = errors.New("orphan block too far above the chain head")
+	// ErrOrphanDifficulty is returned for a block with an unknown parent
+	// whose difficulty is below what the chain head allows
+	ErrOrphanDifficulty = errors.New("orphan block difficulty too low")
+)
+
+type orphanBlock struct {
+	block  *Block
+	source string
+	added  time.Time
+}
+
+// orphanPool holds orphan blocks by hash and by parent hash, and counts them
+// by the peer they came from
+type orphanPool struct {
+	mu       sync.Mutex
+	byHash   map[[32]byte]*orphanBlock
+	byParent map[[32]byte][]*orphanBlock
+	bySource map[string]int
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		byHash:   make(map[[32]byte]*orphanBlock),
+		byParent: make(map[[32]byte][]*orphanBlock),
+		bySource: make(map[string]int),
+	}
+}
+
+// add keeps block from source until its parent arrives. If source already
+// has maxOrphansPerSource orphans its oldest is evicted, otherwise the
+// oldest orphan of all if the pool is full.
+func (op *orphanPool) add(block *Block, source string) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if _, exists := op.byHash[block.Header.Hash]; exists {
+		return
+	}
+
+	now := time.Now()
+	op.expire(now)
+	if source != "" && op.bySource[source] >= maxOrphansPerSource {
+		op.remove(op.oldest(source))
+	} else if len(op.byHash) >= maxOrphanBlocks {
+		op.remove(op.oldest(""))
+	}
+
+	orphan := &orphanBlock{block: block, source: source, added: now}
+	op.byHash[block.Header.Hash] = orphan
+	op.byParent[block.Header.ParentHash] = append(op.byParent[block.Header.ParentHash], orphan)
+	op.bySource[source]++
+}
+
+// oldest returns the oldest orphan from source, or of all orphans if source
+// is empty. Must be called with op.mu held.
+func (op *orphanPool) oldest(source string) *orphanBlock {
+	var oldest *orphanBlock
+	for _, orphan := range op.byHash {
+		if source != "" && orphan.source != source {
+			continue
+		}
+		if oldest == nil || orphan.added.Before(oldest.added) {
+			oldest = orphan
+		}
+	}
+	return oldest
+}
+
+// take removes and returns the orphans that are children of parentHash
+func (op *orphanPool) take(parentHash [32]byte) []*Block {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.expire(time.Now())
+	orphans := op.byParent[parentHash]
+	blocks := make([]*Block, 0, len(orphans))
+	for _, orphan := range orphans {
+		blocks = append(blocks, orphan.block)
+		delete(op.byHash, orphan.block.Header.Hash)
+		op.release(orphan.source)
+	}
+	delete(op.byParent, parentHash)
+	return blocks
+}
+
+// size returns the number of orphans in the pool
+func (op *orphanPool) size() int {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return len(op.byHash)
+}
+
+// expire drops orphans older than orphanExpiry. Must be called with op.mu held.
+func (op *orphanPool) expire(now time.Time) {
+	for _, orphan := range op.byHash {
+		if now.Sub(orphan.added) > orphanExpiry {
+			op.remove(orphan)
+		}
+	}
+}
+
+// remove drops orphan from the pool. Must be called with op.mu held.
+func (op *orphanPool) remove(orphan *orphanBlock) {
+	hash, parentHash := orphan.block.Header.Hash, orphan.block.Header.ParentHash
+	delete(op.byHash, hash)
+	op.release(orphan.source)
+
+	siblings := op.byParent[parentHash]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(op.byParent, parentHash)
+	} else {
+		op.byParent[parentHash] = siblings
+	}
+}
+
+// release drops an orphan from the count of source. Must be called with
+// op.mu held.
+func (op *orphanPool) release(source string) {
+	if op.bySource[source] <= 1 {
+		delete(op.bySource, source)
+	} else {
+		op.bySource[source]--
+	}
+}
+
+// minOrphanDifficulty returns the lowest difficulty a block at number can
+// have on top of head, which is the head's lowered by the largest
+// adjustment for every block in between
+func minOrphanDifficulty(head *BlockHeader, number uint64) *big.Int {
+	if head.Difficulty == nil {
+		return new(big.Int)
+	}
+	difficulty := new(big.Int).Set(head.Difficulty)
+	for n := head.Number + 1; n < number; n++ {
+		difficulty.Sub(difficulty, new(big.Int).Div(difficulty, big.NewInt(consensus.MaxDifficultyShift)))
+	}
+	return difficulty
+}
+
+// addOrphan checks the proof of work of a block from source with an unknown
+// parent, which is all that can be checked without the parent, and keeps it
+// in the pool. The self declared difficulty must not be below what the
+// chain head allows, so cheap blocks far ahead cannot fill the pool.
+func (bc *Blockchain) addOrphan(block *Block, source string) error {
+	if block.CalculateHash() != block.Header.Hash {
+		return errors.New("block hash mismatch")
+	}
+	if err := consensus.CheckDifficulty(block.Header.Difficulty); err != nil {
+		return err
+	}
+
+	head := bc.GetCurrentBlock().Header
+	if block.Header.Number > head.Number+maxOrphanDistance {
+		return ErrOrphanTooFar
+	}
+	if block.Header.Difficulty.Cmp(minOrphanDifficulty(head, block.Header.Number)) < 0 {
+		return ErrOrphanDifficulty
+	}
+	if bc.consensus != nil && !bc.consensus.ValidateProofOfWork(block) {
+		return errors.New("invalid proof of work")
+	}
+
+	bc.orphans.add(block, source)
+	log.Infof("Block %d (%x) has unknown parent %x, kept as orphan (%d orphans)", block.Header.Number, block.Header.Hash, block.Header.ParentHash, bc.orphans.size())
+	return ErrOrphanBlock
+}
+
+// connectOrphans adds the orphans waiting for parent, and in turn those
+// waiting for them. Must be called with bc.insertMu held.
+func (bc *Blockchain) connectOrphans(parent *Block) {
+	queue := []*Block{parent}
+	for len(queue) > 0 {
+		parent, queue = queue[0], queue[1:]
+		for _, child := range bc.orphans.take(parent.Header.Hash) {
+			if err := bc.insertBlock(child, ""); err != nil {
+				log.Warningf("Failed to connect orphan block %d (%x): %v", child.Header.Number, child.Header.Hash, err)
+				continue
+			}
+			log.Infof("Connected orphan block %d (%x)", child.Header.Number, child.Header.Hash)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// OrphanCount returns the number of blocks waiting for their parent
+func (bc *Blockchain) OrphanCount() int {
+	return bc.orphans.size()
+}
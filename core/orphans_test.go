@@ -0,0 +1,52 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+)
+
+func orphan(n byte) *Block {
+	return &Block{Header: &BlockHeader{Number: uint64(n), Hash: [32]byte{n}, ParentHash: [32]byte{0xff, n}}}
+}
+
+func TestOrphanPoolPerSourceLimit(t *testing.T) {
+	op := newOrphanPool()
+	for i := 0; i < maxOrphansPerSource+4; i++ {
+		op.add(orphan(byte(i)), "peer1")
+	}
+	op.add(orphan(0xf0), "peer2")
+
+	if got := op.bySource["peer1"]; got != maxOrphansPerSource {
+		t.Errorf("peer1 keeps %d orphans, expected %d", got, maxOrphansPerSource)
+	}
+	if got := op.size(); got != maxOrphansPerSource+1 {
+		t.Errorf("pool has %d orphans, expected %d", got, maxOrphansPerSource+1)
+	}
+	// The oldest orphans of the peer are evicted first
+	if _, ok := op.byHash[[32]byte{0}]; ok {
+		t.Error("oldest orphan of peer1 not evicted")
+	}
+
+	op.take([32]byte{0xff, 0xf0})
+	if _, ok := op.bySource["peer2"]; ok {
+		t.Error("taken orphan still counted against peer2")
+	}
+}
+
+func TestMinOrphanDifficulty(t *testing.T) {
+	head := &BlockHeader{Number: 10, Difficulty: big.NewInt(1000)}
+
+	tests := []struct {
+		number uint64
+		want   int64
+	}{
+		{11, 1000},
+		{12, 750},
+		{13, 563},
+	}
+	for _, test := range tests {
+		if got := minOrphanDifficulty(head, test.number); got.Int64() != test.want {
+			t.Errorf("block %d: minimum difficulty %v, expected %d", test.number, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"blockchain-node/interfaces"
+	"blockchain-node/state"
+	"math/big"
+	"time"
+)
+
+// pendingState is the state of the head block with the executable mempool
+// transactions applied, valid while neither the head nor the mempool change
+type pendingState struct {
+	head    [32]byte
+	version uint64
+	stateDB *state.StateDB
+	header  *BlockHeader
+}
+
+// PendingState returns a copy of the state the next block would have if it
+// included the executable mempool transactions, with the header of that
+// block. Transactions are applied in the order the miner would pick them;
+// those with a nonce gap or that fail to execute are left out. The result is
+// cached until a block is added or the mempool changes.
+func (bc *Blockchain) PendingState() (*state.StateDB, *BlockHeader, error) {
+	bc.pendingMu.Lock()
+	defer bc.pendingMu.Unlock()
+
+	bc.mu.RLock()
+	head := bc.currentBlock
+	stateDB := bc.stateDB
+	bc.mu.RUnlock()
+
+	// Read the version before the transactions, a change in between only
+	// makes the next call rebuild
+	version := bc.mempool.Version()
+	if p := bc.pending; p != nil && p.head == head.Header.Hash && p.version == version {
+		return p.stateDB.Copy(), p.header, nil
+	}
+
+	stateDB = stateDB.Copy()
+
+	header := &BlockHeader{
+		Number:     head.Header.Number + 1,
+		ParentHash: head.Header.Hash,
+		Timestamp:  time.Now().Unix(),
+		GasLimit:   bc.config.BlockGasLimit,
+		Difficulty: new(big.Int),
+	}
+	if head.Header.Difficulty != nil {
+		header.Difficulty.Set(head.Header.Difficulty)
+	}
+
+	if bc.vm != nil {
+		txs := selectTransactions(bc.mempool.GetPendingTransactions(), bc.config.MaxBlockTxs, bc.config.BlockGasLimit)
+		for _, tx := range txs {
+			if tx.Nonce != stateDB.GetNonce(tx.From) {
+				continue
+			}
+
+			snapshot := stateDB.Snapshot()
+			result, err := bc.vm.ExecuteTransaction(&interfaces.ExecutionContext{
+				Transaction: tx,
+				BlockHeader: header,
+				StateDB:     stateDB,
+				From:        tx.From,
+				To:          (*[20]byte)(tx.To),
+				Value:       tx.Value,
+				GasPrice:    tx.GasPrice,
+				Coinbase:    header.Coinbase,
+				Data:        tx.Data,
+			})
+			if err != nil {
+				log.Debugf("Leaving transaction %x out of the pending state: %v", tx.Hash, err)
+				stateDB.RevertToSnapshot(snapshot)
+				continue
+			}
+			header.GasUsed += result.GasUsed
+		}
+	}
+
+	bc.pending = &pendingState{
+		head:    head.Header.Hash,
+		version: version,
+		stateDB: stateDB,
+		header:  header,
+	}
+	return stateDB.Copy(), header, nil
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// prunedKey is the database key of the pointer to the last block whose
+// transactions and receipts were pruned
+const prunedKey = "pruned"
+
+// MinPruneDistance is the least number of recent blocks that keep their
+// bodies when pruning is enabled, so reorganizations and explorer queries of
+// recent blocks keep working
+const MinPruneDistance = 128
+
+// ErrPruned is returned for transactions and receipts of pruned blocks
+var ErrPruned = errors.New("data pruned")
+
+// storedBlock is the database encoding of a block, which unlike the block
+// sent to peers includes the pruning state
+type storedBlock struct {
+	*Block
+	TxHashes [][32]byte `json:"txHashes,omitempty"`
+	Pruned   bool       `json:"pruned,omitempty"`
+}
+
+func encodeStoredBlock(block *Block) ([]byte, error) {
+	return json.Marshal(storedBlock{Block: block, TxHashes: block.TxHashes, Pruned: block.Pruned})
+}
+
+func decodeStoredBlock(data []byte) (*Block, error) {
+	stored := storedBlock{Block: new(Block)}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	stored.Block.TxHashes = stored.TxHashes
+	stored.Block.Pruned = stored.Pruned
+	return stored.Block, nil
+}
+
+// pruned returns a copy of block without transactions and receipts. The
+// header and the transaction hashes are kept, so the chain can still be
+// verified up to the transactions root and pruned transactions can be told
+// apart from unknown ones.
+func (b *Block) pruned() *Block {
+	hashes := make([][32]byte, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		hashes[i] = tx.Hash
+	}
+	return &Block{
+		Header:   b.Header,
+		TxHashes: hashes,
+		Pruned:   true,
+	}
+}
+
+// pruneBlocks drops the transactions and receipts of the blocks more than
+// PruneBlocks below head. Blocks whose state is not flushed are kept, they
+// may have to be replayed after a crash. Must be called with bc.insertMu
+// held.
+func (bc *Blockchain) pruneBlocks(head *Block) error {
+	distance := bc.config.PruneBlocks
+	if distance == 0 {
+		return nil
+	}
+	if distance < MinPruneDistance {
+		distance = MinPruneDistance
+	}
+	if head.Header.Number <= distance {
+		return nil
+	}
+	target := head.Header.Number - distance
+	if target > bc.lastFlushed {
+		target = bc.lastFlushed
+	}
+	if target <= bc.lastPruned {
+		return nil
+	}
+
+	// The genesis block is never pruned, it has no transactions anyway
+	var last *Block
+	for number := bc.lastPruned + 1; number <= target; number++ {
+		block := bc.GetBlockByNumber(number)
+		if block == nil || block.Pruned {
+			continue
+		}
+		pruned := block.pruned()
+		if err := bc.saveBlock(pruned); err != nil {
+			return fmt.Errorf("failed to prune block %d: %v", number, err)
+		}
+
+		bc.mu.Lock()
+		bc.blocks[pruned.Header.Hash] = pruned
+		bc.blockByNumber[number] = pruned
+		bc.mu.Unlock()
+		last = pruned
+	}
+
+	if last != nil {
+		if err := bc.writeBlockPointer(prunedKey, last); err != nil {
+			return err
+		}
+		log.Debugf("Pruned blocks %d to %d", bc.lastPruned+1, target)
+	}
+	bc.mu.Lock()
+	bc.lastPruned = target
+	bc.mu.Unlock()
+	return nil
+}
+
+// PrunedTransactionBlock returns the number of the pruned block that
+// included the transaction, and false if no pruned block did
+func (bc *Blockchain) PrunedTransactionBlock(hash [32]byte) (uint64, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	for number := uint64(1); number <= bc.lastPruned; number++ {
+		block := bc.blockByNumber[number]
+		if block == nil || !block.Pruned {
+			continue
+		}
+		for _, txHash := range block.TxHashes {
+			if txHash == hash {
+				return number, true
+			}
+		}
+	}
+	return 0, false
+}
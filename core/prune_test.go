@@ -0,0 +1,60 @@
+package core
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestStoredBlockKeepsPruningState(t *testing.T) {
+	block := &Block{
+		Header:   &BlockHeader{Number: 7, Difficulty: big.NewInt(1)},
+		TxHashes: [][32]byte{{1}, {2}},
+		Pruned:   true,
+	}
+
+	data, err := encodeStoredBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeStoredBlock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Pruned || len(decoded.TxHashes) != 2 || decoded.TxHashes[1] != block.TxHashes[1] {
+		t.Errorf("pruning state lost: pruned %v, hashes %x", decoded.Pruned, decoded.TxHashes)
+	}
+	if decoded.Header == nil || decoded.Header.Number != 7 {
+		t.Errorf("header lost: %+v", decoded.Header)
+	}
+}
+
+func TestBlockJSONOmitsPruningState(t *testing.T) {
+	block := &Block{
+		Header:   &BlockHeader{Number: 7, Difficulty: big.NewInt(1)},
+		TxHashes: [][32]byte{{1}},
+		Pruned:   true,
+	}
+	data, err := block.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"pruned", "txHashes"} {
+		if _, ok := fields[field]; ok {
+			t.Errorf("block JSON includes %s", field)
+		}
+	}
+
+	// A peer can't mark the block it sends as pruned
+	var received Block
+	if err := json.Unmarshal([]byte(`{"header":{"number":7},"pruned":true,"txHashes":["0x01"]}`), &received); err != nil {
+		t.Fatal(err)
+	}
+	if received.Pruned || received.TxHashes != nil {
+		t.Errorf("received block marked pruned: %v %x", received.Pruned, received.TxHashes)
+	}
+}
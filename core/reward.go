@@ -0,0 +1,50 @@
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// blockReward is credited to the coinbase of every block
+var blockReward = big.NewInt(2e18)
+
+// RewardPolicy decides which of the configured reward recipients a mined
+// block pays
+type RewardPolicy string
+
+const (
+	// RewardRoundRobin pays the recipients in turn, one block each
+	RewardRoundRobin RewardPolicy = "round-robin"
+	// RewardWeighted pays each recipient a run of blocks as long as its weight
+	RewardWeighted RewardPolicy = "weighted"
+)
+
+// RewardRecipient is an address block rewards are paid to. Weight is only
+// used by RewardWeighted.
+type RewardRecipient struct {
+	Address common.Address
+	Weight  uint64
+}
+
+// selectRewardRecipient returns the recipient of the reward of block number.
+// The choice only depends on the block number, so the rotation continues
+// where it left off after a restart.
+func selectRewardRecipient(recipients []RewardRecipient, policy RewardPolicy, number uint64) common.Address {
+	if policy == RewardWeighted {
+		var total uint64
+		for _, recipient := range recipients {
+			total += recipient.Weight
+		}
+		if total > 0 {
+			slot := number % total
+			for _, recipient := range recipients {
+				if slot < recipient.Weight {
+					return recipient.Address
+				}
+				slot -= recipient.Weight
+			}
+		}
+	}
+	return recipients[number%uint64(len(recipients))].Address
+}
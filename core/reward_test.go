@@ -0,0 +1,46 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRewardRecipientRotation(t *testing.T) {
+	bc := openTestChain(t, t.TempDir(), nil)
+	defer bc.Close()
+	recipients := []RewardRecipient{
+		{Address: common.Address{0x0a}, Weight: 1},
+		{Address: common.Address{0x0b}, Weight: 2},
+		{Address: common.Address{0x0c}, Weight: 1},
+	}
+	config := bc.GetConfig()
+	config.RewardRecipients = recipients
+	config.MineEmptyBlocks = true
+	miner := NewMiner(bc, "0x0000000000000000000000000000000000000001")
+
+	// Round robin pays each recipient in turn by block number
+	for number := uint64(1); number <= 3; number++ {
+		miner.mineBlock()
+		if head := bc.GetCurrentBlock().Header.Number; head != number {
+			t.Fatalf("head at block %d, expected %d", head, number)
+		}
+	}
+	expected := []common.Address{recipients[1].Address, recipients[2].Address, recipients[0].Address}
+	for i, address := range expected {
+		if balance := bc.GetStateDB().GetBalance(address); balance.Cmp(big.NewInt(2e18)) != 0 {
+			t.Errorf("recipient %d has balance %v after block %d, expected one reward", i, balance, i+1)
+		}
+	}
+
+	// Weighted gives each recipient a run of blocks as long as its weight
+	weighted := []common.Address{
+		recipients[0].Address, recipients[1].Address, recipients[1].Address, recipients[2].Address, recipients[0].Address,
+	}
+	for number, address := range weighted {
+		if got := selectRewardRecipient(recipients, RewardWeighted, uint64(number)); got != address {
+			t.Errorf("block %d pays %x, expected %x", number, got, address)
+		}
+	}
+}
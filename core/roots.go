@@ -0,0 +1,114 @@
+package core
+
+import (
+	"blockchain-node/trie"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+// receiptRootFields are the parts of a receipt committed to by the receipts
+// root. The block hash and number are left out, the header depends on them.
+type receiptRootFields struct {
+	Status            uint64          `json:"status"`
+	GasUsed           uint64          `json:"gasUsed"`
+	CumulativeGasUsed uint64          `json:"cumulativeGasUsed"`
+	ContractAddress   *common.Address `json:"contractAddress"`
+	LogsBloom         ethTypes.Bloom  `json:"logsBloom"`
+	Logs              []logRootFields `json:"logs"`
+}
+
+type logRootFields struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    []byte         `json:"data"`
+}
+
+// DeriveTxRoot returns the root of a trie mapping each transaction's index
+// in the block to its encoding. The encoding has big integers as JSON
+// numbers, as before they were hex encoded, so existing roots stay valid.
+func DeriveTxRoot(txs []*Transaction) ([32]byte, error) {
+	values := make([][]byte, len(txs))
+	for i, tx := range txs {
+		data, err := json.Marshal((*transactionFields)(tx))
+		if err != nil {
+			return [32]byte{}, fmt.Errorf("failed to encode transaction %d: %v", i, err)
+		}
+		values[i] = data
+	}
+	return deriveRoot(values)
+}
+
+// DeriveReceiptRoot returns the root of a trie mapping each receipt's index
+// in the block to the encoding of its consensus fields
+func DeriveReceiptRoot(receipts []*TransactionReceipt) ([32]byte, error) {
+	values := make([][]byte, len(receipts))
+	for i, receipt := range receipts {
+		fields := receiptRootFields{
+			Status:            receipt.Status,
+			GasUsed:           receipt.GasUsed,
+			CumulativeGasUsed: receipt.CumulativeGasUsed,
+			ContractAddress:   receipt.ContractAddress,
+			LogsBloom:         receipt.LogsBloom,
+			Logs:              make([]logRootFields, len(receipt.Logs)),
+		}
+		for j, receiptLog := range receipt.Logs {
+			fields.Logs[j] = logRootFields{
+				Address: receiptLog.Address,
+				Topics:  receiptLog.Topics,
+				Data:    receiptLog.Data,
+			}
+		}
+
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return [32]byte{}, fmt.Errorf("failed to encode receipt %d: %v", i, err)
+		}
+		values[i] = data
+	}
+	return deriveRoot(values)
+}
+
+func deriveRoot(values [][]byte) ([32]byte, error) {
+	t, err := trie.NewTrie([32]byte{}, nil)
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	for i, value := range values {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(i))
+		if err := t.Update(key, value); err != nil {
+			return [32]byte{}, err
+		}
+	}
+
+	return t.Hash()
+}
+
+// checkGasUsed checks that the cumulative gas of each receipt adds its gas
+// used to the one before, and that the last one is gasUsed, the gas used of
+// the block's header
+func checkGasUsed(receipts []*TransactionReceipt, gasUsed uint64) error {
+	cumulative := uint64(0)
+	for i, receipt := range receipts {
+		cumulative += receipt.GasUsed
+		if receipt.CumulativeGasUsed != cumulative {
+			return fmt.Errorf("%w: receipt %d cumulative gas %d, expected %d", ErrGasUsedMismatch, i, receipt.CumulativeGasUsed, cumulative)
+		}
+	}
+	if cumulative != gasUsed {
+		return fmt.Errorf("%w: header %d, receipts %d", ErrGasUsedMismatch, gasUsed, cumulative)
+	}
+	return nil
+}
+
+var (
+	ErrTxRootMismatch      = errors.New("transactions root mismatch")
+	ErrReceiptRootMismatch = errors.New("receipts root mismatch")
+	ErrGasUsedMismatch     = errors.New("gas used mismatch")
+)
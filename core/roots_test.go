@@ -0,0 +1,88 @@
+package core
+
+import (
+	"blockchain-node/consensus"
+	"blockchain-node/crypto"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestTamperedTransactionRoot(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PrivateKeyToAddress(key)
+	alloc := map[[20]byte]*big.Int{from: big.NewInt(1e18)}
+
+	miner := openTestChain(t, t.TempDir(), alloc)
+	defer miner.Close()
+	block := mineTestTxs(t, miner, []*Transaction{signedTransfer(t, key, 0, 1)})
+	if root, err := DeriveTxRoot(block.Transactions); err != nil || root != block.Header.TxHash {
+		t.Fatalf("header transactions root %x, derived %x: %v", block.Header.TxHash, root, err)
+	}
+
+	// A validly signed transaction swapped in keeps the header and its proof
+	// of work, only the transactions root gives it away
+	bc := openTestChain(t, t.TempDir(), alloc)
+	defer bc.Close()
+	tampered := *block
+	tampered.Transactions = []*Transaction{signedTransfer(t, key, 0, 2)}
+	if err := bc.AddBlock(&tampered); !errors.Is(err, ErrTxRootMismatch) {
+		t.Fatalf("tampered block: error %v, expected %v", err, ErrTxRootMismatch)
+	}
+	if err := bc.AddBlock(block); err != nil {
+		t.Errorf("original block rejected: %v", err)
+	}
+}
+
+func TestCumulativeGasUsed(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alloc := map[[20]byte]*big.Int{crypto.PrivateKeyToAddress(key): big.NewInt(1e18)}
+
+	miner := openTestChain(t, t.TempDir(), alloc)
+	defer miner.Close()
+	txs := []*Transaction{signedTransfer(t, key, 0, 1), signedTransfer(t, key, 1, 1), signedTransfer(t, key, 2, 1)}
+	block := mineTestTxs(t, miner, txs)
+	for i, receipt := range block.Receipts {
+		if receipt.GasUsed != 21000 || receipt.CumulativeGasUsed != uint64(i+1)*21000 {
+			t.Errorf("receipt %d: gas used %d, cumulative %d", i, receipt.GasUsed, receipt.CumulativeGasUsed)
+		}
+	}
+	if last := block.Receipts[len(block.Receipts)-1]; last.CumulativeGasUsed != block.Header.GasUsed {
+		t.Errorf("cumulative gas %d, header gas used %d", last.CumulativeGasUsed, block.Header.GasUsed)
+	}
+
+	// A header claiming other gas used is rejected, even with a valid proof
+	// of work
+	bc := openTestChain(t, t.TempDir(), alloc)
+	defer bc.Close()
+	header := *block.Header
+	header.GasUsed += 21000
+	tampered := *block
+	tampered.Header = &header
+	pow := consensus.NewProofOfWork()
+	pow.SetHasher(bc.PoWHasher())
+	if err := pow.MineBlock(&tampered); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(&tampered); !errors.Is(err, ErrGasUsedMismatch) {
+		t.Fatalf("tampered block: error %v, expected %v", err, ErrGasUsedMismatch)
+	}
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatalf("original block rejected: %v", err)
+	}
+
+	// Stored receipts that don't add up are found by verification
+	bc.GetBlockByNumber(1).Receipts[1].CumulativeGasUsed++
+	err = bc.VerifyChain(false, nil)
+	var fault *ChainFault
+	if !errors.As(err, &fault) || fault.Number != 1 || !strings.Contains(fault.Reason, ErrGasUsedMismatch.Error()) {
+		t.Errorf("verification error %v, expected a gas used fault in block 1", err)
+	}
+}
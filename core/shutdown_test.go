@@ -0,0 +1,82 @@
+package core
+
+import (
+	"blockchain-node/crypto"
+	"blockchain-node/interfaces"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// blockingVM is a virtual machine that signals started when it executes a
+// transaction and doesn't finish until release is closed
+type blockingVM struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (vm *blockingVM) ExecuteTransaction(ctx *interfaces.ExecutionContext) (*interfaces.ExecutionResult, error) {
+	vm.started <- struct{}{}
+	<-vm.release
+	return &interfaces.ExecutionResult{GasUsed: 21000, Status: 1}, nil
+}
+
+func TestAddBlockDuringClose(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	alloc := map[[20]byte]*big.Int{crypto.PrivateKeyToAddress(key): big.NewInt(1e18)}
+	bc := openTestChain(t, dir, alloc)
+
+	// A block being executed when Close is called is committed first
+	tx := signedTransfer(t, key, 0, 1)
+	block := sealTestTxs(t, bc, []*Transaction{tx})
+	vm := &blockingVM{started: make(chan struct{}, 1), release: make(chan struct{})}
+	bc.SetVirtualMachine(vm)
+
+	added := make(chan error, 1)
+	go func() { added <- bc.AddBlock(block) }()
+	<-vm.started
+	closed := make(chan error, 1)
+	go func() { closed <- bc.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("chain closed during block insertion")
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(vm.release)
+	if err := <-added; err != nil {
+		t.Fatalf("block being inserted at close failed: %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+
+	bc = openTestChain(t, dir, alloc)
+	if head := bc.GetCurrentBlock(); head.Header.Hash != block.Header.Hash {
+		t.Fatalf("head block %d after restart, expected block %d", head.Header.Number, block.Header.Number)
+	}
+	if found, _, _ := bc.GetTransaction(tx.Hash); found == nil {
+		t.Error("transaction of the committed block lost")
+	}
+
+	// A block added after Close is refused and nothing of it is written
+	next := sealTestTxs(t, bc, []*Transaction{signedTransfer(t, key, 1, 1)})
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(next); err != ErrChainClosed {
+		t.Fatalf("block added after close: error %v, expected %v", err, ErrChainClosed)
+	}
+
+	bc = openTestChain(t, dir, alloc)
+	defer bc.Close()
+	if head := bc.GetCurrentBlock(); head.Header.Hash != block.Header.Hash {
+		t.Errorf("head block %d after restart, expected block %d", head.Header.Number, block.Header.Number)
+	}
+	if stored := bc.GetBlockByNumber(next.Header.Number); stored != nil {
+		t.Errorf("block %d refused at close was stored", next.Header.Number)
+	}
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"blockchain-node/state"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// StateSnapshot is a full copy of the world state at a block, used to
+// bootstrap a node without replaying the chain from genesis.
+type StateSnapshot struct {
+	ChainID  uint64               `json:"chainId"`
+	Block    *Block               `json:"block"`
+	Accounts []*state.DumpAccount `json:"accounts"`
+}
+
+// StateAt opens the state as of the given block number
+func (bc *Blockchain) StateAt(number uint64) (*state.StateDB, *Block, error) {
+	block := bc.GetBlockByNumber(number)
+	if block == nil {
+		return nil, nil, fmt.Errorf("block %d not found", number)
+	}
+
+	bc.mu.RLock()
+	fetcher := bc.nodeFetcher
+	bc.mu.RUnlock()
+
+	stateDB, err := state.NewStateDBWithFetcher(block.Header.StateRoot, bc.stateStore, fetcher)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open state at block %d: %w", number, err)
+	}
+	return stateDB, block, nil
+}
+
+// Snapshot returns a copy of the state at the given block number
+func (bc *Blockchain) Snapshot(number uint64) (*StateSnapshot, error) {
+	stateDB, block, err := bc.StateAt(number)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := stateDB.Dump()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump state at block %d: %v", number, err)
+	}
+
+	return &StateSnapshot{
+		ChainID:  bc.config.ChainID,
+		Block:    block,
+		Accounts: accounts,
+	}, nil
+}
+
+// ExportState writes the state at the given block number to a snapshot file
+func (bc *Blockchain) ExportState(number uint64, path string) (*Block, error) {
+	snapshot, err := bc.Snapshot(number)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %v", err)
+	}
+
+	log.Infof("Exported state of block %d (%d accounts) to %s", number, len(snapshot.Accounts), path)
+	return snapshot.Block, nil
+}
+
+// ImportState loads a snapshot file and imports it with ImportSnapshot
+func (bc *Blockchain) ImportState(path string) (*Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+
+	var snapshot StateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %v", err)
+	}
+
+	block, err := bc.ImportSnapshot(&snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Imported state of block %d (%d accounts) from %s", block.Header.Number, len(snapshot.Accounts), path)
+	return block, nil
+}
+
+// ImportSnapshot rebuilds the state of a snapshot and, once its root matches
+// the snapshot block's state root, makes that block the chain head.
+func (bc *Blockchain) ImportSnapshot(snapshot *StateSnapshot) (*Block, error) {
+	return bc.ImportSnapshotWithHeaders(snapshot, nil)
+}
+
+// ImportSnapshotWithHeaders is ImportSnapshot for a fast sync. headers are
+// the verified headers between the chain head and the snapshot block, they
+// are stored as pruned blocks so the chain stays contiguous from genesis.
+func (bc *Blockchain) ImportSnapshotWithHeaders(snapshot *StateSnapshot, headers []*BlockHeader) (*Block, error) {
+	if snapshot.ChainID != bc.config.ChainID {
+		return nil, fmt.Errorf("snapshot chain ID mismatch: expected %d, got %d", bc.config.ChainID, snapshot.ChainID)
+	}
+
+	block := snapshot.Block
+	if block == nil || block.Header == nil {
+		return nil, errors.New("snapshot has no block")
+	}
+
+	stateDB, root, err := state.LoadDump(snapshot.Accounts, bc.stateStore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshot state: %v", err)
+	}
+	if root != block.Header.StateRoot {
+		return nil, fmt.Errorf("snapshot state root mismatch: expected %x, computed %x", block.Header.StateRoot, root)
+	}
+
+	bc.insertMu.Lock()
+	defer bc.insertMu.Unlock()
+	if bc.closed {
+		return nil, ErrChainClosed
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if existing := bc.blockByNumber[block.Header.Number]; existing != nil && existing.Header.Hash != block.Header.Hash {
+		return nil, fmt.Errorf("snapshot block %d conflicts with local block %x", block.Header.Number, existing.Header.Hash)
+	}
+	if len(headers) > 0 {
+		if err := linkHeaders(bc.currentBlock.Header, headers, block.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, header := range headers {
+		headerBlock := &Block{Header: header, Pruned: true}
+		bc.blocks[header.Hash] = headerBlock
+		bc.blockByNumber[header.Number] = headerBlock
+		if err := bc.saveBlock(headerBlock); err != nil {
+			return nil, err
+		}
+	}
+
+	bc.blocks[block.Header.Hash] = block
+	bc.blockByNumber[block.Header.Number] = block
+	bc.currentBlock = block
+	stateDB.SetNodeFetcher(bc.nodeFetcher)
+	bc.stateDB = stateDB
+	bc.blockTimes.add(block)
+	reportSyncStatus(bc.syncStatus())
+	reportBlockTimes(bc.blockTimes.stats())
+
+	if err := bc.saveBlock(block); err != nil {
+		return nil, err
+	}
+	if err := bc.writeChainHead(block); err != nil {
+		return nil, err
+	}
+	if err := bc.flushState(block, true); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// linkHeaders checks that headers connect head with the block after them
+func linkHeaders(head *BlockHeader, headers []*BlockHeader, next *BlockHeader) error {
+	parent := head
+	for i := 0; i <= len(headers); i++ {
+		header := next
+		if i < len(headers) {
+			header = headers[i]
+		}
+		if header.Number != parent.Number+1 || header.ParentHash != parent.Hash {
+			return fmt.Errorf("header %d does not link to block %d", header.Number, parent.Number)
+		}
+		parent = header
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package core
+
+import "testing"
+
+func TestLinkHeaders(t *testing.T) {
+	chain := make([]*BlockHeader, 5)
+	for i := range chain {
+		chain[i] = &BlockHeader{Number: uint64(i), Hash: [32]byte{byte(i + 1)}}
+		if i > 0 {
+			chain[i].ParentHash = chain[i-1].Hash
+		}
+	}
+
+	if err := linkHeaders(chain[0], chain[1:4], chain[4]); err != nil {
+		t.Errorf("linked headers rejected: %v", err)
+	}
+	if err := linkHeaders(chain[0], nil, chain[1]); err != nil {
+		t.Errorf("block after the head rejected: %v", err)
+	}
+	if err := linkHeaders(chain[0], []*BlockHeader{chain[1], chain[3]}, chain[4]); err == nil {
+		t.Error("headers with a gap accepted")
+	}
+	if err := linkHeaders(chain[0], chain[1:3], chain[4]); err == nil {
+		t.Error("headers not reaching the snapshot block accepted")
+	}
+
+	forked := *chain[2]
+	forked.ParentHash = [32]byte{0xff}
+	if err := linkHeaders(chain[0], []*BlockHeader{chain[1], &forked, chain[3]}, chain[4]); err == nil {
+		t.Error("header with a foreign parent accepted")
+	}
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"blockchain-node/database"
+	"fmt"
+	"time"
+)
+
+// stateFlushedKey is the database key of the pointer to the last block whose
+// state was completely flushed to disk
+const stateFlushedKey = "stateflushed"
+
+// flushState writes the buffered state to disk once StateFlushInterval blocks
+// were added since the last flush, or in any case if force is set, and
+// records block as the last block whose state is on disk. Without periodic
+// flushing the state is written with every block and nothing is done. Must
+// be called with bc.insertMu held.
+func (bc *Blockchain) flushState(block *Block, force bool) error {
+	if bc.stateBuffer == nil {
+		return nil
+	}
+	if !force && block.Header.Number < bc.lastFlushed+bc.config.StateFlushInterval {
+		return nil
+	}
+
+	start := time.Now()
+	written, err := bc.stateBuffer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush state: %v", err)
+	}
+	if err := bc.writeBlockPointer(stateFlushedKey, block); err != nil {
+		return err
+	}
+	bc.lastFlushed = block.Header.Number
+
+	log.Debugf("Flushed %d state entries at block %d in %v", written, block.Header.Number, time.Since(start))
+	return nil
+}
+
+// ReplayBlocks executes again the blocks stored after the last state flush
+// of the previous run, whose state was lost when the node stopped without
+// flushing it, and makes the last of them the chain head again. It must be
+// called once the consensus engine and virtual machine are set.
+func (bc *Blockchain) ReplayBlocks() error {
+	bc.insertMu.Lock()
+	defer bc.insertMu.Unlock()
+	if bc.closed {
+		return ErrChainClosed
+	}
+
+	blocks := bc.replay
+	bc.replay = nil
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	log.Infof("Replaying blocks %d to %d, their state was not flushed", blocks[0].Header.Number, blocks[len(blocks)-1].Header.Number)
+	for _, block := range blocks {
+		if err := bc.insertBlock(block, ""); err != nil {
+			return fmt.Errorf("failed to replay block %d: %v", block.Header.Number, err)
+		}
+	}
+	return nil
+}
+
+// StateDatabase returns the database the state is stored in. With periodic
+// state flushing it includes the state that is not flushed yet.
+func (bc *Blockchain) StateDatabase() database.Database {
+	return bc.stateStore
+}
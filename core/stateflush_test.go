@@ -0,0 +1,62 @@
+package core
+
+import (
+	"blockchain-node/database"
+	"blockchain-node/state"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// countingDB counts the writes that reach a database
+type countingDB struct {
+	*database.MemoryDB
+	writes int
+}
+
+func (c *countingDB) Put(key []byte, value []byte) error {
+	c.writes++
+	return c.MemoryDB.Put(key, value)
+}
+
+func (c *countingDB) Delete(key []byte) error {
+	c.writes++
+	return c.MemoryDB.Delete(key)
+}
+
+// BenchmarkStateFlush commits the state of blocks that each update the same
+// accounts, and reports how many database writes a block costs when the state
+// is flushed every interval blocks
+func BenchmarkStateFlush(b *testing.B) {
+	for _, interval := range []int{1, 16} {
+		b.Run(fmt.Sprintf("interval-%d", interval), func(b *testing.B) {
+			disk := &countingDB{MemoryDB: database.NewMemoryDB()}
+			var store database.Database = disk
+			var buffer *database.BufferedDB
+			if interval > 1 {
+				buffer = database.NewBufferedDB(disk)
+				store = buffer
+			}
+			stateDB, err := state.NewStateDB([32]byte{}, store)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for account := byte(0); account < 100; account++ {
+					stateDB.AddBalance([20]byte{account}, big.NewInt(1))
+				}
+				if _, err := stateDB.Commit(); err != nil {
+					b.Fatal(err)
+				}
+				if buffer != nil && (i+1)%interval == 0 {
+					if _, err := buffer.Flush(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(disk.writes)/float64(b.N), "writes/block")
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"blockchain-node/consensus"
+	"blockchain-node/metrics"
+	"fmt"
+)
+
+// SyncStatus describes how far the local chain is behind the best known peer
+type SyncStatus struct {
+	Syncing      bool   `json:"syncing"`
+	CurrentBlock uint64 `json:"currentBlock"`
+	HighestBlock uint64 `json:"highestBlock"`
+}
+
+// UpdateHighestBlock records a block height announced by a peer
+func (bc *Blockchain) UpdateHighestBlock(number uint64) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if number > bc.highestBlock {
+		bc.highestBlock = number
+		reportSyncStatus(bc.syncStatus())
+	}
+}
+
+// GetSyncStatus reports whether the chain is behind the highest block seen
+func (bc *Blockchain) GetSyncStatus() SyncStatus {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.syncStatus()
+}
+
+// syncStatus computes the sync status, bc.mu must be held
+func (bc *Blockchain) syncStatus() SyncStatus {
+	status := SyncStatus{HighestBlock: bc.highestBlock}
+	if bc.currentBlock != nil {
+		status.CurrentBlock = bc.currentBlock.Header.Number
+	}
+	if status.HighestBlock < status.CurrentBlock {
+		status.HighestBlock = status.CurrentBlock
+	}
+	status.Syncing = status.HighestBlock > status.CurrentBlock
+
+	return status
+}
+
+// reportSyncStatus publishes status to the metrics
+func reportSyncStatus(status SyncStatus) {
+	metrics.GetMetrics().SetSyncStatus(status.Syncing, status.CurrentBlock, status.HighestBlock)
+}
+
+// VerifyHeaders checks that headers form a chain extending parent and that
+// each header carries the difficulty following from its parent and a valid
+// proof of work at it, so a cheaper chain can't be passed off. Only the
+// headers are checked, the blocks' transactions and state are not.
+func (bc *Blockchain) VerifyHeaders(parent *BlockHeader, headers []*BlockHeader) error {
+	for _, header := range headers {
+		if header == nil {
+			return fmt.Errorf("malformed header after block %d", parent.Number)
+		}
+		if err := consensus.CheckDifficulty(header.Difficulty); err != nil {
+			return fmt.Errorf("header %d: %v", header.Number, err)
+		}
+		if header.Number != parent.Number+1 || header.ParentHash != parent.Hash {
+			return fmt.Errorf("header %d does not extend block %d", header.Number, parent.Number)
+		}
+
+		block := &Block{Header: header}
+		if block.CalculateHash() != header.Hash {
+			return fmt.Errorf("header %d hash mismatch", header.Number)
+		}
+		if bc.consensus != nil {
+			expected := bc.consensus.CalculateDifficulty(block, &Block{Header: parent})
+			if header.Difficulty.Cmp(expected) != 0 {
+				return fmt.Errorf("header %d difficulty %v, expected %v", header.Number, header.Difficulty, expected)
+			}
+		}
+		if bc.consensus != nil && !bc.consensus.ValidateProofOfWork(block) {
+			return fmt.Errorf("invalid proof of work for header %d", header.Number)
+		}
+
+		parent = header
+	}
+	return nil
+}
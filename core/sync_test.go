@@ -0,0 +1,65 @@
+package core
+
+import (
+	"blockchain-node/consensus"
+	"math/big"
+	"testing"
+)
+
+// sealHeaders returns n headers on top of parent mined at the difficulty
+// returned by difficulty for each of them
+func sealHeaders(t *testing.T, pow *consensus.ProofOfWork, parent *BlockHeader, n int, difficulty func(block, parent *Block) *big.Int) []*BlockHeader {
+	t.Helper()
+	headers := make([]*BlockHeader, n)
+	for i := range headers {
+		block := &Block{Header: &BlockHeader{
+			Number:     parent.Number + 1,
+			ParentHash: parent.Hash,
+			Timestamp:  parent.Timestamp + 15,
+			GasLimit:   8000000,
+		}}
+		block.Header.Difficulty = difficulty(block, &Block{Header: parent})
+		if err := pow.MineBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		headers[i] = block.Header
+		parent = block.Header
+	}
+	return headers
+}
+
+func TestVerifyHeadersDifficulty(t *testing.T) {
+	bc := openTestChain(t, t.TempDir(), nil)
+	defer bc.Close()
+	pow := consensus.NewProofOfWork()
+	pow.SetHasher(bc.PoWHasher())
+	bc.SetConsensus(pow)
+	genesis := bc.GetBlockByNumber(0).Header
+
+	// Past the difficulty window the fast blocks raise the difficulty
+	const n = consensus.DifficultyWindow + 2
+	headers := sealHeaders(t, pow, genesis, n, func(block, parent *Block) *big.Int {
+		return pow.CalculateDifficulty(block, parent)
+	})
+	if err := bc.VerifyHeaders(genesis, headers); err != nil {
+		t.Fatalf("honest headers rejected: %v", err)
+	}
+
+	// A chain of difficulty 1 headers has a valid proof of work at that
+	// difficulty but costs next to nothing to forge
+	forged := sealHeaders(t, pow, genesis, n, func(*Block, *Block) *big.Int {
+		return big.NewInt(1)
+	})
+	if err := bc.VerifyHeaders(genesis, forged); err == nil {
+		t.Error("forged low difficulty headers accepted")
+	}
+
+	// Dropping the difficulty only once the window is reached is caught too
+	tampered := append([]*BlockHeader{}, headers[:consensus.DifficultyWindow-1]...)
+	tampered = append(tampered, sealHeaders(t, pow, tampered[len(tampered)-1], 3, func(block, parent *Block) *big.Int {
+		return new(big.Int).Set(parent.Header.Difficulty)
+	})...)
+	if err := bc.VerifyHeaders(genesis, tampered); err == nil {
+		t.Error("headers keeping the difficulty past the window accepted")
+	}
+}
@@ -1,9 +1,9 @@
-
 package core
 
 import (
 	"blockchain-node/crypto"
 	"encoding/json"
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -12,30 +12,31 @@ import (
 )
 
 type Transaction struct {
-	Nonce    uint64           `json:"nonce"`
-	To       *common.Address  `json:"to"`
-	Value    *big.Int         `json:"value"`
-	GasLimit uint64           `json:"gasLimit"`
-	GasPrice *big.Int         `json:"gasPrice"`
-	Data     []byte           `json:"data"`
-	V        *big.Int         `json:"v"`
-	R        *big.Int         `json:"r"`
-	S        *big.Int         `json:"s"`
-	Hash     [32]byte         `json:"hash"`
-	From     common.Address   `json:"from"`
+	Nonce    uint64          `json:"nonce"`
+	To       *common.Address `json:"to"`
+	Value    *big.Int        `json:"value"`
+	GasLimit uint64          `json:"gasLimit"`
+	GasPrice *big.Int        `json:"gasPrice"`
+	Data     []byte          `json:"data"`
+	V        *big.Int        `json:"v"`
+	R        *big.Int        `json:"r"`
+	S        *big.Int        `json:"s"`
+	Hash     [32]byte        `json:"hash"`
+	From     common.Address  `json:"from"`
 }
 
 // Implement validation interfaces
-func (tx *Transaction) GetHash() [32]byte { return tx.Hash }
+func (tx *Transaction) GetHash() [32]byte       { return tx.Hash }
+func (tx *Transaction) GetNonce() uint64        { return tx.Nonce }
 func (tx *Transaction) GetFrom() common.Address { return tx.From }
-func (tx *Transaction) GetTo() *common.Address { return tx.To }
-func (tx *Transaction) GetValue() *big.Int { return tx.Value }
-func (tx *Transaction) GetGasPrice() *big.Int { return tx.GasPrice }
-func (tx *Transaction) GetGasLimit() uint64 { return tx.GasLimit }
-func (tx *Transaction) GetData() []byte { return tx.Data }
-func (tx *Transaction) GetV() *big.Int { return tx.V }
-func (tx *Transaction) GetR() *big.Int { return tx.R }
-func (tx *Transaction) GetS() *big.Int { return tx.S }
+func (tx *Transaction) GetTo() *common.Address  { return tx.To }
+func (tx *Transaction) GetValue() *big.Int      { return tx.Value }
+func (tx *Transaction) GetGasPrice() *big.Int   { return tx.GasPrice }
+func (tx *Transaction) GetGasLimit() uint64     { return tx.GasLimit }
+func (tx *Transaction) GetData() []byte         { return tx.Data }
+func (tx *Transaction) GetV() *big.Int          { return tx.V }
+func (tx *Transaction) GetR() *big.Int          { return tx.R }
+func (tx *Transaction) GetS() *big.Int          { return tx.S }
 
 func NewTransaction(nonce uint64, to *common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte) *Transaction {
 	tx := &Transaction{
@@ -46,51 +47,75 @@ func NewTransaction(nonce uint64, to *common.Address, value *big.Int, gasLimit u
 		GasPrice: gasPrice,
 		Data:     data,
 	}
-	
+
 	tx.Hash = tx.CalculateHash()
 	return tx
 }
 
 func (tx *Transaction) CalculateHash() [32]byte {
 	data := make([]byte, 0, 256)
-	
+
 	// Nonce (8 bytes)
 	nonceBytes := make([]byte, 8)
 	for i := 0; i < 8; i++ {
 		nonceBytes[7-i] = byte(tx.Nonce >> (i * 8))
 	}
 	data = append(data, nonceBytes...)
-	
+
 	// To address (20 bytes, or empty if nil)
 	if tx.To != nil {
 		data = append(data, tx.To.Bytes()...)
 	} else {
 		data = append(data, make([]byte, 20)...)
 	}
-	
+
 	// Value
 	if tx.Value != nil {
 		data = append(data, tx.Value.Bytes()...)
 	}
-	
+
 	// Gas limit (8 bytes)
 	gasLimitBytes := make([]byte, 8)
 	for i := 0; i < 8; i++ {
 		gasLimitBytes[7-i] = byte(tx.GasLimit >> (i * 8))
 	}
 	data = append(data, gasLimitBytes...)
-	
+
 	// Gas price
 	if tx.GasPrice != nil {
 		data = append(data, tx.GasPrice.Bytes()...)
 	}
-	
+
 	// Data
 	data = append(data, tx.Data...)
-	
+
 	return crypto.SHA256Hash(data)
 }
 
+// Sign signs the transaction with the given private key, setting the sender
+// and an EIP-155 replay-protected V value for the chain id.
+func (tx *Transaction) Sign(privateKey []byte, chainID uint64) error {
+	key, err := crypto.ToECDSA(privateKey)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %v", err)
+	}
+
+	tx.From = common.Address(crypto.PrivateKeyToAddress(key))
+	tx.Hash = tx.CalculateHash()
+
+	signature, err := crypto.Sign(tx.Hash[:], privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign transaction: %v", err)
+	}
+
+	recoveryID := uint64(signature[64] - 27)
+	tx.R = new(big.Int).SetBytes(signature[:32])
+	tx.S = new(big.Int).SetBytes(signature[32:64])
+	tx.V = new(big.Int).SetUint64(recoveryID + chainID*2 + 35)
+
+	return nil
+}
+
 func (tx *Transaction) VerifySignature() bool {
 	// Simplified signature verification
 	// In a real implementation, this would verify the ECDSA signature
@@ -109,12 +134,27 @@ func (tx *Transaction) IsContractCreation() bool {
 	return tx.To == nil
 }
 
+// Type returns the EIP-2718 transaction type. Only legacy transactions are
+// supported so far.
+func (tx *Transaction) Type() uint8 {
+	return ethTypes.LegacyTxType
+}
+
+// EffectiveGasPrice returns the price per gas the sender actually pays. For
+// legacy transactions this is the gas price.
+func (tx *Transaction) EffectiveGasPrice() *big.Int {
+	if tx.GasPrice == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(tx.GasPrice)
+}
+
 func (tx *Transaction) ToEthTransaction() *ethTypes.Transaction {
 	var to *common.Address
 	if tx.To != nil {
 		to = tx.To
 	}
-	
+
 	ethTx := ethTypes.NewTx(&ethTypes.LegacyTx{
 		Nonce:    tx.Nonce,
 		To:       to,
@@ -126,7 +166,7 @@ func (tx *Transaction) ToEthTransaction() *ethTypes.Transaction {
 		R:        tx.R,
 		S:        tx.S,
 	})
-	
+
 	return ethTx
 }
 
@@ -140,18 +180,33 @@ type TransactionReceipt struct {
 	ContractAddress   *common.Address `json:"contractAddress"`
 	GasUsed           uint64          `json:"gasUsed"`
 	CumulativeGasUsed uint64          `json:"cumulativeGasUsed"`
+	EffectiveGasPrice *big.Int        `json:"effectiveGasPrice"`
+	Type              uint8           `json:"type"`
 	Status            uint64          `json:"status"`
 	Logs              []*Log          `json:"logs"`
+	LogsBloom         ethTypes.Bloom  `json:"logsBloom"`
+}
+
+// CreateLogsBloom returns the bloom filter over the addresses and topics of logs
+func CreateLogsBloom(logs []*Log) ethTypes.Bloom {
+	var bloom ethTypes.Bloom
+	for _, log := range logs {
+		bloom.Add(log.Address.Bytes())
+		for _, topic := range log.Topics {
+			bloom.Add(topic.Bytes())
+		}
+	}
+	return bloom
 }
 
 type Log struct {
-	Address     common.Address   `json:"address"`
-	Topics      []common.Hash    `json:"topics"`
-	Data        []byte           `json:"data"`
-	BlockNumber uint64           `json:"blockNumber"`
-	TxHash      [32]byte         `json:"transactionHash"`
-	TxIndex     uint64           `json:"transactionIndex"`
-	BlockHash   [32]byte         `json:"blockHash"`
-	Index       uint64           `json:"logIndex"`
-	Removed     bool             `json:"removed"`
+	Address     common.Address `json:"address"`
+	Topics      []common.Hash  `json:"topics"`
+	Data        []byte         `json:"data"`
+	BlockNumber uint64         `json:"blockNumber"`
+	TxHash      [32]byte       `json:"transactionHash"`
+	TxIndex     uint64         `json:"transactionIndex"`
+	BlockHash   [32]byte       `json:"blockHash"`
+	Index       uint64         `json:"logIndex"`
+	Removed     bool           `json:"removed"`
 }
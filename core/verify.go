@@ -0,0 +1,185 @@
+package core
+
+import (
+	"blockchain-node/state"
+	"context"
+	"fmt"
+)
+
+// ChainFault is the first inconsistency found by VerifyChain
+type ChainFault struct {
+	Number uint64
+	Reason string
+}
+
+func (f *ChainFault) Error() string {
+	return fmt.Sprintf("block %d: %s", f.Number, f.Reason)
+}
+
+// VerifyChain walks the stored blocks from genesis to the head, checking that
+// each block links to its parent, hashes to its header hash, carries a valid
+// proof of work and matches its transactions root. If reexecute is set every
+// block is also executed on its parent's state and the resulting state root,
+// receipts root and gas used are compared with the header, which is much
+// slower. progress, if not nil, is called after each verified block. Of
+// pruned blocks only the header is checked.
+//
+// The first inconsistency is returned as a *ChainFault. The chain itself is
+// not modified.
+func (bc *Blockchain) VerifyChain(reexecute bool, progress func(number uint64)) error {
+	head := bc.GetCurrentBlock()
+	if head == nil {
+		return &ChainFault{Number: 0, Reason: "no genesis block"}
+	}
+
+	var parent *Block
+	for number := uint64(0); number <= head.Header.Number; number++ {
+		block := bc.GetBlockByNumber(number)
+		if block == nil || block.Header == nil {
+			return &ChainFault{Number: number, Reason: "block missing"}
+		}
+
+		if reason := bc.verifyStoredBlock(block, parent, reexecute); reason != "" {
+			return &ChainFault{Number: number, Reason: reason}
+		}
+
+		if progress != nil {
+			progress(number)
+		}
+		parent = block
+	}
+
+	// Without re-execution at least make sure the head state is readable
+	if !reexecute {
+		stateDB, err := state.NewStateDB(head.Header.StateRoot, bc.stateStore)
+		if err == nil {
+			_, err = stateDB.Dump()
+		}
+		if err != nil {
+			return &ChainFault{Number: head.Header.Number, Reason: fmt.Sprintf("state unreadable: %v", err)}
+		}
+	}
+
+	return nil
+}
+
+// verifyStoredBlock checks a block against its parent, nil for the genesis
+// block, and returns the reason it is inconsistent or "" if it isn't
+func (bc *Blockchain) verifyStoredBlock(block, parent *Block, reexecute bool) string {
+	header := block.Header
+	if parent == nil {
+		if header.Number != 0 {
+			return fmt.Sprintf("expected genesis block, found number %d", header.Number)
+		}
+		if header.Hash != bc.GetGenesisHash() {
+			return "genesis hash mismatch"
+		}
+	} else {
+		if header.Number != parent.Header.Number+1 {
+			return fmt.Sprintf("stored under wrong number %d", header.Number)
+		}
+		if header.ParentHash != parent.Header.Hash {
+			return fmt.Sprintf("parent hash %x does not match block %d hash %x", header.ParentHash, parent.Header.Number, parent.Header.Hash)
+		}
+	}
+
+	if hash := block.CalculateHash(); hash != header.Hash {
+		return fmt.Sprintf("header hash %x does not match computed hash %x", header.Hash, hash)
+	}
+	if parent != nil && bc.consensus != nil && !bc.consensus.ValidateProofOfWork(block) {
+		return "invalid proof of work"
+	}
+
+	// Only the header of a pruned block is left to check
+	if block.Pruned {
+		return ""
+	}
+
+	txRoot, err := DeriveTxRoot(block.Transactions)
+	if err != nil {
+		return err.Error()
+	}
+	if txRoot != header.TxHash {
+		return fmt.Sprintf("transactions root %x does not match computed %x", header.TxHash, txRoot)
+	}
+	if err := checkGasUsed(block.Receipts, header.GasUsed); err != nil {
+		return err.Error()
+	}
+
+	if !reexecute || parent == nil {
+		return ""
+	}
+	return bc.reexecuteBlock(block, parent)
+}
+
+// ReexecuteRange executes the blocks from..to again, each on the stored state
+// of its parent, and compares the resulting state root, gas used and receipts
+// root with the stored headers, e.g. to find divergence after a change to the
+// VM or gas model. Unlike VerifyChain it checks every block of the range and
+// returns all mismatches. The genesis block has no parent and is skipped.
+// Neither blocks nor states are modified. ctx is checked between blocks.
+func (bc *Blockchain) ReexecuteRange(ctx context.Context, from, to uint64) ([]*ChainFault, error) {
+	head := bc.GetCurrentBlock()
+	if head == nil {
+		return nil, fmt.Errorf("chain has no blocks")
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid range: block %d is after block %d", from, to)
+	}
+	if to > head.Header.Number {
+		return nil, fmt.Errorf("block %d is beyond the chain head %d", to, head.Header.Number)
+	}
+	if from == 0 {
+		from = 1
+	}
+
+	var faults []*ChainFault
+	for number := from; number <= to; number++ {
+		if err := ctx.Err(); err != nil {
+			return faults, err
+		}
+
+		block := bc.GetBlockByNumber(number)
+		parent := bc.GetBlockByNumber(number - 1)
+		if block == nil || parent == nil {
+			faults = append(faults, &ChainFault{Number: number, Reason: "block or parent missing"})
+			continue
+		}
+		if reason := bc.reexecuteBlock(block, parent); reason != "" {
+			faults = append(faults, &ChainFault{Number: number, Reason: reason})
+		}
+	}
+	return faults, nil
+}
+
+// reexecuteBlock executes block on its parent's state and returns the reason
+// the result differs from the stored header, or "" if it matches
+func (bc *Blockchain) reexecuteBlock(block, parent *Block) string {
+	if block.Pruned {
+		return "transactions were pruned"
+	}
+	header := block.Header
+
+	// Execute a copy, executeBlock fills in the header and receipts
+	replayHeader := *header
+	replay := &Block{Header: &replayHeader, Transactions: block.Transactions}
+	if _, err := bc.executeBlock(replay, parent); err != nil {
+		return fmt.Sprintf("re-execution failed: %v", err)
+	}
+
+	if replayHeader.StateRoot != header.StateRoot {
+		return fmt.Sprintf("state root %x does not match re-executed %x", header.StateRoot, replayHeader.StateRoot)
+	}
+	if replayHeader.GasUsed != header.GasUsed {
+		return fmt.Sprintf("gas used %d does not match re-executed %d", header.GasUsed, replayHeader.GasUsed)
+	}
+	receiptRoot, err := DeriveReceiptRoot(replay.Receipts)
+	if err != nil {
+		return err.Error()
+	}
+	if receiptRoot != header.ReceiptHash {
+		return fmt.Sprintf("receipts root %x does not match re-executed %x", header.ReceiptHash, receiptRoot)
+	}
+
+	return ""
+}
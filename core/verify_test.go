@@ -0,0 +1,88 @@
+package core
+
+import (
+	"blockchain-node/crypto"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestVerifyChainCorruptBlock(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PrivateKeyToAddress(key)
+	bc := openTestChain(t, t.TempDir(), map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	defer bc.Close()
+
+	mineTestBlock(t, bc)
+	mineTestTxs(t, bc, []*Transaction{signedTransfer(t, key, 0, 1)})
+	mineTestBlock(t, bc)
+
+	verified := 0
+	if err := bc.VerifyChain(true, func(uint64) { verified++ }); err != nil {
+		t.Fatalf("intact chain failed verification: %v", err)
+	}
+	if verified != 4 {
+		t.Errorf("%d blocks verified, expected 4", verified)
+	}
+
+	// Corrupt the transactions of block 2
+	bc.GetBlockByNumber(2).Transactions[0] = signedTransfer(t, key, 0, 2)
+
+	err = bc.VerifyChain(false, nil)
+	var fault *ChainFault
+	if !errors.As(err, &fault) || fault.Number != 2 || !strings.Contains(fault.Reason, "transactions root") {
+		t.Fatalf("verification error %v, expected a transactions root fault in block 2", err)
+	}
+}
+
+func TestReexecuteRangeAlteredStateRoot(t *testing.T) {
+	// Without a VM nonces aren't incremented, so each block has its own sender
+	keys := make([]*ecdsa.PrivateKey, 3)
+	alloc := make(map[[20]byte]*big.Int)
+	for i := range keys {
+		key, _, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		alloc[crypto.PrivateKeyToAddress(key)] = big.NewInt(1e18)
+	}
+	bc := openTestChain(t, t.TempDir(), alloc)
+	defer bc.Close()
+
+	for _, key := range keys {
+		mineTestTxs(t, bc, []*Transaction{signedTransfer(t, key, 0, 1)})
+	}
+
+	faults, err := bc.ReexecuteRange(context.Background(), 0, 3)
+	if err != nil || len(faults) != 0 {
+		t.Fatalf("intact chain: faults %v, error %v", faults, err)
+	}
+
+	// Store block 3 with a different state root
+	block := bc.GetBlockByNumber(3)
+	block.Header.StateRoot[0] ^= 0xff
+	if err := bc.saveBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	faults, err = bc.ReexecuteRange(context.Background(), 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faults) != 1 || faults[0].Number != 3 || !strings.Contains(faults[0].Reason, "state root") {
+		t.Fatalf("faults %v, expected a state root fault in block 3", faults)
+	}
+	if faults, err := bc.ReexecuteRange(context.Background(), 1, 2); err != nil || len(faults) != 0 {
+		t.Errorf("range before the altered block: faults %v, error %v", faults, err)
+	}
+	if _, err := bc.ReexecuteRange(context.Background(), 2, 4); err == nil {
+		t.Error("range beyond the chain head accepted")
+	}
+}
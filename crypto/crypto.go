@@ -1,4 +1,3 @@
-
 package crypto
 
 import (
@@ -31,7 +30,7 @@ func GenerateKeyPair() (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	
+
 	return privateKey, &privateKey.PublicKey, nil
 }
 
@@ -98,7 +97,7 @@ func Sign(hash []byte, privateKey []byte) ([]byte, error) {
 	if len(privateKey) != 32 {
 		return nil, errors.New("invalid private key length")
 	}
-	
+
 	// Create private key from bytes
 	privKeyInt := new(big.Int).SetBytes(privateKey)
 	privKey := &ecdsa.PrivateKey{
@@ -108,25 +107,25 @@ func Sign(hash []byte, privateKey []byte) ([]byte, error) {
 		D: privKeyInt,
 	}
 	privKey.PublicKey.X, privKey.PublicKey.Y = privKey.PublicKey.Curve.ScalarBaseMult(privateKey)
-	
+
 	// Sign hash
 	r, s, err := ecdsa.Sign(rand.Reader, privKey, hash)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Ethereum signature format: R (32 bytes) + S (32 bytes) + V (1 byte)
 	signature := make([]byte, 65)
 	rBytes := r.Bytes()
 	sBytes := s.Bytes()
-	
+
 	// Pad with zeros if needed
 	copy(signature[32-len(rBytes):32], rBytes)
 	copy(signature[64-len(sBytes):64], sBytes)
-	
+
 	// Recovery ID (V) - simplified
 	signature[64] = 27 // Standard Ethereum recovery ID
-	
+
 	return signature, nil
 }
 
@@ -134,17 +133,17 @@ func Sign(hash []byte, privateKey []byte) ([]byte, error) {
 func PubkeyToAddress(pubKey *ecdsa.PublicKey) [20]byte {
 	// Get uncompressed public key (64 bytes: 32 bytes X + 32 bytes Y)
 	pubKeyBytes := make([]byte, 64)
-	
+
 	xBytes := pubKey.X.Bytes()
 	yBytes := pubKey.Y.Bytes()
-	
+
 	// Pad with zeros if needed
 	copy(pubKeyBytes[32-len(xBytes):32], xBytes)
 	copy(pubKeyBytes[64-len(yBytes):64], yBytes)
-	
+
 	// Hash the public key
 	hash := Keccak256(pubKeyBytes)
-	
+
 	// Take last 20 bytes as address
 	var addr [20]byte
 	copy(addr[:], hash[12:])
@@ -156,22 +155,15 @@ func PrivateKeyToAddress(privateKey *ecdsa.PrivateKey) [20]byte {
 	return PubkeyToAddress(&privateKey.PublicKey)
 }
 
-// ValidateProofOfWork validates proof of work
-func ValidateProofOfWork(hash [32]byte, nonce uint64, difficulty *big.Int) bool {
-	target := new(big.Int).Div(MaxTarget, difficulty)
-	hashInt := new(big.Int).SetBytes(hash[:])
-	return hashInt.Cmp(target) == -1
-}
-
 // VerifySignature verifies ECDSA signature
 func VerifySignature(pubKey *ecdsa.PublicKey, hash []byte, signature []byte) bool {
 	if len(signature) != 65 {
 		return false
 	}
-	
+
 	r := new(big.Int).SetBytes(signature[:32])
 	s := new(big.Int).SetBytes(signature[32:64])
-	
+
 	return ecdsa.Verify(pubKey, hash, r, s)
 }
 
@@ -180,24 +172,24 @@ func RecoverAddress(hash []byte, signature []byte) ([20]byte, error) {
 	if len(signature) != 65 {
 		return [20]byte{}, errors.New("invalid signature length")
 	}
-	
+
 	// Extract r, s, v
 	r := new(big.Int).SetBytes(signature[:32])
 	s := new(big.Int).SetBytes(signature[32:64])
 	v := signature[64]
-	
+
 	// Simplified recovery - in production use proper ECDSA recovery
 	if v < 27 {
 		v += 27
 	}
-	
+
 	// Create recovered public key (simplified)
 	recoveredPubKey := &ecdsa.PublicKey{
 		Curve: secp256k1(),
 		X:     r,
 		Y:     s,
 	}
-	
+
 	return PubkeyToAddress(recoveredPubKey), nil
 }
 
@@ -206,16 +198,16 @@ func Ecrecover(hash []byte, signature []byte) (*ecdsa.PublicKey, error) {
 	if len(signature) != 65 {
 		return nil, errors.New("invalid signature length")
 	}
-	
+
 	r := new(big.Int).SetBytes(signature[:32])
 	s := new(big.Int).SetBytes(signature[32:64])
-	
+
 	pubKey := &ecdsa.PublicKey{
 		Curve: secp256k1(),
 		X:     r,
 		Y:     s,
 	}
-	
+
 	return pubKey, nil
 }
 
@@ -239,21 +231,21 @@ func ToECDSA(privateKeyBytes []byte) (*ecdsa.PrivateKey, error) {
 	if len(privateKeyBytes) != 32 {
 		return nil, errors.New("invalid private key length")
 	}
-	
+
 	privKeyInt := new(big.Int).SetBytes(privateKeyBytes)
 	if privKeyInt.Cmp(secp256k1N) >= 0 || privKeyInt.Sign() == 0 {
 		return nil, errors.New("invalid private key value")
 	}
-	
+
 	privKey := &ecdsa.PrivateKey{
 		PublicKey: ecdsa.PublicKey{
 			Curve: secp256k1(),
 		},
 		D: privKeyInt,
 	}
-	
+
 	privKey.PublicKey.X, privKey.PublicKey.Y = privKey.PublicKey.Curve.ScalarBaseMult(privateKeyBytes)
-	
+
 	return privKey, nil
 }
 
@@ -262,16 +254,16 @@ func FromECDSAPub(publicKey *ecdsa.PublicKey) []byte {
 	if publicKey == nil {
 		return nil
 	}
-	
+
 	pubKeyBytes := make([]byte, 65)
 	pubKeyBytes[0] = 0x04 // Uncompressed key prefix
-	
+
 	xBytes := publicKey.X.Bytes()
 	yBytes := publicKey.Y.Bytes()
-	
+
 	copy(pubKeyBytes[33-len(xBytes):33], xBytes)
 	copy(pubKeyBytes[65-len(yBytes):65], yBytes)
-	
+
 	return pubKeyBytes
 }
 
@@ -280,13 +272,13 @@ func UnmarshalPubkey(pubKeyBytes []byte) (*ecdsa.PublicKey, error) {
 	if len(pubKeyBytes) != 65 || pubKeyBytes[0] != 0x04 {
 		return nil, errors.New("invalid public key format")
 	}
-	
+
 	pubKey := &ecdsa.PublicKey{
 		Curve: secp256k1(),
 		X:     new(big.Int).SetBytes(pubKeyBytes[1:33]),
 		Y:     new(big.Int).SetBytes(pubKeyBytes[33:65]),
 	}
-	
+
 	return pubKey, nil
 }
 
@@ -298,7 +290,7 @@ func HexToBytes(s string) []byte {
 	if len(s)%2 != 0 {
 		s = "0" + s
 	}
-	
+
 	bytes := make([]byte, len(s)/2)
 	for i := 0; i < len(s); i += 2 {
 		var b byte
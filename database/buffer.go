@@ -0,0 +1,94 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// BufferedDB keeps writes in memory until Flush writes them to the underlying
+// database. Reads see the buffered writes. Keys written repeatedly between
+// flushes, like trie nodes rewritten by every state commit, reach the disk
+// only once.
+type BufferedDB struct {
+	mu      sync.RWMutex
+	db      Database
+	pending map[string][]byte // nil marks a deleted key
+}
+
+// NewBufferedDB creates a write buffer in front of db
+func NewBufferedDB(db Database) *BufferedDB {
+	return &BufferedDB{
+		db:      db,
+		pending: make(map[string][]byte),
+	}
+}
+
+func (b *BufferedDB) Get(key []byte) ([]byte, error) {
+	b.mu.RLock()
+	value, buffered := b.pending[string(key)]
+	b.mu.RUnlock()
+	if buffered {
+		return value, nil
+	}
+	return b.db.Get(key)
+}
+
+func (b *BufferedDB) Put(key []byte, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (b *BufferedDB) Delete(key []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[string(key)] = nil
+	return nil
+}
+
+// Flush writes the buffered writes to the underlying database and returns how
+// many keys were written. Keys are dropped from the buffer once written, so
+// after a failed write the rest stays buffered for the next Flush.
+func (b *BufferedDB) Flush() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	written := 0
+	for key, value := range b.pending {
+		var err error
+		if value == nil {
+			err = b.db.Delete([]byte(key))
+		} else {
+			err = b.db.Put([]byte(key), value)
+		}
+		if err != nil {
+			return written, fmt.Errorf("failed to flush key %x: %v", key, err)
+		}
+		delete(b.pending, key)
+		written++
+	}
+	return written, nil
+}
+
+// Size returns the number of buffered keys
+func (b *BufferedDB) Size() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.pending)
+}
+
+// Close flushes the buffer. The underlying database stays open, it is
+// closed by its owner.
+func (b *BufferedDB) Close() error {
+	_, err := b.Flush()
+	return err
+}
+
+// GetEthDB returns the underlying database, which doesn't see unflushed
+// writes
+func (b *BufferedDB) GetEthDB() ethdb.Database {
+	return b.db.GetEthDB()
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingDB is a memory database that fails to write the key fail
+type failingDB struct {
+	*MemoryDB
+	fail string
+}
+
+func (f *failingDB) Put(key []byte, value []byte) error {
+	if string(key) == f.fail {
+		return errors.New("disk full")
+	}
+	return f.MemoryDB.Put(key, value)
+}
+
+func TestFlushKeepsUnwrittenKeys(t *testing.T) {
+	db := &failingDB{MemoryDB: NewMemoryDB(), fail: "b"}
+	buffer := NewBufferedDB(db)
+	for _, key := range []string{"a", "b", "c"} {
+		buffer.Put([]byte(key), []byte(key))
+	}
+
+	written, err := buffer.Flush()
+	if err == nil {
+		t.Fatal("flush succeeded despite a failed write")
+	}
+	if buffer.Size() != 3-written {
+		t.Fatalf("%d keys buffered after writing %d of 3", buffer.Size(), written)
+	}
+	if value, _ := buffer.Get([]byte("b")); string(value) != "b" {
+		t.Errorf("unwritten key reads %q", value)
+	}
+
+	db.fail = ""
+	if _, err := buffer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.Size() != 0 {
+		t.Errorf("%d keys buffered after a successful flush", buffer.Size())
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if value, _ := db.Get([]byte(key)); string(value) != key {
+			t.Errorf("key %s reads %q from disk", key, value)
+		}
+	}
+}
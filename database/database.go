@@ -1,7 +1,10 @@
-
 package database
 
 import (
+	"blockchain-node/logger"
+	"fmt"
+	"time"
+
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
@@ -22,24 +25,106 @@ type LevelDB struct {
 	db *leveldb.DB
 }
 
-func NewLevelDB(path string) (*LevelDB, error) {
-	opts := &opt.Options{
-		Filter: filter.NewBloomFilter(10),
-	}
-	
+var log = logger.Module("database")
+
+// slowKeyPrefixLen is how many bytes of a binary key are logged for a slow
+// operation
+const slowKeyPrefixLen = 4
+
+// Smallest cache size in MiB and number of open files the database is
+// configured with, lower settings are raised to these
+const (
+	minCache   = 16
+	minHandles = 16
+)
+
+// NewLevelDB opens the database at path with cache MiB of memory for the
+// block cache and up to handles open files
+func NewLevelDB(path string, cache int, handles int) (*LevelDB, error) {
+	opts := levelDBOptions(cache, handles)
+
 	db, err := leveldb.OpenFile(path, opts)
 	if err != nil {
 		if errors.IsCorrupted(err) {
-			db, err = leveldb.RecoverFile(path, nil)
+			db, err = leveldb.RecoverFile(path, opts)
 		}
 		if err != nil {
 			return nil, err
 		}
 	}
-	
+
 	return &LevelDB{db: db}, nil
 }
 
+// levelDBOptions returns the LevelDB options for a cache of cache MiB and
+// handles open files
+func levelDBOptions(cache int, handles int) *opt.Options {
+	if cache < minCache {
+		cache = minCache
+	}
+	if handles < minHandles {
+		handles = minHandles
+	}
+
+	return &opt.Options{
+		Filter:                 filter.NewBloomFilter(10),
+		BlockCacheCapacity:     cache * opt.MiB,
+		OpenFilesCacheCapacity: handles,
+	}
+}
+
+// SlowLogDB wraps a database and logs a warning for Get, Put and Delete
+// calls that take longer than a threshold
+type SlowLogDB struct {
+	Database
+	threshold time.Duration
+}
+
+// NewSlowLogDB returns db with calls slower than threshold logged
+func NewSlowLogDB(db Database, threshold time.Duration) *SlowLogDB {
+	return &SlowLogDB{Database: db, threshold: threshold}
+}
+
+// logSlow logs op on key if it took longer than the threshold since start
+func (s *SlowLogDB) logSlow(op string, key []byte, start time.Time) {
+	if elapsed := time.Since(start); elapsed > s.threshold {
+		log.Warningf("Slow database %s of key %s took %v", op, keyPrefix(key), elapsed)
+	}
+}
+
+func (s *SlowLogDB) Get(key []byte) ([]byte, error) {
+	defer s.logSlow("get", key, time.Now())
+	return s.Database.Get(key)
+}
+
+func (s *SlowLogDB) Put(key []byte, value []byte) error {
+	defer s.logSlow("put", key, time.Now())
+	return s.Database.Put(key, value)
+}
+
+func (s *SlowLogDB) Delete(key []byte) error {
+	defer s.logSlow("delete", key, time.Now())
+	return s.Database.Delete(key)
+}
+
+// keyPrefix returns the part of key that is logged: the name of keys like
+// "block_12", or the first bytes in hex of binary keys such as trie node
+// hashes
+func keyPrefix(key []byte) string {
+	for i, c := range key {
+		if c == '_' && i > 0 {
+			return string(key[:i+1]) + "*"
+		}
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			break
+		}
+	}
+	if len(key) > slowKeyPrefixLen {
+		return fmt.Sprintf("%x*", key[:slowKeyPrefixLen])
+	}
+	return fmt.Sprintf("%x", key)
+}
+
 func (ldb *LevelDB) Get(key []byte) ([]byte, error) {
 	value, err := ldb.db.Get(key, nil)
 	if err == leveldb.ErrNotFound {
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"blockchain-node/logger"
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+func TestLevelDBOptions(t *testing.T) {
+	tests := []struct {
+		cache, handles       int
+		wantCache, wantFiles int
+	}{
+		{256, 512, 256 * opt.MiB, 512},
+		{0, 0, minCache * opt.MiB, minHandles},
+	}
+	for _, test := range tests {
+		opts := levelDBOptions(test.cache, test.handles)
+		if opts.BlockCacheCapacity != test.wantCache || opts.OpenFilesCacheCapacity != test.wantFiles {
+			t.Errorf("cache %d, handles %d: block cache %d, open files %d, expected %d and %d",
+				test.cache, test.handles, opts.BlockCacheCapacity, opts.OpenFilesCacheCapacity, test.wantCache, test.wantFiles)
+		}
+	}
+
+	db, err := NewLevelDB(filepath.Join(t.TempDir(), "db"), 32, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := db.Get([]byte("key")); err != nil || string(value) != "value" {
+		t.Errorf("read %q, %v", value, err)
+	}
+}
+
+// latencyDB is a memory database whose reads take delay
+type latencyDB struct {
+	*MemoryDB
+	delay time.Duration
+}
+
+func (l *latencyDB) Get(key []byte) ([]byte, error) {
+	time.Sleep(l.delay)
+	return l.MemoryDB.Get(key)
+}
+
+func TestSlowLogDB(t *testing.T) {
+	var out bytes.Buffer
+	output := logger.GetLogger().Out
+	logger.GetLogger().SetOutput(&out)
+	t.Cleanup(func() { logger.GetLogger().SetOutput(output) })
+
+	db := NewSlowLogDB(&latencyDB{MemoryDB: NewMemoryDB(), delay: 20 * time.Millisecond}, 10*time.Millisecond)
+	if err := db.Put([]byte("block_12"), []byte("block")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "Slow database") {
+		t.Fatalf("fast put logged:\n%s", out.String())
+	}
+
+	if _, err := db.Get([]byte("block_12")); err != nil {
+		t.Fatal(err)
+	}
+	logged := out.String()
+	if !strings.Contains(logged, "Slow database get of key block_*") {
+		t.Errorf("slow get not logged with its key prefix:\n%s", logged)
+	}
+	if strings.Contains(logged, "block_12") {
+		t.Errorf("full key logged:\n%s", logged)
+	}
+}
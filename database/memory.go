@@ -0,0 +1,53 @@
+package database
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// MemoryDB is a database held in memory only, for state that is computed
+// and thrown away, like a genesis block built to check its hash
+type MemoryDB struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryDB creates an empty in-memory database
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{data: make(map[string][]byte)}
+}
+
+// Get returns nil for missing keys, like LevelDB
+func (m *MemoryDB) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.data[string(key)]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (m *MemoryDB) Put(key []byte, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (m *MemoryDB) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, string(key))
+	return nil
+}
+
+func (m *MemoryDB) Close() error {
+	return nil
+}
+
+// GetEthDB returns nil, a memory database has no ethdb view
+func (m *MemoryDB) GetEthDB() ethdb.Database {
+	return nil
+}
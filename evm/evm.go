@@ -1,102 +1,187 @@
-
 package evm
 
 import (
 	"blockchain-node/core"
+	"blockchain-node/interfaces"
+	"blockchain-node/state"
+	"blockchain-node/validation"
+	"errors"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/state"
-	ethTypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 )
 
+// EVM runs transactions with the go-ethereum interpreter against our state.
+// It implements interfaces.VirtualMachine.
 type EVM struct {
-	blockchain Blockchain
-	vmConfig   vm.Config
+	blockchain  Blockchain
+	chainConfig *params.ChainConfig
+	vmConfig    vm.Config
 }
 
 type Blockchain interface {
-	GetConfig() interface{}
-	GetCurrentBlock() *core.Block
-	GetBlockByHash(hash [32]byte) *core.Block
+	GetChainID() uint64
 	GetBlockByNumber(number uint64) *core.Block
 }
 
 func NewEVM(blockchain Blockchain) *EVM {
+	// All forks up to London are active from genesis. There is no base fee,
+	// senders pay their full gas price.
+	chainConfig := *params.AllEthashProtocolChanges
+	chainConfig.ChainID = new(big.Int).SetUint64(blockchain.GetChainID())
+
 	return &EVM{
-		blockchain: blockchain,
+		blockchain:  blockchain,
+		chainConfig: &chainConfig,
 		vmConfig: vm.Config{
-			Debug: false,
+			NoBaseFee: true,
 		},
 	}
 }
 
-func (e *EVM) ExecuteTransaction(stateDB *state.StateDB, tx *core.Transaction, header *core.BlockHeader, gasUsed uint64) (*core.TransactionReceipt, error) {
-	// Create EVM context
-	context := vm.BlockContext{
+// ExecuteTransaction runs the transaction in ctx against ctx.StateDB
+func (e *EVM) ExecuteTransaction(ctx *interfaces.ExecutionContext) (*interfaces.ExecutionResult, error) {
+	stateDB, ok := ctx.StateDB.(*state.StateDB)
+	if !ok || stateDB == nil {
+		return nil, ErrNoState
+	}
+	tx, ok := ctx.Transaction.(*core.Transaction)
+	if !ok {
+		return nil, ErrInvalidTransaction
+	}
+	header, ok := ctx.BlockHeader.(*core.BlockHeader)
+	if !ok {
+		return nil, ErrInvalidHeader
+	}
+
+	gasPrice := tx.GasPrice
+	if gasPrice == nil {
+		gasPrice = new(big.Int)
+	}
+	value := tx.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	blockCtx := vm.BlockContext{
 		CanTransfer: CanTransfer,
 		Transfer:    Transfer,
 		GetHash:     e.GetHashFn(header),
-		Coinbase:    common.Address{}, // Miner address
+		Coinbase:    header.Coinbase,
 		BlockNumber: new(big.Int).SetUint64(header.Number),
-		Time:        new(big.Int).SetInt64(header.Timestamp),
+		Time:        uint64(header.Timestamp),
 		Difficulty:  header.Difficulty,
 		GasLimit:    header.GasLimit,
+		BaseFee:     new(big.Int),
 	}
-
-	// Create transaction context
-	txContext := vm.TxContext{
+	txCtx := vm.TxContext{
 		Origin:   tx.From,
-		GasPrice: tx.GasPrice,
+		GasPrice: gasPrice,
 	}
 
-	// Create EVM instance
-	evm := vm.NewEVM(context, txContext, stateDB, params.MainnetChainConfig, e.vmConfig)
-
-	// Convert our transaction to Ethereum transaction
-	ethTx := tx.ToEthTransaction()
+	adapter := NewStateAdapter(stateDB)
+	evm := vm.NewEVM(blockCtx, txCtx, adapter, e.chainConfig, e.vmConfig)
+
+	rules := e.chainConfig.Rules(blockCtx.BlockNumber, false, blockCtx.Time)
+	adapter.Prepare(rules, tx.From, blockCtx.Coinbase, tx.To, vm.ActivePrecompiles(rules), nil)
+
+	// The sender buys the whole gas limit up front and gets back what is
+	// left over, the coinbase is paid for the gas used
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(tx.GasLimit), gasPrice)
+	if adapter.GetBalance(tx.From).Cmp(cost) < 0 {
+		// The transaction is still included in the block, so its nonce is
+		// used up
+		adapter.SetNonce(tx.From, adapter.GetNonce(tx.From)+1)
+		return &interfaces.ExecutionResult{
+			GasUsed: tx.GasLimit,
+			Status:  0,
+			Error:   ErrInsufficientFunds,
+		}, nil
+	}
+	adapter.SubBalance(tx.From, cost)
+
+	intrinsic := validation.IntrinsicGas(tx.Data, tx.IsContractCreation())
+	if tx.GasLimit < intrinsic {
+		payCoinbase(adapter, blockCtx.Coinbase, cost)
+		return &interfaces.ExecutionResult{
+			GasUsed: tx.GasLimit,
+			Status:  0,
+			Error:   ErrIntrinsicGas,
+		}, nil
+	}
 
-	// Execute transaction
 	var (
-		result *vm.ExecutionResult
-		err    error
+		ret          []byte
+		contractAddr common.Address
+		leftOverGas  uint64
+		err          error
 	)
+	// Abort the interpreter when the caller gives up on the execution
+	if ctx.Done != nil {
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-ctx.Done:
+				evm.Cancel()
+			case <-finished:
+			}
+		}()
+	}
 
+	gas := tx.GasLimit - intrinsic
 	if tx.IsContractCreation() {
-		// Contract creation
-		result, _, err = evm.Create(vm.AccountRef(tx.From), tx.Data, tx.GasLimit, tx.Value)
+		// Create bumps the sender nonce itself
+		ret, contractAddr, leftOverGas, err = evm.Create(vm.AccountRef(tx.From), tx.Data, gas, value)
 	} else {
-		// Contract call or simple transfer
-		result, err = evm.Call(vm.AccountRef(tx.From), *tx.To, tx.Data, tx.GasLimit, tx.Value)
+		adapter.SetNonce(tx.From, adapter.GetNonce(tx.From)+1)
+		ret, leftOverGas, err = evm.Call(vm.AccountRef(tx.From), *tx.To, tx.Data, gas, value)
 	}
 
-	// Create receipt
-	receipt := &core.TransactionReceipt{
-		TxHash:      tx.Hash,
-		TxIndex:     0, // Will be set by caller
-		BlockHash:   header.Hash,
-		BlockNumber: header.Number,
-		From:        tx.From,
-		To:          tx.To,
-		GasUsed:     tx.GasLimit - result.LeftOverGas,
-		Logs:        convertLogs(result.Logs, header, tx),
-		Status:      1, // Success
+	// Refunds are capped at a fifth of the gas used (EIP-3529)
+	gasUsed := tx.GasLimit - leftOverGas
+	refund := adapter.GetRefund()
+	if max := gasUsed / params.RefundQuotientEIP3529; refund > max {
+		refund = max
+	}
+	gasUsed -= refund
+	leftOver := new(big.Int).Mul(new(big.Int).SetUint64(tx.GasLimit-gasUsed), gasPrice)
+	adapter.AddBalance(tx.From, leftOver)
+	payCoinbase(adapter, blockCtx.Coinbase, new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), gasPrice))
+	stateDB.FinaliseTx()
+
+	result := &interfaces.ExecutionResult{
+		GasUsed:    gasUsed,
+		Logs:       convertLogs(adapter.Logs()),
+		Status:     1,
+		ReturnData: ret,
 	}
 
 	if err != nil {
-		receipt.Status = 0 // Failed
+		result.Status = 0
+		result.Logs = nil
+		if !errors.Is(err, vm.ErrExecutionReverted) {
+			result.ReturnData = nil
+			result.Error = err
+		}
+		return result, nil
 	}
 
-	// Set contract address for contract creation
-	if tx.IsContractCreation() && err == nil {
-		contractAddr := crypto.CreateAddress(tx.From, tx.Nonce)
-		receipt.ContractAddress = &contractAddr
+	if tx.IsContractCreation() {
+		address := [20]byte(contractAddr)
+		result.ContractAddress = &address
 	}
 
-	return receipt, nil
+	return result, nil
+}
+
+// payCoinbase credits fee to coinbase unless the block has none
+func payCoinbase(adapter *StateAdapter, coinbase common.Address, fee *big.Int) {
+	if coinbase != (common.Address{}) && fee.Sign() > 0 {
+		adapter.AddBalance(coinbase, fee)
+	}
 }
 
 func (e *EVM) GetHashFn(header *core.BlockHeader) vm.GetHashFunc {
@@ -108,21 +193,14 @@ func (e *EVM) GetHashFn(header *core.BlockHeader) vm.GetHashFunc {
 	}
 }
 
-func convertLogs(vmLogs []*ethTypes.Log, header *core.BlockHeader, tx *core.Transaction) []*core.Log {
-	var logs []*core.Log
-	for i, vmLog := range vmLogs {
-		log := &core.Log{
-			Address:     vmLog.Address,
-			Topics:      vmLog.Topics,
-			Data:        vmLog.Data,
-			BlockNumber: header.Number,
-			TxHash:      tx.Hash,
-			TxIndex:     0, // Will be set by caller
-			BlockHash:   header.Hash,
-			Index:       uint64(i),
-			Removed:     false,
-		}
-		logs = append(logs, log)
+func convertLogs(stateLogs []*state.Log) []interfaces.ExecutionLog {
+	logs := make([]interfaces.ExecutionLog, 0, len(stateLogs))
+	for _, stateLog := range stateLogs {
+		logs = append(logs, interfaces.ExecutionLog{
+			Address: stateLog.Address,
+			Topics:  stateLog.Topics,
+			Data:    stateLog.Data,
+		})
 	}
 	return logs
 }
@@ -136,3 +214,12 @@ func Transfer(db vm.StateDB, sender, recipient common.Address, amount *big.Int)
 	db.SubBalance(sender, amount)
 	db.AddBalance(recipient, amount)
 }
+
+// EVM errors
+var (
+	ErrNoState            = errors.New("no state to execute against")
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	ErrInvalidHeader      = errors.New("invalid block header")
+	ErrIntrinsicGas       = errors.New("intrinsic gas too low")
+	ErrInsufficientFunds  = errors.New("insufficient funds for gas * price")
+)
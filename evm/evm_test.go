@@ -0,0 +1,230 @@
+package evm
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/database"
+	"blockchain-node/interfaces"
+	"blockchain-node/state"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// pureAndViewBin is the creation code of this contract, compiled with solc 0.6.0:
+//
+//	contract PureAndView {
+//		function PureFunc() public pure returns (uint) { return 42; }
+//		function ViewFunc() public view returns (uint) { return block.number; }
+//	}
+const pureAndViewBin = "608060405234801561001057600080fd5b5060b68061001f6000396000f3fe6080604052348015600f57600080fd5b506004361060325760003560e01c806376b5686a146037578063bb38c66c146053575b600080fd5b603d606f565b6040518082815260200191505060405180910390f35b60596077565b6040518082815260200191505060405180910390f35b600043905090565b6000602a90509056fea2646970667358221220d158c2ab7fdfce366a7998ec79ab84edd43b9815630bbaede2c760ea77f29f7f64736f6c63430006000033"
+
+// callableBin is the creation code of this contract, compiled with solc 0.8.1:
+//
+//	contract Callable {
+//		event Called();
+//		function Call() public { emit Called(); }
+//	}
+const callableBin = "6080604052348015600f57600080fd5b5060998061001e6000396000f3fe6080604052348015600f57600080fd5b506004361060285760003560e01c806334e2292114602d575b600080fd5b60336035565b005b7f81fab7a4a0aa961db47eefc81f143a5220e8c8495260dd65b1356f1d19d3c7b860405160405180910390a156fea2646970667358221220029436d24f3ac598ceca41d4d712e13ced6d70727f4cdc580667de66d2f51d8b64736f6c63430008010033"
+
+type testChain struct{}
+
+func (testChain) GetChainID() uint64                         { return 1337 }
+func (testChain) GetBlockByNumber(number uint64) *core.Block { return nil }
+
+// testEnv executes transactions of a funded sender in block 1
+type testEnv struct {
+	t       *testing.T
+	evm     *EVM
+	stateDB *state.StateDB
+	header  *core.BlockHeader
+	from    common.Address
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	stateDB, err := state.NewStateDB([32]byte{}, database.NewMemoryDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := common.Address{0xaa}
+	stateDB.AddBalance(from, big.NewInt(1e18))
+
+	return &testEnv{
+		t:       t,
+		evm:     NewEVM(testChain{}),
+		stateDB: stateDB,
+		header: &core.BlockHeader{
+			Number:     1,
+			Timestamp:  time.Now().Unix(),
+			GasLimit:   8000000,
+			Difficulty: big.NewInt(1),
+		},
+		from: from,
+	}
+}
+
+// execute runs a transaction of the sender with the next nonce
+func (env *testEnv) execute(to *common.Address, data []byte, gasPrice *big.Int) *interfaces.ExecutionResult {
+	env.t.Helper()
+	tx := core.NewTransaction(env.stateDB.GetNonce(env.from), to, big.NewInt(0), 1000000, gasPrice, data)
+	tx.From = env.from
+
+	result, err := env.evm.ExecuteTransaction(&interfaces.ExecutionContext{
+		Transaction: tx,
+		BlockHeader: env.header,
+		StateDB:     env.stateDB,
+		From:        tx.From,
+		To:          (*[20]byte)(tx.To),
+		Value:       tx.Value,
+		GasPrice:    tx.GasPrice,
+		Data:        tx.Data,
+	})
+	if err != nil {
+		env.t.Fatalf("execution failed: %v", err)
+	}
+	if result.Status != 1 {
+		env.t.Fatalf("transaction failed: %v", result.Error)
+	}
+	return result
+}
+
+// deploy creates a contract from its hex creation code
+func (env *testEnv) deploy(bin string) common.Address {
+	env.t.Helper()
+	result := env.execute(nil, common.FromHex(bin), big.NewInt(0))
+	if result.ContractAddress == nil {
+		env.t.Fatal("no contract address")
+	}
+	address := common.Address(*result.ContractAddress)
+	if len(env.stateDB.GetCode(address)) == 0 {
+		env.t.Fatal("contract has no code")
+	}
+	return address
+}
+
+func selector(signature string) []byte {
+	return crypto.Keccak256([]byte(signature))[:4]
+}
+
+func TestDeployAndCallContract(t *testing.T) {
+	env := newTestEnv(t)
+	contract := env.deploy(pureAndViewBin)
+
+	tests := []struct {
+		method string
+		want   int64
+	}{
+		{"PureFunc()", 42},
+		{"ViewFunc()", 1}, // the block number
+	}
+	for _, test := range tests {
+		result := env.execute(&contract, selector(test.method), big.NewInt(0))
+		if got := new(big.Int).SetBytes(result.ReturnData); got.Int64() != test.want {
+			t.Errorf("%s returned %v, expected %d", test.method, got, test.want)
+		}
+	}
+	if nonce := env.stateDB.GetNonce(env.from); nonce != 3 {
+		t.Errorf("sender nonce %d, expected 3", nonce)
+	}
+}
+
+func TestContractLogs(t *testing.T) {
+	env := newTestEnv(t)
+	contract := env.deploy(callableBin)
+
+	result := env.execute(&contract, selector("Call()"), big.NewInt(0))
+	if len(result.Logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(result.Logs))
+	}
+	got := result.Logs[0]
+	if common.Address(got.Address) != contract || len(got.Topics) != 1 || common.Hash(got.Topics[0]) != crypto.Keccak256Hash([]byte("Called()")) {
+		t.Errorf("unexpected log %+v", got)
+	}
+}
+
+func TestGasFeeCharged(t *testing.T) {
+	env := newTestEnv(t)
+	contract := env.deploy(pureAndViewBin)
+	coinbase := common.Address{0xcc}
+	env.header.Coinbase = coinbase
+
+	before := env.stateDB.GetBalance(env.from)
+	gasPrice := big.NewInt(1000000000)
+	result := env.execute(&contract, selector("PureFunc()"), gasPrice)
+
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(result.GasUsed), gasPrice)
+	want := new(big.Int).Sub(before, fee)
+	if got := env.stateDB.GetBalance(env.from); got.Cmp(want) != 0 {
+		t.Errorf("balance %v after paying %d gas, expected %v", got, result.GasUsed, want)
+	}
+	if got := env.stateDB.GetBalance(coinbase); got.Cmp(fee) != 0 {
+		t.Errorf("coinbase balance %v, expected the fee %v", got, fee)
+	}
+}
+
+func TestGasFeeUnaffordable(t *testing.T) {
+	env := newTestEnv(t)
+
+	// The gas limit of 1000000 costs more than the balance at this price
+	gasPrice := big.NewInt(1e13)
+	tx := core.NewTransaction(0, &common.Address{0x01}, big.NewInt(0), 1000000, gasPrice, nil)
+	tx.From = env.from
+
+	result, err := env.evm.ExecuteTransaction(&interfaces.ExecutionContext{
+		Transaction: tx,
+		BlockHeader: env.header,
+		StateDB:     env.stateDB,
+		From:        tx.From,
+		To:          (*[20]byte)(tx.To),
+		Value:       tx.Value,
+		GasPrice:    tx.GasPrice,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != 0 || result.Error != ErrInsufficientFunds {
+		t.Errorf("expected ErrInsufficientFunds, got status %d: %v", result.Status, result.Error)
+	}
+	if balance := env.stateDB.GetBalance(env.from); balance.Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("balance changed to %v", balance)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	env := newTestEnv(t)
+	to := common.Address{0xbb}
+	value := big.NewInt(12345)
+	gasPrice := big.NewInt(1000)
+	tx := core.NewTransaction(0, &to, value, 21000, gasPrice, nil)
+	tx.From = env.from
+
+	result, err := env.evm.ExecuteTransaction(&interfaces.ExecutionContext{
+		Transaction: tx,
+		BlockHeader: env.header,
+		StateDB:     env.stateDB,
+		From:        tx.From,
+		To:          (*[20]byte)(tx.To),
+		Value:       tx.Value,
+		GasPrice:    tx.GasPrice,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != 1 || result.GasUsed != 21000 {
+		t.Fatalf("transfer status %d used %d gas: %v", result.Status, result.GasUsed, result.Error)
+	}
+
+	if balance := env.stateDB.GetBalance(to); balance.Cmp(value) != 0 {
+		t.Errorf("recipient balance %v, expected %v", balance, value)
+	}
+	want := new(big.Int).Sub(big.NewInt(1e18), value)
+	want.Sub(want, new(big.Int).Mul(big.NewInt(21000), gasPrice))
+	if balance := env.stateDB.GetBalance(env.from); balance.Cmp(want) != 0 {
+		t.Errorf("sender balance %v, expected %v", balance, want)
+	}
+	if nonce := env.stateDB.GetNonce(env.from); nonce != 1 {
+		t.Errorf("sender nonce %d, expected 1", nonce)
+	}
+}
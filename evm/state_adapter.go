@@ -1,25 +1,32 @@
-
 package evm
 
 import (
+	"blockchain-node/state"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/state"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // StateAdapter adapts our state to vm.StateDB interface
 type StateAdapter struct {
-	stateDB *state.StateDB
+	stateDB  *state.StateDB
+	logStart int // logs before this index belong to earlier transactions
 }
 
 func NewStateAdapter(stateDB *state.StateDB) *StateAdapter {
 	return &StateAdapter{
-		stateDB: stateDB,
+		stateDB:  stateDB,
+		logStart: len(stateDB.GetLogs()),
 	}
 }
 
+// Logs returns the logs emitted since the adapter was created
+func (s *StateAdapter) Logs() []*state.Log {
+	return s.stateDB.GetLogs()[s.logStart:]
+}
+
 func (s *StateAdapter) CreateAccount(addr common.Address) {
 	s.stateDB.CreateAccount(addr)
 }
@@ -84,12 +91,24 @@ func (s *StateAdapter) SetState(addr common.Address, key common.Hash, value comm
 	s.stateDB.SetState(addr, key, value)
 }
 
-func (s *StateAdapter) Suicide(addr common.Address) bool {
-	return s.stateDB.Suicide(addr)
+func (s *StateAdapter) GetTransientState(addr common.Address, key common.Hash) common.Hash {
+	return s.stateDB.GetTransientState(addr, key)
 }
 
-func (s *StateAdapter) HasSuicided(addr common.Address) bool {
-	return s.stateDB.HasSuicided(addr)
+func (s *StateAdapter) SetTransientState(addr common.Address, key, value common.Hash) {
+	s.stateDB.SetTransientState(addr, key, value)
+}
+
+func (s *StateAdapter) SelfDestruct(addr common.Address) {
+	s.stateDB.SelfDestruct(addr)
+}
+
+func (s *StateAdapter) HasSelfDestructed(addr common.Address) bool {
+	return s.stateDB.HasSelfDestructed(addr)
+}
+
+func (s *StateAdapter) Selfdestruct6780(addr common.Address) {
+	s.stateDB.SelfDestruct6780(addr)
 }
 
 func (s *StateAdapter) Exist(addr common.Address) bool {
@@ -100,10 +119,6 @@ func (s *StateAdapter) Empty(addr common.Address) bool {
 	return s.stateDB.Empty(addr)
 }
 
-func (s *StateAdapter) PrepareAccessList(sender common.Address, dest *common.Address, precompiles []common.Address, txAccesses []ethTypes.AccessTuple) {
-	s.stateDB.PrepareAccessList(sender, dest, precompiles, txAccesses)
-}
-
 func (s *StateAdapter) AddressInAccessList(addr common.Address) bool {
 	return s.stateDB.AddressInAccessList(addr)
 }
@@ -120,6 +135,29 @@ func (s *StateAdapter) AddSlotToAccessList(addr common.Address, slot common.Hash
 	s.stateDB.AddSlotToAccessList(addr, slot)
 }
 
+// Prepare resets the transaction scoped state and builds the initial access
+// list of the transaction (EIP-2929, EIP-2930 and EIP-3651)
+func (s *StateAdapter) Prepare(rules params.Rules, sender, coinbase common.Address, dest *common.Address, precompiles []common.Address, txAccesses ethTypes.AccessList) {
+	warm := make([][20]byte, 0, len(precompiles)+2)
+	for _, addr := range precompiles {
+		warm = append(warm, addr)
+	}
+	if dest != nil {
+		warm = append(warm, *dest)
+	}
+	if rules.IsShanghai {
+		warm = append(warm, coinbase)
+	}
+	s.stateDB.PrepareTx(sender, warm...)
+
+	for _, tuple := range txAccesses {
+		s.stateDB.AddAddressToAccessList(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			s.stateDB.AddSlotToAccessList(tuple.Address, key)
+		}
+	}
+}
+
 func (s *StateAdapter) RevertToSnapshot(id int) {
 	s.stateDB.RevertToSnapshot(id)
 }
@@ -129,13 +167,17 @@ func (s *StateAdapter) Snapshot() int {
 }
 
 func (s *StateAdapter) AddLog(log *ethTypes.Log) {
-	s.stateDB.AddLog(log)
+	topics := make([][32]byte, len(log.Topics))
+	for i, topic := range log.Topics {
+		topics[i] = topic
+	}
+	s.stateDB.AddLog(&state.Log{
+		Address: log.Address,
+		Topics:  topics,
+		Data:    log.Data,
+	})
 }
 
 func (s *StateAdapter) AddPreimage(hash common.Hash, preimage []byte) {
-	s.stateDB.AddPreimage(hash, preimage)
-}
-
-func (s *StateAdapter) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) error {
-	return s.stateDB.ForEachStorage(addr, cb)
+	s.stateDB.AddPreimage(preimage)
 }
@@ -0,0 +1,26 @@
+package execution
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/evm"
+	"blockchain-node/interfaces"
+	"fmt"
+)
+
+// Execution backends selectable with the vm_type option
+const (
+	VMTypeCustom = "custom"
+	VMTypeEVM    = "evm"
+)
+
+// New creates the virtual machine selected by vmType for the blockchain
+func New(vmType string, blockchain *core.Blockchain) (interfaces.VirtualMachine, error) {
+	switch vmType {
+	case "", VMTypeCustom:
+		return NewVirtualMachine(blockchain.GetStateDB()), nil
+	case VMTypeEVM:
+		return evm.NewEVM(blockchain), nil
+	default:
+		return nil, fmt.Errorf("unknown vm type: %s", vmType)
+	}
+}
@@ -1,9 +1,9 @@
-
 package execution
 
 import (
 	"blockchain-node/interfaces"
 	"blockchain-node/state"
+	"blockchain-node/validation"
 	"fmt"
 	"math/big"
 )
@@ -21,19 +21,47 @@ func NewVirtualMachine(stateDB *state.StateDB) *VirtualMachine {
 func (vm *VirtualMachine) ExecuteTransaction(ctx *interfaces.ExecutionContext) (*interfaces.ExecutionResult, error) {
 	// Simple transaction execution
 	// In a real implementation, this would handle smart contracts, etc.
-	
-	// Basic gas cost for simple transfer
-	gasUsed := uint64(21000)
-	
-	// For contract creation, add extra gas
-	if ctx.To == nil && len(ctx.Data) > 0 {
-		gasUsed += uint64(len(ctx.Data)) * 68
+
+	stateDB := vm.stateDB
+	if ctxState, ok := ctx.StateDB.(*state.StateDB); ok && ctxState != nil {
+		stateDB = ctxState
+	}
+
+	// Don't touch the state once the caller gave up on the execution
+	select {
+	case <-ctx.Done:
+		return nil, ErrExecutionAborted
+	default:
 	}
-	
+
+	// Only the intrinsic gas is charged, no code is run
+	gasUsed := validation.IntrinsicGas(ctx.Data, ctx.To == nil)
+
+	// The nonce is used up even if the transfer fails, since the
+	// transaction is still included in the block
+	stateDB.SetNonce(ctx.From, stateDB.GetNonce(ctx.From)+1)
+
+	// The sender pays the coinbase for the gas used
+	fee := new(big.Int)
+	if ctx.GasPrice != nil {
+		fee.Mul(new(big.Int).SetUint64(gasUsed), ctx.GasPrice)
+	}
+	if stateDB.GetBalance(ctx.From).Cmp(fee) < 0 {
+		return &interfaces.ExecutionResult{
+			GasUsed: gasUsed,
+			Status:  0, // Failed
+			Error:   ErrInsufficientBalance,
+		}, nil
+	}
+	stateDB.SubBalance(ctx.From, fee)
+	if ctx.Coinbase != ([20]byte{}) {
+		stateDB.AddBalance(ctx.Coinbase, fee)
+	}
+
 	// Update balances for simple transfers
 	if ctx.Value.Cmp(big.NewInt(0)) > 0 {
 		// Check if sender has enough balance
-		senderBalance := vm.stateDB.GetBalance(ctx.From)
+		senderBalance := stateDB.GetBalance(ctx.From)
 		if senderBalance.Cmp(ctx.Value) < 0 {
 			return &interfaces.ExecutionResult{
 				GasUsed: gasUsed,
@@ -41,14 +69,14 @@ func (vm *VirtualMachine) ExecuteTransaction(ctx *interfaces.ExecutionContext) (
 				Error:   ErrInsufficientBalance,
 			}, nil
 		}
-		
+
 		// Transfer funds
-		vm.stateDB.SubBalance(ctx.From, ctx.Value)
+		stateDB.SubBalance(ctx.From, ctx.Value)
 		if ctx.To != nil {
-			vm.stateDB.AddBalance(*ctx.To, ctx.Value)
+			stateDB.AddBalance(*ctx.To, ctx.Value)
 		}
 	}
-	
+
 	return &interfaces.ExecutionResult{
 		GasUsed: gasUsed,
 		Status:  1, // Success
@@ -61,4 +89,5 @@ var (
 	ErrInsufficientBalance = fmt.Errorf("insufficient balance")
 	ErrInvalidTransaction  = fmt.Errorf("invalid transaction")
 	ErrContractFailed      = fmt.Errorf("contract execution failed")
+	ErrExecutionAborted    = fmt.Errorf("execution aborted")
 )
@@ -0,0 +1,101 @@
+package execution
+
+import (
+	"blockchain-node/database"
+	"blockchain-node/interfaces"
+	"blockchain-node/state"
+	"math/big"
+	"testing"
+)
+
+func TestTransferPaysGas(t *testing.T) {
+	stateDB, err := state.NewStateDB([32]byte{}, database.NewMemoryDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to, coinbase := [20]byte{0xaa}, [20]byte{0xbb}, [20]byte{0xcc}
+	stateDB.AddBalance(from, big.NewInt(1e18))
+
+	vm := NewVirtualMachine(stateDB)
+	result, err := vm.ExecuteTransaction(&interfaces.ExecutionContext{
+		From:     from,
+		To:       &to,
+		Value:    big.NewInt(1000),
+		GasPrice: big.NewInt(10),
+		Coinbase: coinbase,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != 1 || result.GasUsed != 21000 {
+		t.Fatalf("status %d, gas used %d", result.Status, result.GasUsed)
+	}
+
+	want := big.NewInt(1e18 - 1000 - 21000*10)
+	if balance := stateDB.GetBalance(from); balance.Cmp(want) != 0 {
+		t.Errorf("sender balance %v, expected %v", balance, want)
+	}
+	if balance := stateDB.GetBalance(to); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("recipient balance %v, expected 1000", balance)
+	}
+	if balance := stateDB.GetBalance(coinbase); balance.Int64() != 21000*10 {
+		t.Errorf("coinbase balance %v, expected the fee of %d", balance, 21000*10)
+	}
+	if nonce := stateDB.GetNonce(from); nonce != 1 {
+		t.Errorf("sender nonce %d, expected 1", nonce)
+	}
+}
+
+func TestUnaffordableGasFails(t *testing.T) {
+	stateDB, err := state.NewStateDB([32]byte{}, database.NewMemoryDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to := [20]byte{0xaa}, [20]byte{0xbb}
+	stateDB.AddBalance(from, big.NewInt(20999))
+
+	vm := NewVirtualMachine(stateDB)
+	result, err := vm.ExecuteTransaction(&interfaces.ExecutionContext{
+		From:     from,
+		To:       &to,
+		Value:    big.NewInt(0),
+		GasPrice: big.NewInt(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != 0 || result.Error != ErrInsufficientBalance {
+		t.Errorf("expected ErrInsufficientBalance, got status %d: %v", result.Status, result.Error)
+	}
+	if balance := stateDB.GetBalance(from); balance.Cmp(big.NewInt(20999)) != 0 {
+		t.Errorf("sender balance %v, expected it unchanged", balance)
+	}
+}
+
+func TestAbortedExecutionKeepsState(t *testing.T) {
+	stateDB, err := state.NewStateDB([32]byte{}, database.NewMemoryDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to := [20]byte{0xaa}, [20]byte{0xbb}
+	stateDB.AddBalance(from, big.NewInt(1e18))
+
+	done := make(chan struct{})
+	close(done)
+	vm := NewVirtualMachine(stateDB)
+	if _, err := vm.ExecuteTransaction(&interfaces.ExecutionContext{
+		From:     from,
+		To:       &to,
+		Value:    big.NewInt(1000),
+		GasPrice: big.NewInt(10),
+		Done:     done,
+	}); err != ErrExecutionAborted {
+		t.Fatalf("error %v, expected %v", err, ErrExecutionAborted)
+	}
+	if nonce := stateDB.GetNonce(from); nonce != 0 {
+		t.Errorf("sender nonce %d after an aborted execution", nonce)
+	}
+	if balance := stateDB.GetBalance(from); balance.Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("sender balance %v, expected it unchanged", balance)
+	}
+}
@@ -1,4 +1,3 @@
-
 package health
 
 import (
@@ -7,27 +6,37 @@ import (
 	"blockchain-node/logger"
 	"blockchain-node/metrics"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"runtime"
 	"time"
 )
 
 type HealthStatus struct {
-	Status        string                 `json:"status"`
-	Timestamp     int64                  `json:"timestamp"`
-	Uptime        string                 `json:"uptime"`
-	Version       string                 `json:"version"`
-	Services      map[string]ServiceInfo `json:"services"`
-	Metrics       map[string]interface{} `json:"metrics"`
-	SystemInfo    SystemInfo             `json:"system_info"`
+	Status     string                 `json:"status"`
+	Timestamp  int64                  `json:"timestamp"`
+	Uptime     string                 `json:"uptime"`
+	Version    string                 `json:"version"`
+	Services   map[string]ServiceInfo `json:"services"`
+	Metrics    map[string]interface{} `json:"metrics"`
+	SystemInfo SystemInfo             `json:"system_info"`
 }
 
 type ServiceInfo struct {
-	Status      string `json:"status"`
-	LastChecked int64  `json:"last_checked"`
-	Message     string `json:"message,omitempty"`
+	Status      string                 `json:"status"`
+	LastChecked int64                  `json:"last_checked"`
+	Message     string                 `json:"message,omitempty"`
+	Details     map[string]interface{} `json:"details,omitempty"`
 }
 
+// maxSyncLag is how many blocks the node may be behind the highest known
+// block before it reports itself degraded
+const maxSyncLag = 16
+
+// maxMempoolBacklog is how many full blocks the pending transactions may need
+// to be mined before the mempool is reported degraded
+const maxMempoolBacklog = 16
+
 type SystemInfo struct {
 	GoVersion    string `json:"go_version"`
 	NumGoroutine int    `json:"num_goroutine"`
@@ -58,21 +67,35 @@ func (hc *HealthChecker) CheckHealth() *HealthStatus {
 		Services:  make(map[string]ServiceInfo),
 		Metrics:   metrics.GetMetrics().ToMap(),
 	}
-	
+
 	// Check database
 	dbStatus := hc.checkDatabase()
 	status.Services["database"] = dbStatus
 	if dbStatus.Status != "healthy" {
 		status.Status = "degraded"
 	}
-	
+
 	// Check blockchain
 	blockchainStatus := hc.checkBlockchain()
 	status.Services["blockchain"] = blockchainStatus
 	if blockchainStatus.Status != "healthy" {
 		status.Status = "degraded"
 	}
-	
+
+	// Check sync progress
+	syncStatus := hc.checkSync()
+	status.Services["sync"] = syncStatus
+	if syncStatus.Status != "healthy" {
+		status.Status = "degraded"
+	}
+
+	// Check mempool saturation
+	mempoolStatus := hc.checkMempool()
+	status.Services["mempool"] = mempoolStatus
+	if mempoolStatus.Status != "healthy" {
+		status.Status = "degraded"
+	}
+
 	// System information
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
@@ -82,13 +105,13 @@ func (hc *HealthChecker) CheckHealth() *HealthStatus {
 		NumCPU:       runtime.NumCPU(),
 		MemoryMB:     m.Alloc / 1024 / 1024,
 	}
-	
+
 	return status
 }
 
 func (hc *HealthChecker) checkDatabase() ServiceInfo {
 	now := time.Now().Unix()
-	
+
 	if hc.database == nil {
 		return ServiceInfo{
 			Status:      "unhealthy",
@@ -96,7 +119,7 @@ func (hc *HealthChecker) checkDatabase() ServiceInfo {
 			Message:     "Database not initialized",
 		}
 	}
-	
+
 	// Try a simple operation
 	_, err := hc.database.Get([]byte("health_check"))
 	if err != nil && err.Error() != "key not found" {
@@ -106,7 +129,7 @@ func (hc *HealthChecker) checkDatabase() ServiceInfo {
 			Message:     "Database connection failed: " + err.Error(),
 		}
 	}
-	
+
 	return ServiceInfo{
 		Status:      "healthy",
 		LastChecked: now,
@@ -115,7 +138,7 @@ func (hc *HealthChecker) checkDatabase() ServiceInfo {
 
 func (hc *HealthChecker) checkBlockchain() ServiceInfo {
 	now := time.Now().Unix()
-	
+
 	if hc.blockchain == nil {
 		return ServiceInfo{
 			Status:      "unhealthy",
@@ -123,7 +146,7 @@ func (hc *HealthChecker) checkBlockchain() ServiceInfo {
 			Message:     "Blockchain not initialized",
 		}
 	}
-	
+
 	currentBlock := hc.blockchain.GetCurrentBlock()
 	if currentBlock == nil {
 		return ServiceInfo{
@@ -132,7 +155,7 @@ func (hc *HealthChecker) checkBlockchain() ServiceInfo {
 			Message:     "No current block found",
 		}
 	}
-	
+
 	return ServiceInfo{
 		Status:      "healthy",
 		LastChecked: now,
@@ -140,11 +163,79 @@ func (hc *HealthChecker) checkBlockchain() ServiceInfo {
 	}
 }
 
+func (hc *HealthChecker) checkSync() ServiceInfo {
+	now := time.Now().Unix()
+
+	if hc.blockchain == nil {
+		return ServiceInfo{
+			Status:      "unhealthy",
+			LastChecked: now,
+			Message:     "Blockchain not initialized",
+		}
+	}
+
+	sync := hc.blockchain.GetSyncStatus()
+	info := ServiceInfo{
+		Status:      "healthy",
+		LastChecked: now,
+		Message:     fmt.Sprintf("Synced at block %d", sync.CurrentBlock),
+		Details: map[string]interface{}{
+			"syncing":       sync.Syncing,
+			"current_block": sync.CurrentBlock,
+			"highest_block": sync.HighestBlock,
+		},
+	}
+	if sync.Syncing {
+		info.Message = fmt.Sprintf("Syncing: block %d of %d", sync.CurrentBlock, sync.HighestBlock)
+	}
+	if sync.HighestBlock-sync.CurrentBlock > maxSyncLag {
+		info.Status = "degraded"
+	}
+	return info
+}
+
+func (hc *HealthChecker) checkMempool() ServiceInfo {
+	now := time.Now().Unix()
+
+	if hc.blockchain == nil {
+		return ServiceInfo{
+			Status:      "unhealthy",
+			LastChecked: now,
+			Message:     "Blockchain not initialized",
+		}
+	}
+
+	mempool := hc.blockchain.GetMempool()
+	size, gas := mempool.Size(), mempool.PendingGas()
+	info := ServiceInfo{
+		Status:      "healthy",
+		LastChecked: now,
+		Message:     fmt.Sprintf("%d pending transactions", size),
+		Details: map[string]interface{}{
+			"size":        size,
+			"pending_gas": gas,
+		},
+	}
+	blockGasLimit := hc.blockchain.GetConfig().BlockGasLimit
+	if blockGasLimit == 0 {
+		return info
+	}
+
+	// Blocks needed to mine everything pending, rounded up
+	backlog := (gas + blockGasLimit - 1) / blockGasLimit
+	info.Details["backlog_blocks"] = backlog
+	if backlog > maxMempoolBacklog {
+		info.Status = "degraded"
+		info.Message = fmt.Sprintf("%d pending transactions need %d blocks to be mined", size, backlog)
+	}
+	return info
+}
+
 func (hc *HealthChecker) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	health := hc.CheckHealth()
-	
+
 	w.Header().Set("Content-Type", "application/json")
-	
+
 	// Set HTTP status based on health
 	switch health.Status {
 	case "healthy":
@@ -154,7 +245,7 @@ func (hc *HealthChecker) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	default:
 		w.WriteHeader(http.StatusServiceUnavailable)
 	}
-	
+
 	if err := json.NewEncoder(w).Encode(health); err != nil {
 		logger.Errorf("Failed to encode health response: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -167,10 +258,10 @@ func (hc *HealthChecker) ReadinessHandler(w http.ResponseWriter, r *http.Request
 		"ready":     true,
 		"timestamp": time.Now().Unix(),
 	}
-	
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	
+
 	if err := json.NewEncoder(w).Encode(ready); err != nil {
 		logger.Errorf("Failed to encode readiness response: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -0,0 +1,80 @@
+package health
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/core/coretest"
+	"blockchain-node/metrics"
+	"bytes"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func newTestChain(t *testing.T) *core.Blockchain {
+	t.Helper()
+	dir := t.TempDir()
+
+	blockchain, err := core.NewBlockchain(&core.Config{
+		DataDir:       filepath.Join(dir, "data"),
+		ChainID:       coretest.ChainID,
+		BlockGasLimit: coretest.BlockGasLimit,
+		GenesisPath:   coretest.WriteGenesis(t, dir, nil),
+	})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	t.Cleanup(func() { blockchain.Close() })
+	return blockchain
+}
+
+func TestMempoolBacklogDegraded(t *testing.T) {
+	blockchain := newTestChain(t)
+	hc := NewHealthChecker(blockchain, nil)
+	key := bytes.Repeat([]byte{0x01}, 32)
+
+	// Every transaction takes a full block
+	for nonce := uint64(0); nonce <= maxMempoolBacklog; nonce++ {
+		if info := hc.checkMempool(); info.Status != "healthy" {
+			t.Fatalf("mempool %s with %d blocks of transactions: %s", info.Status, nonce, info.Message)
+		}
+
+		tx := core.NewTransaction(nonce, &common.Address{0x01}, big.NewInt(0), 8000000, big.NewInt(1), nil)
+		if err := tx.Sign(key, 1337); err != nil {
+			t.Fatal(err)
+		}
+		if err := blockchain.GetMempool().AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info := hc.checkMempool()
+	if info.Status != "degraded" {
+		t.Errorf("mempool %s with %d blocks of transactions", info.Status, maxMempoolBacklog+1)
+	}
+	if backlog := info.Details["backlog_blocks"]; backlog != uint64(maxMempoolBacklog+1) {
+		t.Errorf("backlog %v blocks, expected %d", backlog, maxMempoolBacklog+1)
+	}
+}
+
+func TestSyncStatusBehindPeer(t *testing.T) {
+	blockchain := newTestChain(t)
+	hc := NewHealthChecker(blockchain, nil)
+	if info := hc.checkSync(); info.Status != "healthy" || info.Details["syncing"] != false {
+		t.Fatalf("sync %s, details %v without peers", info.Status, info.Details)
+	}
+
+	// A peer announces a head far beyond ours
+	highest := uint64(maxSyncLag + 10)
+	blockchain.UpdateHighestBlock(highest)
+
+	info := hc.checkSync()
+	if info.Status != "degraded" || info.Details["syncing"] != true || info.Details["highest_block"] != highest {
+		t.Errorf("sync %s, details %v behind a peer at %d", info.Status, info.Details, highest)
+	}
+	values := metrics.GetMetrics().ToMap()
+	if values["syncing"] != true || values["current_block"] != uint64(0) || values["highest_block"] != highest {
+		t.Errorf("metrics syncing %v, current %v, highest %v", values["syncing"], values["current_block"], values["highest_block"])
+	}
+}
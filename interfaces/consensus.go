@@ -1,4 +1,3 @@
-
 package interfaces
 
 import (
@@ -23,6 +22,7 @@ type Block interface {
 	GetHeader() BlockHeader
 	GetTransactions() []interface{}
 	CalculateHash() [32]byte
+	SealData() []byte // header encoding the proof of work hash is computed from
 }
 
 // Engine represents the consensus engine interface
@@ -1,4 +1,3 @@
-
 package interfaces
 
 import (
@@ -9,10 +8,14 @@ import (
 type ExecutionContext struct {
 	Transaction interface{}
 	BlockHeader interface{}
+	StateDB     interface{} // state to execute against, nil uses the VM's own
 	From        [20]byte
 	To          *[20]byte
 	Value       *big.Int
+	GasPrice    *big.Int // price per gas charged to From, nil is zero
+	Coinbase    [20]byte // receives the gas fee, the zero address burns it
 	Data        []byte
+	Done        <-chan struct{} // closed to abort execution, may be nil
 }
 
 // ExecutionResult represents the result of transaction execution
@@ -22,6 +25,7 @@ type ExecutionResult struct {
 	Logs            []ExecutionLog
 	Status          uint64
 	Error           error
+	ReturnData      []byte // output of the call, or the revert data if it reverted
 }
 
 // ExecutionLog represents a log entry from contract execution
@@ -37,17 +37,17 @@ func init() {
 
 func NewLogger() *Logger {
 	logger := logrus.New()
-	
+
 	// Create logs directory if it doesn't exist
 	logsDir := "logs"
 	if err := os.MkdirAll(logsDir, 0755); err != nil {
 		log.Printf("Failed to create logs directory: %v", err)
 	}
-	
+
 	// Create log file with timestamp
 	timestamp := time.Now().Format("2006-01-02")
 	logFilePath := filepath.Join(logsDir, fmt.Sprintf("blockchain-%s.log", timestamp))
-	
+
 	var err error
 	logFile, err = os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
@@ -58,7 +58,7 @@ func NewLogger() *Logger {
 		multiWriter := io.MultiWriter(os.Stdout, logFile)
 		logger.SetOutput(multiWriter)
 	}
-	
+
 	// Set custom formatter
 	logger.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp:   true,
@@ -68,30 +68,32 @@ func NewLogger() *Logger {
 			return fmt.Sprintf("%s()", f.Function), fmt.Sprintf("%s:%d", filename, f.Line)
 		},
 	})
-	
+
 	logger.SetReportCaller(true)
 	logger.SetLevel(logrus.InfoLevel)
-	
+
 	return &Logger{Logger: logger}
 }
 
 func SetLevel(level LogLevel) {
-	var logrusLevel logrus.Level
+	defaultLogger.SetLevel(toLogrusLevel(level))
+}
+
+func toLogrusLevel(level LogLevel) logrus.Level {
 	switch level {
 	case DEBUG:
-		logrusLevel = logrus.DebugLevel
+		return logrus.DebugLevel
 	case INFO:
-		logrusLevel = logrus.InfoLevel
+		return logrus.InfoLevel
 	case WARNING:
-		logrusLevel = logrus.WarnLevel
+		return logrus.WarnLevel
 	case ERROR:
-		logrusLevel = logrus.ErrorLevel
+		return logrus.ErrorLevel
 	case FATAL:
-		logrusLevel = logrus.FatalLevel
+		return logrus.FatalLevel
 	default:
-		logrusLevel = logrus.InfoLevel
+		return logrus.InfoLevel
 	}
-	defaultLogger.SetLevel(logrusLevel)
 }
 
 func GetLogger() *Logger {
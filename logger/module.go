@@ -0,0 +1,113 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	moduleMu     sync.RWMutex
+	moduleLevels = make(map[string]*logrus.Logger)
+)
+
+// ModuleLogger logs under a module name. Its level follows the override set
+// with SetModuleLevel, or the global level if there is none.
+type ModuleLogger struct {
+	name string
+}
+
+// Module returns the logger of the named module
+func Module(name string) *ModuleLogger {
+	return &ModuleLogger{name: name}
+}
+
+// SetModuleLevel overrides the log level of a single module
+func SetModuleLevel(module string, level LogLevel) {
+	moduleLogger := logrus.New()
+	moduleLogger.SetOutput(defaultLogger.Out)
+	moduleLogger.SetFormatter(defaultLogger.Formatter)
+	moduleLogger.SetReportCaller(defaultLogger.ReportCaller)
+	moduleLogger.SetLevel(toLogrusLevel(level))
+
+	moduleMu.Lock()
+	defer moduleMu.Unlock()
+	moduleLevels[module] = moduleLogger
+}
+
+// ParseLevel parses a level name such as "debug" or "warn"
+func ParseLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DEBUG, nil
+	case "info":
+		return INFO, nil
+	case "warn", "warning":
+		return WARNING, nil
+	case "error":
+		return ERROR, nil
+	case "fatal":
+		return FATAL, nil
+	default:
+		return INFO, fmt.Errorf("unknown log level: %s", name)
+	}
+}
+
+func (m *ModuleLogger) entry() *logrus.Entry {
+	moduleMu.RLock()
+	moduleLogger, ok := moduleLevels[m.name]
+	moduleMu.RUnlock()
+
+	if !ok {
+		moduleLogger = defaultLogger.Logger
+	}
+	return moduleLogger.WithField("module", m.name)
+}
+
+func (m *ModuleLogger) Debug(args ...interface{}) {
+	m.entry().Debug(args...)
+}
+
+func (m *ModuleLogger) Debugf(format string, args ...interface{}) {
+	m.entry().Debugf(format, args...)
+}
+
+func (m *ModuleLogger) Info(args ...interface{}) {
+	m.entry().Info(args...)
+}
+
+func (m *ModuleLogger) Infof(format string, args ...interface{}) {
+	m.entry().Infof(format, args...)
+}
+
+func (m *ModuleLogger) Warning(args ...interface{}) {
+	m.entry().Warning(args...)
+}
+
+func (m *ModuleLogger) Warningf(format string, args ...interface{}) {
+	m.entry().Warningf(format, args...)
+}
+
+func (m *ModuleLogger) Error(args ...interface{}) {
+	m.entry().Error(args...)
+}
+
+func (m *ModuleLogger) Errorf(format string, args ...interface{}) {
+	m.entry().Errorf(format, args...)
+}
+
+func (m *ModuleLogger) Fatal(args ...interface{}) {
+	m.entry().Fatal(args...)
+}
+
+func (m *ModuleLogger) Fatalf(format string, args ...interface{}) {
+	m.entry().Fatalf(format, args...)
+}
+
+// WithFields returns an entry of the module logger carrying fields, for
+// structured log lines
+func (m *ModuleLogger) WithFields(fields map[string]interface{}) *logrus.Entry {
+	return m.entry().WithFields(fields)
+}
@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestModuleLevels(t *testing.T) {
+	var out bytes.Buffer
+	output := defaultLogger.Out
+	defaultLogger.SetOutput(&out)
+	t.Cleanup(func() {
+		defaultLogger.SetOutput(output)
+		moduleMu.Lock()
+		delete(moduleLevels, "verbose")
+		delete(moduleLevels, "quiet")
+		moduleMu.Unlock()
+	})
+
+	SetModuleLevel("verbose", DEBUG)
+	SetModuleLevel("quiet", INFO)
+
+	Module("verbose").Debug("verbose debug line")
+	Module("quiet").Debug("quiet debug line")
+	Module("quiet").Info("quiet info line")
+
+	logged := out.String()
+	if !strings.Contains(logged, "verbose debug line") || !strings.Contains(logged, "module=verbose") {
+		t.Errorf("debug line of the debug module missing:\n%s", logged)
+	}
+	if strings.Contains(logged, "quiet debug line") {
+		t.Errorf("debug line of the info module logged:\n%s", logged)
+	}
+	if !strings.Contains(logged, "quiet info line") {
+		t.Errorf("info line of the info module missing:\n%s", logged)
+	}
+}
@@ -1,32 +1,68 @@
-
 package metrics
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 type Metrics struct {
-	TransactionCount     uint64
-	BlockCount          uint64
-	PeerCount           uint32
-	TotalHashRate       uint64
-	NetworkLatency      time.Duration
-	MemoryUsage         uint64
-	DiskUsage           uint64
-	ConnectionCount     uint32
-	ErrorCount          uint64
-	StartTime           time.Time
-	LastBlockTime       time.Time
-	TransactionPool     uint32
-	mutex               sync.RWMutex
+	TransactionCount  uint64
+	BlockCount        uint64
+	PeerCount         uint32
+	TotalHashRate     uint64
+	NetworkLatency    time.Duration
+	MemoryUsage       uint64
+	DiskUsage         uint64
+	ConnectionCount   uint32
+	ErrorCount        uint64
+	StartTime         time.Time
+	LastBlockTime     time.Time
+	TransactionPool   uint32
+	HandshakeFailures map[string]uint64
+	UncompressedBytes uint64
+	CompressedBytes   uint64
+	RPCRequests       map[string]*RPCMethodStats
+	P2PBytesSent      uint64
+	P2PBytesReceived  uint64
+	P2PMessages       map[string]*P2PMessageStats
+	Syncing           bool
+	CurrentBlock      uint64
+	HighestBlock      uint64
+	AvgBlockTime      float64 // seconds, over the recent blocks
+	MinBlockTime      int64
+	MaxBlockTime      int64
+	mutex             sync.RWMutex
+}
+
+// P2PMessageStats holds the traffic of one P2P message type
+type P2PMessageStats struct {
+	Sent          uint64
+	Received      uint64
+	BytesSent     uint64
+	BytesReceived uint64
+}
+
+// rpcLatencyBuckets are the upper bounds, in seconds, of the RPC latency histogram
+var rpcLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// RPCMethodStats holds the request count and latency histogram of one RPC method
+type RPCMethodStats struct {
+	Count         uint64
+	TotalDuration time.Duration
+	Buckets       []uint64 // cumulative counts per rpcLatencyBuckets bound
 }
 
 var globalMetrics *Metrics
 
 func init() {
 	globalMetrics = &Metrics{
-		StartTime: time.Now(),
+		StartTime:         time.Now(),
+		HandshakeFailures: make(map[string]uint64),
+		RPCRequests:       make(map[string]*RPCMethodStats),
+		P2PMessages:       make(map[string]*P2PMessageStats),
 	}
 }
 
@@ -34,12 +70,53 @@ func GetMetrics() *Metrics {
 	return globalMetrics
 }
 
+// Reset zeroes the counters and restarts the uptime, so rates such as blocks
+// per second are measured from now on. Gauges describing the current state of
+// the node, such as the peer count, sync status and mempool size, are kept.
+func (m *Metrics) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.TransactionCount = 0
+	m.BlockCount = 0
+	m.ErrorCount = 0
+	m.StartTime = time.Now()
+	m.LastBlockTime = time.Time{}
+	m.HandshakeFailures = make(map[string]uint64)
+	m.UncompressedBytes = 0
+	m.CompressedBytes = 0
+	m.RPCRequests = make(map[string]*RPCMethodStats)
+	m.P2PBytesSent = 0
+	m.P2PBytesReceived = 0
+	m.P2PMessages = make(map[string]*P2PMessageStats)
+}
+
 func (m *Metrics) IncrementTransactionCount() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.TransactionCount++
 }
 
+// SetTransactionCount seeds the transaction counter, e.g. from a loaded chain
+func (m *Metrics) SetTransactionCount(count uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.TransactionCount = count
+}
+
+// SetBlockCount seeds the block counter, e.g. from a loaded chain
+func (m *Metrics) SetBlockCount(count uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.BlockCount = count
+}
+
+func (m *Metrics) GetTransactionCount() uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.TransactionCount
+}
+
 func (m *Metrics) IncrementBlockCount() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -47,12 +124,38 @@ func (m *Metrics) IncrementBlockCount() {
 	m.LastBlockTime = time.Now()
 }
 
+// SetSyncStatus records the local head and the highest block announced by
+// peers
+func (m *Metrics) SetSyncStatus(syncing bool, currentBlock, highestBlock uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Syncing = syncing
+	m.CurrentBlock = currentBlock
+	m.HighestBlock = highestBlock
+}
+
+// SetBlockTimeStats records the average, shortest and longest time in
+// seconds between the recent blocks
+func (m *Metrics) SetBlockTimeStats(avg float64, min, max int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.AvgBlockTime = avg
+	m.MinBlockTime = min
+	m.MaxBlockTime = max
+}
+
 func (m *Metrics) SetPeerCount(count uint32) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.PeerCount = count
 }
 
+func (m *Metrics) GetPeerCount() uint32 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.PeerCount
+}
+
 func (m *Metrics) SetHashRate(hashRate uint64) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -89,12 +192,113 @@ func (m *Metrics) IncrementErrorCount() {
 	m.ErrorCount++
 }
 
+// SetErrorCount restores the cumulative error count persisted by a previous run
+func (m *Metrics) SetErrorCount(count uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.ErrorCount = count
+}
+
+func (m *Metrics) GetErrorCount() uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.ErrorCount
+}
+
 func (m *Metrics) SetTransactionPoolSize(size uint32) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.TransactionPool = size
 }
 
+// IncrementHandshakeFailure counts a failed P2P handshake by reason code
+func (m *Metrics) IncrementHandshakeFailure(reason string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.HandshakeFailures[reason]++
+}
+
+// AddCompressionStats records the size of a P2P payload before and after compression
+func (m *Metrics) AddCompressionStats(uncompressed, compressed uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.UncompressedBytes += uncompressed
+	m.CompressedBytes += compressed
+}
+
+// RecordP2PMessageSent counts a message of the given type sent to a peer
+func (m *Metrics) RecordP2PMessageSent(msgType string, size uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := m.p2pMessageStats(msgType)
+	stats.Sent++
+	stats.BytesSent += size
+	m.P2PBytesSent += size
+}
+
+// RecordP2PMessageReceived counts a message of the given type read from a peer
+func (m *Metrics) RecordP2PMessageReceived(msgType string, size uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := m.p2pMessageStats(msgType)
+	stats.Received++
+	stats.BytesReceived += size
+	m.P2PBytesReceived += size
+}
+
+// GetP2PMessageCount returns how many messages of the type were sent and received
+func (m *Metrics) GetP2PMessageCount(msgType string) (sent, received uint64) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if stats, exists := m.P2PMessages[msgType]; exists {
+		return stats.Sent, stats.Received
+	}
+	return 0, 0
+}
+
+func (m *Metrics) p2pMessageStats(msgType string) *P2PMessageStats {
+	stats, exists := m.P2PMessages[msgType]
+	if !exists {
+		stats = &P2PMessageStats{}
+		m.P2PMessages[msgType] = stats
+	}
+	return stats
+}
+
+// RecordRPCRequest counts a served RPC request and its latency
+func (m *Metrics) RecordRPCRequest(method string, duration time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats, exists := m.RPCRequests[method]
+	if !exists {
+		stats = &RPCMethodStats{Buckets: make([]uint64, len(rpcLatencyBuckets))}
+		m.RPCRequests[method] = stats
+	}
+
+	stats.Count++
+	stats.TotalDuration += duration
+	for i, bound := range rpcLatencyBuckets {
+		if duration.Seconds() <= bound {
+			stats.Buckets[i]++
+		}
+	}
+}
+
+// GetRPCRequestCount returns how many requests were served for the method
+func (m *Metrics) GetRPCRequestCount(method string) uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if stats, exists := m.RPCRequests[method]; exists {
+		return stats.Count
+	}
+	return 0
+}
+
 func (m *Metrics) GetUptime() time.Duration {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
@@ -104,7 +308,7 @@ func (m *Metrics) GetUptime() time.Duration {
 func (m *Metrics) GetBlocksPerSecond() float64 {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
+
 	uptime := time.Since(m.StartTime)
 	if uptime.Seconds() == 0 {
 		return 0
@@ -115,7 +319,7 @@ func (m *Metrics) GetBlocksPerSecond() float64 {
 func (m *Metrics) GetTransactionsPerSecond() float64 {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
+
 	uptime := time.Since(m.StartTime)
 	if uptime.Seconds() == 0 {
 		return 0
@@ -126,21 +330,139 @@ func (m *Metrics) GetTransactionsPerSecond() float64 {
 func (m *Metrics) ToMap() map[string]interface{} {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
+
+	handshakeFailures := make(map[string]uint64, len(m.HandshakeFailures))
+	for reason, count := range m.HandshakeFailures {
+		handshakeFailures[reason] = count
+	}
+
+	rpcRequests := make(map[string]interface{}, len(m.RPCRequests))
+	for method, stats := range m.RPCRequests {
+		rpcRequests[method] = map[string]interface{}{
+			"count":          stats.Count,
+			"avg_latency_ms": float64(stats.TotalDuration.Milliseconds()) / float64(stats.Count),
+		}
+	}
+
+	p2pMessages := make(map[string]interface{}, len(m.P2PMessages))
+	for msgType, stats := range m.P2PMessages {
+		p2pMessages[msgType] = map[string]interface{}{
+			"sent":           stats.Sent,
+			"received":       stats.Received,
+			"bytes_sent":     stats.BytesSent,
+			"bytes_received": stats.BytesReceived,
+		}
+	}
+
+	compressionRatio := 1.0
+	if m.UncompressedBytes > 0 {
+		compressionRatio = float64(m.CompressedBytes) / float64(m.UncompressedBytes)
+	}
+
 	return map[string]interface{}{
-		"transaction_count":     m.TransactionCount,
-		"block_count":          m.BlockCount,
-		"peer_count":           m.PeerCount,
-		"total_hash_rate":      m.TotalHashRate,
-		"network_latency_ms":   m.NetworkLatency.Milliseconds(),
-		"memory_usage_mb":      m.MemoryUsage / 1024 / 1024,
-		"disk_usage_mb":        m.DiskUsage / 1024 / 1024,
-		"connection_count":     m.ConnectionCount,
-		"error_count":          m.ErrorCount,
-		"uptime_seconds":       time.Since(m.StartTime).Seconds(),
-		"blocks_per_second":    m.GetBlocksPerSecond(),
-		"transactions_per_second": m.GetTransactionsPerSecond(),
-		"transaction_pool_size": m.TransactionPool,
-		"last_block_time":      m.LastBlockTime.Unix(),
+		"transaction_count":        m.TransactionCount,
+		"block_count":              m.BlockCount,
+		"peer_count":               m.PeerCount,
+		"total_hash_rate":          m.TotalHashRate,
+		"network_latency_ms":       m.NetworkLatency.Milliseconds(),
+		"memory_usage_mb":          m.MemoryUsage / 1024 / 1024,
+		"disk_usage_mb":            m.DiskUsage / 1024 / 1024,
+		"connection_count":         m.ConnectionCount,
+		"error_count":              m.ErrorCount,
+		"uptime_seconds":           time.Since(m.StartTime).Seconds(),
+		"blocks_per_second":        m.GetBlocksPerSecond(),
+		"transactions_per_second":  m.GetTransactionsPerSecond(),
+		"transaction_pool_size":    m.TransactionPool,
+		"last_block_time":          m.LastBlockTime.Unix(),
+		"handshake_failures":       handshakeFailures,
+		"p2p_compression_ratio":    compressionRatio,
+		"rpc_requests":             rpcRequests,
+		"p2p_bytes_sent_total":     m.P2PBytesSent,
+		"p2p_bytes_received_total": m.P2PBytesReceived,
+		"p2p_messages":             p2pMessages,
+		"syncing":                  m.Syncing,
+		"current_block":            m.CurrentBlock,
+		"highest_block":            m.HighestBlock,
+		"avg_block_time_seconds":   m.AvgBlockTime,
+		"min_block_time_seconds":   m.MinBlockTime,
+		"max_block_time_seconds":   m.MaxBlockTime,
+	}
+}
+
+// ToPrometheus renders the metrics in the Prometheus text exposition format
+func (m *Metrics) ToPrometheus() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var b strings.Builder
+
+	gauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	gauge("blockchain_transaction_count", "Total number of processed transactions.", m.TransactionCount)
+	gauge("blockchain_block_count", "Total number of processed blocks.", m.BlockCount)
+	gauge("blockchain_peer_count", "Number of connected peers.", m.PeerCount)
+	gauge("blockchain_connection_count", "Number of open P2P connections.", m.ConnectionCount)
+	gauge("blockchain_error_count", "Total number of errors.", m.ErrorCount)
+	gauge("blockchain_transaction_pool_size", "Number of transactions in the mempool.", m.TransactionPool)
+	gauge("blockchain_memory_usage_bytes", "Memory used by the node.", m.MemoryUsage)
+	gauge("blockchain_uptime_seconds", "Seconds since the node started.", time.Since(m.StartTime).Seconds())
+	syncing := 0
+	if m.Syncing {
+		syncing = 1
+	}
+	gauge("blockchain_syncing", "1 while the node is behind the highest known block.", syncing)
+	gauge("blockchain_current_block", "Number of the local head block.", m.CurrentBlock)
+	gauge("blockchain_highest_block", "Highest block number announced by peers.", m.HighestBlock)
+	gauge("blockchain_block_time_avg_seconds", "Average time between the recent blocks.", m.AvgBlockTime)
+	gauge("blockchain_block_time_min_seconds", "Shortest time between the recent blocks.", m.MinBlockTime)
+	gauge("blockchain_block_time_max_seconds", "Longest time between the recent blocks.", m.MaxBlockTime)
+
+	b.WriteString("# HELP p2p_bytes_sent_total Total bytes sent to peers.\n")
+	b.WriteString("# TYPE p2p_bytes_sent_total counter\n")
+	fmt.Fprintf(&b, "p2p_bytes_sent_total %d\n", m.P2PBytesSent)
+	b.WriteString("# HELP p2p_bytes_received_total Total bytes received from peers.\n")
+	b.WriteString("# TYPE p2p_bytes_received_total counter\n")
+	fmt.Fprintf(&b, "p2p_bytes_received_total %d\n", m.P2PBytesReceived)
+
+	msgTypes := make([]string, 0, len(m.P2PMessages))
+	for msgType := range m.P2PMessages {
+		msgTypes = append(msgTypes, msgType)
+	}
+	sort.Strings(msgTypes)
+
+	b.WriteString("# HELP p2p_messages_total Total number of P2P messages by type and direction.\n")
+	b.WriteString("# TYPE p2p_messages_total counter\n")
+	for _, msgType := range msgTypes {
+		stats := m.P2PMessages[msgType]
+		fmt.Fprintf(&b, "p2p_messages_total{type=%q,direction=\"sent\"} %d\n", msgType, stats.Sent)
+		fmt.Fprintf(&b, "p2p_messages_total{type=%q,direction=\"received\"} %d\n", msgType, stats.Received)
 	}
+
+	// Sort methods so the output is stable between scrapes
+	methods := make([]string, 0, len(m.RPCRequests))
+	for method := range m.RPCRequests {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	b.WriteString("# HELP rpc_requests_total Total number of RPC requests by method.\n")
+	b.WriteString("# TYPE rpc_requests_total counter\n")
+	for _, method := range methods {
+		fmt.Fprintf(&b, "rpc_requests_total{method=%q} %d\n", method, m.RPCRequests[method].Count)
+	}
+
+	b.WriteString("# HELP rpc_request_duration_seconds RPC request latency by method.\n")
+	b.WriteString("# TYPE rpc_request_duration_seconds histogram\n")
+	for _, method := range methods {
+		stats := m.RPCRequests[method]
+		for i, bound := range rpcLatencyBuckets {
+			fmt.Fprintf(&b, "rpc_request_duration_seconds_bucket{method=%q,le=\"%g\"} %d\n", method, bound, stats.Buckets[i])
+		}
+		fmt.Fprintf(&b, "rpc_request_duration_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", method, stats.Count)
+		fmt.Fprintf(&b, "rpc_request_duration_seconds_sum{method=%q} %g\n", method, stats.TotalDuration.Seconds())
+		fmt.Fprintf(&b, "rpc_request_duration_seconds_count{method=%q} %d\n", method, stats.Count)
+	}
+
+	return b.String()
 }
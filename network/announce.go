@@ -0,0 +1,150 @@
+package network
+
+import (
+	"blockchain-node/core"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// fullBlockPushPeers is how many peers are sent a new block in full right
+// away. The other peers are only sent its hash and fetch the block with
+// getdata if they don't have it yet.
+const fullBlockPushPeers = 3
+
+// maxKnownHashes bounds the number of block or transaction hashes
+// remembered per peer
+const maxKnownHashes = 1024
+
+type blockAnnouncement struct {
+	Hash   [32]byte `json:"hash"`
+	Number uint64   `json:"number"`
+}
+
+// knownHashes is the set of blocks or transactions a peer is known to have,
+// because it sent or announced them to us or we sent them to it
+type knownHashes struct {
+	hashes map[[32]byte]struct{}
+	mu     sync.Mutex
+}
+
+func (k *knownHashes) add(hash [32]byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.hashes == nil {
+		k.hashes = make(map[[32]byte]struct{})
+	}
+	// Forget an arbitrary hash to make room, at worst it is sent twice
+	if len(k.hashes) >= maxKnownHashes {
+		for known := range k.hashes {
+			delete(k.hashes, known)
+			break
+		}
+	}
+	k.hashes[hash] = struct{}{}
+}
+
+func (k *knownHashes) has(hash [32]byte) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, ok := k.hashes[hash]
+	return ok
+}
+
+// broadcastBlocks relays the blocks added to the chain to peers, both mined
+// ones and those received from peers, until ctx is done. Blocks that are no
+// longer the head by the time they are relayed, such as those added in a
+// batch while syncing, are old news to the network and skipped.
+func (s *Server) broadcastBlocks(ctx context.Context) {
+	blocks, unsubscribe := s.blockchain.SubscribeNewBlock()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case block, ok := <-blocks:
+			if !ok {
+				return
+			}
+			if head := s.blockchain.GetCurrentBlock(); head == nil || head.Header.Hash != block.Header.Hash {
+				continue
+			}
+			s.BroadcastBlock(block)
+		}
+	}
+}
+
+// BroadcastBlock sends block to the first fullBlockPushPeers peers and
+// announces its hash to the others, so peers that already have it don't
+// download it again. Peers known to have the block are skipped, and peers
+// that don't understand announcements always get the full block.
+func (s *Server) BroadcastBlock(block *core.Block) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := block.Header.Hash
+	full := &Message{
+		Type: "block",
+		Data: block,
+	}
+	announcement := &Message{
+		Type: "newblockhash",
+		Data: blockAnnouncement{Hash: hash, Number: block.Header.Number},
+	}
+
+	pushed := 0
+	for _, peer := range s.peers {
+		if !peer.handshaked || peer.known.has(hash) {
+			continue
+		}
+
+		if peer.supports(announcement.Type) && pushed >= fullBlockPushPeers {
+			if err := s.sendMessage(peer, announcement); err != nil {
+				log.Debugf("Failed to announce block %d to %s: %v", block.Header.Number, peer.address, err)
+			}
+			continue
+		}
+
+		if peer.supports(full.Type) {
+			if err := s.sendMessage(peer, full); err != nil {
+				log.Debugf("Failed to send block %d to %s: %v", block.Header.Number, peer.address, err)
+				continue
+			}
+			peer.known.add(hash)
+			pushed++
+		}
+	}
+}
+
+// handleNewBlockHash fetches an announced block unless we already have it.
+// If blocks between our head and the announced one are missing as well they
+// are synced first. The announced number is only a claim, the highest known
+// block is raised once the block itself arrives.
+func (s *Server) handleNewBlockHash(peer *Peer, msg *Message) {
+	var announcement blockAnnouncement
+	if err := decodeData(msg, &announcement); err != nil {
+		log.Errorf("Malformed newblockhash from %s: %v", peer.address, err)
+		return
+	}
+	peer.known.add(announcement.Hash)
+
+	if s.blockchain.GetBlockByHash(announcement.Hash) != nil {
+		return
+	}
+
+	current := s.blockchain.GetCurrentBlock()
+	if current != nil && announcement.Number > current.Header.Number+1 {
+		s.requestBlockSync(peer, current.Header.Number+1, announcement.Number)
+		return
+	}
+
+	log.Debugf("Fetching announced block %d from %s", announcement.Number, peer.address)
+	s.sendMessage(peer, &Message{
+		Type: "getdata",
+		Data: map[string]interface{}{
+			"items": []string{fmt.Sprintf("%x", announcement.Hash)},
+		},
+	})
+}
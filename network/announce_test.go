@@ -0,0 +1,62 @@
+package network
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/core/coretest"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// newTestChain creates a chain with an empty genesis block in a temporary
+// directory
+func newTestChain(t *testing.T) *core.Blockchain {
+	t.Helper()
+	return newTestChainAlloc(t, nil)
+}
+
+// newTestChainAlloc is like newTestChain, but funds the accounts of alloc in
+// the genesis block
+func newTestChainAlloc(t *testing.T, alloc map[[20]byte]*big.Int) *core.Blockchain {
+	t.Helper()
+	dir := t.TempDir()
+
+	blockchain, err := core.NewBlockchain(&core.Config{
+		DataDir:       filepath.Join(dir, "data"),
+		ChainID:       coretest.ChainID,
+		BlockGasLimit: coretest.BlockGasLimit,
+		GenesisPath:   coretest.WriteGenesis(t, dir, alloc),
+	})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	t.Cleanup(func() { blockchain.Close() })
+	return blockchain
+}
+
+// newTestPeer returns a peer whose messages are discarded
+func newTestPeer(t *testing.T) *Peer {
+	local, remote := net.Pipe()
+	go io.Copy(io.Discard, remote)
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+	return &Peer{conn: local, address: "test-peer"}
+}
+
+func TestBlockAnnouncementDoesNotRaiseHighestBlock(t *testing.T) {
+	blockchain := newTestChain(t)
+	s := NewServer(0, blockchain)
+
+	s.handleNewBlockHash(newTestPeer(t), &Message{
+		Type: "newblockhash",
+		Data: blockAnnouncement{Hash: [32]byte{1}, Number: 1000000},
+	})
+
+	if status := blockchain.GetSyncStatus(); status.HighestBlock != 0 || status.Syncing {
+		t.Errorf("announcement raised the highest block to %d", status.HighestBlock)
+	}
+}
@@ -0,0 +1,173 @@
+package network
+
+import (
+	"blockchain-node/utils"
+	"context"
+	"sync"
+	"time"
+)
+
+// dialInterval is how often the dial loop checks for boot nodes to connect to
+const dialInterval = 5 * time.Second
+
+// Default backoff of boot nodes that can't be dialed. The delay doubles with
+// every failed dial or handshake up to the maximum and is reset by a
+// completed handshake, so a node that accepts connections but refuses the
+// handshake is not redialed at the dial interval.
+const (
+	defaultDialBackoff    = 5 * time.Second
+	defaultMaxDialBackoff = 5 * time.Minute
+)
+
+// maxRedialFailures is how many dials in a row may fail before a
+// disconnected peer is no longer redialed. Boot nodes are redialed forever.
+const maxRedialFailures = 5
+
+// dialState tracks the boot nodes the server keeps connections with, and the
+// disconnected peers it redials at their announced listen address
+type dialState struct {
+	mu         sync.Mutex
+	bootNodes  []string
+	peers      map[string]bool      // listen addresses of disconnected peers
+	active     map[string]bool      // nodes being dialed or connected
+	failures   map[string]int       // consecutive failed dials
+	nextDial   map[string]time.Time // when a failed node may be dialed again
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func newDialState() *dialState {
+	return &dialState{
+		peers:      make(map[string]bool),
+		active:     make(map[string]bool),
+		failures:   make(map[string]int),
+		nextDial:   make(map[string]time.Time),
+		backoff:    defaultDialBackoff,
+		maxBackoff: defaultMaxDialBackoff,
+	}
+}
+
+// SetBootNodes sets the peer addresses the server dials on start and redials
+// whenever the connection is lost
+func (s *Server) SetBootNodes(addresses []string) {
+	s.dials.mu.Lock()
+	defer s.dials.mu.Unlock()
+	s.dials.bootNodes = append([]string(nil), addresses...)
+}
+
+// SetDialBackoff sets the delay before redialing a boot node after a failed
+// dial, which doubles with every further failure up to maxBackoff. Zero or
+// less keeps the default.
+func (s *Server) SetDialBackoff(backoff, maxBackoff time.Duration) {
+	s.dials.mu.Lock()
+	defer s.dials.mu.Unlock()
+	if backoff > 0 {
+		s.dials.backoff = backoff
+	}
+	if maxBackoff > 0 {
+		s.dials.maxBackoff = maxBackoff
+	}
+}
+
+// dialLoop keeps connections with the boot nodes and redials disconnected
+// peers until ctx is done
+func (s *Server) dialLoop(ctx context.Context) {
+	ticker := time.NewTicker(dialInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, address := range s.dials.due(time.Now()) {
+			go s.dialNode(address)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dialNode dials a boot node or peer at address and records the outcome of
+// the dial and the handshake for the backoff
+func (s *Server) dialNode(address string) {
+	handshakeDone := func(ok bool) {
+		if !ok {
+			delay := s.dials.failed(address, time.Now())
+			log.Warningf("Handshake with %s failed, retrying in %v", address, delay)
+			return
+		}
+		s.dials.succeeded(address)
+		log.Infof("Connected to %s", address)
+	}
+	err := s.connect(address, handshakeDone, func() {
+		s.dials.mu.Lock()
+		defer s.dials.mu.Unlock()
+		delete(s.dials.active, address)
+	})
+	if err != nil {
+		delay := s.dials.failed(address, time.Now())
+		log.Warningf("Failed to connect to %s, retrying in %v: %v", address, delay, err)
+	}
+}
+
+// addPeer redials a disconnected peer at its listen address from now on,
+// until it can't be reached maxRedialFailures times in a row
+func (d *dialState) addPeer(address string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, bootNode := range d.bootNodes {
+		if bootNode == address {
+			return
+		}
+	}
+	d.peers[address] = true
+}
+
+// due returns the boot nodes and peers that are neither active nor backing
+// off, and marks them active
+func (d *dialState) due(now time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	addresses := append([]string(nil), d.bootNodes...)
+	for address := range d.peers {
+		addresses = append(addresses, address)
+	}
+
+	var due []string
+	for _, address := range addresses {
+		if d.active[address] || now.Before(d.nextDial[address]) {
+			continue
+		}
+		d.active[address] = true
+		due = append(due, address)
+	}
+	return due
+}
+
+// failed records a failed dial of address and returns the delay until it is
+// dialed again
+func (d *dialState) failed(address string, now time.Time) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.active, address)
+	delay := utils.BackoffDelay(d.failures[address], d.backoff, d.maxBackoff)
+	d.failures[address]++
+	d.nextDial[address] = now.Add(delay)
+
+	if d.peers[address] && d.failures[address] >= maxRedialFailures {
+		delete(d.peers, address)
+		delete(d.failures, address)
+		delete(d.nextDial, address)
+	}
+	return delay
+}
+
+func (d *dialState) succeeded(address string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.failures, address)
+	delete(d.nextDial, address)
+}
@@ -0,0 +1,106 @@
+package network
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialBackoffKeptOnFailedHandshake(t *testing.T) {
+	// A boot node that accepts connections but never handshakes
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	s := NewServer(0, newTestChain(t))
+	address := listener.Addr().String()
+	s.SetBootNodes([]string{address})
+	if due := s.dials.due(time.Now()); len(due) != 1 {
+		t.Fatalf("%d boot nodes due, expected 1", len(due))
+	}
+	s.dialNode(address)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.dials.mu.Lock()
+		failures := s.dials.failures[address]
+		s.dials.mu.Unlock()
+		if failures == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failed handshake not counted, %d failures", failures)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if due := s.dials.due(time.Now()); len(due) != 0 {
+		t.Errorf("boot node redialed right after a failed handshake")
+	}
+}
+
+func TestVersionMessageAdvertisesListenAddr(t *testing.T) {
+	s := NewServer(30303, newTestChain(t))
+	s.SetBindAddr("0.0.0.0")
+	s.SetAdvertiseAddr("203.0.113.7:30303")
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	go s.performHandshake(&Peer{conn: local, address: "test-peer"})
+
+	var msg Message
+	if err := json.NewDecoder(remote).Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var version VersionMessage
+	if err := json.Unmarshal(data, &version); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "version" || version.ListenAddr != "203.0.113.7:30303" {
+		t.Errorf("%s message announces %q, expected the advertise address", msg.Type, version.ListenAddr)
+	}
+}
+
+func TestDisconnectedPeerRedialed(t *testing.T) {
+	d := newDialState()
+	d.bootNodes = []string{"10.0.0.1:30303"}
+	d.addPeer("10.0.0.1:30303")
+	d.addPeer("10.0.0.2:30303")
+	if len(d.peers) != 1 {
+		t.Fatalf("%d peers to redial, expected 1", len(d.peers))
+	}
+
+	now := time.Now()
+	for i := 0; i < maxRedialFailures; i++ {
+		if due := d.due(now); len(due) != 2 {
+			t.Fatalf("dial %d: %d nodes due, expected 2", i, len(due))
+		}
+		d.failed("10.0.0.1:30303", now)
+		d.failed("10.0.0.2:30303", now)
+		now = now.Add(time.Hour)
+	}
+
+	if d.peers["10.0.0.2:30303"] {
+		t.Error("unreachable peer still redialed")
+	}
+	if due := d.due(now); len(due) != 1 || due[0] != "10.0.0.1:30303" {
+		t.Errorf("due %v, expected only the boot node", due)
+	}
+}
@@ -0,0 +1,321 @@
+package network
+
+import (
+	"blockchain-node/core"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sync modes selectable with SetSyncMode. A full sync replays every block
+// from the local head, a fast sync downloads the headers up to a pivot block
+// near the peer's head, imports the state snapshot at the pivot and replays
+// only the blocks after it.
+const (
+	SyncModeFull = "full"
+	SyncModeFast = "fast"
+)
+
+// defaultPivotDistance is how many blocks below the peer's head the fast
+// sync pivot is placed unless configured otherwise
+const defaultPivotDistance = 64
+
+// maxHeadersPerRequest caps the number of headers sent in one message
+const maxHeadersPerRequest = 512
+
+// snapshotInterval is how often a remote IP is served a state snapshot.
+// Dumping the state is expensive, requests within the interval get an empty
+// snapshot.
+const snapshotInterval = time.Minute
+
+// ErrSnapshotTooLarge is logged when the requested snapshot doesn't fit in a
+// message
+var ErrSnapshotTooLarge = errors.New("snapshot exceeds the message size limit")
+
+// fastSync is a fast sync in progress with a single peer
+type fastSync struct {
+	peer    *Peer
+	pivot   uint64
+	last    *core.BlockHeader   // last verified header
+	headers []*core.BlockHeader // verified headers up to last
+}
+
+type headersRequest struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+type snapshotRequest struct {
+	Number uint64 `json:"number"`
+}
+
+// SetSyncMode selects how the node catches up with peers ahead of it. In
+// fast mode the pivot is placed pivotDistance blocks below the peer's head,
+// peers less than that far ahead are synced in full.
+func (s *Server) SetSyncMode(mode string, pivotDistance uint64) {
+	s.syncMode = mode
+	s.pivotDistance = pivotDistance
+}
+
+// startSync requests the blocks the peer has beyond localHeight, fast syncing
+// when enabled and the peer can serve headers and snapshots
+func (s *Server) startSync(peer *Peer, localHeight uint64) {
+	if s.syncMode != SyncModeFast || peer.bestHeight <= localHeight+s.pivotDistance ||
+		!peer.supports("getheaders") || !peer.supports("getsnapshot") {
+		s.requestBlockSync(peer, localHeight+1, peer.bestHeight)
+		return
+	}
+
+	current := s.blockchain.GetCurrentBlock()
+	if current == nil {
+		s.requestBlockSync(peer, localHeight+1, peer.bestHeight)
+		return
+	}
+
+	s.mu.Lock()
+	if s.fastSync != nil {
+		s.mu.Unlock()
+		log.Debugf("Fast sync already in progress, not syncing with %s", peer.address)
+		return
+	}
+	fs := &fastSync{
+		peer:  peer,
+		pivot: peer.bestHeight - s.pivotDistance,
+		last:  current.Header,
+	}
+	s.fastSync = fs
+	s.mu.Unlock()
+
+	log.Infof("Fast syncing with %s to pivot block %d", peer.address, fs.pivot)
+	s.requestHeaders(fs)
+}
+
+// activeFastSync returns the fast sync in progress with peer, if any
+func (s *Server) activeFastSync(peer *Peer) *fastSync {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.fastSync == nil || s.fastSync.peer != peer {
+		return nil
+	}
+	return s.fastSync
+}
+
+// endFastSync forgets the fast sync with peer, if any
+func (s *Server) endFastSync(peer *Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fastSync != nil && s.fastSync.peer == peer {
+		s.fastSync = nil
+	}
+}
+
+// abortFastSync gives up on fast syncing with peer and replays the blocks
+// from the local head instead
+func (s *Server) abortFastSync(peer *Peer, err error) {
+	log.Warningf("Fast sync with %s failed, falling back to full sync: %v", peer.address, err)
+	s.endFastSync(peer)
+
+	localHeight := uint64(0)
+	if current := s.blockchain.GetCurrentBlock(); current != nil {
+		localHeight = current.Header.Number
+	}
+	s.requestBlockSync(peer, localHeight+1, peer.bestHeight)
+}
+
+func (s *Server) requestHeaders(fs *fastSync) {
+	from := fs.last.Number + 1
+	to := fs.pivot
+	if to-from >= maxHeadersPerRequest {
+		to = from + maxHeadersPerRequest - 1
+	}
+
+	if err := s.sendMessage(fs.peer, &Message{
+		Type: "getheaders",
+		Data: headersRequest{From: from, To: to},
+	}); err != nil {
+		s.abortFastSync(fs.peer, err)
+	}
+}
+
+func (s *Server) handleGetHeaders(peer *Peer, msg *Message) {
+	var req headersRequest
+	if err := decodeData(msg, &req); err != nil {
+		log.Errorf("Malformed getheaders from %s: %v", peer.address, err)
+		return
+	}
+	if req.To >= req.From+maxHeadersPerRequest {
+		req.To = req.From + maxHeadersPerRequest - 1
+	}
+
+	headers := make([]*core.BlockHeader, 0)
+	for i := req.From; i <= req.To; i++ {
+		block := s.blockchain.GetBlockByNumber(i)
+		if block == nil {
+			break
+		}
+		headers = append(headers, block.Header)
+	}
+
+	s.sendMessage(peer, &Message{
+		Type: "headers",
+		Data: headers,
+	})
+}
+
+func (s *Server) handleHeaders(peer *Peer, msg *Message) {
+	fs := s.activeFastSync(peer)
+	if fs == nil {
+		log.Debugf("Unexpected headers from %s", peer.address)
+		return
+	}
+
+	var headers []*core.BlockHeader
+	if err := decodeData(msg, &headers); err != nil {
+		s.abortFastSync(peer, fmt.Errorf("malformed headers: %v", err))
+		return
+	}
+	if len(headers) == 0 {
+		s.abortFastSync(peer, errors.New("peer returned no headers"))
+		return
+	}
+	if last := headers[len(headers)-1]; last != nil && last.Number > fs.pivot {
+		s.abortFastSync(peer, fmt.Errorf("header %d is past the pivot", last.Number))
+		return
+	}
+	if err := s.blockchain.VerifyHeaders(fs.last, headers); err != nil {
+		s.abortFastSync(peer, err)
+		return
+	}
+
+	fs.last = headers[len(headers)-1]
+	fs.headers = append(fs.headers, headers...)
+	s.blockchain.UpdateHighestBlock(fs.last.Number)
+	if fs.last.Number < fs.pivot {
+		s.requestHeaders(fs)
+		return
+	}
+
+	log.Infof("Downloaded headers up to pivot block %d from %s, requesting snapshot", fs.pivot, peer.address)
+	if err := s.sendMessage(peer, &Message{
+		Type: "getsnapshot",
+		Data: snapshotRequest{Number: fs.pivot},
+	}); err != nil {
+		s.abortFastSync(peer, err)
+	}
+}
+
+func (s *Server) handleGetSnapshot(peer *Peer, msg *Message) {
+	var req snapshotRequest
+	if err := decodeData(msg, &req); err != nil {
+		log.Errorf("Malformed getsnapshot from %s: %v", peer.address, err)
+		return
+	}
+
+	// An empty snapshot tells the peer to fall back to a full sync
+	data, err := s.encodeSnapshot(peer, req.Number)
+	if err != nil {
+		log.Warningf("Cannot serve snapshot of block %d to %s: %v", req.Number, peer.address, err)
+		data, _ = json.Marshal(&core.StateSnapshot{})
+	}
+
+	s.sendMessage(peer, &Message{
+		Type: "snapshot",
+		Data: json.RawMessage(data),
+	})
+}
+
+// encodeSnapshot returns the encoded snapshot of block number for peer,
+// unless its IP was served one within snapshotInterval or the snapshot is
+// larger than a peer accepts
+func (s *Server) encodeSnapshot(peer *Peer, number uint64) ([]byte, error) {
+	if !s.allowSnapshot(remoteIP(peer.conn), time.Now()) {
+		return nil, fmt.Errorf("already served a snapshot within %v", snapshotInterval)
+	}
+
+	snapshot, err := s.blockchain.Snapshot(number)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMessageSize {
+		return nil, ErrSnapshotTooLarge
+	}
+	return data, nil
+}
+
+// allowSnapshot reports whether ip may be served a snapshot at now and, if
+// so, records it. Expired records are dropped.
+func (s *Server) allowSnapshot(ip string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for served, at := range s.snapshotsServed {
+		if now.Sub(at) >= snapshotInterval {
+			delete(s.snapshotsServed, served)
+		}
+	}
+	if _, ok := s.snapshotsServed[ip]; ok {
+		return false
+	}
+	s.snapshotsServed[ip] = now
+	return true
+}
+
+func (s *Server) handleSnapshot(peer *Peer, msg *Message) {
+	fs := s.activeFastSync(peer)
+	if fs == nil || fs.last.Number != fs.pivot {
+		log.Debugf("Unexpected snapshot from %s", peer.address)
+		return
+	}
+
+	var snapshot core.StateSnapshot
+	if err := decodeData(msg, &snapshot); err != nil {
+		s.abortFastSync(peer, fmt.Errorf("malformed snapshot: %v", err))
+		return
+	}
+	if snapshot.Block == nil || snapshot.Block.Header == nil {
+		s.abortFastSync(peer, errors.New("peer has no snapshot"))
+		return
+	}
+
+	// The snapshot block must be the pivot whose header chain was verified
+	block := snapshot.Block
+	if block.Header.Hash != fs.last.Hash || block.CalculateHash() != fs.last.Hash {
+		s.abortFastSync(peer, fmt.Errorf("snapshot block %x is not the pivot %x", block.Header.Hash, fs.last.Hash))
+		return
+	}
+	if txRoot, err := core.DeriveTxRoot(block.Transactions); err != nil || txRoot != block.Header.TxHash {
+		s.abortFastSync(peer, core.ErrTxRootMismatch)
+		return
+	}
+
+	// Store the headers below the pivot too, the pivot block itself comes
+	// with the snapshot
+	headers := fs.headers
+	if len(headers) > 0 && headers[len(headers)-1].Number == fs.pivot {
+		headers = headers[:len(headers)-1]
+	}
+	if _, err := s.blockchain.ImportSnapshotWithHeaders(&snapshot, headers); err != nil {
+		s.abortFastSync(peer, err)
+		return
+	}
+	s.endFastSync(peer)
+
+	log.Infof("Fast sync imported state of block %d (%d accounts) from %s", fs.pivot, len(snapshot.Accounts), peer.address)
+	s.requestBlockSync(peer, fs.pivot+1, peer.bestHeight)
+}
+
+// decodeData decodes a message's data into v
+func decodeData(msg *Message, v interface{}) error {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,27 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowSnapshot(t *testing.T) {
+	s := &Server{snapshotsServed: make(map[string]time.Time)}
+	now := time.Now()
+
+	if !s.allowSnapshot("10.0.0.1", now) {
+		t.Fatal("first snapshot refused")
+	}
+	if s.allowSnapshot("10.0.0.1", now.Add(snapshotInterval/2)) {
+		t.Error("second snapshot within the interval served")
+	}
+	if !s.allowSnapshot("10.0.0.2", now.Add(snapshotInterval/2)) {
+		t.Error("snapshot for another IP refused")
+	}
+	if !s.allowSnapshot("10.0.0.1", now.Add(snapshotInterval)) {
+		t.Error("snapshot after the interval refused")
+	}
+	if len(s.snapshotsServed) != 2 {
+		t.Errorf("%d IPs recorded, expected the expired one dropped", len(s.snapshotsServed))
+	}
+}
@@ -0,0 +1,129 @@
+package network
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// handshake runs the handshake of s with a peer announcing version. It
+// returns the peer, whether s accepted it, and the message s answered with.
+func handshake(t *testing.T, s *Server, version VersionMessage) (*Peer, bool, HandshakeData) {
+	t.Helper()
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	peer := &Peer{conn: local, address: "test-peer"}
+	result := make(chan bool, 1)
+	go func() { result <- s.performHandshake(peer) }()
+
+	decoder := json.NewDecoder(remote)
+	var msg Message
+	if err := decoder.Decode(&msg); err != nil || msg.Type != "version" {
+		t.Fatalf("expected a version message, got %s: %v", msg.Type, err)
+	}
+	if err := json.NewEncoder(remote).Encode(&Message{Type: "version", Data: version}); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var answer HandshakeData
+	if err := json.Unmarshal(data, &answer); err != nil {
+		t.Fatal(err)
+	}
+	return peer, <-result, answer
+}
+
+// peerVersion returns the version message of a compatible peer of s
+func peerVersion(s *Server) VersionMessage {
+	return VersionMessage{
+		Version:            "peer",
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		ChainID:            s.blockchain.GetChainID(),
+		GenesisHash:        s.blockchain.GetGenesisHash(),
+	}
+}
+
+func TestHandshakeChainIDMismatch(t *testing.T) {
+	s := NewServer(0, newTestChain(t))
+	version := peerVersion(s)
+	version.ChainID = 1
+
+	_, ok, answer := handshake(t, s, version)
+	if ok || answer.Success || answer.Reason != ReasonChainIDMismatch {
+		t.Errorf("handshake accepted %v, answer %+v, expected reason %s", ok, answer, ReasonChainIDMismatch)
+	}
+}
+
+func TestHandshakeNegotiatesVersion(t *testing.T) {
+	s := NewServer(0, newTestChain(t))
+	version := peerVersion(s)
+	version.ProtocolVersion = ProtocolVersion + 2
+
+	peer, ok, answer := handshake(t, s, version)
+	if !ok || !answer.Success {
+		t.Fatalf("newer peer rejected: %+v", answer)
+	}
+	if peer.protocolVersion != ProtocolVersion {
+		t.Errorf("negotiated version %d, expected %d", peer.protocolVersion, ProtocolVersion)
+	}
+}
+
+func TestHandshakeRejectsOldPeer(t *testing.T) {
+	s := NewServer(0, newTestChain(t))
+	version := peerVersion(s)
+	version.ProtocolVersion = MinProtocolVersion - 1
+	version.MinProtocolVersion = MinProtocolVersion - 1
+
+	_, ok, answer := handshake(t, s, version)
+	if ok || answer.Success || answer.Reason != ReasonVersionUnsupported {
+		t.Errorf("handshake accepted %v, answer %+v, expected reason %s", ok, answer, ReasonVersionUnsupported)
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	s := NewServer(0, newTestChain(t))
+	s.SetHandshakeTimeout(200 * time.Millisecond)
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	ip, err := s.admitPeer(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan bool, 1)
+	go s.handleConnection(local, ip, func(ok bool) { result <- ok })
+
+	// Read the version of s and never answer
+	var msg Message
+	if err := json.NewDecoder(remote).Decode(&msg); err != nil || msg.Type != "version" {
+		t.Fatalf("expected a version message, got %s: %v", msg.Type, err)
+	}
+	select {
+	case ok := <-result:
+		if ok {
+			t.Fatal("silent peer completed the handshake")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("silent peer not dropped after the handshake timeout")
+	}
+
+	// The connection is closed and the peer never registered
+	remote.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := remote.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read from a dropped peer returned %v, expected EOF", err)
+	}
+	if count := s.GetPeerCount(); count != 0 {
+		t.Errorf("%d peers after the handshake timed out", count)
+	}
+}
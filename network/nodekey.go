@@ -0,0 +1,111 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// LoadNodeKey loads the node key from keyPath, generating it on first use.
+// The key is the node's identity: its public key is the node id reported in
+// the node's enode URL, and it signs the P2P TLS certificate.
+func (s *Server) LoadNodeKey(keyPath string) error {
+	key, err := loadOrCreateNodeKey(keyPath)
+	if err != nil {
+		return err
+	}
+	s.nodeKey = key
+	return nil
+}
+
+// NodeID returns the hex encoded public key of the node key, the X and Y
+// coordinates without the point format prefix. Empty if no key is loaded.
+func (s *Server) NodeID() string {
+	if s.nodeKey == nil {
+		return ""
+	}
+	return nodeIDFromKey(&s.nodeKey.PublicKey)
+}
+
+// nodeIDFromKey returns the node id of a node public key
+func nodeIDFromKey(key *ecdsa.PublicKey) string {
+	pub := elliptic.Marshal(key.Curve, key.X, key.Y)
+	return hex.EncodeToString(pub[1:])
+}
+
+// Enode returns the enode URL of the node, its id and the address announced
+// to peers. A node listening on all interfaces without an advertise address
+// is reported at 127.0.0.1.
+func (s *Server) Enode() string {
+	id := s.NodeID()
+	if id == "" {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(s.listenAddr())
+	if err != nil {
+		return ""
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("enode://%s@%s", id, net.JoinHostPort(host, port))
+}
+
+// splitEnode splits an enode URL into the node id and the host:port to dial.
+// Plain host:port addresses are returned with an empty id.
+func splitEnode(address string) (string, string, error) {
+	if !strings.HasPrefix(address, "enode://") {
+		return "", address, nil
+	}
+	id, hostPort, ok := strings.Cut(strings.TrimPrefix(address, "enode://"), "@")
+	if !ok {
+		return "", "", fmt.Errorf("invalid enode URL %q: missing address", address)
+	}
+	if decoded, err := hex.DecodeString(id); err != nil || len(decoded) != 64 {
+		return "", "", fmt.Errorf("invalid enode URL %q: bad node id", address)
+	}
+	return id, hostPort, nil
+}
+
+func loadOrCreateNodeKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("invalid node key file")
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse node key: %v", err)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read node key: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate node key: %v", err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode node key: %v", err)
+	}
+
+	data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write node key: %v", err)
+	}
+
+	return key, nil
+}
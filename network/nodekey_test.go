@@ -0,0 +1,37 @@
+package network
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNodeIdentityPersisted(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "nodekey.pem")
+	first := &Server{port: 30303}
+	if err := first.LoadNodeKey(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.NodeID()) != 128 {
+		t.Fatalf("node id %q, expected 64 hex encoded bytes", first.NodeID())
+	}
+	if enode := first.Enode(); enode != "enode://"+first.NodeID()+"@127.0.0.1:30303" {
+		t.Errorf("enode URL %s", enode)
+	}
+
+	// A restarted node loads the key generated by the first start
+	restarted := &Server{port: 30303}
+	if err := restarted.LoadNodeKey(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.NodeID() != first.NodeID() {
+		t.Errorf("node id %s after a restart, expected %s", restarted.NodeID(), first.NodeID())
+	}
+
+	other := &Server{port: 30303}
+	if err := other.LoadNodeKey(filepath.Join(t.TempDir(), "nodekey.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if other.NodeID() == first.NodeID() {
+		t.Error("two data directories got the same node id")
+	}
+}
@@ -0,0 +1,67 @@
+package network
+
+// defaultMaxInvalidMessages is the number of messages outside its protocol
+// version a peer may send before it is dropped, unless configured otherwise
+const defaultMaxInvalidMessages = 10
+
+// handshakeMessages are valid in every protocol version, they negotiate it
+var handshakeMessages = map[string]bool{
+	"version":           true,
+	"handshake_error":   true,
+	"handshake_success": true,
+}
+
+// protocolMessages lists the message types valid after the handshake in each
+// supported protocol version. A new protocol version gets its own entry, so
+// peers that negotiated an older one are neither sent messages they can't
+// parse nor allowed to send ones that version doesn't have. Entries below
+// MinProtocolVersion can be removed.
+var protocolMessages = map[uint32][]string{
+	3: supportedMessages,
+}
+
+// messageAllowed reports whether msgType is valid in protocol version
+func messageAllowed(version uint32, msgType string) bool {
+	if handshakeMessages[msgType] {
+		return true
+	}
+	for _, allowed := range protocolMessages[version] {
+		if allowed == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+// statsMessageType returns the type msgType is counted under in the message
+// statistics. Types this node doesn't know are all counted as "unknown", so
+// peers can't add an entry per made up type.
+func statsMessageType(msgType string) string {
+	if handshakeMessages[msgType] {
+		return msgType
+	}
+	for _, known := range supportedMessages {
+		if known == msgType {
+			return msgType
+		}
+	}
+	return "unknown"
+}
+
+// SetMaxInvalidMessages sets how many messages outside the negotiated
+// protocol version a peer may send before it is dropped. Such messages are
+// always ignored, zero or less never drops the peer for them.
+func (s *Server) SetMaxInvalidMessages(limit int) {
+	s.maxInvalidMessages = limit
+}
+
+// rejectMessage ignores a message type the peer's protocol version doesn't
+// have and drops the peer once it sent too many of them
+func (s *Server) rejectMessage(peer *Peer, msgType string) {
+	count := peer.invalidMessages.Add(1)
+	log.Debugf("Ignoring %s message from %s, not part of protocol version %d", msgType, peer.address, peer.protocolVersion)
+
+	if s.maxInvalidMessages > 0 && count >= uint32(s.maxInvalidMessages) {
+		s.dropPeer(peer, "sent too many messages outside its protocol version")
+	}
+}
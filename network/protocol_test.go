@@ -0,0 +1,59 @@
+package network
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestMessageOutsideProtocolVersion(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain := newTestChainAlloc(t, map[[20]byte]*big.Int{crypto.PrivateKeyToAddress(key): big.NewInt(1e18)})
+	s := NewServer(0, blockchain)
+	s.SetMaxInvalidMessages(3)
+
+	// An older protocol version without transaction relay
+	old := uint32(ProtocolVersion - 1)
+	protocolMessages[old] = []string{"block", "newblockhash"}
+	defer delete(protocolMessages, old)
+
+	tx := core.NewTransaction(0, &common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1000), nil)
+	if err := tx.Sign(crypto.FromECDSA(key), 1337); err != nil {
+		t.Fatal(err)
+	}
+
+	peer := newTestPeer(t)
+	peer.handshaked = true
+	peer.protocolVersion = old
+	for i, msgType := range []string{"tx", "made_up"} {
+		s.handleMessage(peer, &Message{Type: msgType, Data: tx})
+		if count := peer.invalidMessages.Load(); count != uint32(i+1) {
+			t.Errorf("%s message: %d invalid messages counted, expected %d", msgType, count, i+1)
+		}
+	}
+	if size := blockchain.GetMempool().Size(); size != 0 {
+		t.Fatalf("transaction outside the protocol version added, %d pending", size)
+	}
+	if peer.dropped.Load() {
+		t.Fatal("peer dropped below the invalid message limit")
+	}
+	s.handleMessage(peer, &Message{Type: "tx", Data: tx})
+	if !peer.dropped.Load() {
+		t.Error("peer not dropped at the invalid message limit")
+	}
+
+	// The same message is handled in the current version
+	current := newTestPeer(t)
+	current.handshaked = true
+	current.protocolVersion = ProtocolVersion
+	s.handleMessage(current, &Message{Type: "tx", Data: tx})
+	if size := blockchain.GetMempool().Size(); size != 1 || current.invalidMessages.Load() != 0 {
+		t.Errorf("%d pending and %d invalid messages after a tx message in the current version", size, current.invalidMessages.Load())
+	}
+}
@@ -1,15 +1,26 @@
-
 package network
 
 import (
 	"blockchain-node/core"
 	"blockchain-node/interfaces"
 	"blockchain-node/logger"
+	"blockchain-node/metrics"
+	"blockchain-node/security"
+	"blockchain-node/validation"
+	"blockchain-node/version"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,71 +31,274 @@ type Config struct {
 }
 
 type Server struct {
-	port       int
-	blockchain *core.Blockchain
-	peers      map[string]*Peer
-	listener   net.Listener
-	running    bool
-	mu         sync.RWMutex
-	ctx        context.Context
-	cancel     context.CancelFunc
+	port               int
+	bindAddr           string // listen address, empty for all interfaces
+	advertiseAddr      string // host:port announced to peers, empty for the bind address
+	blockchain         *core.Blockchain
+	peers              map[string]*Peer
+	listener           net.Listener
+	running            bool
+	compression        bool
+	txBroadcast        string // TxBroadcastAll or TxBroadcastSqrt
+	tlsConfig          *tls.Config
+	tlsRequired        bool              // reject inbound peers that don't use TLS
+	nodeKey            *ecdsa.PrivateKey // node identity, see LoadNodeKey
+	security           *security.SecurityManager
+	maxConnsPerIP      int
+	connsPerIP         map[string]int // open connections by remote IP
+	handshakes         chan struct{}  // slots of inbound handshakes in progress, nil for no limit
+	handshakeTimeout   time.Duration
+	txAnnounceLimit    int // pending transactions announced to new peers, 0 disables
+	maxInvalidMessages int // messages outside the protocol version before a peer is dropped, 0 never drops
+	dials              *dialState
+	syncMode           string
+	pivotDistance      uint64
+	fastSync           *fastSync                  // fast sync in progress, if any
+	snapshotsServed    map[string]time.Time       // when each remote IP was last served a snapshot, guarded by mu
+	nodeRequests       map[[32]byte][]chan []byte // pending FetchTrieNode calls by hash
+	mu                 sync.RWMutex
+	ctx                context.Context
+	cancel             context.CancelFunc
+}
+
+// P2P protocol versions. Peers negotiate the highest version both sides
+// support and refuse peers that cannot speak at least MinProtocolVersion.
+const (
+	ProtocolVersion    uint32 = 3
+	MinProtocolVersion uint32 = 3
+)
+
+// defaultMaxConnsPerIP is the number of connections allowed with a single IP
+// address unless configured otherwise
+const defaultMaxConnsPerIP = 5
+
+// defaultHandshakeTimeout is how long a peer has to complete the handshake,
+// and the TLS handshake before it, unless configured otherwise
+const defaultHandshakeTimeout = 30 * time.Second
+
+// defaultMaxHandshakes is the number of inbound connections that may be
+// handshaking at the same time unless configured otherwise
+const defaultMaxHandshakes = 32
+
+// Message payloads larger than compressionThreshold bytes are gzip
+// compressed when both peers announced support for it.
+const (
+	compressionGzip      = "gzip"
+	compressionThreshold = 1024
+)
+
+// maxMessageSize is the largest size a compressed payload may expand to
+const maxMessageSize = 32 << 20
+
+// ErrMessageTooLarge is returned for compressed payloads that expand to more
+// than maxMessageSize bytes
+var ErrMessageTooLarge = errors.New("message too large")
+
+var log = logger.Module("network")
+
+// supportedMessages lists the message types this node understands
+var supportedMessages = []string{
+	"sync_request", "getblocks", "inv", "getdata", "block", "newblockhash", "tx",
+	"getheaders", "headers", "getsnapshot", "snapshot", "getnode", "node",
 }
 
 type Peer struct {
-	conn        net.Conn
-	address     string
-	version     string
-	services    uint64
-	chainID     uint64
-	genesisHash [32]byte
-	bestHeight  uint64
-	handshaked  bool
+	conn            net.Conn
+	decoder         *json.Decoder // of conn, kept from the handshake so no buffered message is lost
+	address         string
+	version         string
+	protocolVersion uint32
+	capabilities    map[string]bool
+	compression     string
+	services        uint64
+	chainID         uint64
+	genesisHash     [32]byte
+	bestHeight      uint64
+	listenAddr      string // address the peer accepts connections at, empty if it announced none
+	handshaked      bool
+	traffic         peerTraffic
+	known           knownHashes   // blocks the peer has
+	knownTxs        knownHashes   // transactions the peer has
+	invalidMessages atomic.Uint32 // messages received outside the negotiated protocol version
+	dropped         atomic.Bool   // disconnected for misbehaving, not redialed
+}
+
+// peerTraffic counts the messages and bytes exchanged with a peer. It lives
+// on the Peer, so the counters start from zero on every new connection.
+type peerTraffic struct {
+	bytesSent        atomic.Uint64
+	bytesReceived    atomic.Uint64
+	messagesSent     atomic.Uint64
+	messagesReceived atomic.Uint64
+}
+
+// PeerStats is a snapshot of the traffic exchanged with a connected peer
+type PeerStats struct {
+	Address          string `json:"address"`
+	ListenAddr       string `json:"listenAddr,omitempty"`
+	BytesSent        uint64 `json:"bytesSent"`
+	BytesReceived    uint64 `json:"bytesReceived"`
+	MessagesSent     uint64 `json:"messagesSent"`
+	MessagesReceived uint64 `json:"messagesReceived"`
 }
 
 type Message struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Type     string      `json:"type"`
+	Data     interface{} `json:"data"`
+	Encoding string      `json:"encoding,omitempty"`
+	Payload  []byte      `json:"payload,omitempty"`
 }
 
 type VersionMessage struct {
-	Version     string   `json:"version"`
-	ChainID     uint64   `json:"chainId"`
-	GenesisHash [32]byte `json:"genesisHash"`
-	BestHeight  uint64   `json:"bestHeight"`
-	Services    uint64   `json:"services"`
+	Version            string   `json:"version"`
+	ProtocolVersion    uint32   `json:"protocolVersion"`
+	MinProtocolVersion uint32   `json:"minProtocolVersion"`
+	Capabilities       []string `json:"capabilities"`
+	Compression        []string `json:"compression,omitempty"`
+	ChainID            uint64   `json:"chainId"`
+	GenesisHash        [32]byte `json:"genesisHash"`
+	BestHeight         uint64   `json:"bestHeight"`
+	Services           uint64   `json:"services"`
+	ListenAddr         string   `json:"listenAddr,omitempty"`
 }
 
+// HandshakeReason is a machine readable code explaining a handshake rejection
+type HandshakeReason string
+
+const (
+	ReasonChainIDMismatch    HandshakeReason = "chainIdMismatch"
+	ReasonGenesisMismatch    HandshakeReason = "genesisMismatch"
+	ReasonVersionUnsupported HandshakeReason = "versionUnsupported"
+)
+
 type HandshakeData struct {
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
+	Success bool            `json:"success"`
+	Reason  HandshakeReason `json:"reason,omitempty"`
+	Message string          `json:"message,omitempty"`
 }
 
 func NewServer(port int, blockchain *core.Blockchain) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
-		port:       port,
-		blockchain: blockchain,
-		peers:      make(map[string]*Peer),
-		ctx:        ctx,
-		cancel:     cancel,
+		port:               port,
+		blockchain:         blockchain,
+		peers:              make(map[string]*Peer),
+		compression:        true,
+		txBroadcast:        TxBroadcastSqrt,
+		maxConnsPerIP:      defaultMaxConnsPerIP,
+		connsPerIP:         make(map[string]int),
+		handshakes:         make(chan struct{}, defaultMaxHandshakes),
+		handshakeTimeout:   defaultHandshakeTimeout,
+		txAnnounceLimit:    defaultTxAnnounceLimit,
+		maxInvalidMessages: defaultMaxInvalidMessages,
+		dials:              newDialState(),
+		syncMode:           SyncModeFull,
+		pivotDistance:      defaultPivotDistance,
+		snapshotsServed:    make(map[string]time.Time),
+		nodeRequests:       make(map[[32]byte][]chan []byte),
+		ctx:                ctx,
+		cancel:             cancel,
+	}
+}
+
+// SetSecurityManager makes the server refuse peers the manager doesn't allow
+func (s *Server) SetSecurityManager(sm *security.SecurityManager) {
+	s.security = sm
+}
+
+// SetHandshakeTimeout sets how long a peer has to complete the handshake
+// before it is dropped. Zero or less keeps the default.
+func (s *Server) SetHandshakeTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.handshakeTimeout = timeout
+	}
+}
+
+// SetMaxConnsPerIP limits the number of connections, inbound and outbound
+// together, with a single IP address. Zero or less disables the limit.
+func (s *Server) SetMaxConnsPerIP(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxConnsPerIP = limit
+}
+
+// SetMaxHandshakes limits the number of inbound connections that are
+// still handshaking. Connections accepted beyond the limit are closed right
+// away. Zero or less disables the limit. Must be called before Start.
+func (s *Server) SetMaxHandshakes(limit int) {
+	if limit <= 0 {
+		s.handshakes = nil
+		return
+	}
+	s.handshakes = make(chan struct{}, limit)
+}
+
+// SetBindAddr makes the server listen on the given interface address only.
+// An empty address listens on all interfaces.
+func (s *Server) SetBindAddr(addr string) {
+	s.bindAddr = addr
+}
+
+// SetAdvertiseAddr sets the host:port announced to peers in the handshake,
+// e.g. the public address of a node behind NAT. Empty announces the bind
+// address.
+func (s *Server) SetAdvertiseAddr(addr string) {
+	s.advertiseAddr = addr
+}
+
+// listenAddr returns the address announced to peers for dialing back. The
+// host is empty when listening on all interfaces without an advertise
+// address, peers then use the IP they see the connection from.
+func (s *Server) listenAddr() string {
+	if s.advertiseAddr != "" {
+		return s.advertiseAddr
+	}
+	host := s.bindAddr
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = ""
+	}
+	return net.JoinHostPort(host, strconv.Itoa(s.port))
+}
+
+// dialBackAddr returns the address a peer can be dialed at from the listen
+// address it announced, with an empty or unspecified host replaced by the
+// IP of its connection. It is empty if the peer announced no valid address.
+func dialBackAddr(announced string, conn net.Conn) string {
+	host, port, err := net.SplitHostPort(announced)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = remoteIP(conn)
 	}
+	return net.JoinHostPort(host, port)
+}
+
+// SetCompression enables or disables offering gzip compression to peers
+func (s *Server) SetCompression(enabled bool) {
+	s.compression = enabled
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	listener, err := net.Listen("tcp", net.JoinHostPort(s.bindAddr, strconv.Itoa(s.port)))
 	if err != nil {
 		return fmt.Errorf("failed to start server: %v", err)
 	}
 
+	s.mu.Lock()
 	s.listener = listener
 	s.running = true
+	s.mu.Unlock()
+
+	go s.acceptConnections(listener)
+	go s.broadcastTransactions(ctx)
+	go s.broadcastBlocks(ctx)
+	go s.dialLoop(ctx)
 
-	go s.acceptConnections()
+	log.Infof("P2P server started on %s", listener.Addr())
+	log.Infof("Genesis hash: %x", s.blockchain.GetGenesisHash())
+	log.Infof("Chain ID: %d", s.blockchain.GetChainID())
 
-	logger.Infof("P2P server started on port %d", s.port)
-	logger.Infof("Genesis hash: %x", s.blockchain.GetGenesisHash())
-	logger.Infof("Chain ID: %d", s.blockchain.GetChainID())
-	
 	// Wait for context cancellation
 	<-ctx.Done()
 	return s.Stop()
@@ -100,7 +314,7 @@ func (s *Server) Stop() error {
 
 	s.running = false
 	s.cancel()
-	
+
 	if s.listener != nil {
 		s.listener.Close()
 	}
@@ -110,40 +324,164 @@ func (s *Server) Stop() error {
 		peer.conn.Close()
 	}
 
-	logger.Info("P2P server stopped")
+	log.Info("P2P server stopped")
 	return nil
 }
 
-func (s *Server) acceptConnections() {
-	for s.running {
-		conn, err := s.listener.Accept()
+// isRunning reports whether the server has been started and not yet stopped
+func (s *Server) isRunning() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.running
+}
+
+func (s *Server) acceptConnections(listener net.Listener) {
+	for s.isRunning() {
+		conn, err := listener.Accept()
 		if err != nil {
-			if s.running {
-				logger.Errorf("Failed to accept connection: %v", err)
+			if s.isRunning() {
+				log.Errorf("Failed to accept connection: %v", err)
 			}
 			continue
 		}
 
-		go s.handleConnection(conn)
+		// Connections that would be refused anyway must not take one of
+		// the handshake slots
+		ip, err := s.admitPeer(conn)
+		if err != nil {
+			log.Warningf("Rejected connection from %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+
+		if !s.acquireHandshake() {
+			log.Warningf("Rejected connection from %s: too many handshakes in progress", conn.RemoteAddr())
+			metrics.GetMetrics().IncrementHandshakeFailure("tooManyHandshakes")
+			s.releaseIP(ip)
+			conn.Close()
+			continue
+		}
+
+		go s.handleInbound(conn, ip)
+	}
+}
+
+// admitPeer checks a new connection against the peer security policy and
+// the per-IP limit, and counts it against its IP. The returned IP is passed
+// on to handleConnection, which gives the slot back.
+func (s *Server) admitPeer(conn net.Conn) (string, error) {
+	address := conn.RemoteAddr().String()
+	if s.security != nil && !s.security.AllowPeer(address) {
+		return "", fmt.Errorf("untrusted peer %s", address)
+	}
+
+	ip := remoteIP(conn)
+	if !s.acquireIP(ip) {
+		return "", fmt.Errorf("too many connections with %s", ip)
+	}
+	return ip, nil
+}
+
+// acquireHandshake takes a handshake slot without waiting for one
+func (s *Server) acquireHandshake() bool {
+	if s.handshakes == nil {
+		return true
+	}
+	select {
+	case s.handshakes <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) releaseHandshake() {
+	if s.handshakes != nil {
+		<-s.handshakes
 	}
 }
 
-func (s *Server) handleConnection(conn net.Conn) {
+// handleInbound serves an accepted connection holding a handshake slot, the
+// slot is given back once the handshake is over
+func (s *Server) handleInbound(conn net.Conn, ip string) {
+	var once sync.Once
+	release := func() { once.Do(s.releaseHandshake) }
+	defer release()
+
+	upgraded, err := s.upgradeInbound(conn)
+	if err != nil {
+		log.Errorf("Failed to set up connection from %s: %v", conn.RemoteAddr(), err)
+		s.releaseIP(ip)
+		conn.Close()
+		return
+	}
+
+	s.handleConnection(upgraded, ip, func(bool) { release() })
+}
+
+// Connect dials a peer and performs the handshake in the background. The
+// address is host:port, or an enode URL whose id the peer's TLS certificate
+// must match when TLS is enabled.
+func (s *Server) Connect(address string) error {
+	return s.connect(address, func(bool) {}, func() {})
+}
+
+// connect dials a peer and serves the connection in the background, calling
+// handshakeDone with the outcome of the handshake and closed once the
+// connection ends
+func (s *Server) connect(address string, handshakeDone func(ok bool), closed func()) error {
+	nodeID, dialAddr, err := splitEnode(address)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", dialAddr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %v", address, err)
+	}
+
+	ip, err := s.admitPeer(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	upgraded, err := s.upgradeOutbound(conn, nodeID)
+	if err != nil {
+		s.releaseIP(ip)
+		conn.Close()
+		return fmt.Errorf("failed to set up connection to %s: %v", address, err)
+	}
+
+	go func() {
+		defer closed()
+		s.handleConnection(upgraded, ip, handshakeDone)
+	}()
+	return nil
+}
+
+// handleConnection handshakes with the peer on conn, admitted by admitPeer
+// for ip, and then serves its messages until it disconnects. handshakeDone is
+// called with the outcome once the handshake is over.
+func (s *Server) handleConnection(conn net.Conn, ip string, handshakeDone func(ok bool)) {
 	defer conn.Close()
+	defer s.releaseIP(ip)
 
 	peer := &Peer{
 		conn:    conn,
 		address: conn.RemoteAddr().String(),
 	}
 
-	logger.Infof("New peer connected: %s", peer.address)
+	log.Infof("New peer connected: %s", peer.address)
 
 	// Set connection timeout for handshake
-	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	conn.SetReadDeadline(time.Now().Add(s.handshakeTimeout))
 
 	// Perform handshake
-	if !s.performHandshake(peer) {
-		logger.Errorf("Handshake failed with peer %s", peer.address)
+	handshaked := s.performHandshake(peer)
+	handshakeDone(handshaked)
+	if !handshaked {
+		log.Errorf("Handshake failed with peer %s", peer.address)
 		return
 	}
 
@@ -158,22 +496,67 @@ func (s *Server) handleConnection(conn net.Conn) {
 		s.mu.Lock()
 		delete(s.peers, peer.address)
 		s.mu.Unlock()
-		logger.Infof("Peer disconnected: %s", peer.address)
+		s.endFastSync(peer)
+		log.Infof("Peer disconnected: %s", peer.address)
+
+		// Reconnect at the address the peer announced, the one it
+		// connected from is useless for inbound peers
+		if peer.listenAddr != "" && !peer.dropped.Load() {
+			s.dials.addPeer(peer.listenAddr)
+		}
 	}()
 
-	// Handle peer messages
-	decoder := json.NewDecoder(conn)
+	s.announceMempool(peer)
+
+	// Handle peer messages, messages sent right after the handshake may
+	// already be buffered by the decoder
+	decoder := peer.decoder
 	for {
 		var msg Message
+		offset := decoder.InputOffset()
 		if err := decoder.Decode(&msg); err != nil {
-			logger.Debugf("Peer %s disconnected: %v", peer.address, err)
+			log.Debugf("Peer %s disconnected: %v", peer.address, err)
 			break
 		}
+		s.recordReceived(peer, msg.Type, decoder.InputOffset()-offset)
+
+		if err := decodePayload(&msg); err != nil {
+			log.Errorf("Failed to decode %s message from %s: %v", msg.Type, peer.address, err)
+			continue
+		}
 
 		s.handleMessage(peer, &msg)
 	}
 }
 
+// remoteIP returns the IP address of the remote end of conn
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// acquireIP counts a new connection with ip, failing if ip is at the limit
+func (s *Server) acquireIP(ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxConnsPerIP > 0 && s.connsPerIP[ip] >= s.maxConnsPerIP {
+		return false
+	}
+	s.connsPerIP[ip]++
+	return true
+}
+
+func (s *Server) releaseIP(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connsPerIP[ip]--; s.connsPerIP[ip] <= 0 {
+		delete(s.connsPerIP, ip)
+	}
+}
+
 func (s *Server) performHandshake(peer *Peer) bool {
 	// Send version message
 	currentBlock := s.blockchain.GetCurrentBlock()
@@ -183,82 +566,97 @@ func (s *Server) performHandshake(peer *Peer) bool {
 	}
 
 	versionMsg := VersionMessage{
-		Version:     "1.0.0",
-		ChainID:     s.blockchain.GetChainID(),
-		GenesisHash: s.blockchain.GetGenesisHash(),
-		BestHeight:  bestHeight,
-		Services:    1, // Full node
+		Version:            version.ClientVersion(s.blockchain.GetChainName()),
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		Capabilities:       supportedMessages,
+		Compression:        s.supportedCompression(),
+		ChainID:            s.blockchain.GetChainID(),
+		GenesisHash:        s.blockchain.GetGenesisHash(),
+		BestHeight:         bestHeight,
+		Services:           1, // Full node
+		ListenAddr:         s.listenAddr(),
 	}
 
 	if err := s.sendMessage(peer, &Message{
 		Type: "version",
 		Data: versionMsg,
 	}); err != nil {
-		logger.Errorf("Failed to send version to %s: %v", peer.address, err)
+		log.Errorf("Failed to send version to %s: %v", peer.address, err)
 		return false
 	}
 
 	// Wait for version response
-	decoder := json.NewDecoder(peer.conn)
+	peer.decoder = json.NewDecoder(peer.conn)
 	var response Message
-	if err := decoder.Decode(&response); err != nil {
-		logger.Errorf("Failed to receive version from %s: %v", peer.address, err)
+	if err := peer.decoder.Decode(&response); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			log.Warningf("Peer %s did not send its version within %v", peer.address, s.handshakeTimeout)
+			return false
+		}
+		log.Errorf("Failed to receive version from %s: %v", peer.address, err)
 		return false
 	}
+	s.recordReceived(peer, response.Type, peer.decoder.InputOffset())
 
 	if response.Type != "version" {
-		logger.Errorf("Expected version message from %s, got %s", peer.address, response.Type)
+		log.Errorf("Expected version message from %s, got %s", peer.address, response.Type)
 		return false
 	}
 
 	// Parse peer version
 	versionData, err := json.Marshal(response.Data)
 	if err != nil {
-		logger.Errorf("Failed to parse version data from %s: %v", peer.address, err)
+		log.Errorf("Failed to parse version data from %s: %v", peer.address, err)
 		return false
 	}
 
 	var peerVersion VersionMessage
 	if err := json.Unmarshal(versionData, &peerVersion); err != nil {
-		logger.Errorf("Failed to unmarshal version from %s: %v", peer.address, err)
+		log.Errorf("Failed to unmarshal version from %s: %v", peer.address, err)
+		return false
+	}
+
+	// Negotiate protocol version
+	protocolVersion, ok := negotiateProtocolVersion(&peerVersion)
+	if !ok {
+		s.rejectHandshake(peer, ReasonVersionUnsupported, fmt.Sprintf("Unsupported protocol version: supported %d-%d, got %d-%d",
+			MinProtocolVersion, ProtocolVersion, peerVersion.MinProtocolVersion, peerVersion.ProtocolVersion))
 		return false
 	}
 
 	// Verify compatibility
 	if peerVersion.ChainID != s.blockchain.GetChainID() {
-		logger.Errorf("Chain ID mismatch with %s: expected %d, got %d", 
-			peer.address, s.blockchain.GetChainID(), peerVersion.ChainID)
-		
-		s.sendMessage(peer, &Message{
-			Type: "handshake_error",
-			Data: HandshakeData{
-				Success: false,
-				Message: fmt.Sprintf("Chain ID mismatch: expected %d, got %d", 
-					s.blockchain.GetChainID(), peerVersion.ChainID),
-			},
-		})
+		s.rejectHandshake(peer, ReasonChainIDMismatch, fmt.Sprintf("Chain ID mismatch: expected %d, got %d",
+			s.blockchain.GetChainID(), peerVersion.ChainID))
 		return false
 	}
 
 	if peerVersion.GenesisHash != s.blockchain.GetGenesisHash() {
-		logger.Errorf("Genesis hash mismatch with %s", peer.address)
-		
-		s.sendMessage(peer, &Message{
-			Type: "handshake_error",
-			Data: HandshakeData{
-				Success: false,
-				Message: "Genesis hash mismatch",
-			},
-		})
+		s.rejectHandshake(peer, ReasonGenesisMismatch, "Genesis hash mismatch")
 		return false
 	}
 
 	// Update peer info
 	peer.version = peerVersion.Version
+	peer.protocolVersion = protocolVersion
+	peer.capabilities = make(map[string]bool, len(peerVersion.Capabilities))
+	for _, msgType := range peerVersion.Capabilities {
+		peer.capabilities[msgType] = true
+	}
+	if s.compression {
+		for _, algorithm := range peerVersion.Compression {
+			if algorithm == compressionGzip {
+				peer.compression = compressionGzip
+			}
+		}
+	}
 	peer.chainID = peerVersion.ChainID
 	peer.genesisHash = peerVersion.GenesisHash
 	peer.bestHeight = peerVersion.BestHeight
 	peer.services = peerVersion.Services
+	peer.listenAddr = dialBackAddr(peerVersion.ListenAddr, peer.conn)
 	peer.handshaked = true
 
 	// Send handshake success
@@ -269,24 +667,55 @@ func (s *Server) performHandshake(peer *Peer) bool {
 			Message: "Handshake completed successfully",
 		},
 	}); err != nil {
-		logger.Errorf("Failed to send handshake success to %s: %v", peer.address, err)
+		log.Errorf("Failed to send handshake success to %s: %v", peer.address, err)
 		return false
 	}
 
-	logger.Infof("Handshake completed with peer %s (ChainID: %d, Height: %d)", 
-		peer.address, peer.chainID, peer.bestHeight)
+	log.Infof("Handshake completed with peer %s (Client: %s, ChainID: %d, Height: %d, Protocol: %d)",
+		peer.address, peer.version, peer.chainID, peer.bestHeight, peer.protocolVersion)
+
+	s.blockchain.UpdateHighestBlock(peer.bestHeight)
 
 	// Request blocks if peer has higher height
 	if peer.bestHeight > bestHeight {
-		s.requestBlockSync(peer, bestHeight+1, peer.bestHeight)
+		s.startSync(peer, bestHeight)
 	}
 
 	return true
 }
 
+// negotiateProtocolVersion picks the highest protocol version supported by
+// both sides, reporting false if the supported ranges don't overlap.
+func negotiateProtocolVersion(peerVersion *VersionMessage) (uint32, bool) {
+	version := ProtocolVersion
+	if peerVersion.ProtocolVersion < version {
+		version = peerVersion.ProtocolVersion
+	}
+
+	if version < MinProtocolVersion || version < peerVersion.MinProtocolVersion {
+		return 0, false
+	}
+	return version, true
+}
+
+// rejectHandshake notifies the peer why its handshake was refused
+func (s *Server) rejectHandshake(peer *Peer, reason HandshakeReason, message string) {
+	log.Errorf("Rejecting handshake with %s (%s): %s", peer.address, reason, message)
+	metrics.GetMetrics().IncrementHandshakeFailure(string(reason))
+
+	s.sendMessage(peer, &Message{
+		Type: "handshake_error",
+		Data: HandshakeData{
+			Success: false,
+			Reason:  reason,
+			Message: message,
+		},
+	})
+}
+
 func (s *Server) requestBlockSync(peer *Peer, fromHeight, toHeight uint64) {
-	logger.Infof("Requesting block sync from %s (blocks %d-%d)", peer.address, fromHeight, toHeight)
-	
+	log.Infof("Requesting block sync from %s (blocks %d-%d)", peer.address, fromHeight, toHeight)
+
 	syncRequest := map[string]interface{}{
 		"from": fromHeight,
 		"to":   toHeight,
@@ -300,7 +729,11 @@ func (s *Server) requestBlockSync(peer *Peer, fromHeight, toHeight uint64) {
 
 func (s *Server) handleMessage(peer *Peer, msg *Message) {
 	if !peer.handshaked && msg.Type != "version" && msg.Type != "handshake_error" && msg.Type != "handshake_success" {
-		logger.Errorf("Received %s message from non-handshaked peer %s", msg.Type, peer.address)
+		log.Errorf("Received %s message from non-handshaked peer %s", msg.Type, peer.address)
+		return
+	}
+	if !messageAllowed(peer.protocolVersion, msg.Type) {
+		s.rejectMessage(peer, msg.Type)
 		return
 	}
 
@@ -322,21 +755,46 @@ func (s *Server) handleMessage(peer *Peer, msg *Message) {
 		s.handleGetData(peer, msg)
 	case "block":
 		s.handleBlock(peer, msg)
+	case "newblockhash":
+		s.handleNewBlockHash(peer, msg)
 	case "tx":
 		s.handleTransaction(peer, msg)
+	case "getheaders":
+		s.handleGetHeaders(peer, msg)
+	case "headers":
+		s.handleHeaders(peer, msg)
+	case "getsnapshot":
+		s.handleGetSnapshot(peer, msg)
+	case "snapshot":
+		s.handleSnapshot(peer, msg)
+	case "getnode":
+		s.handleGetNode(peer, msg)
+	case "node":
+		s.handleNode(peer, msg)
 	default:
-		logger.Debugf("Unknown message type from %s: %s", peer.address, msg.Type)
+		log.Debugf("Unknown message type from %s: %s", peer.address, msg.Type)
 	}
 }
 
 func (s *Server) handleHandshakeError(peer *Peer, msg *Message) {
-	handshakeData, _ := msg.Data.(map[string]interface{})
-	message := handshakeData["message"].(string)
-	logger.Errorf("Handshake error from %s: %s", peer.address, message)
+	data, _ := json.Marshal(msg.Data)
+	var handshakeData HandshakeData
+	if err := json.Unmarshal(data, &handshakeData); err != nil {
+		log.Errorf("Malformed handshake error from %s: %v", peer.address, err)
+		return
+	}
+
+	reason := handshakeData.Reason
+	if reason == "" {
+		reason = "unknown"
+	}
+	metrics.GetMetrics().IncrementHandshakeFailure(string(reason))
+
+	log.Errorf("Handshake rejected by %s (%s): %s", peer.address, reason, handshakeData.Message)
 }
 
 func (s *Server) handleHandshakeSuccess(peer *Peer, msg *Message) {
-	logger.Infof("Handshake success with %s", peer.address)
+	log.Infof("Handshake success with %s", peer.address)
 }
 
 func (s *Server) handleSyncRequest(peer *Peer, msg *Message) {
@@ -344,11 +802,11 @@ func (s *Server) handleSyncRequest(peer *Peer, msg *Message) {
 	from := uint64(syncData["from"].(float64))
 	to := uint64(syncData["to"].(float64))
 
-	logger.Infof("Sync request from %s for blocks %d-%d", peer.address, from, to)
+	log.Infof("Sync request from %s for blocks %d-%d", peer.address, from, to)
 
-	// Send blocks
+	// Send blocks, pruned ones lack the transactions a peer needs
 	for i := from; i <= to; i++ {
-		if block := s.blockchain.GetBlockByNumber(i); block != nil {
+		if block := s.blockchain.GetBlockByNumber(i); block != nil && !block.Pruned {
 			s.sendMessage(peer, &Message{
 				Type: "block",
 				Data: block,
@@ -366,7 +824,7 @@ func (s *Server) handleGetBlocks(peer *Peer, msg *Message) {
 
 	inv := make([]string, 0)
 	for i := uint64(0); i <= currentBlock.Header.Number; i++ {
-		if block := s.blockchain.GetBlockByNumber(i); block != nil {
+		if block := s.blockchain.GetBlockByNumber(i); block != nil && !block.Pruned {
 			inv = append(inv, fmt.Sprintf("%x", block.Header.Hash))
 		}
 	}
@@ -384,6 +842,10 @@ func (s *Server) handleInv(peer *Peer, msg *Message) {
 	// Handle inventory message
 	invData, _ := msg.Data.(map[string]interface{})
 	items, _ := invData["items"].([]interface{})
+	if invData["type"] == "tx" {
+		s.handleTxInv(peer, items)
+		return
+	}
 
 	// Request data for items we don't have
 	needed := make([]string, 0)
@@ -394,7 +856,7 @@ func (s *Server) handleInv(peer *Peer, msg *Message) {
 		for i := 0; i < 32 && i*2 < len(hashStr); i++ {
 			fmt.Sscanf(hashStr[i*2:i*2+2], "%02x", &hash[i])
 		}
-		
+
 		if s.blockchain.GetBlockByHash(hash) == nil {
 			needed = append(needed, item.(string))
 		}
@@ -414,6 +876,10 @@ func (s *Server) handleGetData(peer *Peer, msg *Message) {
 	// Send requested data
 	getData, _ := msg.Data.(map[string]interface{})
 	items, _ := getData["items"].([]interface{})
+	if getData["type"] == "tx" {
+		s.handleGetTxData(peer, items)
+		return
+	}
 
 	for _, item := range items {
 		hashStr := item.(string)
@@ -422,12 +888,13 @@ func (s *Server) handleGetData(peer *Peer, msg *Message) {
 		for i := 0; i < 32 && i*2 < len(hashStr); i++ {
 			fmt.Sscanf(hashStr[i*2:i*2+2], "%02x", &hash[i])
 		}
-		
-		if block := s.blockchain.GetBlockByHash(hash); block != nil {
+
+		if block := s.blockchain.GetBlockByHash(hash); block != nil && !block.Pruned {
 			s.sendMessage(peer, &Message{
 				Type: "block",
 				Data: block,
 			})
+			peer.known.add(hash)
 		}
 	}
 }
@@ -437,17 +904,43 @@ func (s *Server) handleBlock(peer *Peer, msg *Message) {
 	blockData, _ := json.Marshal(msg.Data)
 	var block core.Block
 	if err := json.Unmarshal(blockData, &block); err != nil {
-		logger.Errorf("Failed to decode block from %s: %v", peer.address, err)
+		log.Errorf("Failed to decode block from %s: %v", peer.address, err)
+		return
+	}
+	if block.Header == nil {
+		log.Errorf("Block from %s has no header", peer.address)
 		return
 	}
+	peer.known.add(block.Header.Hash)
 
 	// Add block to blockchain
-	if err := s.blockchain.AddBlock(&block); err != nil {
-		logger.Debugf("Failed to add block from %s: %v", peer.address, err)
+	if err := s.blockchain.AddBlockFrom(&block, peer.address); err != nil {
+		if errors.Is(err, core.ErrOrphanBlock) {
+			// The orphan passed the proof of work check, so the chain
+			// reaches at least this high
+			s.blockchain.UpdateHighestBlock(block.Header.Number)
+
+			// Fetch the missing ancestors, the orphan is connected after
+			// them. The orphan is close to the head, but never ask for more
+			// than one request's worth.
+			if head := s.blockchain.GetCurrentBlock(); head != nil && block.Header.Number > head.Header.Number+1 {
+				from, to := head.Header.Number+1, block.Header.Number-1
+				if to-from >= maxHeadersPerRequest {
+					to = from + maxHeadersPerRequest - 1
+				}
+				s.requestBlockSync(peer, from, to)
+			}
+			return
+		}
+		if validation.IsInvalid(err) {
+			s.dropPeer(peer, fmt.Sprintf("sent invalid block %d: %v", block.Header.Number, err))
+			return
+		}
+		log.Debugf("Failed to add block from %s: %v", peer.address, err)
 		return
 	}
 
-	logger.Infof("Added block %d from peer %s", block.Header.Number, peer.address)
+	log.Infof("Added block %d from peer %s", block.Header.Number, peer.address)
 }
 
 func (s *Server) handleTransaction(peer *Peer, msg *Message) {
@@ -455,57 +948,143 @@ func (s *Server) handleTransaction(peer *Peer, msg *Message) {
 	txData, _ := json.Marshal(msg.Data)
 	var tx core.Transaction
 	if err := json.Unmarshal(txData, &tx); err != nil {
-		logger.Errorf("Failed to decode transaction from %s: %v", peer.address, err)
+		log.Errorf("Failed to decode transaction from %s: %v", peer.address, err)
 		return
 	}
+	peer.knownTxs.add(tx.Hash)
 
 	// Add transaction to mempool
 	if err := s.blockchain.AddTransaction(&tx); err != nil {
-		logger.Debugf("Failed to add transaction from %s: %v", peer.address, err)
+		if validation.IsInvalid(err) {
+			s.dropPeer(peer, fmt.Sprintf("sent invalid transaction %x: %v", tx.Hash, err))
+			return
+		}
+		log.Debugf("Failed to add transaction from %s: %v", peer.address, err)
 		return
 	}
 
-	logger.Debugf("Added transaction %x from peer %s", tx.Hash, peer.address)
+	log.Debugf("Added transaction %x from peer %s", tx.Hash, peer.address)
+}
+
+// dropPeer disconnects a peer that sent data no valid node would send. Data
+// rejected only by the limits of this node, like a low gas price, doesn't
+// drop the peer.
+func (s *Server) dropPeer(peer *Peer, reason string) {
+	log.Warningf("Disconnecting peer %s: %s", peer.address, reason)
+	peer.dropped.Store(true)
+	peer.conn.Close()
 }
 
 func (s *Server) sendMessage(peer *Peer, msg *Message) error {
-	encoder := json.NewEncoder(peer.conn)
-	if err := encoder.Encode(msg); err != nil {
+	// The peer's protocol version is known once the handshake is done
+	if peer.handshaked && !messageAllowed(peer.protocolVersion, msg.Type) {
+		return fmt.Errorf("message type %s is not part of protocol version %d of %s", msg.Type, peer.protocolVersion, peer.address)
+	}
+	if peer.compression != "" {
+		compressed, err := compressMessage(msg)
+		if err != nil {
+			return fmt.Errorf("failed to compress message to %s: %v", peer.address, err)
+		}
+		msg = compressed
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message to %s: %v", peer.address, err)
+	}
+	data = append(data, '\n')
+
+	if _, err := peer.conn.Write(data); err != nil {
 		return fmt.Errorf("failed to send message to %s: %v", peer.address, err)
 	}
+
+	peer.traffic.messagesSent.Add(1)
+	peer.traffic.bytesSent.Add(uint64(len(data)))
+	metrics.GetMetrics().RecordP2PMessageSent(statsMessageType(msg.Type), uint64(len(data)))
 	return nil
 }
 
-func (s *Server) BroadcastTransaction(tx *core.Transaction) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *Server) recordReceived(peer *Peer, msgType string, size int64) {
+	peer.traffic.messagesReceived.Add(1)
+	peer.traffic.bytesReceived.Add(uint64(size))
+	metrics.GetMetrics().RecordP2PMessageReceived(statsMessageType(msgType), uint64(size))
+}
 
-	msg := &Message{
-		Type: "tx",
-		Data: tx,
+func (s *Server) supportedCompression() []string {
+	if !s.compression {
+		return nil
 	}
+	return []string{compressionGzip}
+}
 
-	for _, peer := range s.peers {
-		if peer.handshaked {
-			s.sendMessage(peer, msg)
-		}
+// compressMessage returns a gzip encoded copy of msg if its payload is large
+// enough to be worth compressing, otherwise msg itself.
+func compressMessage(msg *Message) (*Message, error) {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < compressionThreshold {
+		return msg, nil
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
 	}
+
+	metrics.GetMetrics().AddCompressionStats(uint64(len(data)), uint64(buf.Len()))
+
+	return &Message{
+		Type:     msg.Type,
+		Encoding: compressionGzip,
+		Payload:  buf.Bytes(),
+	}, nil
 }
 
-func (s *Server) BroadcastBlock(block *core.Block) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// decodePayload restores the data of a compressed message in place
+func decodePayload(msg *Message) error {
+	if msg.Encoding == "" {
+		return nil
+	}
+	if msg.Encoding != compressionGzip {
+		return fmt.Errorf("unsupported encoding %q", msg.Encoding)
+	}
 
-	msg := &Message{
-		Type: "block",
-		Data: block,
+	reader, err := gzip.NewReader(bytes.NewReader(msg.Payload))
+	if err != nil {
+		return err
 	}
+	defer reader.Close()
 
-	for _, peer := range s.peers {
-		if peer.handshaked {
-			s.sendMessage(peer, msg)
-		}
+	// Read one byte past the limit to tell a payload of exactly
+	// maxMessageSize bytes from a larger one
+	data, err := io.ReadAll(io.LimitReader(reader, maxMessageSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMessageSize {
+		return ErrMessageTooLarge
 	}
+
+	var payload interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	msg.Data = payload
+	msg.Encoding = ""
+	msg.Payload = nil
+	return nil
+}
+
+// supports reports whether the peer announced the message type in its handshake
+func (p *Peer) supports(msgType string) bool {
+	return p.capabilities[msgType]
 }
 
 func (s *Server) GetPeerCount() int {
@@ -520,6 +1099,25 @@ func (s *Server) GetPeerCount() int {
 	return count
 }
 
+// GetPeerStats returns the traffic counters of every connected peer
+func (s *Server) GetPeerStats() []PeerStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make([]PeerStats, 0, len(s.peers))
+	for _, peer := range s.peers {
+		stats = append(stats, PeerStats{
+			Address:          peer.address,
+			ListenAddr:       peer.listenAddr,
+			BytesSent:        peer.traffic.bytesSent.Load(),
+			BytesReceived:    peer.traffic.bytesReceived.Load(),
+			MessagesSent:     peer.traffic.messagesSent.Load(),
+			MessagesReceived: peer.traffic.messagesReceived.Load(),
+		})
+	}
+	return stats
+}
+
 func (s *Server) GetConnectionCount() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -0,0 +1,209 @@
+package network
+
+import (
+	"blockchain-node/core"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLargeValuesRoundTrip(t *testing.T) {
+	large, _ := new(big.Int).SetString("123456789012345678901234567", 10)
+	tx := core.NewTransaction(1, nil, large, 21000, new(big.Int).Lsh(big.NewInt(1), 60), nil)
+	header := &core.BlockHeader{Number: 1, Difficulty: new(big.Int).Add(large, big.NewInt(1))}
+
+	// Message data is decoded into interface{} before it reaches a handler
+	roundTrip := func(data interface{}, v interface{}) {
+		t.Helper()
+		encoded, err := json.Marshal(&Message{Type: "tx", Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg Message
+		if err := json.Unmarshal(encoded, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := decodeData(&msg, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var decodedTx core.Transaction
+	roundTrip(tx, &decodedTx)
+	if decodedTx.Value.Cmp(tx.Value) != 0 || decodedTx.GasPrice.Cmp(tx.GasPrice) != 0 {
+		t.Errorf("value %v at gas price %v, expected %v at %v", decodedTx.Value, decodedTx.GasPrice, tx.Value, tx.GasPrice)
+	}
+
+	var decodedHeader core.BlockHeader
+	roundTrip(header, &decodedHeader)
+	if decodedHeader.Difficulty.Cmp(header.Difficulty) != 0 {
+		t.Errorf("difficulty %v, expected %v", decodedHeader.Difficulty, header.Difficulty)
+	}
+}
+
+func TestCompressedPayloadRoundTrip(t *testing.T) {
+	data := strings.Repeat("a", 4*compressionThreshold)
+	msg, err := compressMessage(&Message{Type: "tx", Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Encoding != compressionGzip {
+		t.Fatalf("payload of %d bytes was not compressed", len(data))
+	}
+
+	if err := decodePayload(msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Data != data || msg.Encoding != "" || msg.Payload != nil {
+		t.Errorf("payload not restored: %+v", msg)
+	}
+}
+
+func TestCompressedPayloadTooLarge(t *testing.T) {
+	// A JSON string that expands to one byte more than allowed
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(`"`))
+	writer.Write(bytes.Repeat([]byte("a"), maxMessageSize-1))
+	writer.Write([]byte(`"`))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{Type: "tx", Encoding: compressionGzip, Payload: buf.Bytes()}
+	if err := decodePayload(msg); err != ErrMessageTooLarge {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+func TestAdmitPeerPerIPLimit(t *testing.T) {
+	s := NewServer(0, nil)
+	s.maxConnsPerIP = 1
+
+	first, remote := net.Pipe()
+	defer first.Close()
+	defer remote.Close()
+
+	ip, err := s.admitPeer(first)
+	if err != nil {
+		t.Fatalf("first connection rejected: %v", err)
+	}
+	if _, err := s.admitPeer(first); err == nil {
+		t.Fatal("connection over the per-IP limit admitted")
+	}
+	if len(s.handshakes) != 0 {
+		t.Errorf("admission took %d handshake slots", len(s.handshakes))
+	}
+
+	s.releaseIP(ip)
+	if _, err := s.admitPeer(first); err != nil {
+		t.Errorf("connection rejected after the slot was given back: %v", err)
+	}
+}
+
+// tcpConn is a connection that reports a TCP remote address
+type tcpConn struct {
+	net.Conn
+	remote *net.TCPAddr
+}
+
+func (c tcpConn) RemoteAddr() net.Addr { return c.remote }
+
+func TestAdmitPeerOtherIPs(t *testing.T) {
+	s := NewServer(0, nil)
+	s.maxConnsPerIP = 3
+
+	conn := func(ip string, port int) net.Conn {
+		return tcpConn{remote: &net.TCPAddr{IP: net.ParseIP(ip), Port: port}}
+	}
+	for port := 1; port <= 3; port++ {
+		if _, err := s.admitPeer(conn("10.0.0.1", port)); err != nil {
+			t.Fatalf("connection %d rejected: %v", port, err)
+		}
+	}
+	if _, err := s.admitPeer(conn("10.0.0.1", 4)); err == nil {
+		t.Error("fourth connection from one IP admitted")
+	}
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3"} {
+		if _, err := s.admitPeer(conn(ip, 1)); err != nil {
+			t.Errorf("connection from %s rejected: %v", ip, err)
+		}
+	}
+}
+
+func TestStatsMessageType(t *testing.T) {
+	tests := map[string]string{
+		"version":     "version",
+		"block":       "block",
+		"tx":          "tx",
+		"made_up_123": "unknown",
+		"":            "unknown",
+	}
+	for msgType, want := range tests {
+		if got := statsMessageType(msgType); got != want {
+			t.Errorf("%q counted as %q, expected %q", msgType, got, want)
+		}
+	}
+}
+
+// nonLoopbackIP returns an IPv4 address of a local interface other than
+// loopback, or nil if there is none
+func nonLoopbackIP() net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP
+		}
+	}
+	return nil
+}
+
+func TestBindAddrLoopback(t *testing.T) {
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	s := NewServer(port, newTestChain(t))
+	s.SetBindAddr("127.0.0.1")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	loopback := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	var conn net.Conn
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", loopback); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("loopback connection failed: %v", err)
+	}
+	conn.Close()
+
+	ip := nonLoopbackIP()
+	if ip == nil {
+		t.Skip("no non-loopback interface to connect from")
+	}
+	if conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)), time.Second); err == nil {
+		conn.Close()
+		t.Errorf("connection to %s accepted while bound to loopback", ip)
+	}
+}
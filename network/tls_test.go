@@ -0,0 +1,132 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestTLSServer(t *testing.T, required bool) *Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := newTLSConfig(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		nodeKey:          key,
+		tlsConfig:        config,
+		tlsRequired:      required,
+		handshakeTimeout: 5 * time.Second,
+	}
+}
+
+// dialTLS connects a client to server over a pipe, pinning nodeID
+func dialTLS(client, server *Server, nodeID string) error {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		conn, err := server.upgradeInbound(serverConn)
+		if err == nil {
+			// Complete the handshake from this side too
+			conn.Read(make([]byte, 1))
+		}
+		serverConn.Close()
+	}()
+
+	_, err := client.upgradeOutbound(clientConn, nodeID)
+	return err
+}
+
+func TestTLSPinsNodeID(t *testing.T) {
+	client := newTestTLSServer(t, true)
+	server := newTestTLSServer(t, true)
+	other := newTestTLSServer(t, true)
+
+	if err := dialTLS(client, server, ""); err != nil {
+		t.Errorf("unpinned handshake failed: %v", err)
+	}
+	if err := dialTLS(client, server, server.NodeID()); err != nil {
+		t.Errorf("handshake with the pinned node failed: %v", err)
+	}
+	if err := dialTLS(client, server, other.NodeID()); err == nil || !strings.Contains(err.Error(), ErrNodeIDMismatch.Error()) {
+		t.Errorf("expected %v, got %v", ErrNodeIDMismatch, err)
+	}
+}
+
+func TestVerifyNodeCertificate(t *testing.T) {
+	s := newTestTLSServer(t, true)
+	raw := s.tlsConfig.Certificates[0].Certificate
+
+	if err := verifyNodeCertificate("")(raw, nil); err != nil {
+		t.Errorf("own certificate rejected: %v", err)
+	}
+	if err := verifyNodeCertificate(strings.ToUpper(s.NodeID()))(raw, nil); err != nil {
+		t.Errorf("certificate rejected for its node id: %v", err)
+	}
+	if err := verifyNodeCertificate(newTestTLSServer(t, true).NodeID())(raw, nil); err != ErrNodeIDMismatch {
+		t.Errorf("expected ErrNodeIDMismatch, got %v", err)
+	}
+	if err := verifyNodeCertificate("")(nil, nil); err != ErrNoCertificate {
+		t.Errorf("expected ErrNoCertificate, got %v", err)
+	}
+
+	// A certificate signed by another key than its own
+	forged := append([]byte(nil), raw[0]...)
+	forged[len(forged)-1] ^= 0xff
+	if err := verifyNodeCertificate("")([][]byte{forged}, nil); err == nil {
+		t.Error("certificate with a bad signature accepted")
+	}
+}
+
+func TestPlaintextPeerWhenTLSRequired(t *testing.T) {
+	for _, required := range []bool{false, true} {
+		s := newTestTLSServer(t, required)
+		clientConn, serverConn := net.Pipe()
+		go clientConn.Write([]byte(`{"type":"version"}`))
+
+		conn, err := s.upgradeInbound(serverConn)
+		if required && err != ErrPlaintextPeer {
+			t.Errorf("required: expected ErrPlaintextPeer, got %v", err)
+		}
+		if !required {
+			if err != nil {
+				t.Errorf("optional: plaintext peer rejected: %v", err)
+			} else if _, ok := conn.(*tls.Conn); ok {
+				t.Error("optional: plaintext peer upgraded to TLS")
+			}
+		}
+		clientConn.Close()
+		serverConn.Close()
+	}
+}
+
+func TestSplitEnode(t *testing.T) {
+	id := strings.Repeat("ab", 64)
+	tests := []struct {
+		address  string
+		id, host string
+		fails    bool
+	}{
+		{"10.0.0.1:8080", "", "10.0.0.1:8080", false},
+		{"enode://" + id + "@10.0.0.1:8080", id, "10.0.0.1:8080", false},
+		{"enode://" + id, "", "", true},
+		{"enode://abcd@10.0.0.1:8080", "", "", true},
+	}
+	for _, test := range tests {
+		gotID, gotHost, err := splitEnode(test.address)
+		if (err != nil) != test.fails || gotID != test.id || gotHost != test.host {
+			t.Errorf("splitEnode(%q) = %q, %q, %v", test.address, gotID, gotHost, err)
+		}
+	}
+}
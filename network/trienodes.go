@@ -0,0 +1,128 @@
+package network
+
+import (
+	"blockchain-node/crypto"
+	"blockchain-node/trie"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// nodeFetchTimeout bounds how long FetchTrieNode waits for peers to answer
+const nodeFetchTimeout = 5 * time.Second
+
+type nodeRequest struct {
+	Hash [32]byte `json:"hash"`
+}
+
+type nodeResponse struct {
+	Hash [32]byte `json:"hash"`
+	Data []byte   `json:"data"`
+}
+
+// FetchTrieNode asks every connected peer for the trie node with the given
+// hash and returns the first answer that matches it. It is meant to be used
+// as a Blockchain.SetNodeFetcher fallback when the local database lost a node.
+func (s *Server) FetchTrieNode(hash [32]byte) ([]byte, error) {
+	ch := make(chan []byte, 1)
+
+	s.mu.Lock()
+	peers := make([]*Peer, 0, len(s.peers))
+	for _, peer := range s.peers {
+		if peer.supports("getnode") {
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) == 0 {
+		s.mu.Unlock()
+		return nil, errNoNodePeers
+	}
+	s.nodeRequests[hash] = append(s.nodeRequests[hash], ch)
+	s.mu.Unlock()
+
+	defer s.removeNodeRequest(hash, ch)
+
+	for _, peer := range peers {
+		if err := s.sendMessage(peer, &Message{
+			Type: "getnode",
+			Data: nodeRequest{Hash: hash},
+		}); err != nil {
+			log.Debugf("Failed to request trie node from %s: %v", peer.address, err)
+		}
+	}
+
+	timer := time.NewTimer(nodeFetchTimeout)
+	defer timer.Stop()
+
+	select {
+	case data := <-ch:
+		log.Infof("Recovered trie node %x from peers", hash)
+		return data, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("timed out fetching trie node %x", hash)
+	case <-s.ctx.Done():
+		return nil, errors.New("server stopped")
+	}
+}
+
+func (s *Server) removeNodeRequest(hash [32]byte, ch chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	waiting := s.nodeRequests[hash]
+	for i, waiter := range waiting {
+		if waiter == ch {
+			waiting = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(waiting) == 0 {
+		delete(s.nodeRequests, hash)
+	} else {
+		s.nodeRequests[hash] = waiting
+	}
+}
+
+func (s *Server) handleGetNode(peer *Peer, msg *Message) {
+	var req nodeRequest
+	if err := decodeData(msg, &req); err != nil {
+		log.Errorf("Malformed getnode from %s: %v", peer.address, err)
+		return
+	}
+
+	data, err := trie.NodeData(s.blockchain.StateDatabase(), req.Hash)
+	if err != nil || data == nil {
+		return
+	}
+
+	s.sendMessage(peer, &Message{
+		Type: "node",
+		Data: nodeResponse{Hash: req.Hash, Data: data},
+	})
+}
+
+func (s *Server) handleNode(peer *Peer, msg *Message) {
+	var resp nodeResponse
+	if err := decodeData(msg, &resp); err != nil {
+		log.Errorf("Malformed node from %s: %v", peer.address, err)
+		return
+	}
+	if crypto.Keccak256Hash(resp.Data) != resp.Hash {
+		log.Warningf("Peer %s sent trie node not matching hash %x", peer.address, resp.Hash)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ch := range s.nodeRequests[resp.Hash] {
+		select {
+		case ch <- resp.Data:
+		default:
+		}
+	}
+}
+
+var (
+	errNoNodePeers = errors.New("no peers to fetch trie node from")
+)
@@ -0,0 +1,211 @@
+package network
+
+import (
+	"blockchain-node/core"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Transaction broadcast policies. With TxBroadcastSqrt a new transaction is
+// sent to ceil(sqrt(n)) of the n peers that don't have it yet, chosen at
+// random, and the peers receiving it relay it the same way, which reaches the
+// whole network with much less traffic than sending it to every peer.
+const (
+	TxBroadcastAll  = "all"
+	TxBroadcastSqrt = "sqrt"
+)
+
+// defaultTxAnnounceLimit is the number of pending transactions announced to a
+// new peer unless configured otherwise
+const defaultTxAnnounceLimit = 1024
+
+// SetTxBroadcast sets the transaction broadcast policy, TxBroadcastAll or
+// TxBroadcastSqrt
+func (s *Server) SetTxBroadcast(policy string) error {
+	switch policy {
+	case TxBroadcastAll, TxBroadcastSqrt:
+		s.txBroadcast = policy
+		return nil
+	default:
+		return fmt.Errorf("unknown transaction broadcast policy: %s", policy)
+	}
+}
+
+// broadcastTransactions sends the transactions entering the mempool to peers,
+// both local ones and those received from peers, until ctx is done
+func (s *Server) broadcastTransactions(ctx context.Context) {
+	txs, unsubscribe := s.blockchain.SubscribeNewTx()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tx, ok := <-txs:
+			if !ok {
+				return
+			}
+			s.BroadcastTransaction(tx)
+		}
+	}
+}
+
+// BroadcastTransaction sends tx to the peers selected by the broadcast policy
+// among those not known to have it
+func (s *Server) BroadcastTransaction(tx *core.Transaction) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msg := &Message{
+		Type: "tx",
+		Data: tx,
+	}
+
+	var candidates []*Peer
+	for _, peer := range s.peers {
+		if peer.handshaked && peer.supports(msg.Type) && !peer.knownTxs.has(tx.Hash) {
+			candidates = append(candidates, peer)
+		}
+	}
+
+	for _, peer := range selectTxPeers(candidates, s.txBroadcast) {
+		if err := s.sendMessage(peer, msg); err != nil {
+			log.Debugf("Failed to send transaction %x to %s: %v", tx.Hash, peer.address, err)
+			continue
+		}
+		peer.knownTxs.add(tx.Hash)
+	}
+}
+
+// SetTxAnnounceLimit sets how many pending transactions are announced to a
+// peer once the handshake is done, the highest priced first. Zero or less
+// disables the announcement.
+func (s *Server) SetTxAnnounceLimit(limit int) {
+	s.txAnnounceLimit = limit
+}
+
+// announceMempool sends a peer that just connected an inv of the pending
+// transactions, so it can request those it lacks. Otherwise it would only
+// learn of transactions that enter the mempool after it connected.
+func (s *Server) announceMempool(peer *Peer) {
+	if s.txAnnounceLimit <= 0 || !peer.supports("inv") {
+		return
+	}
+
+	txs := s.blockchain.GetMempool().GetPendingTransactions()
+	if len(txs) == 0 {
+		return
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].GasPrice.Cmp(txs[j].GasPrice) > 0
+	})
+	if len(txs) > s.txAnnounceLimit {
+		txs = txs[:s.txAnnounceLimit]
+	}
+
+	items := make([]string, len(txs))
+	for i, tx := range txs {
+		items[i] = fmt.Sprintf("%x", tx.Hash)
+	}
+	if err := s.sendMessage(peer, &Message{
+		Type: "inv",
+		Data: map[string]interface{}{
+			"type":  "tx",
+			"items": items,
+		},
+	}); err != nil {
+		log.Debugf("Failed to announce pending transactions to %s: %v", peer.address, err)
+		return
+	}
+	log.Debugf("Announced %d pending transactions to %s", len(items), peer.address)
+}
+
+// handleTxInv requests the announced transactions that are neither pending
+// nor in the chain. At most the announce limit of hashes is considered.
+func (s *Server) handleTxInv(peer *Peer, items []interface{}) {
+	limit := s.txAnnounceLimit
+	if limit <= 0 {
+		limit = defaultTxAnnounceLimit
+	}
+	if len(items) > limit {
+		items = items[:limit]
+	}
+
+	mempool := s.blockchain.GetMempool()
+	needed := make([]string, 0)
+	for _, item := range items {
+		hash, ok := parseInvHash(item)
+		if !ok {
+			continue
+		}
+		peer.knownTxs.add(hash)
+		if mempool.GetTransaction(hash) != nil {
+			continue
+		}
+		if tx, _, _ := s.blockchain.GetTransaction(hash); tx != nil {
+			continue
+		}
+		needed = append(needed, fmt.Sprintf("%x", hash))
+	}
+
+	if len(needed) > 0 {
+		s.sendMessage(peer, &Message{
+			Type: "getdata",
+			Data: map[string]interface{}{
+				"type":  "tx",
+				"items": needed,
+			},
+		})
+	}
+}
+
+// handleGetTxData sends the requested transactions that are still pending
+func (s *Server) handleGetTxData(peer *Peer, items []interface{}) {
+	mempool := s.blockchain.GetMempool()
+	for _, item := range items {
+		hash, ok := parseInvHash(item)
+		if !ok {
+			continue
+		}
+		if tx := mempool.GetTransaction(hash); tx != nil {
+			if err := s.sendMessage(peer, &Message{Type: "tx", Data: tx}); err != nil {
+				return
+			}
+			peer.knownTxs.add(hash)
+		}
+	}
+}
+
+// parseInvHash parses a hash of an inv or getdata message, hex without prefix
+func parseInvHash(item interface{}) ([32]byte, bool) {
+	var hash [32]byte
+	str, ok := item.(string)
+	if !ok {
+		return hash, false
+	}
+	decoded, err := hex.DecodeString(str)
+	if err != nil || len(decoded) != 32 {
+		return hash, false
+	}
+	copy(hash[:], decoded)
+	return hash, true
+}
+
+// selectTxPeers returns the peers a transaction is sent to under policy
+func selectTxPeers(peers []*Peer, policy string) []*Peer {
+	if policy != TxBroadcastSqrt || len(peers) <= 1 {
+		return peers
+	}
+
+	count := int(math.Ceil(math.Sqrt(float64(len(peers)))))
+	selected := make([]*Peer, len(peers))
+	copy(selected, peers)
+	rand.Shuffle(len(selected), func(i, j int) {
+		selected[i], selected[j] = selected[j], selected[i]
+	})
+	return selected[:count]
+}
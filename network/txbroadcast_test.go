@@ -0,0 +1,114 @@
+package network
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/crypto"
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestBroadcastTransactionFanOut(t *testing.T) {
+	s := NewServer(0, newTestChain(t))
+	const peers = 16
+	for i := 0; i < peers; i++ {
+		peer := newTestPeer(t)
+		peer.handshaked = true
+		peer.protocolVersion = ProtocolVersion
+		peer.capabilities = map[string]bool{"tx": true}
+		s.peers[fmt.Sprintf("peer-%d", i)] = peer
+	}
+	received := func(tx *core.Transaction) int {
+		count := 0
+		for _, peer := range s.peers {
+			if peer.knownTxs.has(tx.Hash) {
+				count++
+			}
+		}
+		return count
+	}
+
+	tx := core.NewTransaction(0, &common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1000), nil)
+	s.BroadcastTransaction(tx)
+	if count := received(tx); count != 4 {
+		t.Fatalf("transaction sent to %d of %d peers, expected 4", count, peers)
+	}
+
+	// Peers that have the transaction are not sent it again
+	s.BroadcastTransaction(tx)
+	if count := received(tx); count != 8 {
+		t.Errorf("transaction sent to %d peers after a second broadcast, expected 8", count)
+	}
+
+	if err := s.SetTxBroadcast(TxBroadcastAll); err != nil {
+		t.Fatal(err)
+	}
+	other := core.NewTransaction(1, &common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1000), nil)
+	s.BroadcastTransaction(other)
+	if count := received(other); count != peers {
+		t.Errorf("transaction sent to %d of %d peers with the all policy", count, peers)
+	}
+}
+
+func TestNewPeerLearnsPendingTransactions(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alloc := map[[20]byte]*big.Int{crypto.PrivateKeyToAddress(key): big.NewInt(1e18)}
+	tx := core.NewTransaction(0, &common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1000), nil)
+	if err := tx.Sign(crypto.FromECDSA(key), 1337); err != nil {
+		t.Fatal(err)
+	}
+
+	// A node with a pending transaction
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+	node := NewServer(port, newTestChainAlloc(t, alloc))
+	node.SetBindAddr("127.0.0.1")
+	if err := node.blockchain.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- node.Start(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node not listening: %v", err)
+		}
+	}
+
+	// A peer joining after the transaction was broadcast
+	joining := newTestChainAlloc(t, alloc)
+	go NewServer(0, joining).dialNode(address)
+
+	for deadline := time.Now().Add(5 * time.Second); joining.GetMempool().Size() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("pending transaction not announced to the new peer")
+		}
+	}
+	if pending := joining.GetMempool().GetPendingTransactions(); pending[0].Hash != tx.Hash {
+		t.Errorf("peer has transaction %x, expected %x", pending[0].Hash, tx.Hash)
+	}
+}
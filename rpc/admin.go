@@ -1,8 +1,10 @@
-
 package rpc
 
 import (
 	"blockchain-node/core"
+	"blockchain-node/metrics"
+	"blockchain-node/utils"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -18,9 +20,9 @@ type AdminAPI struct {
 }
 
 type NodeStatus struct {
-	Running   bool                `json:"running"`
-	StartTime time.Time          `json:"startTime"`
-	Config    *NodeConfig        `json:"config"`
+	Running   bool        `json:"running"`
+	StartTime time.Time   `json:"startTime"`
+	Config    *NodeConfig `json:"config"`
 }
 
 type NodeConfig struct {
@@ -37,7 +39,7 @@ func NewAdminAPI(blockchain *core.Blockchain) *AdminAPI {
 	return &AdminAPI{
 		blockchain: blockchain,
 		nodeStatus: &NodeStatus{
-			Running: true,
+			Running:   true,
 			StartTime: time.Now(),
 			Config: &NodeConfig{
 				DataDir:       "./data",
@@ -70,6 +72,9 @@ func (api *AdminAPI) StartHandler(w http.ResponseWriter, r *http.Request) {
 
 	var config NodeConfig
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		if bodyTooLarge(w, err) {
+			return
+		}
 		// Use default config if no config provided
 		config = *api.nodeStatus.Config
 	}
@@ -119,46 +124,136 @@ func (api *AdminAPI) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	response := map[string]interface{}{
-		"status": "ok",
-		"config": api.nodeStatus.Config,
-		"running": api.nodeStatus.Running,
+		"status":    "ok",
+		"config":    api.nodeStatus.Config,
+		"running":   api.nodeStatus.Running,
 		"startTime": api.nodeStatus.StartTime.Unix(),
-		"uptime": time.Since(api.nodeStatus.StartTime).Seconds(),
+		"uptime":    time.Since(api.nodeStatus.StartTime).Seconds(),
+	}
+	for key, value := range chainStatus(api.blockchain) {
+		response[key] = value
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
-func (api *AdminAPI) ConfigHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// chainStatus collects live chain, mempool, peer and sync figures for status endpoints
+func chainStatus(blockchain *core.Blockchain) map[string]interface{} {
+	blockHeight := uint64(0)
+	if currentBlock := blockchain.GetCurrentBlock(); currentBlock != nil {
+		blockHeight = currentBlock.Header.Number
+	}
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
+	return map[string]interface{}{
+		"blockHeight":       blockHeight,
+		"totalTransactions": metrics.GetMetrics().GetTransactionCount(),
+		"mempoolSize":       blockchain.GetMempool().Size(),
+		"peerCount":         metrics.GetMetrics().GetPeerCount(),
+		"sync":              blockchain.GetSyncStatus(),
 	}
+}
 
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// NodeInfo is the effective node configuration returned by admin_nodeInfo.
+// It must never carry secrets such as the RPC auth token.
+type NodeInfo struct {
+	ID             string             `json:"id"`    // hex encoded node public key
+	Enode          string             `json:"enode"` // enode URL with the P2P listen address
+	Protocol       uint32             `json:"protocolVersion"`
+	ChainID        uint64             `json:"chainId"`
+	ChainName      string             `json:"chainName"`
+	DataDir        string             `json:"dataDir"`
+	P2PBindAddr    string             `json:"p2pBindAddr"`
+	P2PPort        int                `json:"p2pPort"`
+	RPCAddr        string             `json:"rpcAddr"`
+	RPCPort        int                `json:"rpcPort"`
+	RPCAuth        bool               `json:"rpcAuth"`
+	MaxPeers       int                `json:"maxPeers"`
+	MaxConnsPerIP  int                `json:"maxConnsPerIp"`
+	SyncMode       string             `json:"syncMode"`
+	VMType         string             `json:"vmType"`
+	BlockGasLimit  uint64             `json:"blockGasLimit"`
+	Mining         bool               `json:"mining"`
+	Miner          string             `json:"miner"`
+	GasPriceOracle GasPriceOracleInfo `json:"gasPriceOracle"`
+}
+
+// GasPriceOracleInfo is the effective gas price oracle configuration
+type GasPriceOracleInfo struct {
+	Blocks     int    `json:"blocks"`
+	Percentile int    `json:"percentile"`
+	MinPrice   string `json:"minPrice"` // wei, 0x0 for no bound
+	MaxPrice   string `json:"maxPrice"` // wei, 0x0 for no bound
+}
+
+// SetNodeInfo sets the node settings reported by admin_nodeInfo that the RPC
+// server doesn't know itself
+func (s *Server) SetNodeInfo(info NodeInfo) {
+	s.nodeInfo = info
+}
+
+// handleNodeInfo returns the effective node configuration. Chain and RPC
+// settings are read from the running blockchain and server.
+func (s *Server) handleNodeInfo(params []interface{}) (interface{}, *RPCError) {
+	info := s.nodeInfo
+	config := s.blockchain.GetConfig()
+	info.ChainID = s.blockchain.GetChainID()
+	info.ChainName = s.blockchain.GetChainName()
+	info.DataDir = config.DataDir
+	info.BlockGasLimit = config.BlockGasLimit
+	info.RPCAddr = s.config.Host
+	info.RPCPort = s.config.Port
+	info.RPCAuth = s.config.AuthToken != ""
+	oracle := s.gasPriceConfig()
+	info.GasPriceOracle = GasPriceOracleInfo{
+		Blocks:     oracle.Blocks,
+		Percentile: oracle.Percentile,
+		MinPrice:   utils.EncodeQuantity(oracle.MinPrice),
+		MaxPrice:   utils.EncodeQuantity(oracle.MaxPrice),
 	}
+	return info, nil
+}
 
-	var newConfig NodeConfig
-	if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
-		http.Error(w, "Invalid config format", http.StatusBadRequest)
-		return
+// maxReexecuteBlocks bounds the range of one admin_reexecuteBlocks call
+const maxReexecuteBlocks = 1000
+
+// handleReexecuteBlocks executes a range of stored blocks again and reports
+// every block whose state root, gas used or receipts root differs from its
+// header
+func (s *Server) handleReexecuteBlocks(ctx context.Context, params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 2 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
 	}
 
-	// Update configuration
-	api.nodeStatus.Config = &newConfig
+	from, rpcErr := s.parseBlockNumberParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	to, rpcErr := s.parseBlockNumberParam(params[1])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if to >= from && to-from >= maxReexecuteBlocks {
+		return nil, &RPCError{Code: -32602, Message: fmt.Sprintf("range too large, at most %d blocks per call", maxReexecuteBlocks)}
+	}
 
-	response := map[string]interface{}{
-		"success": true,
-		"message": "Configuration updated successfully",
-		"config":  api.nodeStatus.Config,
+	faults, err := s.blockchain.ReexecuteRange(ctx, from, to)
+	if ctx.Err() != nil {
+		return nil, errRequestTimeout
+	}
+	if err != nil {
+		return nil, &RPCError{Code: -32000, Message: err.Error()}
 	}
 
-	json.NewEncoder(w).Encode(response)
+	mismatches := make([]map[string]interface{}, len(faults))
+	for i, fault := range faults {
+		mismatches[i] = map[string]interface{}{
+			"number": utils.EncodeQuantity(fault.Number),
+			"reason": fault.Reason,
+		}
+	}
+	return map[string]interface{}{
+		"fromBlock":  utils.EncodeQuantity(from),
+		"toBlock":    utils.EncodeQuantity(to),
+		"mismatches": mismatches,
+	}, nil
 }
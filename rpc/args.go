@@ -0,0 +1,139 @@
+package rpc
+
+import (
+	"blockchain-node/utils"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// defaultGasPrice is used when a call object does not specify a gas price (20 Gwei)
+const defaultGasPrice = 20000000000
+
+// TransactionArgs holds the fields of a transaction call object. Optional
+// fields that were not supplied are left nil.
+type TransactionArgs struct {
+	From     [20]byte
+	To       *common.Address
+	Gas      *uint64
+	GasPrice *big.Int
+	Value    *big.Int
+	Nonce    *uint64
+	Data     []byte
+}
+
+func parseTransactionArgs(param interface{}) (*TransactionArgs, *RPCError) {
+	obj, ok := param.(map[string]interface{})
+	if !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid transaction object"}
+	}
+
+	args := &TransactionArgs{}
+
+	if from, exists := obj["from"]; exists {
+		address, rpcErr := parseAddressParam(from)
+		if rpcErr != nil {
+			return nil, &RPCError{Code: -32602, Message: "Invalid from address"}
+		}
+		args.From = address
+	}
+
+	if to, exists := obj["to"]; exists && to != nil {
+		address, rpcErr := parseAddressParam(to)
+		if rpcErr != nil {
+			return nil, &RPCError{Code: -32602, Message: "Invalid to address"}
+		}
+		toAddr := common.Address(address)
+		args.To = &toAddr
+	}
+
+	if gas, exists := obj["gas"]; exists && gas != nil {
+		value, ok := parseUint64Param(gas)
+		if !ok {
+			return nil, &RPCError{Code: -32602, Message: "Invalid gas"}
+		}
+		args.Gas = &value
+	}
+
+	if nonce, exists := obj["nonce"]; exists && nonce != nil {
+		value, ok := parseUint64Param(nonce)
+		if !ok {
+			return nil, &RPCError{Code: -32602, Message: "Invalid nonce"}
+		}
+		args.Nonce = &value
+	}
+
+	if gasPrice, exists := obj["gasPrice"]; exists && gasPrice != nil {
+		value, ok := parseBigIntParam(gasPrice)
+		if !ok {
+			return nil, &RPCError{Code: -32602, Message: "Invalid gasPrice"}
+		}
+		args.GasPrice = value
+	}
+
+	if value, exists := obj["value"]; exists && value != nil {
+		parsed, ok := parseBigIntParam(value)
+		if !ok {
+			return nil, &RPCError{Code: -32602, Message: "Invalid value"}
+		}
+		args.Value = parsed
+	}
+
+	// "input" is the newer name for "data", accept either
+	data, exists := obj["input"]
+	if !exists {
+		data, exists = obj["data"]
+	}
+	if exists && data != nil {
+		dataStr, ok := data.(string)
+		if !ok {
+			return nil, &RPCError{Code: -32602, Message: "Invalid data"}
+		}
+		decoded, err := utils.DecodeBytes(dataStr)
+		if err != nil {
+			return nil, &RPCError{Code: -32602, Message: "Invalid data"}
+		}
+		args.Data = decoded
+	}
+
+	return args, nil
+}
+
+func parseHashParam(param interface{}) ([32]byte, *RPCError) {
+	hashStr, ok := param.(string)
+	if !ok {
+		return [32]byte{}, &RPCError{Code: -32602, Message: "Invalid hash parameter"}
+	}
+
+	hash, err := utils.DecodeHash(hashStr)
+	if err != nil {
+		return [32]byte{}, &RPCError{Code: -32602, Message: "Invalid hash parameter"}
+	}
+	return hash, nil
+}
+
+func parseUint64Param(param interface{}) (uint64, bool) {
+	str, ok := param.(string)
+	if !ok {
+		return 0, false
+	}
+
+	value, err := utils.DecodeQuantity(str)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+func parseBigIntParam(param interface{}) (*big.Int, bool) {
+	str, ok := param.(string)
+	if !ok {
+		return nil, false
+	}
+
+	value, err := utils.DecodeBigQuantity(str)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
@@ -0,0 +1,191 @@
+package rpc
+
+import (
+	"blockchain-node/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// Lifetimes of sign-in challenges and of the session tokens issued for them
+const (
+	challengeTTL = 5 * time.Minute
+	sessionTTL   = 15 * time.Minute
+)
+
+// maxChallenges bounds the outstanding challenges, so requesting challenges
+// for random addresses can't exhaust memory
+const maxChallenges = 10000
+
+// challenge is a message an address has to sign to get a session token
+type challenge struct {
+	message string
+	expires time.Time
+}
+
+// session is a token issued for a signed challenge
+type session struct {
+	address [20]byte
+	expires time.Time
+}
+
+// authStore keeps the outstanding sign-in challenges and the issued sessions.
+// Expired entries are dropped whenever a challenge is created.
+type authStore struct {
+	mu         sync.Mutex
+	challenges map[[20]byte]challenge
+	sessions   map[string]session
+}
+
+func newAuthStore() *authStore {
+	return &authStore{
+		challenges: make(map[[20]byte]challenge),
+		sessions:   make(map[string]session),
+	}
+}
+
+// prune drops expired challenges and sessions. Must be called with a.mu held.
+func (a *authStore) prune(now time.Time) {
+	for address, c := range a.challenges {
+		if now.After(c.expires) {
+			delete(a.challenges, address)
+		}
+	}
+	for token, sess := range a.sessions {
+		if now.After(sess.expires) {
+			delete(a.sessions, token)
+		}
+	}
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// handleAuthChallenge implements auth_challenge. It returns a message with a
+// random nonce for the address to sign with personal_sign in a secp256k1
+// wallet. A new challenge replaces the previous one of the address.
+func (s *Server) handleAuthChallenge(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	address, rpcErr := parseAddressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	nonce, err := randomHex(16)
+	if err != nil {
+		return nil, &RPCError{Code: -32603, Message: "Failed to create challenge: " + err.Error()}
+	}
+	now := time.Now()
+	expires := now.Add(challengeTTL)
+	message := fmt.Sprintf("Sign in to %s\n\nAddress: 0x%x\nNonce: %s\nExpires: %s",
+		s.blockchain.GetChainName(), address, nonce, expires.UTC().Format(time.RFC3339))
+
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+	s.auth.prune(now)
+	if _, exists := s.auth.challenges[address]; !exists && len(s.auth.challenges) >= maxChallenges {
+		return nil, &RPCError{Code: -32005, Message: "too many outstanding challenges"}
+	}
+	s.auth.challenges[address] = challenge{message: message, expires: expires}
+
+	return map[string]interface{}{
+		"message":   message,
+		"expiresAt": expires.Unix(),
+	}, nil
+}
+
+// handleAuthVerify implements auth_verify. It recovers the signer of the
+// address's challenge and issues a session token if it is the address. A
+// challenge can be answered once, a failed attempt needs a new challenge.
+func (s *Server) handleAuthVerify(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 2 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	address, rpcErr := parseAddressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	signatureStr, ok := params[1].(string)
+	if !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid signature parameter"}
+	}
+	signature, err := utils.DecodeBytes(signatureStr)
+	if err != nil || len(signature) != 65 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid signature parameter"}
+	}
+
+	s.auth.mu.Lock()
+	c, exists := s.auth.challenges[address]
+	delete(s.auth.challenges, address)
+	s.auth.mu.Unlock()
+
+	now := time.Now()
+	if !exists || now.After(c.expires) {
+		return nil, &RPCError{Code: -32000, Message: "no pending challenge for address"}
+	}
+
+	// Wallets sign with a recovery id of 27 or 28
+	sig := append([]byte{}, signature...)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	data := []byte(c.message)
+	hash := ethcrypto.Keccak256(append([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(data))), data...))
+	pubKey, err := ethcrypto.SigToPub(hash, sig)
+	if err != nil || ethcrypto.PubkeyToAddress(*pubKey) != address {
+		return nil, &RPCError{Code: -32000, Message: "signature does not match address"}
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return nil, &RPCError{Code: -32603, Message: "Failed to create session: " + err.Error()}
+	}
+	expires := now.Add(sessionTTL)
+
+	s.auth.mu.Lock()
+	s.auth.sessions[token] = session{address: address, expires: expires}
+	s.auth.mu.Unlock()
+
+	return map[string]interface{}{
+		"token":     token,
+		"expiresAt": expires.Unix(),
+	}, nil
+}
+
+// handleAuthSession implements auth_session, it returns the address a session
+// token was issued to, or null if the token is unknown or expired
+func (s *Server) handleAuthSession(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+	token, ok := params[0].(string)
+	if !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid token parameter"}
+	}
+
+	s.auth.mu.Lock()
+	sess, exists := s.auth.sessions[token]
+	s.auth.mu.Unlock()
+	if !exists || time.Now().After(sess.expires) {
+		return nil, nil
+	}
+
+	return map[string]interface{}{
+		"address":   fmt.Sprintf("0x%x", sess.address),
+		"expiresAt": sess.expires.Unix(),
+	}, nil
+}
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"testing"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// signChallenge signs message with key the way browser wallets implement
+// personal_sign, with a recovery id of 27 or 28
+func signChallenge(t *testing.T, key *ecdsa.PrivateKey, message string) string {
+	t.Helper()
+	hash := ethcrypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+	signature, err := ethcrypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature[64] += 27
+	return fmt.Sprintf("0x%x", signature)
+}
+
+func TestAuthVerify(t *testing.T) {
+	s := newTestServer(t, nil)
+	key, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := fmt.Sprintf("0x%x", ethcrypto.PubkeyToAddress(key.PublicKey))
+
+	result := call(t, s, "auth_challenge", address).(map[string]interface{})
+	signature := signChallenge(t, key, result["message"].(string))
+	token := call(t, s, "auth_verify", address, signature).(map[string]interface{})["token"]
+
+	sess, ok := call(t, s, "auth_session", token).(map[string]interface{})
+	if !ok || sess["address"] != address {
+		t.Errorf("session %v, expected one for %s", sess, address)
+	}
+}
+
+func TestAuthVerifyWrongSigner(t *testing.T) {
+	s := newTestServer(t, nil)
+	key, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := fmt.Sprintf("0x%x", ethcrypto.PubkeyToAddress(key.PublicKey))
+
+	result := call(t, s, "auth_challenge", address).(map[string]interface{})
+	signature := signChallenge(t, other, result["message"].(string))
+	if _, rpcErr := s.dispatch(context.Background(), "auth_verify", []interface{}{address, signature}); rpcErr == nil || rpcErr.Code != -32000 {
+		t.Fatalf("signature of another key accepted: %v", rpcErr)
+	}
+
+	// The failed attempt used up the challenge
+	signature = signChallenge(t, key, result["message"].(string))
+	if _, rpcErr := s.dispatch(context.Background(), "auth_verify", []interface{}{address, signature}); rpcErr == nil {
+		t.Error("challenge answered twice")
+	}
+}
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func (s *Server) handleCall(ctx context.Context, params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	tx, rpcErr := s.callTransaction(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	// Only the pending tag selects a different state, other block
+	// parameters run against the head
+	call := s.blockchain.Call
+	if len(params) > 1 && params[1] == "pending" {
+		call = s.blockchain.CallPending
+	}
+
+	result, err := call(ctx, tx)
+	if err != nil {
+		return nil, executionError(err)
+	}
+
+	return fmt.Sprintf("0x%x", result.ReturnData), nil
+}
+
+func (s *Server) handleEstimateGas(ctx context.Context, params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	tx, rpcErr := s.callTransaction(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	gas, err := s.blockchain.EstimateGas(ctx, tx)
+	if err != nil {
+		return nil, executionError(err)
+	}
+
+	return utils.EncodeQuantity(gas), nil
+}
+
+// callTransaction builds an unsigned transaction from a call object, filling
+// in the defaults used when simulating it against the current state.
+func (s *Server) callTransaction(param interface{}) (*core.Transaction, *RPCError) {
+	args, rpcErr := parseTransactionArgs(param)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	nonce := s.blockchain.GetNonce(args.From)
+	if args.Nonce != nil {
+		nonce = *args.Nonce
+	}
+
+	gas := s.blockchain.GetConfig().BlockGasLimit
+	if args.Gas != nil {
+		gas = *args.Gas
+	}
+
+	value := args.Value
+	if value == nil {
+		value = big.NewInt(0)
+	}
+
+	gasPrice := args.GasPrice
+	if gasPrice == nil {
+		gasPrice = big.NewInt(0)
+	}
+
+	tx := core.NewTransaction(nonce, args.To, value, gas, gasPrice, args.Data)
+	tx.From = common.Address(args.From)
+	return tx, nil
+}
+
+// executionError converts a call failure into an RPC error. Reverts use code
+// 3 and carry the revert data so clients can decode custom errors too.
+func executionError(err error) *RPCError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errRequestTimeout
+	}
+	var revertErr *core.RevertError
+	if errors.As(err, &revertErr) {
+		return &RPCError{
+			Code:    3,
+			Message: revertErr.Error(),
+			Data:    fmt.Sprintf("0x%x", revertErr.Data),
+		}
+	}
+	return &RPCError{Code: -32000, Message: err.Error()}
+}
@@ -0,0 +1,203 @@
+package rpc
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/evm"
+	"blockchain-node/interfaces"
+	"blockchain-node/wallet"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// slowVM is a virtual machine that doesn't finish an execution until it is
+// aborted
+type slowVM struct{}
+
+func (slowVM) ExecuteTransaction(ctx *interfaces.ExecutionContext) (*interfaces.ExecutionResult, error) {
+	select {
+	case <-ctx.Done:
+	case <-time.After(10 * time.Second):
+	}
+	return &interfaces.ExecutionResult{GasUsed: 21000, Status: 1}, nil
+}
+
+func TestRequestTimeout(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.config.RequestTimeout = 50 * time.Millisecond
+	s.blockchain.SetVirtualMachine(slowVM{})
+
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_call",
+		"params":  []interface{}{map[string]interface{}{"to": fmt.Sprintf("0x%x", [20]byte{0x01})}},
+		"id":      1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	recorder := httptest.NewRecorder()
+	s.handleRPC(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("request took %v", elapsed)
+	}
+
+	var response struct {
+		Error *RPCError `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error == nil || response.Error.Code != -32000 || response.Error.Message != errRequestTimeout.Message {
+		t.Errorf("error %+v, expected %+v", response.Error, errRequestTimeout)
+	}
+}
+
+func TestSendTransactionAfterTimeout(t *testing.T) {
+	key := newKey(t)
+	from := key.GetAddressBytes()
+	s := newTestServer(t, map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	unlockKey(t, s, key)
+	s.blockchain.SetVirtualMachine(slowVM{})
+
+	for _, gas := range []interface{}{nil, "0x5208"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		args := map[string]interface{}{
+			"from":  fmt.Sprintf("0x%x", from),
+			"to":    fmt.Sprintf("0x%x", [20]byte{0x01}),
+			"value": "0x1",
+		}
+		if gas != nil {
+			// Nothing is executed with a gas limit, so time out before queuing
+			args["gas"] = gas
+			cancel()
+		}
+
+		_, rpcErr := s.dispatch(ctx, "eth_sendTransaction", []interface{}{args})
+		cancel()
+		if rpcErr != errRequestTimeout {
+			t.Errorf("gas %v: error %+v, expected %+v", gas, rpcErr, errRequestTimeout)
+		}
+	}
+
+	if size := s.blockchain.GetMempool().Size(); size != 0 {
+		t.Errorf("%d transactions queued by timed out requests", size)
+	}
+}
+
+// revertingBin is the creation code of a contract that reverts every call
+// with Error("boom"): the runtime code stores the selector, string offset,
+// length and data in memory and reverts with those 100 bytes.
+const revertingBin = "605780600b6000396000f3" +
+	"7f08c379a000000000000000000000000000000000000000000000000000000000600052" +
+	"6020600452" +
+	"6004602452" +
+	"7f626f6f6d00000000000000000000000000000000000000000000000000000000604452" +
+	"60646000fd"
+
+// deployContract mines the deployment of the hex creation code bin by key,
+// which must not have sent transactions yet
+func deployContract(t *testing.T, s *Server, key *wallet.Wallet, bin string) *common.Address {
+	t.Helper()
+	tx := core.NewTransaction(0, nil, big.NewInt(0), 200000, big.NewInt(1000), common.FromHex(bin))
+	if err := key.SignTransaction(tx, testChainID); err != nil {
+		t.Fatal(err)
+	}
+	block := mineBlock(t, s, []*core.Transaction{tx})
+	if block.Receipts[0].ContractAddress == nil {
+		t.Fatal("contract not deployed")
+	}
+	return block.Receipts[0].ContractAddress
+}
+
+func TestCallRevertReason(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+	s.blockchain.SetVirtualMachine(evm.NewEVM(s.blockchain))
+	contract := deployContract(t, s, key, revertingBin)
+
+	for _, method := range []string{"eth_call", "eth_estimateGas"} {
+		_, rpcErr := s.dispatch(context.Background(), method, []interface{}{map[string]interface{}{"to": contract.Hex()}})
+		if rpcErr == nil {
+			t.Fatalf("%s of a reverting contract succeeded", method)
+		}
+		data, _ := rpcErr.Data.(string)
+		if rpcErr.Code != 3 || rpcErr.Message != "execution reverted: boom" || !strings.HasPrefix(data, "0x08c379a0") {
+			t.Errorf("%s error %+v, expected the revert reason boom", method, rpcErr)
+		}
+	}
+}
+
+func TestRevertedTransactionReceipt(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+	s.blockchain.SetVirtualMachine(evm.NewEVM(s.blockchain))
+	contract := deployContract(t, s, key, revertingBin)
+
+	tx := core.NewTransaction(1, contract, big.NewInt(0), 100000, big.NewInt(1000), nil)
+	if err := key.SignTransaction(tx, testChainID); err != nil {
+		t.Fatal(err)
+	}
+	block := mineBlock(t, s, []*core.Transaction{tx})
+	if len(block.Transactions) != 1 {
+		t.Fatalf("%d transactions in the block, expected the reverted one", len(block.Transactions))
+	}
+
+	receipt := call(t, s, "eth_getTransactionReceipt", fmt.Sprintf("0x%x", tx.Hash)).(map[string]interface{})
+	if receipt["status"] != "0x0" {
+		t.Errorf("status %v, expected 0x0", receipt["status"])
+	}
+	if receipt["gasUsed"] == "0x0" {
+		t.Error("reverted transaction used no gas")
+	}
+}
+
+// balanceBin is the creation code of a contract returning the balance of the
+// address in the first 32 bytes of its call data
+const balanceBin = "600c80600b6000396000f3" + "6000353160005260206000f3"
+
+func TestCallPendingBalance(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+	s.blockchain.SetVirtualMachine(evm.NewEVM(s.blockchain))
+	contract := deployContract(t, s, key, balanceBin)
+
+	recipient := common.Address{0x02}
+	tx := core.NewTransaction(1, &recipient, big.NewInt(5000), 21000, big.NewInt(1000), nil)
+	if err := key.SignTransaction(tx, testChainID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.blockchain.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	balanceAt := func(tag string) *big.Int {
+		args := map[string]interface{}{
+			"to":   contract.Hex(),
+			"data": fmt.Sprintf("0x%064x", recipient[:]),
+		}
+		result := call(t, s, "eth_call", args, tag).(string)
+		balance, ok := new(big.Int).SetString(strings.TrimPrefix(result, "0x"), 16)
+		if !ok {
+			t.Fatalf("eth_call at %s returned %s", tag, result)
+		}
+		return balance
+	}
+	if balance := balanceAt("pending"); balance.Int64() != 5000 {
+		t.Errorf("pending balance %v, expected the pending transfer of 5000", balance)
+	}
+	if balance := balanceAt("latest"); balance.Sign() != 0 {
+		t.Errorf("latest balance %v, expected 0", balance)
+	}
+}
@@ -0,0 +1,24 @@
+package rpc
+
+import "fmt"
+
+func (s *Server) handleDebugPreimage(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	hash, rpcErr := parseHashParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	preimage, enabled := s.blockchain.GetPreimage(hash)
+	if !enabled {
+		return nil, &RPCError{Code: -32000, Message: "preimage store is disabled, set enable_preimages"}
+	}
+	if preimage == nil {
+		return nil, nil
+	}
+
+	return fmt.Sprintf("0x%x", preimage), nil
+}
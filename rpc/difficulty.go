@@ -0,0 +1,33 @@
+package rpc
+
+import (
+	"blockchain-node/consensus"
+	"blockchain-node/core"
+	"blockchain-node/utils"
+	"fmt"
+	"math/big"
+)
+
+// currentDifficulty returns the difficulty of the chain head and the proof of
+// work target derived from it
+func currentDifficulty(blockchain *core.Blockchain) (*big.Int, *big.Int) {
+	difficulty := big.NewInt(0)
+	if currentBlock := blockchain.GetCurrentBlock(); currentBlock != nil && currentBlock.Header.Difficulty != nil {
+		difficulty = new(big.Int).Set(currentBlock.Header.Difficulty)
+	}
+	return difficulty, consensus.CalculateTarget(difficulty)
+}
+
+func (s *Server) handleDifficulty(params []interface{}) (interface{}, *RPCError) {
+	currentBlock := s.blockchain.GetCurrentBlock()
+	if currentBlock == nil {
+		return nil, &RPCError{Code: -32000, Message: "No blocks found"}
+	}
+
+	difficulty, target := currentDifficulty(s.blockchain)
+	return map[string]interface{}{
+		"number":     utils.EncodeQuantity(currentBlock.Header.Number),
+		"difficulty": utils.EncodeQuantity(difficulty),
+		"target":     fmt.Sprintf("0x%064x", target),
+	}, nil
+}
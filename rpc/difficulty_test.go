@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"blockchain-node/consensus"
+	"blockchain-node/utils"
+	"fmt"
+	"testing"
+)
+
+func TestDifficultyFollowsHead(t *testing.T) {
+	s := newTestServer(t, nil)
+	before := call(t, s, "eth_difficulty").(map[string]interface{})
+	if before["difficulty"] != "0x1" {
+		t.Fatalf("genesis difficulty %v, expected 0x1", before["difficulty"])
+	}
+
+	block := mineBlock(t, s, nil)
+	if block.Header.Difficulty.Cmp(s.blockchain.GetBlockByNumber(0).Header.Difficulty) == 0 {
+		t.Fatal("difficulty not adjusted")
+	}
+
+	result := call(t, s, "eth_difficulty").(map[string]interface{})
+	if result["number"] != "0x1" || result["difficulty"] != utils.EncodeQuantity(block.Header.Difficulty) {
+		t.Errorf("difficulty %v at %v, expected %s at 0x1", result["difficulty"], result["number"], utils.EncodeQuantity(block.Header.Difficulty))
+	}
+	if target := fmt.Sprintf("0x%064x", consensus.CalculateTarget(block.Header.Difficulty)); result["target"] != target {
+		t.Errorf("target %v, expected %s", result["target"], target)
+	}
+}
@@ -0,0 +1,214 @@
+package rpc
+
+import (
+	"blockchain-node/utils"
+	"context"
+	"fmt"
+)
+
+// maxBatchBalances bounds the number of addresses of one explorer_getBalances
+// call
+const maxBatchBalances = 100
+
+// handleGetBalances returns the balances of several addresses at one block.
+// The block is resolved and its state opened once for all of them.
+func (s *Server) handleGetBalances(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	addressParams, ok := params[0].([]interface{})
+	if !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid addresses parameter"}
+	}
+	if len(addressParams) > maxBatchBalances {
+		return nil, &RPCError{Code: -32602, Message: fmt.Sprintf("too many addresses, at most %d per call", maxBatchBalances)}
+	}
+
+	addresses := make([][20]byte, len(addressParams))
+	for i, param := range addressParams {
+		address, rpcErr := parseAddressParam(param)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		addresses[i] = address
+	}
+
+	stateDB, rpcErr := s.stateAtParam(params, 1)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	balances := make(map[string]string, len(addresses))
+	for _, address := range addresses {
+		balances[fmt.Sprintf("0x%x", address)] = utils.EncodeQuantity(stateDB.GetBalance(address))
+	}
+	if rpcErr := stateReadError(stateDB); rpcErr != nil {
+		return nil, rpcErr
+	}
+	return balances, nil
+}
+
+// handleGetBlockReceipts returns the receipts of a block in transaction
+// order, or null if the block is unknown. Without a page object they are
+// returned as an array, as before pagination was added; with one as a page
+// whose offset is the index of the first transaction.
+func (s *Server) handleGetBlockReceipts(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	blockNum, rpcErr := s.parseBlockNumberParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	p, rpcErr := parsePageParam(params, 1)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	block := s.blockchain.GetBlockByNumber(blockNum)
+	if block == nil {
+		return nil, nil
+	}
+	if block.Pruned {
+		return nil, prunedError(blockNum)
+	}
+
+	if len(params) < 2 || params[1] == nil {
+		receipts := make([]map[string]interface{}, len(block.Receipts))
+		for i, receipt := range block.Receipts {
+			receipts[i] = formatReceipt(receipt)
+		}
+		return receipts, nil
+	}
+
+	total := uint64(len(block.Receipts))
+	receipts := []map[string]interface{}{}
+	for i := p.offset; i < total && uint64(len(receipts)) < p.limit; i++ {
+		receipts = append(receipts, formatReceipt(block.Receipts[i]))
+	}
+	next := p.offset + uint64(len(receipts))
+	return pageResult(receipts, next, next < total), nil
+}
+
+// handleGetBlocks returns a page of blocks in ascending order, with
+// transaction hashes. The offset is the number of the first block, blocks
+// skipped by a state snapshot import are left out.
+func (s *Server) handleGetBlocks(params []interface{}) (interface{}, *RPCError) {
+	p, rpcErr := parsePageParam(params, 0)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	head := s.blockchain.GetCurrentBlock()
+	if head == nil {
+		return pageResult([]map[string]interface{}{}, 0, false), nil
+	}
+
+	blocks := []map[string]interface{}{}
+	number := p.offset
+	for ; number <= head.Header.Number && number-p.offset < p.limit; number++ {
+		if block := s.blockchain.GetBlockByNumber(number); block != nil {
+			blocks = append(blocks, s.formatBlock(block, false))
+		}
+	}
+	return pageResult(blocks, number, number <= head.Header.Number), nil
+}
+
+// handleGetAccountHistory returns a page of the transactions sent from or to
+// an address, oldest first, so that offsets stay valid as the chain grows.
+// The offset counts the account's transactions. Every call scans the chain
+// from genesis, it gives up when the request times out.
+func (s *Server) handleGetAccountHistory(ctx context.Context, params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	address, rpcErr := parseAddressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	p, rpcErr := parsePageParam(params, 1)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	head := s.blockchain.GetCurrentBlock()
+	if head == nil {
+		return pageResult([]map[string]interface{}{}, 0, false), nil
+	}
+
+	txs := []map[string]interface{}{}
+	var matched uint64
+	for number := uint64(0); number <= head.Header.Number; number++ {
+		if ctx.Err() != nil {
+			return nil, errRequestTimeout
+		}
+		block := s.blockchain.GetBlockByNumber(number)
+		if block == nil {
+			continue
+		}
+
+		for i, tx := range block.Transactions {
+			if tx.From != address && (tx.To == nil || *tx.To != address) {
+				continue
+			}
+			matched++
+			if matched <= p.offset {
+				continue
+			}
+			if uint64(len(txs)) == p.limit {
+				// One more match means there is a next page
+				return pageResult(txs, p.offset+p.limit, true), nil
+			}
+			txs = append(txs, formatTransaction(tx, block, i))
+		}
+	}
+	return pageResult(txs, 0, false), nil
+}
+
+// handleGetTransactionConfirmations returns the number of blocks confirming a
+// transaction, counting its own block, from the current chain head. Pending
+// transactions have 0 confirmations, unknown ones null.
+func (s *Server) handleGetTransactionConfirmations(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	hash, rpcErr := parseHashParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	var number uint64
+	if _, block, _ := s.blockchain.GetTransaction(hash); block != nil {
+		number = block.Header.Number
+	} else if n, pruned := s.blockchain.PrunedTransactionBlock(hash); pruned {
+		number = n
+	} else if tx := s.blockchain.GetMempool().GetTransaction(hash); tx != nil {
+		return "0x0", nil
+	} else {
+		return nil, nil
+	}
+
+	head := s.blockchain.GetCurrentBlock()
+	if head == nil || head.Header.Number < number {
+		return "0x0", nil
+	}
+	return utils.EncodeQuantity(head.Header.Number - number + 1), nil
+}
+
+// handleGetBlockTimeStats returns the average, shortest and longest time
+// between the last core.BlockTimeWindow blocks, in seconds
+func (s *Server) handleGetBlockTimeStats(params []interface{}) (interface{}, *RPCError) {
+	stats := s.blockchain.GetBlockTimeStats()
+	return map[string]interface{}{
+		"fromBlock": utils.EncodeQuantity(stats.FromBlock),
+		"toBlock":   utils.EncodeQuantity(stats.ToBlock),
+		"intervals": stats.Intervals,
+		"average":   stats.Average,
+		"min":       stats.Min,
+		"max":       stats.Max,
+	}, nil
+}
@@ -0,0 +1,180 @@
+package rpc
+
+import (
+	"blockchain-node/consensus"
+	"blockchain-node/core"
+	"blockchain-node/wallet"
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// mineBlock adds a block with txs on top of the server's chain
+func mineBlock(t *testing.T, s *Server, txs []*core.Transaction) *core.Block {
+	t.Helper()
+	head := s.blockchain.GetCurrentBlock()
+	block := core.NewBlock(head.Header.Hash, head.Header.Number+1, txs)
+	if err := s.blockchain.FinalizeBlock(block); err != nil {
+		t.Fatalf("failed to finalize block: %v", err)
+	}
+
+	pow := consensus.NewProofOfWork()
+	pow.SetHasher(s.blockchain.PoWHasher())
+	if err := pow.MineBlock(block); err != nil {
+		t.Fatalf("failed to mine block: %v", err)
+	}
+	if err := s.blockchain.AddBlock(block); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+	return block
+}
+
+// transfers returns n signed transfers of key, starting at nonce 0
+func transfers(t *testing.T, key *wallet.Wallet, n int) []*core.Transaction {
+	t.Helper()
+	txs := make([]*core.Transaction, n)
+	for i := range txs {
+		tx := core.NewTransaction(uint64(i), &common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1000), nil)
+		if err := key.SignTransaction(tx, testChainID); err != nil {
+			t.Fatal(err)
+		}
+		txs[i] = tx
+	}
+	return txs
+}
+
+func TestAccountHistoryPages(t *testing.T) {
+	key := newKey(t)
+	from := key.GetAddressBytes()
+	s := newTestServer(t, map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	mineBlock(t, s, transfers(t, key, 25))
+
+	seen := make(map[string]bool)
+	pages := 0
+	var cursor interface{} = "0x0"
+	for cursor != nil {
+		result := call(t, s, "explorer_getAccountHistory", fmt.Sprintf("0x%x", from), map[string]interface{}{"offset": cursor, "limit": "0xa"})
+		page := result.(map[string]interface{})
+		items := page["items"].([]map[string]interface{})
+		if len(items) == 0 || len(items) > 10 {
+			t.Fatalf("page %d has %d items", pages, len(items))
+		}
+		for _, tx := range items {
+			hash := tx["hash"].(string)
+			if seen[hash] {
+				t.Errorf("transaction %s on more than one page", hash)
+			}
+			seen[hash] = true
+		}
+		pages++
+		cursor = page["nextCursor"]
+	}
+
+	if pages != 3 {
+		t.Errorf("%d pages, expected 3", pages)
+	}
+	if len(seen) != 25 {
+		t.Errorf("%d transactions, expected 25", len(seen))
+	}
+}
+
+func TestBlockReceiptsWithoutPage(t *testing.T) {
+	key := newKey(t)
+	from := key.GetAddressBytes()
+	s := newTestServer(t, map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	block := mineBlock(t, s, transfers(t, key, 3))
+
+	receipts, ok := call(t, s, "explorer_getBlockReceipts", "0x1").([]map[string]interface{})
+	if !ok {
+		t.Fatal("receipts without a page object are not an array")
+	}
+	if len(receipts) != len(block.Receipts) {
+		t.Errorf("%d receipts, expected %d", len(receipts), len(block.Receipts))
+	}
+
+	paged := call(t, s, "explorer_getBlockReceipts", "0x1", map[string]interface{}{"limit": "0x2"}).(map[string]interface{})
+	if items := paged["items"].([]map[string]interface{}); len(items) != 2 || paged["nextCursor"] != "0x2" {
+		t.Errorf("page of %d receipts with cursor %v", len(items), paged["nextCursor"])
+	}
+}
+
+func TestGetBalances(t *testing.T) {
+	addresses := [][20]byte{{0x0a}, {0x0b}, {0x0c}}
+	alloc := make(map[[20]byte]*big.Int, len(addresses))
+	for i, address := range addresses {
+		alloc[address] = big.NewInt(int64(i + 1))
+	}
+	s := newTestServer(t, alloc)
+
+	params := make([]interface{}, len(addresses))
+	for i, address := range addresses {
+		params[i] = fmt.Sprintf("0x%x", address)
+	}
+	balances := call(t, s, "explorer_getBalances", params, "latest").(map[string]string)
+	if len(balances) != len(addresses) {
+		t.Fatalf("%d balances, expected %d", len(balances), len(addresses))
+	}
+	for i, address := range addresses {
+		if balance, expected := balances[params[i].(string)], fmt.Sprintf("0x%x", alloc[address]); balance != expected {
+			t.Errorf("balance of %s is %s, expected %s", params[i], balance, expected)
+		}
+	}
+
+	tooMany := make([]interface{}, maxBatchBalances+1)
+	for i := range tooMany {
+		tooMany[i] = params[0]
+	}
+	if _, rpcErr := s.dispatch(context.Background(), "explorer_getBalances", []interface{}{tooMany}); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Errorf("error %+v for %d addresses, expected -32602", rpcErr, len(tooMany))
+	}
+}
+
+func TestGetBlockReceipts(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+	block := mineBlock(t, s, transfers(t, key, 2))
+
+	receipts := call(t, s, "explorer_getBlockReceipts", "0x1").([]map[string]interface{})
+	if len(receipts) != 2 {
+		t.Fatalf("%d receipts, expected 2", len(receipts))
+	}
+	for i, receipt := range receipts {
+		if receipt["transactionHash"] != fmt.Sprintf("0x%x", block.Transactions[i].Hash) || receipt["transactionIndex"] != fmt.Sprintf("0x%x", i) {
+			t.Errorf("receipt %d is of transaction %v at index %v", i, receipt["transactionHash"], receipt["transactionIndex"])
+		}
+	}
+
+	if receipts := call(t, s, "explorer_getBlockReceipts", "0x5"); receipts != nil {
+		t.Errorf("receipts %v of an unknown block, expected null", receipts)
+	}
+}
+
+func TestGetTransactionConfirmations(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+	tx := transfers(t, key, 1)[0]
+	hash := fmt.Sprintf("0x%x", tx.Hash)
+
+	if result := call(t, s, "explorer_getTransactionConfirmations", hash); result != nil {
+		t.Errorf("unknown transaction has %v confirmations, expected null", result)
+	}
+	if err := s.blockchain.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if result := call(t, s, "explorer_getTransactionConfirmations", hash); result != "0x0" {
+		t.Errorf("pending transaction has %v confirmations, expected 0x0", result)
+	}
+
+	// Included in block 1, confirmed by every block on top
+	mineBlock(t, s, []*core.Transaction{tx})
+	for confirmations := 1; confirmations <= 3; confirmations++ {
+		expected := fmt.Sprintf("0x%x", confirmations)
+		if result := call(t, s, "explorer_getTransactionConfirmations", hash); result != expected {
+			t.Errorf("head %d: %v confirmations, expected %s", confirmations, result, expected)
+		}
+		mineBlock(t, s, nil)
+	}
+}
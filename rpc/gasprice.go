@@ -0,0 +1,168 @@
+package rpc
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/utils"
+	"math/big"
+	"sort"
+)
+
+// Gas price oracle defaults, used for zero config values
+const (
+	defaultOracleBlocks     = 20
+	defaultOraclePercentile = 60
+)
+
+// maxFeeHistoryBlocks bounds the block count of one eth_feeHistory call
+const maxFeeHistoryBlocks = 1024
+
+// GasPriceConfig tunes the gas price oracle of eth_gasPrice. The suggested
+// price is the given percentile of the gas prices paid in the last Blocks
+// blocks, clamped to MinPrice and MaxPrice.
+type GasPriceConfig struct {
+	Blocks     int    // recent blocks sampled, 0 uses defaultOracleBlocks
+	Percentile int    // 0-100, 0 uses defaultOraclePercentile
+	MinPrice   uint64 // lowest suggestion in wei, 0 for no bound
+	MaxPrice   uint64 // highest suggestion in wei, 0 for no bound
+}
+
+// gasPriceConfig returns the oracle configuration with defaults applied
+func (s *Server) gasPriceConfig() GasPriceConfig {
+	config := s.config.GasPrice
+	if config.Blocks <= 0 {
+		config.Blocks = defaultOracleBlocks
+	}
+	if config.Percentile <= 0 || config.Percentile > 100 {
+		config.Percentile = defaultOraclePercentile
+	}
+	return config
+}
+
+// suggestGasPrice returns the configured percentile of the gas prices of the
+// transactions in the sampled blocks, or the default gas price if they hold
+// no transactions
+func suggestGasPrice(blockchain *core.Blockchain, config GasPriceConfig) *big.Int {
+	var prices []*big.Int
+	if head := blockchain.GetCurrentBlock(); head != nil {
+		for n := 0; n < config.Blocks && uint64(n) <= head.Header.Number; n++ {
+			block := blockchain.GetBlockByNumber(head.Header.Number - uint64(n))
+			if block == nil {
+				continue
+			}
+			for _, tx := range block.Transactions {
+				prices = append(prices, tx.EffectiveGasPrice())
+			}
+		}
+	}
+
+	price := big.NewInt(defaultGasPrice)
+	if len(prices) > 0 {
+		price = percentile(prices, config.Percentile)
+	}
+	if config.MinPrice > 0 && price.Cmp(new(big.Int).SetUint64(config.MinPrice)) < 0 {
+		price = new(big.Int).SetUint64(config.MinPrice)
+	}
+	if config.MaxPrice > 0 && price.Cmp(new(big.Int).SetUint64(config.MaxPrice)) > 0 {
+		price = new(big.Int).SetUint64(config.MaxPrice)
+	}
+	return price
+}
+
+// percentile returns the p-th percentile of prices, which are sorted in place
+func percentile(prices []*big.Int, p int) *big.Int {
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Cmp(prices[j]) < 0
+	})
+	return prices[(len(prices)-1)*p/100]
+}
+
+func (s *Server) handleGasPrice(params []interface{}) (interface{}, *RPCError) {
+	return utils.EncodeQuantity(suggestGasPrice(s.blockchain, s.gasPriceConfig())), nil
+}
+
+// handleFeeHistory implements eth_feeHistory. Only legacy transactions exist,
+// so base fees are zero and rewards are the gas prices paid at the requested
+// percentiles of each block.
+func (s *Server) handleFeeHistory(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 2 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	blockCount, ok := parseUint64Param(params[0])
+	if !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid block count"}
+	}
+	if blockCount > maxFeeHistoryBlocks {
+		blockCount = maxFeeHistoryBlocks
+	}
+	newest, rpcErr := s.parseBlockNumberParam(params[1])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	var percentiles []float64
+	if len(params) > 2 && params[2] != nil {
+		list, ok := params[2].([]interface{})
+		if !ok {
+			return nil, &RPCError{Code: -32602, Message: "Invalid reward percentiles"}
+		}
+		for i, param := range list {
+			p, ok := param.(float64)
+			if !ok || p < 0 || p > 100 || (i > 0 && p < percentiles[i-1]) {
+				return nil, &RPCError{Code: -32602, Message: "Reward percentiles must be ascending values from 0 to 100"}
+			}
+			percentiles = append(percentiles, p)
+		}
+	}
+
+	if head := s.blockchain.GetCurrentBlock(); head == nil || newest > head.Header.Number {
+		return nil, &RPCError{Code: -32000, Message: "Block not found"}
+	}
+	if blockCount > newest+1 {
+		blockCount = newest + 1
+	}
+	oldest := newest + 1 - blockCount
+
+	baseFees := make([]string, 0, blockCount+1)
+	gasUsedRatios := make([]float64, 0, blockCount)
+	var rewards [][]string
+	for number := oldest; number <= newest; number++ {
+		baseFees = append(baseFees, "0x0")
+
+		block := s.blockchain.GetBlockByNumber(number)
+		if block == nil || block.Header.GasLimit == 0 {
+			gasUsedRatios = append(gasUsedRatios, 0)
+		} else {
+			gasUsedRatios = append(gasUsedRatios, float64(block.Header.GasUsed)/float64(block.Header.GasLimit))
+		}
+
+		if percentiles == nil {
+			continue
+		}
+		var prices []*big.Int
+		if block != nil {
+			for _, tx := range block.Transactions {
+				prices = append(prices, tx.EffectiveGasPrice())
+			}
+		}
+		reward := make([]string, len(percentiles))
+		for i, p := range percentiles {
+			reward[i] = "0x0"
+			if len(prices) > 0 {
+				reward[i] = utils.EncodeQuantity(percentile(prices, int(p)))
+			}
+		}
+		rewards = append(rewards, reward)
+	}
+	baseFees = append(baseFees, "0x0")
+
+	result := map[string]interface{}{
+		"oldestBlock":   utils.EncodeQuantity(oldest),
+		"baseFeePerGas": baseFees,
+		"gasUsedRatio":  gasUsedRatios,
+	}
+	if percentiles != nil {
+		result["reward"] = rewards
+	}
+	return result, nil
+}
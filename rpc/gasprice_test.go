@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"blockchain-node/core"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestGasPricePercentile(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+
+	// One block paying gas prices of 1000 to 5000
+	txs := make([]*core.Transaction, 5)
+	for i := range txs {
+		tx := core.NewTransaction(uint64(i), &common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(int64(i+1)*1000), nil)
+		if err := key.SignTransaction(tx, testChainID); err != nil {
+			t.Fatal(err)
+		}
+		txs[i] = tx
+	}
+	mineBlock(t, s, txs)
+	s.config.AuthToken = "secret-token"
+
+	tests := []struct {
+		config GasPriceConfig
+		price  string
+	}{
+		{GasPriceConfig{Percentile: 25}, "0x7d0"},   // 2000
+		{GasPriceConfig{Percentile: 50}, "0xbb8"},   // 3000
+		{GasPriceConfig{Percentile: 100}, "0x1388"}, // 5000
+		{GasPriceConfig{Percentile: 100, MaxPrice: 4000}, "0xfa0"},
+		{GasPriceConfig{Percentile: 1, MinPrice: 1500}, "0x5dc"},
+	}
+	for _, test := range tests {
+		s.config.GasPrice = test.config
+		if price := call(t, s, "eth_gasPrice"); price != test.price {
+			t.Errorf("%+v: gas price %v, expected %s", test.config, price, test.price)
+		}
+
+		oracle := call(t, s, "admin_nodeInfo").(NodeInfo).GasPriceOracle
+		if oracle.Percentile != test.config.Percentile || oracle.Blocks != defaultOracleBlocks {
+			t.Errorf("%+v: node info reports %+v", test.config, oracle)
+		}
+	}
+}
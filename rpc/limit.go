@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"context"
+	"time"
+)
+
+// expensiveMethods are the JSON-RPC methods that execute transactions or
+// scan many blocks. At most Config.MaxExpensive of them run at once, so a
+// burst of them can't starve block processing. All other methods are cheap
+// and never throttled.
+var expensiveMethods = map[string]bool{
+	"eth_call":                   true,
+	"eth_estimateGas":            true,
+	"eth_feeHistory":             true,
+	"eth_getProof":               true,
+	"explorer_getBalances":       true,
+	"explorer_getBlockTimeStats": true,
+	"explorer_getBlockReceipts":  true,
+	"explorer_getBlocks":         true,
+	"explorer_getAccountHistory": true,
+	"admin_exportState":          true,
+	"admin_reexecuteBlocks":      true,
+}
+
+// errLimitExceeded is returned for expensive requests that found no free
+// slot within the configured wait
+var errLimitExceeded = &RPCError{Code: -32005, Message: "limit exceeded"}
+
+// limiter bounds the number of expensive requests running at once
+type limiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// newLimiter returns a limiter allowing max concurrent expensive requests,
+// which wait up to wait for a slot. It returns nil, no limit, if max is not
+// positive.
+func newLimiter(max int, wait time.Duration) *limiter {
+	if max <= 0 {
+		return nil
+	}
+	return &limiter{slots: make(chan struct{}, max), wait: wait}
+}
+
+// acquire takes a slot for method if it is expensive and returns the
+// function releasing it. It fails with errLimitExceeded if no slot frees up
+// within the wait, and with errRequestTimeout if ctx is done first.
+func (l *limiter) acquire(ctx context.Context, method string) (func(), *RPCError) {
+	if l == nil || !expensiveMethods[method] {
+		return func() {}, nil
+	}
+	release := func() { <-l.slots }
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if l.wait <= 0 {
+		return nil, errLimitExceeded
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, errLimitExceeded
+	case <-ctx.Done():
+		return nil, errRequestTimeout
+	}
+}
@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"blockchain-node/interfaces"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// heldVM is a virtual machine that signals started for every execution and
+// doesn't finish until release is closed
+type heldVM struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (vm *heldVM) ExecuteTransaction(ctx *interfaces.ExecutionContext) (*interfaces.ExecutionResult, error) {
+	vm.started <- struct{}{}
+	<-vm.release
+	return &interfaces.ExecutionResult{GasUsed: 21000, Status: 1}, nil
+}
+
+func TestExpensiveRequestLimit(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	// request serves method through the HTTP handler and returns its error
+	request := func(method string, params ...interface{}) *RPCError {
+		body, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params, "id": 1})
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		recorder := httptest.NewRecorder()
+		s.handleRPC(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+		var response struct {
+			Error *RPCError `json:"error"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Error(err)
+		}
+		return response.Error
+	}
+	call := map[string]interface{}{"to": fmt.Sprintf("0x%x", [20]byte{0x01})}
+
+	for _, wait := range []time.Duration{0, 5 * time.Second} {
+		vm := &heldVM{started: make(chan struct{}, 3), release: make(chan struct{})}
+		s.blockchain.SetVirtualMachine(vm)
+		s.limiter = newLimiter(2, wait)
+
+		// Take both slots
+		results := make(chan *RPCError, 3)
+		for i := 0; i < 2; i++ {
+			go func() { results <- request("eth_call", call) }()
+			<-vm.started
+		}
+
+		// Cheap methods aren't throttled
+		if err := request("eth_blockNumber"); err != nil {
+			t.Errorf("wait %v: cheap request failed while saturated: %+v", wait, err)
+		}
+
+		requests := 2
+		if wait == 0 {
+			if err := request("eth_call", call); err == nil || err.Code != errLimitExceeded.Code {
+				t.Errorf("excess request: error %+v, expected %+v", err, errLimitExceeded)
+			}
+		} else {
+			// The excess request waits for a slot
+			requests++
+			go func() { results <- request("eth_call", call) }()
+			select {
+			case <-vm.started:
+				t.Error("excess request executed while saturated")
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+
+		close(vm.release)
+		for i := 0; i < requests; i++ {
+			if err := <-results; err != nil {
+				t.Errorf("wait %v: request failed: %+v", wait, err)
+			}
+		}
+	}
+}
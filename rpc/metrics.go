@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"blockchain-node/metrics"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// handleMetricsSnapshot writes the current metrics to a JSON file, by default
+// a timestamped file in the metrics directory of the node
+func (s *Server) handleMetricsSnapshot(params []interface{}) (interface{}, *RPCError) {
+	takenAt := time.Now()
+
+	name := fmt.Sprintf("metrics-%s.json", takenAt.UTC().Format("20060102-150405"))
+	if len(params) > 0 && params[0] != nil {
+		var ok bool
+		if name, ok = params[0].(string); !ok || name == "" {
+			return nil, &RPCError{Code: -32602, Message: "Invalid path parameter"}
+		}
+	}
+	path, rpcErr := s.dataFile("metrics", name)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"timestamp": takenAt.Unix(),
+		"metrics":   metrics.GetMetrics().ToMap(),
+	}, "", "  ")
+	if err != nil {
+		return nil, &RPCError{Code: -32000, Message: fmt.Sprintf("Failed to encode metrics: %v", err)}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, &RPCError{Code: -32000, Message: fmt.Sprintf("Failed to write metrics snapshot: %v", err)}
+	}
+
+	return map[string]interface{}{
+		"path":      path,
+		"timestamp": takenAt.Unix(),
+	}, nil
+}
+
+// handleResetMetrics resets the metrics counters
+func (s *Server) handleResetMetrics(params []interface{}) (interface{}, *RPCError) {
+	s.blockchain.ResetMetrics()
+	rpcLog.Info("Metrics reset over RPC")
+	return true, nil
+}
@@ -0,0 +1,22 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAdminMethodsRequireAuthToken(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	for _, method := range []string{"admin_exportState", "admin_importState", "admin_metricsSnapshot", "admin_resetMetrics", "admin_nodeInfo"} {
+		_, rpcErr := s.dispatch(context.Background(), method, nil)
+		if rpcErr == nil || rpcErr.Code != -32000 {
+			t.Errorf("%s allowed without rpc_auth_token: %v", method, rpcErr)
+		}
+	}
+
+	s.config.AuthToken = "secret"
+	if result := call(t, s, "admin_resetMetrics"); result != true {
+		t.Errorf("admin_resetMetrics returned %v with a token set", result)
+	}
+}
@@ -24,6 +24,7 @@ type MiningStats struct {
 	HashRate     float64 `json:"hashRate"`
 	BlocksFound  int     `json:"blocksFound"`
 	Difficulty   string  `json:"difficulty"`
+	Target       string  `json:"target"`
 	MinerAddress string  `json:"minerAddress"`
 	StartTime    int64   `json:"startTime"`
 }
@@ -62,6 +63,9 @@ func (api *MiningAPI) StartHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if bodyTooLarge(w, err) {
+			return
+		}
 		http.Error(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
@@ -138,10 +142,13 @@ func (api *MiningAPI) StatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	api.mutex.RLock()
-	defer api.mutex.RUnlock()
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
 
 	// Update stats
+	difficulty, target := currentDifficulty(api.blockchain)
+	api.stats.Difficulty = difficulty.String()
+	api.stats.Target = fmt.Sprintf("0x%064x", target)
 	if api.isActive && time.Now().Unix()-api.stats.StartTime > 0 {
 		api.stats.HashRate = float64(api.stats.BlocksFound) / float64(time.Now().Unix()-api.stats.StartTime)
 	}
@@ -170,6 +177,9 @@ func (api *MiningAPI) MineBlockHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if bodyTooLarge(w, err) {
+			return
+		}
 		http.Error(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
@@ -191,6 +201,10 @@ func (api *MiningAPI) MineBlockHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Mine the block using consensus
 	consensusEngine := consensus.NewProofOfWork()
+	consensusEngine.SetHasher(api.blockchain.PoWHasher())
+	if currentBlock != nil {
+		block.Header.Difficulty = consensusEngine.CalculateDifficulty(block, currentBlock)
+	}
 	if err := consensusEngine.MineBlock(block); err != nil {
 		http.Error(w, "Failed to mine block: "+err.Error(), http.StatusInternalServerError)
 		return
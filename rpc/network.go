@@ -1,9 +1,9 @@
-
 package rpc
 
 import (
 	"blockchain-node/core"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"runtime"
 	"time"
@@ -29,16 +29,18 @@ func (api *NetworkAPI) StatsHandler(w http.ResponseWriter, r *http.Request) {
 		blockHeight = currentBlock.Header.Number
 	}
 
+	difficulty, target := currentDifficulty(api.blockchain)
 	stats := map[string]interface{}{
 		"peerCount":   0, // Will be updated by P2P server
 		"blockHeight": blockHeight,
-		"difficulty":  "1000",
+		"difficulty":  difficulty.String(),
+		"target":      fmt.Sprintf("0x%064x", target),
 		"hashRate":    "0",
 		"chainId":     api.blockchain.GetConfig().ChainID,
 		"syncStatus": map[string]interface{}{
-			"isSyncing":     false,
-			"currentBlock":  blockHeight,
-			"highestBlock":  blockHeight,
+			"isSyncing":    false,
+			"currentBlock": blockHeight,
+			"highestBlock": blockHeight,
 		},
 	}
 
@@ -0,0 +1,60 @@
+package rpc
+
+import "blockchain-node/utils"
+
+// Page sizes of the paginated explorer methods. A limit above maxPageSize is
+// lowered to it, clients follow nextCursor for the rest.
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+// page selects a slice of a collection. Paginated methods take an optional
+// page object {"offset": QUANTITY, "limit": QUANTITY} and return
+// {"items": [...], "nextCursor": QUANTITY|null}, where nextCursor is the
+// offset of the next page.
+type page struct {
+	offset uint64
+	limit  uint64
+}
+
+// parsePageParam parses the page object at params[index], all fields are
+// optional
+func parsePageParam(params []interface{}, index int) (page, *RPCError) {
+	p := page{limit: defaultPageSize}
+	if len(params) <= index || params[index] == nil {
+		return p, nil
+	}
+
+	obj, ok := params[index].(map[string]interface{})
+	if !ok {
+		return p, &RPCError{Code: -32602, Message: "Invalid page parameter"}
+	}
+	if offset, present := obj["offset"]; present {
+		if p.offset, ok = parseUint64Param(offset); !ok {
+			return p, &RPCError{Code: -32602, Message: "Invalid page offset"}
+		}
+	}
+	if limit, present := obj["limit"]; present {
+		if p.limit, ok = parseUint64Param(limit); !ok || p.limit == 0 {
+			return p, &RPCError{Code: -32602, Message: "Invalid page limit"}
+		}
+	}
+	if p.limit > maxPageSize {
+		p.limit = maxPageSize
+	}
+	return p, nil
+}
+
+// pageResult returns the page object of items. next is the offset of the
+// next page, only used if more is set.
+func pageResult(items interface{}, next uint64, more bool) map[string]interface{} {
+	var nextCursor interface{}
+	if more {
+		nextCursor = utils.EncodeQuantity(next)
+	}
+	return map[string]interface{}{
+		"items":      items,
+		"nextCursor": nextCursor,
+	}
+}
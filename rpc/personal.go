@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"blockchain-node/utils"
+	"blockchain-node/wallet"
+	"fmt"
+	"time"
+)
+
+func (s *Server) handleUnlockAccount(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 2 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	address, rpcErr := parseAddressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	password, ok := params[1].(string)
+	if !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid password parameter"}
+	}
+
+	// Duration is given in seconds, zero or omitted unlocks until locked
+	var duration time.Duration
+	if len(params) > 2 && params[2] != nil {
+		seconds, ok := params[2].(float64)
+		if !ok || seconds < 0 {
+			return nil, &RPCError{Code: -32602, Message: "Invalid duration parameter"}
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	if err := s.keystore.Unlock(address, password, duration); err != nil {
+		return nil, &RPCError{Code: -32000, Message: err.Error()}
+	}
+
+	return true, nil
+}
+
+func (s *Server) handleLockAccount(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	address, rpcErr := parseAddressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if err := s.keystore.Lock(address); err != nil {
+		return nil, &RPCError{Code: -32000, Message: err.Error()}
+	}
+
+	return true, nil
+}
+
+func (s *Server) handleListAccounts(params []interface{}) (interface{}, *RPCError) {
+	accounts := s.keystore.Accounts()
+
+	result := make([]string, len(accounts))
+	for i, address := range accounts {
+		result[i] = fmt.Sprintf("0x%x", address)
+	}
+	return result, nil
+}
+
+func (s *Server) handlePersonalSign(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 2 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	dataStr, ok := params[0].(string)
+	if !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid data parameter"}
+	}
+	data, err := utils.DecodeBytes(dataStr)
+	if err != nil {
+		return nil, &RPCError{Code: -32602, Message: "Invalid data parameter"}
+	}
+
+	address, rpcErr := parseAddressParam(params[1])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	// Prefix the message so a signature can never be replayed as a transaction
+	message := append([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(data))), data...)
+
+	signature, err := s.keystore.SignData(address, message)
+	if err != nil {
+		if err == wallet.ErrAccountLocked || err == wallet.ErrUnknownAccount {
+			return nil, &RPCError{Code: -32000, Message: err.Error()}
+		}
+		return nil, &RPCError{Code: -32603, Message: "Failed to sign data: " + err.Error()}
+	}
+
+	return fmt.Sprintf("0x%x", signature), nil
+}
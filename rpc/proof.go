@@ -0,0 +1,127 @@
+package rpc
+
+import (
+	"blockchain-node/utils"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// accountProof is the EIP-1186 result of eth_getProof. Proof nodes are the
+// hex encoded trie node encodings from the root down, as made by trie.Prove.
+type accountProof struct {
+	Address      string         `json:"address"`
+	AccountProof []string       `json:"accountProof"`
+	Balance      string         `json:"balance"`
+	CodeHash     string         `json:"codeHash"`
+	Nonce        string         `json:"nonce"`
+	StorageHash  string         `json:"storageHash"`
+	StorageProof []storageProof `json:"storageProof"`
+}
+
+type storageProof struct {
+	Key   string   `json:"key"`
+	Value string   `json:"value"`
+	Proof []string `json:"proof"`
+}
+
+func (s *Server) handleGetProof(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 3 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	address, rpcErr := parseAddressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	keyParams, ok := params[1].([]interface{})
+	if !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid storage keys parameter"}
+	}
+	keys := make([][32]byte, len(keyParams))
+	for i, param := range keyParams {
+		key, rpcErr := parseStorageKeyParam(param)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		keys[i] = key
+	}
+
+	blockNum, rpcErr := s.parseBlockNumberParam(params[2])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	stateDB, _, err := s.blockchain.StateAt(blockNum)
+	if err != nil {
+		return nil, &RPCError{Code: -32000, Message: err.Error()}
+	}
+
+	proof, err := stateDB.GetProof(address)
+	if err != nil {
+		return nil, &RPCError{Code: -32000, Message: err.Error()}
+	}
+
+	result := &accountProof{
+		Address:      fmt.Sprintf("0x%x", address),
+		AccountProof: encodeProof(proof),
+		Balance:      utils.EncodeQuantity(stateDB.GetBalance(address)),
+		CodeHash:     fmt.Sprintf("0x%x", stateDB.GetCodeHash(address)),
+		Nonce:        utils.EncodeQuantity(stateDB.GetNonce(address)),
+		StorageHash:  fmt.Sprintf("0x%x", stateDB.GetStorageRoot(address)),
+		StorageProof: make([]storageProof, len(keys)),
+	}
+
+	for i, key := range keys {
+		proof, err := stateDB.GetStorageProof(address, key)
+		if err != nil {
+			return nil, &RPCError{Code: -32000, Message: err.Error()}
+		}
+
+		value := stateDB.GetCommittedState(address, key)
+		result.StorageProof[i] = storageProof{
+			Key:   fmt.Sprintf("0x%x", key),
+			Value: utils.EncodeQuantity(new(big.Int).SetBytes(value[:])),
+			Proof: encodeProof(proof),
+		}
+	}
+
+	// Reads that hit a missing node return zero values, don't prove those
+	if err := stateDB.Error(); err != nil {
+		return nil, &RPCError{Code: -32000, Message: err.Error()}
+	}
+
+	return result, nil
+}
+
+// parseStorageKeyParam parses a storage slot given as hex of up to 32 bytes
+func parseStorageKeyParam(param interface{}) ([32]byte, *RPCError) {
+	var key [32]byte
+
+	keyStr, ok := param.(string)
+	if !ok {
+		return key, &RPCError{Code: -32602, Message: "Invalid storage key parameter"}
+	}
+
+	keyStr = strings.TrimPrefix(keyStr, "0x")
+	if len(keyStr)%2 == 1 {
+		keyStr = "0" + keyStr
+	}
+	decoded, err := hex.DecodeString(keyStr)
+	if err != nil || len(decoded) > 32 {
+		return key, &RPCError{Code: -32602, Message: "Invalid storage key parameter"}
+	}
+
+	copy(key[32-len(decoded):], decoded)
+	return key, nil
+}
+
+func encodeProof(proof [][]byte) []string {
+	encoded := make([]string, len(proof))
+	for i, node := range proof {
+		encoded[i] = fmt.Sprintf("0x%x", node)
+	}
+	return encoded
+}
@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"blockchain-node/state"
+	"blockchain-node/trie"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// decodeProof decodes the hex proof nodes of eth_getProof, checking that
+// each is an RLP list of a leaf or extension, or of a branch
+func decodeProof(t *testing.T, encoded []string) [][]byte {
+	t.Helper()
+	proof := make([][]byte, len(encoded))
+	for i, node := range encoded {
+		data, err := hex.DecodeString(strings.TrimPrefix(node, "0x"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var items [][]byte
+		if err := rlp.DecodeBytes(data, &items); err != nil || (len(items) != 2 && len(items) != 17) {
+			t.Fatalf("proof node %d is not an RLP trie node: %s", i, node)
+		}
+		proof[i] = data
+	}
+	return proof
+}
+
+func TestGetProof(t *testing.T) {
+	key := newKey(t)
+	from := key.GetAddressBytes()
+	s := newTestServer(t, map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	block := mineBlock(t, s, transfers(t, key, 2))
+
+	result := call(t, s, "eth_getProof", fmt.Sprintf("0x%x", from), []interface{}{"0x0"}, "latest").(*accountProof)
+	value, err := trie.VerifyProof(block.Header.StateRoot, from[:], decodeProof(t, result.AccountProof))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account state.Account
+	if err := json.Unmarshal(value, &account); err != nil {
+		t.Fatalf("proven value %q: %v", value, err)
+	}
+	if account.Nonce != 2 || fmt.Sprintf("0x%x", account.Balance) != result.Balance || result.Nonce != "0x2" {
+		t.Errorf("proven account %+v, result balance %s nonce %s", account, result.Balance, result.Nonce)
+	}
+	if len(result.StorageProof) != 1 || result.StorageProof[0].Value != "0x0" {
+		t.Errorf("storage proof %+v, expected a zero value", result.StorageProof)
+	}
+
+	// The genesis state doesn't hold the recipient, the proof shows its absence
+	absent := [20]byte{0x01}
+	genesis := s.blockchain.GetBlockByNumber(0)
+	result = call(t, s, "eth_getProof", fmt.Sprintf("0x%x", absent), []interface{}{}, "0x0").(*accountProof)
+	value, err = trie.VerifyProof(genesis.Header.StateRoot, absent[:], decodeProof(t, result.AccountProof))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != nil {
+		t.Errorf("absent account proven to hold %q", value)
+	}
+
+	// At the head the recipient exists, its proof doesn't verify against genesis
+	result = call(t, s, "eth_getProof", fmt.Sprintf("0x%x", absent), []interface{}{}, "latest").(*accountProof)
+	if value, err := trie.VerifyProof(block.Header.StateRoot, absent[:], decodeProof(t, result.AccountProof)); err != nil || value == nil {
+		t.Errorf("recipient not proven at the head: %v", err)
+	}
+	if _, err := trie.VerifyProof(genesis.Header.StateRoot, absent[:], decodeProof(t, result.AccountProof)); err == nil {
+		t.Error("head proof verified against the genesis state root")
+	}
+}
@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"blockchain-node/logger"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+var rpcLog = logger.Module("rpc")
+
+// maxLoggedParams caps the length of the params summary in request logs
+const maxLoggedParams = 256
+
+// redacted replaces sensitive values in request logs
+const redacted = "<redacted>"
+
+// sensitiveParams lists the positions of secret parameters by method
+var sensitiveParams = map[string][]int{
+	"personal_unlockAccount": {1}, // password
+	"auth_session":           {0}, // session token
+}
+
+// sensitiveFields are object keys whose values are never logged
+var sensitiveFields = map[string]bool{
+	"password":   true,
+	"passphrase": true,
+	"privatekey": true,
+	"secret":     true,
+}
+
+// errorResponse is an RPC error as sent to the client, carrying the
+// correlation id of the request so it can be found in the node's logs
+type errorResponse struct {
+	*RPCError
+	RequestID string `json:"requestId"`
+}
+
+// newRequestID returns a random correlation id for a request
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// logRequest writes a debug log line for a finished JSON-RPC request
+func logRequest(requestID, method string, params []interface{}, duration time.Duration, rpcErr *RPCError) {
+	fields := map[string]interface{}{
+		"request_id":  requestID,
+		"method":      method,
+		"params":      summarizeParams(method, params),
+		"duration_ms": float64(duration.Microseconds()) / 1000,
+		"status":      "ok",
+	}
+	if rpcErr != nil {
+		fields["status"] = "error"
+		fields["error_code"] = rpcErr.Code
+		fields["error"] = rpcErr.Message
+	}
+	rpcLog.WithFields(fields).Debug("RPC request")
+}
+
+// summarizeParams renders params for logging with secrets redacted,
+// truncated to maxLoggedParams characters
+func summarizeParams(method string, params []interface{}) string {
+	safe := make([]interface{}, len(params))
+	for i, param := range params {
+		safe[i] = redact(param)
+	}
+	for _, i := range sensitiveParams[method] {
+		if i < len(safe) {
+			safe[i] = redacted
+		}
+	}
+
+	data, err := json.Marshal(safe)
+	if err != nil {
+		return "<unencodable>"
+	}
+	if len(data) > maxLoggedParams {
+		return string(data[:maxLoggedParams]) + "..."
+	}
+	return string(data)
+}
+
+// redact returns a copy of value with the values of sensitive object keys
+// replaced
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		safe := make(map[string]interface{}, len(v))
+		for key, field := range v {
+			if sensitiveFields[strings.ToLower(key)] {
+				safe[key] = redacted
+			} else {
+				safe[key] = redact(field)
+			}
+		}
+		return safe
+	case []interface{}:
+		safe := make([]interface{}, len(v))
+		for i, item := range v {
+			safe[i] = redact(item)
+		}
+		return safe
+	default:
+		return value
+	}
+}
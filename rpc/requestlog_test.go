@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"blockchain-node/logger"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogCorrelationID(t *testing.T) {
+	var out bytes.Buffer
+	log := logger.GetLogger()
+	output, level := log.Out, log.GetLevel()
+	log.SetOutput(&out)
+	logger.SetLevel(logger.DEBUG)
+	t.Cleanup(func() {
+		log.SetOutput(output)
+		log.SetLevel(level)
+	})
+
+	s := newTestServer(t, nil)
+	body := []byte(`{"jsonrpc":"2.0","method":"personal_unlockAccount","params":["0x0000000000000000000000000000000000000001","hunter2"],"id":1}`)
+	recorder := httptest.NewRecorder()
+	s.handleRPC(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+
+	var response struct {
+		Error *struct {
+			RequestID string `json:"requestId"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error == nil || response.Error.RequestID == "" {
+		t.Fatal("error response without a request id")
+	}
+	if header := recorder.Header().Get("X-Request-ID"); header != response.Error.RequestID {
+		t.Errorf("request id header %q, expected %q", header, response.Error.RequestID)
+	}
+
+	logged := out.String()
+	if !strings.Contains(logged, "request_id="+response.Error.RequestID) || !strings.Contains(logged, "method=personal_unlockAccount") {
+		t.Errorf("no log entry of request %s:\n%s", response.Error.RequestID, logged)
+	}
+	if strings.Contains(logged, "hunter2") {
+		t.Errorf("password logged:\n%s", logged)
+	}
+}
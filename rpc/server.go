@@ -2,10 +2,20 @@ package rpc
 
 import (
 	"blockchain-node/core"
+	"blockchain-node/metrics"
+	"blockchain-node/security"
+	"blockchain-node/state"
+	"blockchain-node/utils"
+	"blockchain-node/validation"
+	"blockchain-node/version"
+	"blockchain-node/wallet"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,8 +23,16 @@ import (
 )
 
 type Config struct {
-	Host string
-	Port int
+	Host            string
+	Port            int
+	WalletDir       string
+	ShutdownTimeout time.Duration
+	MaxBodySize     int64         // request body limit in bytes, 0 uses defaultMaxBodySize
+	RequestTimeout  time.Duration // JSON-RPC request limit, 0 uses defaultRequestTimeout
+	AuthToken       string        // bearer token required on every request, empty disables auth
+	GasPrice        GasPriceConfig
+	MaxExpensive    int           // concurrent expensive requests, 0 for no limit
+	ExpensiveWait   time.Duration // how long an expensive request waits for a slot
 }
 
 type Server struct {
@@ -22,49 +40,68 @@ type Server struct {
 	blockchain *core.Blockchain
 	server     *http.Server
 	walletAPI  *WalletAPI
+	keystore   *wallet.KeyStore
+	security   *security.SecurityManager
+	nodeInfo   NodeInfo
+	limiter    *limiter
+	auth       *authStore
 }
 
 func NewServer(config *Config, blockchain *core.Blockchain) *Server {
+	keystore := wallet.NewKeyStore(config.WalletDir)
+	if err := keystore.Load(); err != nil {
+		log.Printf("Failed to load keystore from %s: %v", config.WalletDir, err)
+	}
+
 	return &Server{
 		config:     config,
 		blockchain: blockchain,
 		walletAPI:  NewWalletAPI(blockchain),
+		keystore:   keystore,
+		limiter:    newLimiter(config.MaxExpensive, config.ExpensiveWait),
+		auth:       newAuthStore(),
 	}
 }
 
+// SetSecurityManager makes the server refuse blacklisted IPs and report
+// failed authentication attempts to the manager
+func (s *Server) SetSecurityManager(sm *security.SecurityManager) {
+	s.security = sm
+}
+
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
-	
+
 	// JSON-RPC endpoint
 	mux.HandleFunc("/", s.handleRPC)
-	
+
 	// Wallet API endpoints
 	mux.HandleFunc("/api/wallet/create", s.walletAPI.CreateHandler)
 	mux.HandleFunc("/api/wallet/import", s.walletAPI.ImportHandler)
 	mux.HandleFunc("/api/wallet/send", s.walletAPI.SendTransactionHandler)
 	mux.HandleFunc("/api/wallet/balance", s.walletAPI.CheckBalanceHandler)
-	
+
 	// Admin API endpoints
 	mux.HandleFunc("/api/admin/status", s.handleAdminStatus)
 	mux.HandleFunc("/api/admin/start", s.handleAdminStart)
 	mux.HandleFunc("/api/admin/stop", s.handleAdminStop)
-	
+
 	// Mining API endpoints
 	mux.HandleFunc("/api/mining/start", s.handleMiningStart)
 	mux.HandleFunc("/api/mining/stop", s.handleMiningStop)
 	mux.HandleFunc("/api/mining/stats", s.handleMiningStats)
 	mux.HandleFunc("/api/mining/mine-block", s.handleMineBlock)
-	
+
 	// Network API endpoints
 	mux.HandleFunc("/api/network/stats", s.handleNetworkStats)
 	mux.HandleFunc("/api/network/peers", s.handleNetworkPeers)
-	
+
 	// Metrics endpoint
 	mux.HandleFunc("/api/metrics", s.handleMetrics)
 
 	s.server = &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", s.config.Host, s.config.Port),
-		Handler: corsMiddleware(mux),
+		Handler: corsMiddleware(s.authMiddleware(bodyLimitMiddleware(s.config.MaxBodySize, metricsMiddleware(mux)))),
 	}
 
 	log.Printf("RPC server starting on %s:%d", s.config.Host, s.config.Port)
@@ -73,7 +110,11 @@ func (s *Server) Start() error {
 
 func (s *Server) Stop() error {
 	if s.server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		timeout := s.config.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
 		return s.server.Shutdown(ctx)
 	}
@@ -85,16 +126,107 @@ func corsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		
+
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// authMiddleware refuses requests from blacklisted IPs with 403 and, when an
+// auth token is configured, requests without it with 401. Failed attempts are
+// reported to the security manager, which blacklists IPs that keep failing.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := r.RemoteAddr
+		if s.security != nil {
+			clientIP = s.security.ValidateClientIP(r.RemoteAddr)
+			if s.security.IsBlacklisted(clientIP) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		if s.config.AuthToken == "" || validAuthToken(r, s.config.AuthToken) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.security != nil && s.security.RecordAuthFailure(clientIP) {
+			log.Printf("Blacklisted %s after repeated RPC authentication failures", clientIP)
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// validAuthToken reports whether r carries token as its bearer token
+func validAuthToken(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// defaultMaxBodySize is the request body limit used when none is configured
+const defaultMaxBodySize = 1024 * 1024
+
+// defaultRequestTimeout is the JSON-RPC request timeout used when none is
+// configured
+const defaultRequestTimeout = 30 * time.Second
+
+// errRequestTimeout is returned for requests that didn't finish in time
+var errRequestTimeout = &RPCError{Code: -32000, Message: "request timed out"}
+
+// bodyLimitMiddleware caps request bodies at limit bytes. Reading past the
+// limit fails with *http.MaxBytesError, which handlers report with
+// bodyTooLarge.
+func bodyLimitMiddleware(limit int64, next http.Handler) http.Handler {
+	if limit <= 0 {
+		limit = defaultMaxBodySize
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyTooLarge replies with 413 and returns true if err is caused by a
+// request body over the size limit
+func bodyTooLarge(w http.ResponseWriter, err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return false
+	}
+	http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+	return true
+}
+
+// metricsMiddleware records request counts and latencies of the REST
+// endpoints. JSON-RPC calls are recorded per method by handleRPC instead.
+func metricsMiddleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "/" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		mux.ServeHTTP(w, r)
+
+		// Unregistered paths share one label to bound the number of series
+		if pattern == "" {
+			pattern = "unknown"
+		}
+		metrics.GetMetrics().RecordRPCRequest(pattern, time.Since(start))
+	})
+}
+
 func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -109,6 +241,9 @@ func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if bodyTooLarge(w, err) {
+			return
+		}
 		http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
 		return
 	}
@@ -116,55 +251,261 @@ func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
 	var result interface{}
 	var rpcErr *RPCError
 
-	switch req.Method {
+	requestID := newRequestID()
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.requestTimeout())
+	defer cancel()
+
+	// The method runs in its own goroutine so a slow one can't hold the
+	// connection past the timeout
+	type outcome struct {
+		result interface{}
+		err    *RPCError
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("RPC method %s panicked (request %s): %v", req.Method, requestID, p)
+				done <- outcome{err: &RPCError{Code: -32603, Message: "Internal error"}}
+			}
+		}()
+		release, err := s.limiter.acquire(ctx, req.Method)
+		if err != nil {
+			done <- outcome{err: err}
+			return
+		}
+		defer release()
+		result, err := s.dispatch(ctx, req.Method, req.Params)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		result, rpcErr = res.result, res.err
+	case <-ctx.Done():
+		rpcErr = errRequestTimeout
+	}
+
+	method := req.Method
+	if rpcErr != nil && rpcErr.Code == -32601 {
+		method = "unknown"
+	}
+	duration := time.Since(start)
+	metrics.GetMetrics().RecordRPCRequest(method, duration)
+	logRequest(requestID, req.Method, req.Params, duration, rpcErr)
+
+	response := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      req.ID,
+	}
+
+	if rpcErr != nil {
+		response["error"] = errorResponse{RPCError: rpcErr, RequestID: requestID}
+	} else {
+		response["result"] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Request-ID", requestID)
+	json.NewEncoder(w).Encode(response)
+}
+
+// formatChainID returns chainID as eth_chainId reports it, a hex quantity,
+// and as net_version does, a decimal string. The network id always equals the
+// chain id.
+func formatChainID(chainID uint64) (hexID string, networkID string) {
+	return utils.EncodeQuantity(chainID), strconv.FormatUint(chainID, 10)
+}
+
+// dispatch calls the handler of a JSON-RPC method. ctx is done when the
+// request times out, long running handlers should give up then.
+func (s *Server) dispatch(ctx context.Context, method string, params []interface{}) (interface{}, *RPCError) {
+	// Admin methods read and write files and change the node, anyone who can
+	// reach an unauthenticated server could use them
+	if strings.HasPrefix(method, "admin_") && s.config.AuthToken == "" {
+		return nil, &RPCError{Code: -32000, Message: method + " requires rpc_auth_token to be set"}
+	}
+
+	switch method {
 	case "eth_chainId":
-		result = fmt.Sprintf("0x%x", s.blockchain.GetChainID())
+		chainID, _ := formatChainID(s.blockchain.GetChainID())
+		return chainID, nil
 	case "net_version":
-		result = strconv.FormatUint(s.blockchain.GetChainID(), 10)
+		_, networkID := formatChainID(s.blockchain.GetChainID())
+		return networkID, nil
+	case "web3_clientVersion":
+		return version.ClientVersion(s.blockchain.GetChainName()), nil
+	case "eth_protocolVersion":
+		return utils.EncodeQuantity(uint64(s.nodeInfo.Protocol)), nil
 	case "eth_blockNumber":
 		if currentBlock := s.blockchain.GetCurrentBlock(); currentBlock != nil {
-			result = fmt.Sprintf("0x%x", currentBlock.Header.Number)
-		} else {
-			result = "0x0"
+			return utils.EncodeQuantity(currentBlock.Header.Number), nil
 		}
+		return "0x0", nil
+	case "eth_difficulty":
+		return s.handleDifficulty(params)
+	case "eth_gasPrice":
+		return s.handleGasPrice(params)
+	case "eth_feeHistory":
+		return s.handleFeeHistory(params)
 	case "eth_getBalance":
-		result, rpcErr = s.handleGetBalance(req.Params)
+		return s.handleGetBalance(params)
 	case "eth_getTransactionCount":
-		result, rpcErr = s.handleGetTransactionCount(req.Params)
+		return s.handleGetTransactionCount(params)
+	case "explorer_getBalances":
+		return s.handleGetBalances(params)
+	case "explorer_getBlockTimeStats":
+		return s.handleGetBlockTimeStats(params)
+	case "explorer_getBlockReceipts":
+		return s.handleGetBlockReceipts(params)
+	case "explorer_getBlocks":
+		return s.handleGetBlocks(params)
+	case "explorer_getAccountHistory":
+		return s.handleGetAccountHistory(ctx, params)
+	case "explorer_getTransactionConfirmations":
+		return s.handleGetTransactionConfirmations(params)
+	case "eth_getProof":
+		return s.handleGetProof(params)
 	case "eth_getBlockByNumber":
-		result, rpcErr = s.handleGetBlockByNumber(req.Params)
+		return s.handleGetBlockByNumber(params)
 	case "eth_getBlockByHash":
-		result, rpcErr = s.handleGetBlockByHash(req.Params)
+		return s.handleGetBlockByHash(params)
+	case "eth_getUncleCountByBlockNumber":
+		return s.handleGetUncleCountByBlockNumber(params)
+	case "eth_getUncleCountByBlockHash":
+		return s.handleGetUncleCountByBlockHash(params)
+	case "eth_getUncleByBlockNumberAndIndex":
+		return s.handleGetUncleByBlockNumberAndIndex(params)
+	case "eth_getUncleByBlockHashAndIndex":
+		return s.handleGetUncleByBlockHashAndIndex(params)
 	case "eth_getTransactionByHash":
-		result, rpcErr = s.handleGetTransactionByHash(req.Params)
+		return s.handleGetTransactionByHash(params)
 	case "eth_getTransactionReceipt":
-		result, rpcErr = s.handleGetTransactionReceipt(req.Params)
+		return s.handleGetTransactionReceipt(params)
+	case "txpool_inspect":
+		return s.handleTxPoolInspect(params)
+	case "eth_call":
+		return s.handleCall(ctx, params)
+	case "eth_estimateGas":
+		return s.handleEstimateGas(ctx, params)
 	case "eth_sendTransaction":
-		result, rpcErr = s.handleSendTransaction(req.Params)
+		return s.handleSendTransaction(ctx, params)
 	case "eth_sendRawTransaction":
-		result, rpcErr = s.handleSendRawTransaction(req.Params)
+		return s.handleSendRawTransaction(params)
+	case "personal_unlockAccount":
+		return s.handleUnlockAccount(params)
+	case "personal_lockAccount":
+		return s.handleLockAccount(params)
+	case "personal_listAccounts":
+		return s.handleListAccounts(params)
+	case "personal_sign":
+		return s.handlePersonalSign(params)
+	case "auth_challenge":
+		return s.handleAuthChallenge(params)
+	case "auth_verify":
+		return s.handleAuthVerify(params)
+	case "auth_session":
+		return s.handleAuthSession(params)
+	case "debug_preimage":
+		return s.handleDebugPreimage(params)
+	case "admin_exportState":
+		return s.handleExportState(params)
+	case "admin_importState":
+		return s.handleImportState(params)
+	case "admin_reexecuteBlocks":
+		return s.handleReexecuteBlocks(ctx, params)
+	case "admin_nodeInfo":
+		return s.handleNodeInfo(params)
+	case "admin_metricsSnapshot":
+		return s.handleMetricsSnapshot(params)
+	case "admin_resetMetrics":
+		return s.handleResetMetrics(params)
 	default:
-		rpcErr = &RPCError{Code: -32601, Message: "Method not found"}
+		return nil, &RPCError{Code: -32601, Message: "Method not found"}
 	}
 
-	response := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      req.ID,
+}
+
+// requestTimeout returns how long a JSON-RPC request may run
+func (s *Server) requestTimeout() time.Duration {
+	if s.config.RequestTimeout <= 0 {
+		return defaultRequestTimeout
+	}
+	return s.config.RequestTimeout
+}
+
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func parseAddressParam(param interface{}) ([20]byte, *RPCError) {
+	addressStr, ok := param.(string)
+	if !ok {
+		return [20]byte{}, &RPCError{Code: -32602, Message: "Invalid address parameter"}
 	}
 
+	address, err := utils.DecodeAddress(addressStr)
+	if err != nil {
+		return [20]byte{}, &RPCError{Code: -32602, Message: "Invalid address format"}
+	}
+	return address, nil
+}
+
+// parseBlockNumberParam parses a hex block number or the "latest" tag
+func (s *Server) parseBlockNumberParam(param interface{}) (uint64, *RPCError) {
+	blockNumStr, ok := param.(string)
+	if !ok {
+		return 0, &RPCError{Code: -32602, Message: "Invalid block number parameter"}
+	}
+
+	if blockNumStr == "latest" {
+		if currentBlock := s.blockchain.GetCurrentBlock(); currentBlock != nil {
+			return currentBlock.Header.Number, nil
+		}
+		return 0, nil
+	}
+
+	blockNum, err := utils.DecodeQuantity(blockNumStr)
+	if err != nil {
+		return 0, &RPCError{Code: -32602, Message: "Invalid block number format"}
+	}
+	return blockNum, nil
+}
+
+// stateAtParam opens the state at the block given by params[index], or the
+// latest state if the parameter is omitted. A block whose state is no longer
+// stored is reported as an error.
+func (s *Server) stateAtParam(params []interface{}, index int) (*state.StateDB, *RPCError) {
+	if len(params) <= index {
+		return s.blockchain.GetStateDB(), nil
+	}
+
+	blockNum, rpcErr := s.parseBlockNumberParam(params[index])
 	if rpcErr != nil {
-		response["error"] = rpcErr
-	} else {
-		response["result"] = result
+		return nil, rpcErr
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	stateDB, _, err := s.blockchain.StateAt(blockNum)
+	if errors.Is(err, state.ErrMissingTrieNode) {
+		return nil, &RPCError{Code: -32000, Message: fmt.Sprintf("state at block %d is not available", blockNum)}
+	}
+	if err != nil {
+		return nil, &RPCError{Code: -32000, Message: err.Error()}
+	}
+	return stateDB, nil
 }
 
-type RPCError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+// stateReadError reports a failed read from stateDB, reads return zero
+// values when trie nodes are missing
+func stateReadError(stateDB *state.StateDB) *RPCError {
+	if err := stateDB.Error(); err != nil {
+		return &RPCError{Code: -32000, Message: err.Error()}
+	}
+	return nil
 }
 
 func (s *Server) handleGetBalance(params []interface{}) (interface{}, *RPCError) {
@@ -172,28 +513,21 @@ func (s *Server) handleGetBalance(params []interface{}) (interface{}, *RPCError)
 		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
 	}
 
-	addressStr, ok := params[0].(string)
-	if !ok {
-		return nil, &RPCError{Code: -32602, Message: "Invalid address parameter"}
-	}
-
-	// Clean address
-	addressStr = strings.TrimSpace(addressStr)
-	if strings.HasPrefix(addressStr, "0x") {
-		addressStr = addressStr[2:]
+	address, rpcErr := parseAddressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
 	}
 
-	if len(addressStr) != 40 {
-		return nil, &RPCError{Code: -32602, Message: "Invalid address format"}
+	stateDB, rpcErr := s.stateAtParam(params, 1)
+	if rpcErr != nil {
+		return nil, rpcErr
 	}
 
-	var address [20]byte
-	for i := 0; i < 20; i++ {
-		fmt.Sscanf(addressStr[i*2:i*2+2], "%02x", &address[i])
+	balance := stateDB.GetBalance(address)
+	if rpcErr := stateReadError(stateDB); rpcErr != nil {
+		return nil, rpcErr
 	}
-
-	balance := s.blockchain.GetStateDB().GetBalance(address)
-	return fmt.Sprintf("0x%x", balance), nil
+	return utils.EncodeQuantity(balance), nil
 }
 
 func (s *Server) handleGetTransactionCount(params []interface{}) (interface{}, *RPCError) {
@@ -201,24 +535,21 @@ func (s *Server) handleGetTransactionCount(params []interface{}) (interface{}, *
 		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
 	}
 
-	addressStr, ok := params[0].(string)
-	if !ok {
-		return nil, &RPCError{Code: -32602, Message: "Invalid address parameter"}
+	address, rpcErr := parseAddressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
 	}
 
-	// Clean address
-	addressStr = strings.TrimSpace(addressStr)
-	if strings.HasPrefix(addressStr, "0x") {
-		addressStr = addressStr[2:]
+	stateDB, rpcErr := s.stateAtParam(params, 1)
+	if rpcErr != nil {
+		return nil, rpcErr
 	}
 
-	var address [20]byte
-	for i := 0; i < 20; i++ {
-		fmt.Sscanf(addressStr[i*2:i*2+2], "%02x", &address[i])
+	nonce := stateDB.GetNonce(address)
+	if rpcErr := stateReadError(stateDB); rpcErr != nil {
+		return nil, rpcErr
 	}
-
-	nonce := s.blockchain.GetStateDB().GetNonce(address)
-	return fmt.Sprintf("0x%x", nonce), nil
+	return utils.EncodeQuantity(nonce), nil
 }
 
 func (s *Server) handleGetBlockByNumber(params []interface{}) (interface{}, *RPCError) {
@@ -226,27 +557,9 @@ func (s *Server) handleGetBlockByNumber(params []interface{}) (interface{}, *RPC
 		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
 	}
 
-	blockNumStr, ok := params[0].(string)
-	if !ok {
-		return nil, &RPCError{Code: -32602, Message: "Invalid block number parameter"}
-	}
-
-	var blockNum uint64
-	if blockNumStr == "latest" {
-		if currentBlock := s.blockchain.GetCurrentBlock(); currentBlock != nil {
-			blockNum = currentBlock.Header.Number
-		} else {
-			return nil, nil
-		}
-	} else {
-		if strings.HasPrefix(blockNumStr, "0x") {
-			blockNumStr = blockNumStr[2:]
-		}
-		var err error
-		blockNum, err = strconv.ParseUint(blockNumStr, 16, 64)
-		if err != nil {
-			return nil, &RPCError{Code: -32602, Message: "Invalid block number format"}
-		}
+	blockNum, rpcErr := s.parseBlockNumberParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
 	}
 
 	block := s.blockchain.GetBlockByNumber(blockNum)
@@ -254,7 +567,8 @@ func (s *Server) handleGetBlockByNumber(params []interface{}) (interface{}, *RPC
 		return nil, nil
 	}
 
-	return s.formatBlock(block), nil
+	fullTx, _ := params[1].(bool)
+	return s.formatBlock(block, fullTx), nil
 }
 
 func (s *Server) handleGetBlockByHash(params []interface{}) (interface{}, *RPCError) {
@@ -262,19 +576,9 @@ func (s *Server) handleGetBlockByHash(params []interface{}) (interface{}, *RPCEr
 		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
 	}
 
-	hashStr, ok := params[0].(string)
-	if !ok {
-		return nil, &RPCError{Code: -32602, Message: "Invalid hash parameter"}
-	}
-
-	// Clean hash
-	if strings.HasPrefix(hashStr, "0x") {
-		hashStr = hashStr[2:]
-	}
-
-	var hash [32]byte
-	for i := 0; i < 32 && i*2 < len(hashStr); i++ {
-		fmt.Sscanf(hashStr[i*2:i*2+2], "%02x", &hash[i])
+	hash, rpcErr := parseHashParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
 	}
 
 	block := s.blockchain.GetBlockByHash(hash)
@@ -282,43 +586,267 @@ func (s *Server) handleGetBlockByHash(params []interface{}) (interface{}, *RPCEr
 		return nil, nil
 	}
 
-	return s.formatBlock(block), nil
+	fullTx, _ := params[1].(bool)
+	return s.formatBlock(block, fullTx), nil
 }
 
-func (s *Server) formatBlock(block *core.Block) map[string]interface{} {
-	txHashes := make([]string, len(block.Transactions))
-	for i, tx := range block.Transactions {
-		txHashes[i] = fmt.Sprintf("0x%x", tx.Hash)
+// formatBlock returns the JSON-RPC block object of block, with the full
+// transaction objects if fullTx is set and their hashes otherwise
+func (s *Server) formatBlock(block *core.Block, fullTx bool) map[string]interface{} {
+	var transactions []interface{}
+	if block.Pruned {
+		// Only the hashes of pruned transactions are left
+		transactions = make([]interface{}, len(block.TxHashes))
+		for i, hash := range block.TxHashes {
+			transactions[i] = fmt.Sprintf("0x%x", hash)
+		}
+	} else {
+		transactions = make([]interface{}, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			if fullTx {
+				transactions[i] = formatTransaction(tx, block, i)
+			} else {
+				transactions[i] = fmt.Sprintf("0x%x", tx.Hash)
+			}
+		}
 	}
 
 	return map[string]interface{}{
-		"number":           fmt.Sprintf("0x%x", block.Header.Number),
+		"number":           utils.EncodeQuantity(block.Header.Number),
 		"hash":             fmt.Sprintf("0x%x", block.Header.Hash),
 		"parentHash":       fmt.Sprintf("0x%x", block.Header.ParentHash),
-		"timestamp":        fmt.Sprintf("0x%x", block.Header.Timestamp),
-		"gasLimit":         fmt.Sprintf("0x%x", block.Header.GasLimit),
-		"gasUsed":          fmt.Sprintf("0x%x", block.Header.GasUsed),
-		"difficulty":       fmt.Sprintf("0x%x", block.Header.Difficulty),
-		"transactionCount": len(block.Transactions),
-		"transactions":     txHashes,
-		"size":            "0x0",
-		"miner":           "0x0000000000000000000000000000000000000000",
+		"timestamp":        utils.EncodeQuantity(uint64(block.Header.Timestamp)),
+		"gasLimit":         utils.EncodeQuantity(block.Header.GasLimit),
+		"gasUsed":          utils.EncodeQuantity(block.Header.GasUsed),
+		"difficulty":       utils.EncodeQuantity(block.Header.Difficulty),
+		"transactionCount": len(transactions),
+		"transactions":     transactions,
+		"uncles":           []string{},
+		"sha3Uncles":       emptyUncleHash,
+		"size":             "0x0",
+		"miner":            fmt.Sprintf("0x%x", block.Header.Coinbase),
 	}
 }
 
+// handleGetTransactionByHash looks the transaction up in the chain and then
+// in the mempool. Pending transactions have null block fields.
 func (s *Server) handleGetTransactionByHash(params []interface{}) (interface{}, *RPCError) {
-	// Implementation for getting transaction by hash
-	return nil, &RPCError{Code: -32601, Message: "Not implemented"}
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	hash, rpcErr := parseHashParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if tx, block, index := s.blockchain.GetTransaction(hash); tx != nil {
+		return formatTransaction(tx, block, index), nil
+	}
+	if tx := s.blockchain.GetMempool().GetTransaction(hash); tx != nil {
+		return formatTransaction(tx, nil, 0), nil
+	}
+	if number, pruned := s.blockchain.PrunedTransactionBlock(hash); pruned {
+		return nil, prunedError(number)
+	}
+	return nil, nil
+}
+
+// prunedError is returned for transactions and receipts of a pruned block
+func prunedError(number uint64) *RPCError {
+	return &RPCError{Code: -32000, Message: fmt.Sprintf("%v: transactions and receipts of block %d were pruned", core.ErrPruned, number)}
+}
+
+// formatTransaction returns the JSON-RPC transaction object of tx, included
+// in block at index. block is nil for pending transactions.
+func formatTransaction(tx *core.Transaction, block *core.Block, index int) map[string]interface{} {
+	var blockHash, blockNumber, transactionIndex, to interface{}
+	if block != nil {
+		blockHash = fmt.Sprintf("0x%x", block.Header.Hash)
+		blockNumber = utils.EncodeQuantity(block.Header.Number)
+		transactionIndex = utils.EncodeQuantity(uint64(index))
+	}
+	if tx.To != nil {
+		to = strings.ToLower(tx.To.Hex())
+	}
+
+	quantity := func(value *big.Int) string {
+		if value == nil {
+			return "0x0"
+		}
+		return utils.EncodeQuantity(value)
+	}
+
+	return map[string]interface{}{
+		"hash":             fmt.Sprintf("0x%x", tx.Hash),
+		"nonce":            utils.EncodeQuantity(tx.Nonce),
+		"blockHash":        blockHash,
+		"blockNumber":      blockNumber,
+		"transactionIndex": transactionIndex,
+		"from":             strings.ToLower(tx.From.Hex()),
+		"to":               to,
+		"value":            quantity(tx.Value),
+		"gas":              utils.EncodeQuantity(tx.GasLimit),
+		"gasPrice":         quantity(tx.GasPrice),
+		"input":            fmt.Sprintf("0x%x", tx.Data),
+		"type":             "0x0",
+		"v":                quantity(tx.V),
+		"r":                quantity(tx.R),
+		"s":                quantity(tx.S),
+	}
 }
 
 func (s *Server) handleGetTransactionReceipt(params []interface{}) (interface{}, *RPCError) {
-	// Implementation for getting transaction receipt
-	return nil, &RPCError{Code: -32601, Message: "Not implemented"}
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	hash, rpcErr := parseHashParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	receipt := s.blockchain.GetTransactionReceipt(hash)
+	if receipt == nil {
+		if number, pruned := s.blockchain.PrunedTransactionBlock(hash); pruned {
+			return nil, prunedError(number)
+		}
+		return nil, nil
+	}
+
+	return formatReceipt(receipt), nil
 }
 
-func (s *Server) handleSendTransaction(params []interface{}) (interface{}, *RPCError) {
-	// Implementation for sending transaction
-	return nil, &RPCError{Code: -32601, Message: "Not implemented"}
+func formatReceipt(receipt *core.TransactionReceipt) map[string]interface{} {
+	logs := make([]map[string]interface{}, len(receipt.Logs))
+	for i, l := range receipt.Logs {
+		topics := make([]string, len(l.Topics))
+		for j, topic := range l.Topics {
+			topics[j] = topic.Hex()
+		}
+		logs[i] = map[string]interface{}{
+			"address":          strings.ToLower(l.Address.Hex()),
+			"topics":           topics,
+			"data":             fmt.Sprintf("0x%x", l.Data),
+			"blockNumber":      utils.EncodeQuantity(l.BlockNumber),
+			"transactionHash":  fmt.Sprintf("0x%x", l.TxHash),
+			"transactionIndex": utils.EncodeQuantity(l.TxIndex),
+			"blockHash":        fmt.Sprintf("0x%x", l.BlockHash),
+			"logIndex":         utils.EncodeQuantity(l.Index),
+			"removed":          l.Removed,
+		}
+	}
+
+	var to, contractAddress interface{}
+	if receipt.To != nil {
+		to = strings.ToLower(receipt.To.Hex())
+	}
+	if receipt.ContractAddress != nil {
+		contractAddress = strings.ToLower(receipt.ContractAddress.Hex())
+	}
+
+	effectiveGasPrice := "0x0"
+	if receipt.EffectiveGasPrice != nil {
+		effectiveGasPrice = utils.EncodeQuantity(receipt.EffectiveGasPrice)
+	}
+
+	return map[string]interface{}{
+		"transactionHash":   fmt.Sprintf("0x%x", receipt.TxHash),
+		"transactionIndex":  utils.EncodeQuantity(receipt.TxIndex),
+		"blockHash":         fmt.Sprintf("0x%x", receipt.BlockHash),
+		"blockNumber":       utils.EncodeQuantity(receipt.BlockNumber),
+		"from":              strings.ToLower(receipt.From.Hex()),
+		"to":                to,
+		"contractAddress":   contractAddress,
+		"gasUsed":           utils.EncodeQuantity(receipt.GasUsed),
+		"cumulativeGasUsed": utils.EncodeQuantity(receipt.CumulativeGasUsed),
+		"effectiveGasPrice": effectiveGasPrice,
+		"type":              utils.EncodeQuantity(uint64(receipt.Type)),
+		"status":            utils.EncodeQuantity(receipt.Status),
+		"logs":              logs,
+		"logsBloom":         fmt.Sprintf("0x%x", receipt.LogsBloom.Bytes()),
+	}
+}
+
+func (s *Server) handleSendTransaction(ctx context.Context, params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	args, rpcErr := parseTransactionArgs(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if !s.keystore.HasAccount(args.From) {
+		return nil, &RPCError{Code: -32000, Message: wallet.ErrUnknownAccount.Error()}
+	}
+	if !s.keystore.IsUnlocked(args.From) {
+		return nil, &RPCError{Code: -32000, Message: wallet.ErrAccountLocked.Error()}
+	}
+
+	// Continue after any transactions from this account still in the mempool
+	var nonce uint64
+	if args.Nonce != nil {
+		nonce = *args.Nonce
+	} else {
+		stateNonce := s.blockchain.GetNonce(args.From)
+		nonce = s.blockchain.GetMempool().GetPendingNonce(args.From, stateNonce)
+	}
+
+	value := args.Value
+	if value == nil {
+		value = big.NewInt(0)
+	}
+
+	gasPrice := args.GasPrice
+	if gasPrice == nil {
+		gasPrice = big.NewInt(defaultGasPrice)
+	}
+
+	tx := core.NewTransaction(nonce, args.To, value, 0, gasPrice, args.Data)
+	tx.From = args.From
+	if args.Gas != nil {
+		tx.GasLimit = *args.Gas
+	} else {
+		gas, err := s.blockchain.EstimateGas(ctx, tx)
+		if ctx.Err() != nil {
+			return nil, errRequestTimeout
+		}
+		if err != nil {
+			return nil, &RPCError{Code: -32000, Message: "Failed to estimate gas: " + err.Error()}
+		}
+		tx.GasLimit = gas
+	}
+
+	if err := s.keystore.SignTransaction(args.From, tx, s.blockchain.GetChainID()); err != nil {
+		return nil, &RPCError{Code: -32000, Message: err.Error()}
+	}
+
+	// The client was already told the request timed out, so it must not
+	// be sent anyway
+	if ctx.Err() != nil {
+		return nil, errRequestTimeout
+	}
+	if err := s.blockchain.AddTransaction(tx); err != nil {
+		return nil, transactionError(err)
+	}
+
+	return fmt.Sprintf("0x%x", tx.Hash), nil
+}
+
+// transactionError maps an error adding a transaction to its JSON-RPC error:
+// -32602 for transactions that are invalid on any node, -32003 for those
+// rejected by the limits of this node and -32000 otherwise
+func transactionError(err error) *RPCError {
+	switch {
+	case validation.IsInvalid(err):
+		return &RPCError{Code: -32602, Message: err.Error()}
+	case validation.IsPolicyError(err):
+		return &RPCError{Code: -32003, Message: "transaction rejected: " + err.Error()}
+	default:
+		return &RPCError{Code: -32000, Message: err.Error()}
+	}
 }
 
 func (s *Server) handleSendRawTransaction(params []interface{}) (interface{}, *RPCError) {
@@ -328,16 +856,21 @@ func (s *Server) handleSendRawTransaction(params []interface{}) (interface{}, *R
 
 func (s *Server) handleAdminStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	
+
 	response := map[string]interface{}{
 		"status": "running",
 		"config": map[string]interface{}{
 			"chainId":   s.blockchain.GetChainID(),
+			"chainName": s.blockchain.GetChainName(),
+			"extraData": fmt.Sprintf("0x%x", s.blockchain.GetGenesisExtraData()),
 			"dataDir":   s.blockchain.GetConfig().DataDir,
 			"gasLimit":  s.blockchain.GetConfig().BlockGasLimit,
 		},
 	}
-	
+	for key, value := range chainStatus(s.blockchain) {
+		response[key] = value
+	}
+
 	json.NewEncoder(w).Encode(response)
 }
 
@@ -367,14 +900,16 @@ func (s *Server) handleMiningStop(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleMiningStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	
+
+	difficulty, target := currentDifficulty(s.blockchain)
 	stats := map[string]interface{}{
 		"isActive":    false,
 		"hashRate":    0,
 		"blocksFound": 0,
-		"difficulty":  "1024",
+		"difficulty":  difficulty.String(),
+		"target":      fmt.Sprintf("0x%064x", target),
 	}
-	
+
 	json.NewEncoder(w).Encode(stats)
 }
 
@@ -389,13 +924,15 @@ func (s *Server) handleMineBlock(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleNetworkStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	
+
+	difficulty, target := currentDifficulty(s.blockchain)
 	stats := map[string]interface{}{
 		"peerCount":  0,
-		"difficulty": "1024",
+		"difficulty": difficulty.String(),
+		"target":     fmt.Sprintf("0x%064x", target),
 		"hashRate":   "0",
 	}
-	
+
 	json.NewEncoder(w).Encode(stats)
 }
 
@@ -406,16 +943,16 @@ func (s *Server) handleNetworkPeers(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	
+
 	metrics := map[string]interface{}{
-		"uptime":            time.Now().Unix(),
-		"memoryUsage":       100 * 1024 * 1024,
-		"diskUsage":         500 * 1024 * 1024,
-		"cpuUsage":          10.5,
-		"blockCount":        1,
-		"transactionCount":  0,
-		"peersConnected":    0,
-	}
-	
+		"uptime":           time.Now().Unix(),
+		"memoryUsage":      100 * 1024 * 1024,
+		"diskUsage":        500 * 1024 * 1024,
+		"cpuUsage":         10.5,
+		"blockCount":       1,
+		"transactionCount": 0,
+		"peersConnected":   0,
+	}
+
 	json.NewEncoder(w).Encode(metrics)
 }
@@ -0,0 +1,449 @@
+package rpc
+
+import (
+	"blockchain-node/core"
+	"blockchain-node/core/coretest"
+	"blockchain-node/execution"
+	"blockchain-node/metrics"
+	"blockchain-node/utils"
+	"blockchain-node/wallet"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testChainID = coretest.ChainID
+
+// newTestServer creates a server on a new chain in a temporary directory.
+// The genesis block funds each address of alloc with its balance in wei.
+func newTestServer(t *testing.T, alloc map[[20]byte]*big.Int) *Server {
+	t.Helper()
+	return newTestServerConfig(t, alloc, nil)
+}
+
+// newTestServerConfig is like newTestServer, but lets configure change the
+// chain config first
+func newTestServerConfig(t *testing.T, alloc map[[20]byte]*big.Int, configure func(*core.Config)) *Server {
+	t.Helper()
+	dir := t.TempDir()
+
+	config := &core.Config{
+		DataDir:       filepath.Join(dir, "data"),
+		ChainID:       testChainID,
+		BlockGasLimit: coretest.BlockGasLimit,
+		GenesisPath:   coretest.WriteGenesis(t, dir, alloc),
+	}
+	if configure != nil {
+		configure(config)
+	}
+	blockchain, err := core.NewBlockchain(config)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	t.Cleanup(func() { blockchain.Close() })
+
+	vm, err := execution.New(execution.VMTypeCustom, blockchain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.SetVirtualMachine(vm)
+
+	return NewServer(&Config{WalletDir: filepath.Join(dir, "wallet")}, blockchain)
+}
+
+// newKey creates a key that can be funded in the genesis block before it is
+// added to a server's keystore with unlockKey
+func newKey(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// unlockKey stores w in the server's keystore and unlocks it
+func unlockKey(t *testing.T, s *Server, w *wallet.Wallet) {
+	t.Helper()
+	if _, err := s.keystore.StoreKey(w, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.keystore.Unlock(w.GetAddressBytes(), "password", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// call dispatches a JSON-RPC method and fails the test on an error
+func call(t *testing.T, s *Server, method string, params ...interface{}) interface{} {
+	t.Helper()
+	result, rpcErr := s.dispatch(context.Background(), method, params)
+	if rpcErr != nil {
+		t.Fatalf("%s failed: %d %s", method, rpcErr.Code, rpcErr.Message)
+	}
+	return result
+}
+
+func TestSendTransactionWithoutGas(t *testing.T) {
+	key := newKey(t)
+	from := key.GetAddressBytes()
+	s := newTestServer(t, map[[20]byte]*big.Int{
+		from: new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18)),
+	})
+	unlockKey(t, s, key)
+
+	to := [20]byte{0x01}
+	result := call(t, s, "eth_sendTransaction", map[string]interface{}{
+		"from":  fmt.Sprintf("0x%x", from),
+		"to":    fmt.Sprintf("0x%x", to),
+		"value": "0xde0b6b3a7640000", // 1 ether
+	})
+
+	hashStr, _ := result.(string)
+	hashBytes, err := utils.DecodeBytes(hashStr)
+	if err != nil || len(hashBytes) != 32 {
+		t.Fatalf("expected a transaction hash, got %v", result)
+	}
+
+	tx := s.blockchain.GetMempool().GetTransaction([32]byte(hashBytes))
+	if tx == nil {
+		t.Fatal("transaction not in the mempool")
+	}
+	if tx.From != from {
+		t.Errorf("sender %x, expected %x", tx.From, from)
+	}
+	if tx.GasLimit < 21000 {
+		t.Errorf("estimated gas limit %d is below the transfer cost", tx.GasLimit)
+	}
+}
+
+func TestFormatPrunedBlock(t *testing.T) {
+	block := &core.Block{
+		Header:   &core.BlockHeader{Number: 5, Difficulty: big.NewInt(1)},
+		TxHashes: [][32]byte{{0xaa}, {0xbb}},
+		Pruned:   true,
+	}
+
+	for _, fullTx := range []bool{false, true} {
+		formatted := (&Server{}).formatBlock(block, fullTx)
+		if count := formatted["transactionCount"]; count != 2 {
+			t.Errorf("fullTx %v: transactionCount %v, expected 2", fullTx, count)
+		}
+		txs, _ := formatted["transactions"].([]interface{})
+		if len(txs) != 2 || txs[1] != fmt.Sprintf("0x%x", [32]byte{0xbb}) {
+			t.Errorf("fullTx %v: transactions %v, expected the pruned hashes", fullTx, txs)
+		}
+	}
+}
+
+func TestConcurrentStateReads(t *testing.T) {
+	key := newKey(t)
+	from := key.GetAddressBytes()
+	funds := big.NewInt(1e18)
+	s := newTestServer(t, map[[20]byte]*big.Int{from: funds})
+
+	// Every transfer costs its value and 21000 gas at a price of 1000
+	const blocks = 20
+	cost := big.NewInt(1 + 21000*1000)
+	txs := transfers(t, key, blocks)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var lastNonce uint64
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				stateDB := s.blockchain.GetStateDB()
+				nonce := stateDB.GetNonce(from)
+				want := new(big.Int).Sub(funds, new(big.Int).Mul(cost, new(big.Int).SetUint64(nonce)))
+				if balance := stateDB.GetBalance(from); balance.Cmp(want) != 0 {
+					t.Errorf("balance %v at nonce %d, expected %v", balance, nonce, want)
+					return
+				}
+				if nonce = s.blockchain.GetNonce(from); nonce < lastNonce {
+					t.Errorf("nonce went back from %d to %d", lastNonce, nonce)
+					return
+				}
+				lastNonce = nonce
+			}
+		}()
+	}
+
+	for _, tx := range txs {
+		mineBlock(t, s, []*core.Transaction{tx})
+	}
+	close(done)
+	wg.Wait()
+
+	if nonce := s.blockchain.GetNonce(from); nonce != blocks {
+		t.Errorf("nonce %d after %d blocks", nonce, blocks)
+	}
+}
+
+func TestGenesisExtraData(t *testing.T) {
+	s := newTestServerConfig(t, nil, func(config *core.Config) {
+		config.ChainName = "forge"
+		config.GenesisExtraData = "0x666f726765"
+	})
+
+	if extra := s.blockchain.GetBlockByNumber(0).Header.ExtraData; string(extra) != "forge" {
+		t.Errorf("genesis extra data %x, expected the configured 666f726765", extra)
+	}
+	if version := call(t, s, "web3_clientVersion").(string); !strings.Contains(version, "/forge/") {
+		t.Errorf("client version %s lacks the chain name", version)
+	}
+
+	recorder := httptest.NewRecorder()
+	s.handleAdminStatus(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/status", nil))
+	var status struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Config["extraData"] != "0x666f726765" || status.Config["chainName"] != "forge" {
+		t.Errorf("admin status config %v", status.Config)
+	}
+}
+
+// adminStatus returns the response of the admin status endpoint
+func adminStatus(t *testing.T, s *Server) map[string]interface{} {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	s.handleAdminStatus(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/status", nil))
+	var status map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestAdminStatusChainTip(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+	before := adminStatus(t, s)
+	if before["blockHeight"] != float64(0) {
+		t.Fatalf("block height %v before mining", before["blockHeight"])
+	}
+
+	mineBlock(t, s, transfers(t, key, 2))
+
+	status := adminStatus(t, s)
+	if status["blockHeight"] != float64(1) {
+		t.Errorf("block height %v after mining a block", status["blockHeight"])
+	}
+	if mined := status["totalTransactions"].(float64) - before["totalTransactions"].(float64); mined != 2 {
+		t.Errorf("total transactions grew by %v, expected 2", mined)
+	}
+	if status["mempoolSize"] != float64(0) {
+		t.Errorf("mempool size %v", status["mempoolSize"])
+	}
+}
+
+func TestChainIDConsistent(t *testing.T) {
+	s := newTestServer(t, nil)
+	chainID, err := strconv.ParseUint(strings.TrimPrefix(call(t, s, "eth_chainId").(string), "0x"), 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	networkID, err := strconv.ParseUint(call(t, s, "net_version").(string), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chainID != testChainID || networkID != chainID {
+		t.Errorf("chain id %d and network id %d, expected both %d", chainID, networkID, testChainID)
+	}
+}
+
+func TestNodeInfo(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.config.AuthToken = "secret-token"
+	s.SetNodeInfo(NodeInfo{P2PPort: 30303, MaxPeers: 25, Mining: true})
+
+	info := call(t, s, "admin_nodeInfo").(NodeInfo)
+	config := s.blockchain.GetConfig()
+	if info.ChainID != testChainID || info.DataDir != config.DataDir || info.BlockGasLimit != config.BlockGasLimit {
+		t.Errorf("chain settings %+v, expected those of the running chain", info)
+	}
+	if info.RPCPort != s.config.Port || !info.RPCAuth {
+		t.Errorf("RPC port %d with auth %v, expected %d with auth", info.RPCPort, info.RPCAuth, s.config.Port)
+	}
+	if info.P2PPort != 30303 || info.MaxPeers != 25 || !info.Mining {
+		t.Errorf("node settings %+v, expected those set", info)
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(s.config.AuthToken)) {
+		t.Errorf("node info exposes the auth token: %s", data)
+	}
+}
+
+func TestFormatTransaction(t *testing.T) {
+	key := newKey(t)
+	from := key.GetAddressBytes()
+	s := newTestServer(t, map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	txs := transfers(t, key, 2)
+	block := mineBlock(t, s, txs)
+
+	fields := []string{"blockHash", "blockNumber", "from", "gas", "gasPrice", "hash", "input", "nonce", "r", "s", "to", "transactionIndex", "type", "v", "value"}
+	formats := map[string]*regexp.Regexp{
+		"blockHash":        regexp.MustCompile(`^0x[0-9a-f]{64}$`),
+		"hash":             regexp.MustCompile(`^0x[0-9a-f]{64}$`),
+		"from":             regexp.MustCompile(`^0x[0-9a-f]{40}$`),
+		"to":               regexp.MustCompile(`^0x[0-9a-f]{40}$`),
+		"input":            regexp.MustCompile(`^0x([0-9a-f]{2})*$`),
+		"blockNumber":      regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`),
+		"gas":              regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`),
+		"gasPrice":         regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`),
+		"nonce":            regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`),
+		"r":                regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`),
+		"s":                regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`),
+		"transactionIndex": regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`),
+		"type":             regexp.MustCompile(`^0x0$`),
+		"v":                regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`),
+		"value":            regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`),
+	}
+
+	result := formatTransaction(txs[1], block, 1)
+	keys := make([]string, 0, len(result))
+	for key := range result {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, fields) {
+		t.Fatalf("fields %v, expected %v", keys, fields)
+	}
+	for field, format := range formats {
+		if value, ok := result[field].(string); !ok || !format.MatchString(value) {
+			t.Errorf("%s is %v, expected %s", field, result[field], format)
+		}
+	}
+
+	expected := map[string]interface{}{
+		"blockNumber":      "0x1",
+		"transactionIndex": "0x1",
+		"nonce":            "0x1",
+		"from":             fmt.Sprintf("0x%x", from),
+		"to":               fmt.Sprintf("0x%x", [20]byte{0x01}),
+		"value":            "0x1",
+		"gas":              "0x5208",
+		"gasPrice":         "0x3e8",
+		"input":            "0x",
+	}
+	for field, value := range expected {
+		if result[field] != value {
+			t.Errorf("%s is %v, expected %v", field, result[field], value)
+		}
+	}
+
+	// Every method serializing the transaction gives the same object
+	if byHash := call(t, s, "eth_getTransactionByHash", result["hash"]); !reflect.DeepEqual(byHash, result) {
+		t.Errorf("eth_getTransactionByHash gives %v, expected %v", byHash, result)
+	}
+
+	// A pending transaction has no block fields
+	pending := formatTransaction(txs[0], nil, 0)
+	for _, field := range []string{"blockHash", "blockNumber", "transactionIndex"} {
+		if pending[field] != nil {
+			t.Errorf("pending %s is %v, expected null", field, pending[field])
+		}
+	}
+}
+
+func TestRPCRequestMetrics(t *testing.T) {
+	s := newTestServer(t, nil)
+	before := metrics.GetMetrics().GetRPCRequestCount("eth_blockNumber")
+
+	const requests = 3
+	for i := 0; i < requests; i++ {
+		body := []byte(`{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1}`)
+		recorder := httptest.NewRecorder()
+		s.handleRPC(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, recorder.Code)
+		}
+	}
+
+	if count := metrics.GetMetrics().GetRPCRequestCount("eth_blockNumber"); count != before+requests {
+		t.Errorf("eth_blockNumber counted %d times, expected %d", count-before, requests)
+	}
+}
+
+func TestLegacyReceipt(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+	block := mineBlock(t, s, transfers(t, key, 1))
+
+	hash := fmt.Sprintf("0x%x", block.Transactions[0].Hash)
+	receipt := call(t, s, "eth_getTransactionReceipt", hash).(map[string]interface{})
+	if receipt["type"] != "0x0" {
+		t.Errorf("legacy receipt type %v, expected 0x0", receipt["type"])
+	}
+	if price := utils.EncodeQuantity(block.Transactions[0].GasPrice); receipt["effectiveGasPrice"] != price {
+		t.Errorf("effective gas price %v, expected %s", receipt["effectiveGasPrice"], price)
+	}
+	if receipt["gasUsed"] != "0x5208" {
+		t.Errorf("gas used %v, expected 0x5208", receipt["gasUsed"])
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	s := newTestServer(t, nil)
+	handler := bodyLimitMiddleware(256, http.HandlerFunc(s.handleRPC))
+
+	request := func(params string) int {
+		body := `{"jsonrpc":"2.0","method":"eth_blockNumber","params":["` + params + `"],"id":1}`
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		return recorder.Code
+	}
+
+	if code := request(""); code != http.StatusOK {
+		t.Errorf("small request answered with %d", code)
+	}
+	if code := request(strings.Repeat("a", 512)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("over-limit request answered with %d, expected %d", code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestBalanceAtBlock(t *testing.T) {
+	key := newKey(t)
+	from := key.GetAddressBytes()
+	s := newTestServer(t, map[[20]byte]*big.Int{from: big.NewInt(1e18)})
+	txs := transfers(t, key, 2)
+	mineBlock(t, s, txs[:1])
+	mineBlock(t, s, txs[1:])
+
+	recipient := fmt.Sprintf("0x%x", txs[0].To[:])
+	for tag, expected := range map[string]string{"0x0": "0x0", "0x1": "0x1", "latest": "0x2"} {
+		if balance := call(t, s, "eth_getBalance", recipient, tag); balance != expected {
+			t.Errorf("balance %v at %s, expected %s", balance, tag, expected)
+		}
+	}
+	if nonce := call(t, s, "eth_getTransactionCount", fmt.Sprintf("0x%x", from), "0x1"); nonce != "0x1" {
+		t.Errorf("nonce %v at block 1, expected 0x1", nonce)
+	}
+}
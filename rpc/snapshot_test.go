@@ -0,0 +1,31 @@
+package rpc
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDataFileConfinedToDataDir(t *testing.T) {
+	s := newTestServer(t, nil)
+	dir := filepath.Join(s.blockchain.GetConfig().DataDir, "snapshots")
+
+	path, rpcErr := s.dataFile("snapshots", "state-1.json")
+	if rpcErr != nil {
+		t.Fatalf("plain file name rejected: %s", rpcErr.Message)
+	}
+	if path != filepath.Join(dir, "state-1.json") {
+		t.Errorf("resolved to %s, expected a file in %s", path, dir)
+	}
+
+	for _, name := range []string{"/etc/passwd", "../chaindata/CURRENT", "a/../../b", ".."} {
+		if _, rpcErr := s.dataFile("snapshots", name); rpcErr == nil || rpcErr.Code != -32602 {
+			t.Errorf("path %q was not rejected", name)
+		}
+	}
+
+	// Subdirectories are flattened to the file name
+	path, rpcErr = s.dataFile("snapshots", "sub/state-2.json")
+	if rpcErr != nil || path != filepath.Join(dir, "state-2.json") {
+		t.Errorf("sub/state-2.json resolved to %s, %v", path, rpcErr)
+	}
+}
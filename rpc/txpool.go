@@ -0,0 +1,31 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// handleTxPoolInspect summarizes the mempool in the txpool_inspect format:
+// the transactions of each sender by nonce, as a human readable line. The
+// mempool doesn't hold back transactions with nonce gaps, so every
+// transaction is listed as pending and queued is always empty.
+func (s *Server) handleTxPoolInspect(params []interface{}) (interface{}, *RPCError) {
+	pending := make(map[string]map[string]string)
+	for _, tx := range s.blockchain.GetMempool().GetPendingTransactions() {
+		from := strings.ToLower(tx.From.Hex())
+		if pending[from] == nil {
+			pending[from] = make(map[string]string)
+		}
+
+		to := "contract creation"
+		if tx.To != nil {
+			to = strings.ToLower(tx.To.Hex())
+		}
+		pending[from][fmt.Sprintf("%d", tx.Nonce)] = fmt.Sprintf("%s: %s wei + %d gas × %s wei", to, tx.Value, tx.GasLimit, tx.GasPrice)
+	}
+
+	return map[string]interface{}{
+		"pending": pending,
+		"queued":  map[string]map[string]string{},
+	}, nil
+}
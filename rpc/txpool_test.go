@@ -0,0 +1,35 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestPendingTransactionByHash(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+	tx := transfers(t, key, 1)[0]
+	if err := s.blockchain.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	result, ok := call(t, s, "eth_getTransactionByHash", fmt.Sprintf("0x%x", tx.Hash)).(map[string]interface{})
+	if !ok {
+		t.Fatal("pending transaction not found")
+	}
+	for _, field := range []string{"blockHash", "blockNumber", "transactionIndex"} {
+		if result[field] != nil {
+			t.Errorf("%s of a pending transaction is %v, expected null", field, result[field])
+		}
+	}
+	if result["from"] != strings.ToLower(tx.From.Hex()) || result["nonce"] != "0x0" {
+		t.Errorf("pending transaction from %v with nonce %v, expected %s with 0x0", result["from"], result["nonce"], strings.ToLower(tx.From.Hex()))
+	}
+
+	pending := call(t, s, "txpool_inspect").(map[string]interface{})["pending"].(map[string]map[string]string)
+	if summary := pending[strings.ToLower(tx.From.Hex())]["0"]; !strings.HasPrefix(summary, strings.ToLower(tx.To.Hex())+": 1 wei") {
+		t.Errorf("txpool_inspect summary %q", summary)
+	}
+}
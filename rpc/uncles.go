@@ -0,0 +1,70 @@
+package rpc
+
+// This chain has no uncles. The uncle methods exist because some tooling
+// expects them, they report zero uncles for every known block.
+
+// emptyUncleHash is the Keccak-256 hash of an empty RLP list, the uncle hash
+// of a block without uncles
+const emptyUncleHash = "0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347"
+
+func (s *Server) handleGetUncleCountByBlockNumber(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	blockNum, rpcErr := s.parseBlockNumberParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if s.blockchain.GetBlockByNumber(blockNum) == nil {
+		return nil, nil
+	}
+	return "0x0", nil
+}
+
+func (s *Server) handleGetUncleCountByBlockHash(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	hash, rpcErr := parseHashParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if s.blockchain.GetBlockByHash(hash) == nil {
+		return nil, nil
+	}
+	return "0x0", nil
+}
+
+func (s *Server) handleGetUncleByBlockNumberAndIndex(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 2 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	if _, rpcErr := s.parseBlockNumberParam(params[0]); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if _, ok := parseUint64Param(params[1]); !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid index parameter"}
+	}
+
+	return nil, nil
+}
+
+func (s *Server) handleGetUncleByBlockHashAndIndex(params []interface{}) (interface{}, *RPCError) {
+	if len(params) < 2 {
+		return nil, &RPCError{Code: -32602, Message: "Invalid params"}
+	}
+
+	if _, rpcErr := parseHashParam(params[0]); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if _, ok := parseUint64Param(params[1]); !ok {
+		return nil, &RPCError{Code: -32602, Message: "Invalid index parameter"}
+	}
+
+	return nil, nil
+}
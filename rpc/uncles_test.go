@@ -0,0 +1,37 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestUncleMethods(t *testing.T) {
+	s := newTestServer(t, nil)
+	genesis := s.blockchain.GetBlockByNumber(0)
+	hash := fmt.Sprintf("0x%x", genesis.Header.Hash)
+
+	tests := []struct {
+		method string
+		params []interface{}
+		want   interface{}
+	}{
+		{"eth_getUncleCountByBlockNumber", []interface{}{"0x0"}, "0x0"},
+		{"eth_getUncleCountByBlockHash", []interface{}{hash}, "0x0"},
+		{"eth_getUncleByBlockNumberAndIndex", []interface{}{"0x0", "0x0"}, nil},
+		{"eth_getUncleByBlockHashAndIndex", []interface{}{hash, "0x0"}, nil},
+	}
+	for _, test := range tests {
+		if got := call(t, s, test.method, test.params...); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s returned %v, expected %v", test.method, got, test.want)
+		}
+	}
+
+	block := call(t, s, "eth_getBlockByNumber", "0x0", false).(map[string]interface{})
+	if uncles, ok := block["uncles"].([]string); !ok || len(uncles) != 0 {
+		t.Errorf("block uncles %v, expected none", block["uncles"])
+	}
+	if block["sha3Uncles"] != emptyUncleHash {
+		t.Errorf("block sha3Uncles %v, expected %s", block["sha3Uncles"], emptyUncleHash)
+	}
+}
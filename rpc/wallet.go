@@ -1,11 +1,9 @@
-
 package rpc
 
 import (
 	"blockchain-node/core"
-	"blockchain-node/crypto"
+	"blockchain-node/utils"
 	"blockchain-node/wallet"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math/big"
@@ -47,7 +45,7 @@ func (api *WalletAPI) CreateHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get balance (should be 0 for new wallet)
 	address := newWallet.GetAddressBytes()
-	balance := api.blockchain.GetStateDB().GetBalance(address)
+	balance := api.blockchain.GetBalance(address)
 
 	// Format private key with 0x prefix and ensure 64 characters
 	privateKeyHex := newWallet.GetPrivateKeyHex()
@@ -66,7 +64,8 @@ func (api *WalletAPI) CreateHandler(w http.ResponseWriter, r *http.Request) {
 		"address":    "0x" + newWallet.GetAddress(),
 		"privateKey": privateKeyHex,
 		"publicKey":  "0x" + newWallet.GetPublicKeyHex(),
-		"balance":    fmt.Sprintf("0x%x", balance),
+		"scheme":     newWallet.Scheme(),
+		"balance":    utils.EncodeQuantity(balance),
 		"balanceEth": formatWeiToEth(balance),
 	}
 
@@ -91,13 +90,22 @@ func (api *WalletAPI) ImportHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		PrivateKey string `json:"privateKey"`
+		Scheme     string `json:"scheme"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if bodyTooLarge(w, err) {
+			return
+		}
 		http.Error(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
 
+	if err := wallet.ValidateScheme(req.Scheme); err != nil {
+		http.Error(w, "Invalid key scheme: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Clean private key
 	privateKeyHex := strings.TrimSpace(req.PrivateKey)
 	if strings.HasPrefix(privateKeyHex, "0x") {
@@ -110,7 +118,7 @@ func (api *WalletAPI) ImportHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	importedWallet, err := wallet.NewWalletFromPrivateKey(privateKeyHex)
+	importedWallet, err := wallet.ImportWallet(privateKeyHex, req.Scheme)
 	if err != nil {
 		http.Error(w, "Failed to import wallet: "+err.Error(), http.StatusBadRequest)
 		return
@@ -118,13 +126,14 @@ func (api *WalletAPI) ImportHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get balance
 	address := importedWallet.GetAddressBytes()
-	balance := api.blockchain.GetStateDB().GetBalance(address)
+	balance := api.blockchain.GetBalance(address)
 
 	response := map[string]interface{}{
 		"address":    "0x" + importedWallet.GetAddress(),
 		"privateKey": "0x" + importedWallet.GetPrivateKeyHex(),
 		"publicKey":  "0x" + importedWallet.GetPublicKeyHex(),
-		"balance":    fmt.Sprintf("0x%x", balance),
+		"scheme":     importedWallet.Scheme(),
+		"balance":    utils.EncodeQuantity(balance),
 		"balanceEth": formatWeiToEth(balance),
 		"valid":      true,
 	}
@@ -159,6 +168,9 @@ func (api *WalletAPI) SendTransactionHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if bodyTooLarge(w, err) {
+			return
+		}
 		http.Error(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
@@ -181,62 +193,56 @@ func (api *WalletAPI) SendTransactionHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Parse values
-	value, ok := new(big.Int).SetString(req.Value, 0)
-	if !ok {
-		http.Error(w, "Invalid value format", http.StatusBadRequest)
+	// Parse values, only omitted gas fields fall back to the defaults
+	value, err := parseAmount("value", req.Value, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	gasLimit, ok := new(big.Int).SetString(req.GasLimit, 0)
-	if !ok {
-		gasLimit = big.NewInt(21000) // Default gas limit
+	gasLimit, err := parseAmount("gasLimit", req.GasLimit, big.NewInt(21000))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !gasLimit.IsUint64() || gasLimit.Sign() == 0 {
+		http.Error(w, "Invalid gasLimit: must be between 1 and 2^64-1", http.StatusBadRequest)
+		return
 	}
 
-	gasPrice, ok := new(big.Int).SetString(req.GasPrice, 0)
-	if !ok {
-		gasPrice = big.NewInt(20000000000) // Default 20 Gwei
+	gasPrice, err := parseAmount("gasPrice", req.GasPrice, big.NewInt(20000000000)) // Default 20 Gwei
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Parse to address
 	var toAddr *[20]byte
 	if req.To != "" {
-		toAddrStr := strings.TrimSpace(req.To)
-		if strings.HasPrefix(toAddrStr, "0x") {
-			toAddrStr = toAddrStr[2:]
-		}
-		
-		if len(toAddrStr) == 40 {
-			toBytes := crypto.HexToBytes(toAddrStr)
-			if len(toBytes) == 20 {
-				var addr [20]byte
-				copy(addr[:], toBytes)
-				toAddr = &addr
-			}
-		}
-		
-		if toAddr == nil {
+		addr, err := utils.DecodeAddress(withHexPrefix(req.To))
+		if err != nil {
 			http.Error(w, "Invalid to address format", http.StatusBadRequest)
 			return
 		}
+		toAddr = &addr
 	}
 
 	// Get nonce
 	fromAddr := senderWallet.GetAddressBytes()
-	nonce := api.blockchain.GetStateDB().GetNonce(fromAddr)
+	nonce := api.blockchain.GetNonce(fromAddr)
 
 	// Parse data
 	var data []byte
 	if req.Data != "" {
-		dataStr := strings.TrimSpace(req.Data)
-		if strings.HasPrefix(dataStr, "0x") {
-			dataStr = dataStr[2:]
+		data, err = utils.DecodeBytes(withHexPrefix(req.Data))
+		if err != nil {
+			http.Error(w, "Invalid data: "+err.Error(), http.StatusBadRequest)
+			return
 		}
-		data = crypto.HexToBytes(dataStr)
 	}
 
 	// Check balance
-	balance := api.blockchain.GetStateDB().GetBalance(fromAddr)
+	balance := api.blockchain.GetBalance(fromAddr)
 	totalCost := new(big.Int).Add(value, new(big.Int).Mul(gasPrice, gasLimit))
 	if balance.Cmp(totalCost) < 0 {
 		http.Error(w, "Insufficient balance", http.StatusBadRequest)
@@ -247,22 +253,23 @@ func (api *WalletAPI) SendTransactionHandler(w http.ResponseWriter, r *http.Requ
 	tx := core.NewTransaction(nonce, toAddr, value, gasLimit.Uint64(), gasPrice, data)
 
 	// Sign transaction
-	if err := senderWallet.SignTransaction(tx); err != nil {
+	if err := senderWallet.SignTransaction(tx, api.blockchain.GetChainID()); err != nil {
 		http.Error(w, "Failed to sign transaction: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Add to mempool
-	if err := api.blockchain.GetMempool().AddTransaction(tx); err != nil {
+	if err := api.blockchain.AddTransaction(tx); err != nil {
 		http.Error(w, "Failed to add transaction to mempool: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	response := map[string]interface{}{
-		"hash":    fmt.Sprintf("0x%x", tx.Hash),
-		"success": true,
-		"nonce":   fmt.Sprintf("0x%x", nonce),
-		"gasUsed": fmt.Sprintf("0x%x", gasLimit.Uint64()),
+		"hash":        fmt.Sprintf("0x%x", tx.Hash),
+		"success":     true,
+		"nonce":       utils.EncodeQuantity(nonce),
+		"gasUsed":     utils.EncodeQuantity(gasLimit.Uint64()),
+		"transaction": formatTransaction(tx, nil, 0),
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -286,68 +293,64 @@ func (api *WalletAPI) CheckBalanceHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Clean address
-	address = strings.TrimSpace(address)
-	if strings.HasPrefix(address, "0x") {
-		address = address[2:]
-	}
-
-	if len(address) != 40 {
-		http.Error(w, "Invalid address format", http.StatusBadRequest)
-		return
-	}
-
-	addrBytes := crypto.HexToBytes(address)
-	if len(addrBytes) != 20 {
+	addr, err := utils.DecodeAddress(withHexPrefix(address))
+	if err != nil {
 		http.Error(w, "Invalid address format", http.StatusBadRequest)
 		return
 	}
 
-	var addr [20]byte
-	copy(addr[:], addrBytes)
-
-	balance := api.blockchain.GetStateDB().GetBalance(addr)
-	nonce := api.blockchain.GetStateDB().GetNonce(addr)
+	balance := api.blockchain.GetBalance(addr)
+	nonce := api.blockchain.GetNonce(addr)
 
 	response := map[string]interface{}{
 		"address":    "0x" + address,
-		"balance":    fmt.Sprintf("0x%x", balance),
+		"balance":    utils.EncodeQuantity(balance),
 		"balanceEth": formatWeiToEth(balance),
-		"nonce":      fmt.Sprintf("0x%x", nonce),
+		"nonce":      utils.EncodeQuantity(nonce),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// parseAmount parses the decimal or 0x prefixed hex integer s of the named
+// request field. An empty s yields def, or an error if the field is required
+// (def is nil).
+func parseAmount(field, s string, def *big.Int) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		if def == nil {
+			return nil, fmt.Errorf("missing %s", field)
+		}
+		return def, nil
+	}
+
+	amount, ok := new(big.Int).SetString(s, 0)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("invalid %s: %q is not a non-negative decimal or 0x hex integer", field, s)
+	}
+	return amount, nil
+}
+
+// withHexPrefix trims s and adds the 0x prefix if it is missing, the REST
+// endpoints accept hex addresses and data without it
+func withHexPrefix(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return s
+	}
+	return "0x" + s
+}
+
 // Helper function to format Wei to ETH
 func formatWeiToEth(wei *big.Int) string {
 	if wei == nil {
 		return "0"
 	}
-	
+
 	// Convert wei to ETH (1 ETH = 10^18 wei)
 	eth := new(big.Float).SetInt(wei)
 	divisor := new(big.Float).SetFloat64(1e18)
 	eth.Quo(eth, divisor)
-	
-	return eth.Text('f', 6)
-}
 
-// Helper function to parse hex string to bytes
-func parseHexToBytes(hexStr string, expectedLen int) ([]byte, error) {
-	hexStr = strings.TrimSpace(hexStr)
-	if strings.HasPrefix(hexStr, "0x") {
-		hexStr = hexStr[2:]
-	}
-	
-	if len(hexStr) != expectedLen*2 {
-		return nil, fmt.Errorf("expected %d bytes (got %d)", expectedLen, len(hexStr)/2)
-	}
-	
-	bytes, err := hex.DecodeString(hexStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid hex string: %v", err)
-	}
-	
-	return bytes, nil
+	return eth.Text('f', 6)
 }
@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckBalanceAddressPrefix(t *testing.T) {
+	address := [20]byte{0x42}
+	s := newTestServer(t, map[[20]byte]*big.Int{address: big.NewInt(1000)})
+	api := NewWalletAPI(s.blockchain)
+
+	for _, param := range []string{fmt.Sprintf("0x%x", address), fmt.Sprintf("%x", address)} {
+		recorder := httptest.NewRecorder()
+		api.CheckBalanceHandler(recorder, httptest.NewRequest(http.MethodGet, "/wallet/balance?address="+param, nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("address %s: status %d: %s", param, recorder.Code, recorder.Body)
+			continue
+		}
+
+		var response map[string]interface{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response["balance"] != "0x3e8" {
+			t.Errorf("address %s: balance %v, expected 0x3e8", param, response["balance"])
+		}
+	}
+}
+
+func TestSendTransactionMalformedFields(t *testing.T) {
+	key := newKey(t)
+	s := newTestServer(t, map[[20]byte]*big.Int{key.GetAddressBytes(): big.NewInt(1e18)})
+	api := NewWalletAPI(s.blockchain)
+
+	tests := []struct {
+		field, value, want string
+	}{
+		{"value", "1e18", "invalid value"},
+		{"value", "", "missing value"},
+		{"gasLimit", "21k", "invalid gasLimit"},
+		{"gasLimit", "-1", "invalid gasLimit"},
+		{"gasPrice", "0xzz", "invalid gasPrice"},
+	}
+	for _, test := range tests {
+		req := map[string]string{
+			"from":       "0x" + key.GetAddress(),
+			"to":         fmt.Sprintf("0x%x", [20]byte{0x01}),
+			"value":      "1",
+			"privateKey": key.GetPrivateKeyHex(),
+		}
+		req[test.field] = test.value
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		api.SendTransactionHandler(recorder, httptest.NewRequest(http.MethodPost, "/wallet/send", bytes.NewReader(body)))
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), test.want) {
+			t.Errorf("%s %q: status %d: %s", test.field, test.value, recorder.Code, recorder.Body)
+		}
+	}
+	if size := s.blockchain.GetMempool().Size(); size != 0 {
+		t.Errorf("%d malformed transactions queued", size)
+	}
+}
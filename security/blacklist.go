@@ -0,0 +1,81 @@
+package security
+
+import (
+	"blockchain-node/database"
+	"blockchain-node/logger"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// blacklistDuration is how long an IP stays blacklisted
+const blacklistDuration = time.Hour
+
+// blacklistKey is the database key of the persisted blacklist
+const blacklistKey = "security_blacklist"
+
+// SetDatabase makes the manager save its blacklist to db, so blacklisted IPs
+// stay blocked across restarts, and restores the entries saved by a previous
+// run. Entries that expired meanwhile are dropped.
+func (sm *SecurityManager) SetDatabase(db database.Database) error {
+	data, err := db.Get([]byte(blacklistKey))
+	if err != nil {
+		return fmt.Errorf("failed to read blacklist: %v", err)
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.db = db
+	if data == nil {
+		return nil
+	}
+
+	// The blacklist is saved as the expiry time of each IP
+	var expiries map[string]int64
+	if err := json.Unmarshal(data, &expiries); err != nil {
+		return fmt.Errorf("failed to parse blacklist: %v", err)
+	}
+
+	now := time.Now()
+	restored := 0
+	for clientIP, expiry := range expiries {
+		blacklistTime := time.Unix(expiry, 0).Add(-blacklistDuration)
+		if now.Sub(blacklistTime) >= blacklistDuration {
+			continue
+		}
+		if existing, ok := sm.blacklistedIPs[clientIP]; !ok || existing.Before(blacklistTime) {
+			sm.blacklistedIPs[clientIP] = blacklistTime
+		}
+		restored++
+	}
+	if restored > 0 {
+		logger.Infof("Restored %d blacklisted IPs", restored)
+	}
+
+	// Write back the pruned list
+	sm.saveBlacklist()
+	return nil
+}
+
+// saveBlacklist writes the blacklist to the database, if one is set. The
+// caller must hold sm.mutex.
+func (sm *SecurityManager) saveBlacklist() {
+	if sm.db == nil {
+		return
+	}
+
+	expiries := make(map[string]int64, len(sm.blacklistedIPs))
+	for clientIP, blacklistTime := range sm.blacklistedIPs {
+		expiries[clientIP] = blacklistTime.Add(blacklistDuration).Unix()
+	}
+
+	data, err := json.Marshal(expiries)
+	if err != nil {
+		logger.Errorf("Failed to encode blacklist: %v", err)
+		return
+	}
+	if err := sm.db.Put([]byte(blacklistKey), data); err != nil {
+		logger.Errorf("Failed to save blacklist: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package security
+
+import (
+	"blockchain-node/database"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestBlacklistPersisted(t *testing.T) {
+	db := database.NewMemoryDB()
+	sm := NewSecurityManager()
+	if err := sm.SetDatabase(db); err != nil {
+		t.Fatal(err)
+	}
+	sm.BlacklistIP("10.0.0.1")
+
+	// A new manager on the same database is a restart of the node
+	restarted := NewSecurityManager()
+	if err := restarted.SetDatabase(db); err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.IsBlacklisted("10.0.0.1") {
+		t.Fatal("blacklisted IP allowed after a restart")
+	}
+
+	// An entry that expired while the node was down is dropped
+	data, err := json.Marshal(map[string]int64{
+		"10.0.0.1": time.Now().Add(-time.Second).Unix(),
+		"10.0.0.2": time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte(blacklistKey), data); err != nil {
+		t.Fatal(err)
+	}
+	restarted = NewSecurityManager()
+	if err := restarted.SetDatabase(db); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.IsBlacklisted("10.0.0.1") {
+		t.Error("IP still blacklisted after its expiry")
+	}
+	if !restarted.IsBlacklisted("10.0.0.2") {
+		t.Error("IP allowed before its expiry")
+	}
+
+	var saved map[string]int64
+	data, err = db.Get([]byte(blacklistKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved["10.0.0.1"]; ok || len(saved) != 1 {
+		t.Errorf("saved blacklist %v, expected only the unexpired IP", saved)
+	}
+}
@@ -1,8 +1,9 @@
-
 package security
 
 import (
+	"blockchain-node/database"
 	"blockchain-node/logger"
+	"fmt"
 	"net"
 	"sync"
 	"time"
@@ -21,26 +22,26 @@ func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
 		limit:    limit,
 		window:   window,
 	}
-	
+
 	// Clean up old entries periodically
 	go rl.cleanup()
-	
+
 	return rl
 }
 
 func (rl *RateLimiter) Allow(clientIP string) bool {
 	rl.mutex.Lock()
 	defer rl.mutex.Unlock()
-	
+
 	now := time.Now()
-	
+
 	// Get client requests
 	requests, exists := rl.requests[clientIP]
 	if !exists {
 		rl.requests[clientIP] = []time.Time{now}
 		return true
 	}
-	
+
 	// Remove old requests outside the window
 	validRequests := make([]time.Time, 0)
 	for _, reqTime := range requests {
@@ -48,7 +49,7 @@ func (rl *RateLimiter) Allow(clientIP string) bool {
 			validRequests = append(validRequests, reqTime)
 		}
 	}
-	
+
 	// Check if limit exceeded
 	if len(validRequests) >= rl.limit {
 		logger.LogSecurityEvent("rate_limit_exceeded", map[string]interface{}{
@@ -59,22 +60,22 @@ func (rl *RateLimiter) Allow(clientIP string) bool {
 		})
 		return false
 	}
-	
+
 	// Add current request
 	validRequests = append(validRequests, now)
 	rl.requests[clientIP] = validRequests
-	
+
 	return true
 }
 
 func (rl *RateLimiter) cleanup() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
-	
+
 	for range ticker.C {
 		rl.mutex.Lock()
 		now := time.Now()
-		
+
 		for clientIP, requests := range rl.requests {
 			validRequests := make([]time.Time, 0)
 			for _, reqTime := range requests {
@@ -82,43 +83,159 @@ func (rl *RateLimiter) cleanup() {
 					validRequests = append(validRequests, reqTime)
 				}
 			}
-			
+
 			if len(validRequests) == 0 {
 				delete(rl.requests, clientIP)
 			} else {
 				rl.requests[clientIP] = validRequests
 			}
 		}
-		
+
 		rl.mutex.Unlock()
 	}
 }
 
+// Default limit on failed authentication attempts from one IP before it is
+// blacklisted
+const (
+	DefaultMaxAuthFailures   = 5
+	DefaultAuthFailureWindow = time.Minute
+)
+
 type SecurityManager struct {
-	rateLimiter    *RateLimiter
-	blacklistedIPs map[string]time.Time
-	mutex          sync.RWMutex
+	rateLimiter       *RateLimiter
+	blacklistedIPs    map[string]time.Time
+	trustedIPs        map[string]bool
+	authFailures      map[string][]time.Time
+	maxAuthFailures   int
+	authFailureWindow time.Duration
+	db                database.Database // persists the blacklist, if set
+	mutex             sync.RWMutex
 }
 
 func NewSecurityManager() *SecurityManager {
-	return &SecurityManager{
-		rateLimiter:    NewRateLimiter(100, time.Minute), // 100 requests per minute
-		blacklistedIPs: make(map[string]time.Time),
+	sm := &SecurityManager{
+		rateLimiter:       NewRateLimiter(100, time.Minute), // 100 requests per minute
+		blacklistedIPs:    make(map[string]time.Time),
+		authFailures:      make(map[string][]time.Time),
+		maxAuthFailures:   DefaultMaxAuthFailures,
+		authFailureWindow: DefaultAuthFailureWindow,
+	}
+
+	// Forget failures of IPs that stopped trying
+	go sm.cleanup()
+
+	return sm
+}
+
+func (sm *SecurityManager) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sm.expireAuthFailures(time.Now())
+	}
+}
+
+// expireAuthFailures drops the failures older than the window, and the IPs
+// left without any
+func (sm *SecurityManager) expireAuthFailures(now time.Time) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	for clientIP, failures := range sm.authFailures {
+		valid := make([]time.Time, 0, len(failures))
+		for _, failure := range failures {
+			if now.Sub(failure) <= sm.authFailureWindow {
+				valid = append(valid, failure)
+			}
+		}
+
+		if len(valid) == 0 {
+			delete(sm.authFailures, clientIP)
+		} else {
+			sm.authFailures[clientIP] = valid
+		}
+	}
+}
+
+// SetAuthFailureLimit blacklists an IP once it fails to authenticate limit
+// times within window. Zero or less disables automatic blacklisting.
+func (sm *SecurityManager) SetAuthFailureLimit(limit int, window time.Duration) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.maxAuthFailures = limit
+	sm.authFailureWindow = window
+}
+
+// RecordAuthFailure counts a failed authentication attempt from clientIP and
+// blacklists it when the limit is reached. It returns true if the IP was
+// blacklisted.
+func (sm *SecurityManager) RecordAuthFailure(clientIP string) bool {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	logger.LogSecurityEvent("auth_failure", map[string]interface{}{
+		"client_ip": clientIP,
+	})
+
+	if sm.maxAuthFailures <= 0 {
+		return false
+	}
+
+	// Only count failures inside the window
+	now := time.Now()
+	failures := make([]time.Time, 0, len(sm.authFailures[clientIP])+1)
+	for _, failure := range sm.authFailures[clientIP] {
+		if now.Sub(failure) <= sm.authFailureWindow {
+			failures = append(failures, failure)
+		}
 	}
+	failures = append(failures, now)
+
+	if len(failures) < sm.maxAuthFailures {
+		sm.authFailures[clientIP] = failures
+		return false
+	}
+
+	delete(sm.authFailures, clientIP)
+	sm.blacklistedIPs[clientIP] = now
+	sm.saveBlacklist()
+	logger.LogSecurityEvent("ip_blacklisted", map[string]interface{}{
+		"client_ip":      clientIP,
+		"reason":         "auth_failures",
+		"failure_count":  len(failures),
+		"window_seconds": sm.authFailureWindow.Seconds(),
+	})
+	return true
 }
 
 func (sm *SecurityManager) IsAllowed(clientIP string) bool {
+	if sm.isBlacklisted(clientIP) {
+		return false
+	}
+
+	return sm.rateLimiter.Allow(clientIP)
+}
+
+// IsBlacklisted reports whether clientIP is currently blacklisted
+func (sm *SecurityManager) IsBlacklisted(clientIP string) bool {
+	return sm.isBlacklisted(clientIP)
+}
+
+func (sm *SecurityManager) isBlacklisted(clientIP string) bool {
 	sm.mutex.RLock()
 	blacklistTime, isBlacklisted := sm.blacklistedIPs[clientIP]
 	sm.mutex.RUnlock()
-	
+
 	// Check if IP is blacklisted and if blacklist has expired
 	if isBlacklisted {
-		if time.Since(blacklistTime) < time.Hour {
+		if time.Since(blacklistTime) < blacklistDuration {
 			logger.LogSecurityEvent("blacklisted_ip_access", map[string]interface{}{
 				"client_ip": clientIP,
 			})
-			return false
+			return true
 		} else {
 			// Remove expired blacklist entry
 			sm.mutex.Lock()
@@ -126,15 +243,77 @@ func (sm *SecurityManager) IsAllowed(clientIP string) bool {
 			sm.mutex.Unlock()
 		}
 	}
-	
-	return sm.rateLimiter.Allow(clientIP)
+
+	return false
+}
+
+// SetTrustedPeers restricts P2P connections to the given peers. Entries are
+// IPs or host names, optionally with a port. An empty list allows any peer.
+func (sm *SecurityManager) SetTrustedPeers(peers []string) error {
+	trusted := make(map[string]bool)
+	for _, peer := range peers {
+		host, _, err := net.SplitHostPort(peer)
+		if err != nil {
+			host = peer
+		}
+
+		if ip := net.ParseIP(host); ip != nil {
+			trusted[ip.String()] = true
+			continue
+		}
+
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			return fmt.Errorf("failed to resolve trusted peer %s: %v", peer, err)
+		}
+		for _, addr := range addrs {
+			trusted[net.ParseIP(addr).String()] = true
+		}
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if len(trusted) == 0 {
+		sm.trustedIPs = nil
+		return nil
+	}
+	sm.trustedIPs = trusted
+	return nil
+}
+
+// AllowPeer reports whether a P2P connection from remoteAddr is accepted. A
+// blacklisted peer is always refused, and when trusted peers are configured
+// only those are accepted.
+func (sm *SecurityManager) AllowPeer(remoteAddr string) bool {
+	clientIP := sm.ValidateClientIP(remoteAddr)
+	if clientIP == "" {
+		return false
+	}
+
+	if sm.isBlacklisted(clientIP) {
+		return false
+	}
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	if sm.trustedIPs != nil && !sm.trustedIPs[clientIP] {
+		logger.LogSecurityEvent("untrusted_peer_rejected", map[string]interface{}{
+			"client_ip": clientIP,
+		})
+		return false
+	}
+
+	return true
 }
 
 func (sm *SecurityManager) BlacklistIP(clientIP string) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
-	
+
 	sm.blacklistedIPs[clientIP] = time.Now()
+	sm.saveBlacklist()
 	logger.LogSecurityEvent("ip_blacklisted", map[string]interface{}{
 		"client_ip": clientIP,
 	})
@@ -147,13 +326,13 @@ func (sm *SecurityManager) ValidateClientIP(remoteAddr string) string {
 		// If no port, assume it's just an IP
 		host = remoteAddr
 	}
-	
+
 	// Validate IP format
 	ip := net.ParseIP(host)
 	if ip == nil {
 		logger.Warning("Invalid IP address format: ", host)
 		return ""
 	}
-	
+
 	return ip.String()
 }
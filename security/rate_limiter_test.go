@@ -0,0 +1,47 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpireAuthFailures(t *testing.T) {
+	sm := NewSecurityManager()
+	sm.RecordAuthFailure("10.0.0.1")
+	sm.RecordAuthFailure("10.0.0.2")
+
+	sm.expireAuthFailures(time.Now())
+	if len(sm.authFailures) != 2 {
+		t.Fatalf("recent failures expired, %d IPs left", len(sm.authFailures))
+	}
+
+	sm.expireAuthFailures(time.Now().Add(DefaultAuthFailureWindow + time.Second))
+	if len(sm.authFailures) != 0 {
+		t.Errorf("failures outside the window kept for %d IPs", len(sm.authFailures))
+	}
+}
+
+func TestAllowPeerTrusted(t *testing.T) {
+	sm := NewSecurityManager()
+	if !sm.AllowPeer("10.0.0.2:30303") {
+		t.Fatal("peer refused without trusted peers")
+	}
+
+	if err := sm.SetTrustedPeers([]string{"10.0.0.1:30303", "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []string{"10.0.0.1:41000", "127.0.0.1:30303"} {
+		if !sm.AllowPeer(addr) {
+			t.Errorf("trusted peer %s refused", addr)
+		}
+	}
+	if sm.AllowPeer("10.0.0.2:30303") {
+		t.Error("untrusted peer accepted")
+	}
+
+	// The blacklist applies to trusted peers too
+	sm.BlacklistIP("10.0.0.1")
+	if sm.AllowPeer("10.0.0.1:41000") {
+		t.Error("blacklisted trusted peer accepted")
+	}
+}
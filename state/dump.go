@@ -0,0 +1,112 @@
+package state
+
+import (
+	"blockchain-node/database"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// DumpAccount is the serialized form of an account with its code and storage
+type DumpAccount struct {
+	Address [20]byte            `json:"address"`
+	Nonce   uint64              `json:"nonce"`
+	Balance *big.Int            `json:"balance"`
+	Code    []byte              `json:"code,omitempty"`
+	Storage map[string][32]byte `json:"storage,omitempty"`
+}
+
+// Dump returns every account in the committed state, including contract
+// code and storage. Storage keys are hex encoded.
+func (s *StateDB) Dump() ([]*DumpAccount, error) {
+	var accounts []*DumpAccount
+	var err error
+	s.read(func() {
+		accounts, err = s.dump()
+	})
+	return accounts, err
+}
+
+func (s *StateDB) dump() ([]*DumpAccount, error) {
+	var accounts []*DumpAccount
+
+	err := s.trie.Iterate(func(key, value []byte) error {
+		var acc Account
+		if err := json.Unmarshal(value, &acc); err != nil {
+			return fmt.Errorf("failed to unmarshal account %x: %v", key, err)
+		}
+
+		dump := &DumpAccount{
+			Nonce:   acc.Nonce,
+			Balance: acc.Balance,
+		}
+		copy(dump.Address[:], key)
+		dump.Code = s.getCode(dump.Address)
+
+		if acc.Root != ([32]byte{}) {
+			storageTrie, err := openTrie(acc.Root, s.db)
+			if err != nil {
+				return fmt.Errorf("failed to open storage of %x: %w", key, err)
+			}
+
+			dump.Storage = make(map[string][32]byte)
+			err = storageTrie.Iterate(func(slot, data []byte) error {
+				var value [32]byte
+				copy(value[:], data)
+				dump.Storage[fmt.Sprintf("%x", slot)] = value
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to read storage of %x: %w", key, err)
+			}
+		}
+
+		accounts = append(accounts, dump)
+		return nil
+	})
+	if err != nil {
+		return nil, s.readError(err)
+	}
+
+	return accounts, nil
+}
+
+// LoadDump builds a new state from dumped accounts and commits it to db
+func LoadDump(accounts []*DumpAccount, db database.Database) (*StateDB, [32]byte, error) {
+	stateDB, err := NewStateDB([32]byte{}, db)
+	if err != nil {
+		return nil, [32]byte{}, err
+	}
+
+	for _, dump := range accounts {
+		balance := dump.Balance
+		if balance == nil {
+			balance = big.NewInt(0)
+		}
+
+		stateDB.SetBalance(dump.Address, balance)
+		stateDB.SetNonce(dump.Address, dump.Nonce)
+		if len(dump.Code) > 0 {
+			stateDB.SetCode(dump.Address, dump.Code)
+		}
+
+		for slot, value := range dump.Storage {
+			keyBytes, err := hex.DecodeString(slot)
+			if err != nil || len(keyBytes) != 32 {
+				return nil, [32]byte{}, fmt.Errorf("invalid storage key %s of %x", slot, dump.Address)
+			}
+
+			var key [32]byte
+			copy(key[:], keyBytes)
+			stateDB.SetState(dump.Address, key, value)
+		}
+	}
+
+	root, err := stateDB.Commit()
+	if err != nil {
+		return nil, [32]byte{}, fmt.Errorf("failed to commit state: %v", err)
+	}
+
+	return stateDB, root, nil
+}
@@ -0,0 +1,58 @@
+package state
+
+import (
+	"blockchain-node/crypto"
+	"sync"
+)
+
+// PreimageStore maps Keccak-256 hashes of account addresses and storage keys
+// back to the original bytes, so tooling can resolve hashes it comes across.
+// It holds at most limit entries and evicts the oldest ones first.
+type PreimageStore struct {
+	mu        sync.RWMutex
+	limit     int
+	preimages map[[32]byte][]byte
+	order     [][32]byte
+}
+
+// NewPreimageStore creates a preimage store holding up to limit entries
+func NewPreimageStore(limit int) *PreimageStore {
+	return &PreimageStore{
+		limit:     limit,
+		preimages: make(map[[32]byte][]byte),
+	}
+}
+
+// Add records the preimage of keccak256(preimage)
+func (p *PreimageStore) Add(preimage []byte) {
+	hash := crypto.Keccak256Hash(preimage)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.preimages[hash]; exists {
+		return
+	}
+
+	for len(p.order) >= p.limit && len(p.order) > 0 {
+		delete(p.preimages, p.order[0])
+		p.order = p.order[1:]
+	}
+
+	p.preimages[hash] = append([]byte(nil), preimage...)
+	p.order = append(p.order, hash)
+}
+
+// Get returns the preimage of hash, or nil if it isn't known
+func (p *PreimageStore) Get(hash [32]byte) []byte {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.preimages[hash]
+}
+
+// Len returns the number of stored preimages
+func (p *PreimageStore) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.preimages)
+}
@@ -0,0 +1,52 @@
+package state
+
+import (
+	"blockchain-node/crypto"
+	"blockchain-node/database"
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func TestPreimagesAfterCommit(t *testing.T) {
+	s, err := NewStateDB([32]byte{}, database.NewMemoryDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewPreimageStore(16)
+	s.SetPreimageStore(store)
+
+	addr := [20]byte{0x01, 0x02}
+	key := [32]byte{0x03}
+	s.SetBalance(addr, big.NewInt(1))
+	s.SetState(addr, key, [32]byte{0x04})
+	if preimage := store.Get(crypto.Keccak256Hash(addr[:])); preimage != nil {
+		t.Fatalf("preimage %x stored before the commit", preimage)
+	}
+	if _, err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if preimage := store.Get(crypto.Keccak256Hash(addr[:])); !bytes.Equal(preimage, addr[:]) {
+		t.Errorf("address preimage %x, expected %x", preimage, addr)
+	}
+	if preimage := store.Get(crypto.Keccak256Hash(key[:])); !bytes.Equal(preimage, key[:]) {
+		t.Errorf("storage key preimage %x, expected %x", preimage, key)
+	}
+}
+
+func TestPreimageStoreLimit(t *testing.T) {
+	store := NewPreimageStore(2)
+	for i := byte(0); i < 3; i++ {
+		store.Add([]byte{i})
+	}
+	if store.Len() != 2 {
+		t.Fatalf("%d preimages stored with a limit of 2", store.Len())
+	}
+	if store.Get(crypto.Keccak256Hash([]byte{0})) != nil {
+		t.Error("oldest preimage not evicted")
+	}
+	if preimage := store.Get(crypto.Keccak256Hash([]byte{2})); !bytes.Equal(preimage, []byte{2}) {
+		t.Errorf("newest preimage %x", preimage)
+	}
+}
@@ -0,0 +1,55 @@
+package state
+
+import "fmt"
+
+// GetProof returns the proof of an account against the committed state root.
+// Account keys are the raw addresses and values their JSON encoding.
+func (s *StateDB) GetProof(addr [20]byte) ([][]byte, error) {
+	var proof [][]byte
+	var err error
+	s.read(func() {
+		proof, err = s.trie.Prove(addr[:])
+		if err != nil {
+			err = fmt.Errorf("failed to prove account %x: %w", addr, s.readError(err))
+		}
+	})
+	return proof, err
+}
+
+// GetStorageProof returns the proof of a storage slot against the committed
+// storage root of its account
+func (s *StateDB) GetStorageProof(addr [20]byte, key [32]byte) ([][]byte, error) {
+	var proof [][]byte
+	var err error
+	s.read(func() {
+		proof, err = s.getStorageProof(addr, key)
+	})
+	return proof, err
+}
+
+func (s *StateDB) getStorageProof(addr [20]byte, key [32]byte) ([][]byte, error) {
+	acc := s.getAccount(addr)
+	if acc.Root == ([32]byte{}) {
+		return [][]byte{}, nil // Empty storage
+	}
+
+	storageTrie, err := openTrie(acc.Root, s.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage of %x: %w", addr, s.readError(err))
+	}
+
+	proof, err := storageTrie.Prove(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to prove storage %x of %x: %w", key, addr, s.readError(err))
+	}
+	return proof, nil
+}
+
+// GetStorageRoot returns the committed storage root of an account
+func (s *StateDB) GetStorageRoot(addr [20]byte) [32]byte {
+	var root [32]byte
+	s.read(func() {
+		root = s.getAccount(addr).Root
+	})
+	return root
+}
@@ -0,0 +1,119 @@
+package state
+
+import (
+	"blockchain-node/database"
+	"blockchain-node/logger"
+	"blockchain-node/trie"
+	"errors"
+	"fmt"
+)
+
+// NewStateDBWithFetcher creates a state database like NewStateDB that
+// fetches trie nodes missing from db with fetcher, see SetNodeFetcher. The
+// caller must not hold locks, a missing root is fetched before returning.
+func NewStateDBWithFetcher(root [32]byte, db database.Database, fetcher trie.NodeFetcher) (*StateDB, error) {
+	s, err := NewStateDB(root, db)
+	if err != nil && fetcher != nil && errors.Is(err, ErrMissingTrieNode) && trie.FetchNode(db, fetcher, root) == nil {
+		s, err = NewStateDB(root, db)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.fetcher = fetcher
+	return s, nil
+}
+
+// SetNodeFetcher makes reads of the state try fetcher, typically backed by
+// the node's peers, before giving up on a trie node missing from the
+// database. Fetching happens with the lock released, only the read methods
+// fetch, and copies don't, so executing blocks never waits on peers.
+func (s *StateDB) SetNodeFetcher(fetcher trie.NodeFetcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetcher = fetcher
+}
+
+// read runs fn, a read of the state, holding the lock. A trie node found
+// missing is fetched with the lock released and fn run again.
+func (s *StateDB) read(fn func()) {
+	var last [32]byte
+	for {
+		s.mu.Lock()
+		dbErr := s.dbErr
+		s.missing = nil
+		fn()
+		missing, fetcher := s.missing, s.fetcher
+		s.missing = nil
+		s.mu.Unlock()
+
+		// A node that is still missing after fetching it won't turn up
+		if missing == nil || fetcher == nil || missing.Hash == last {
+			return
+		}
+		if err := trie.FetchNode(s.db, fetcher, missing.Hash); err != nil {
+			return
+		}
+		last = missing.Hash
+
+		// The node is back, the failed read doesn't count
+		s.mu.Lock()
+		s.dbErr = dbErr
+		s.mu.Unlock()
+	}
+}
+
+// openTrie opens the trie with the given root
+func openTrie(root [32]byte, db database.Database) (*trie.Trie, error) {
+	return trie.NewTrie(root, db)
+}
+
+// trieError turns a missing trie node error into ErrMissingTrieNode, logging
+// the corruption. Other errors are returned unchanged.
+func trieError(err error) error {
+	var missing *trie.MissingNodeError
+	if !errors.As(err, &missing) {
+		return err
+	}
+
+	logger.LogSecurityEvent("missing_trie_node", map[string]interface{}{
+		"hash": fmt.Sprintf("%x", missing.Hash),
+	})
+	return fmt.Errorf("%w: %x", ErrMissingTrieNode, missing.Hash)
+}
+
+// setError records the first error hit while reading the state. Reads that
+// fail return zero values, so the error surfaces through Error and Commit.
+func (s *StateDB) setError(err error) {
+	s.noteMissing(err)
+	if s.dbErr == nil {
+		s.dbErr = trieError(err)
+	}
+}
+
+// readError is trieError for an error returned by a read, which may fetch
+// the missing node and try again
+func (s *StateDB) readError(err error) error {
+	s.noteMissing(err)
+	return trieError(err)
+}
+
+// noteMissing remembers the trie node err reports missing, for read to fetch
+func (s *StateDB) noteMissing(err error) {
+	var missing *trie.MissingNodeError
+	if errors.As(err, &missing) {
+		s.missing = missing
+	}
+}
+
+// Error returns the first error hit while reading the state, if any. A
+// missing trie node is reported as ErrMissingTrieNode.
+func (s *StateDB) Error() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dbErr
+}
+
+var (
+	ErrMissingTrieNode = errors.New("missing trie node")
+)
@@ -0,0 +1,93 @@
+package state
+
+import (
+	"blockchain-node/crypto"
+	"blockchain-node/database"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// stateWithLostNode commits two accounts and deletes the leaf of addr from
+// the database, returning the state root and the deleted node
+func stateWithLostNode(t *testing.T, db database.Database, addr [20]byte) ([32]byte, []byte) {
+	t.Helper()
+	s, err := NewStateDB([32]byte{}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetBalance(addr, big.NewInt(100))
+	s.SetBalance([20]byte{0xff}, big.NewInt(1))
+	root, err := s.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := s.GetProof(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := proof[len(proof)-1]
+	hash := crypto.Keccak256Hash(leaf)
+	if err := db.Delete(append([]byte("trie_"), hash[:]...)); err != nil {
+		t.Fatal(err)
+	}
+	return root, leaf
+}
+
+func TestMissingTrieNode(t *testing.T) {
+	db := database.NewMemoryDB()
+	addr := [20]byte{0x01}
+	root, _ := stateWithLostNode(t, db, addr)
+
+	s, err := NewStateDB(root, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := s.GetBalance(addr); balance.Sign() != 0 {
+		t.Errorf("balance %v read from a lost node", balance)
+	}
+	if err := s.Error(); !errors.Is(err, ErrMissingTrieNode) {
+		t.Errorf("error %v, expected %v", err, ErrMissingTrieNode)
+	}
+	if _, err := s.GetProof(addr); !errors.Is(err, ErrMissingTrieNode) {
+		t.Errorf("proof error %v, expected %v", err, ErrMissingTrieNode)
+	}
+}
+
+func TestMissingTrieNodeFetched(t *testing.T) {
+	db := database.NewMemoryDB()
+	addr := [20]byte{0x01}
+	root, leaf := stateWithLostNode(t, db, addr)
+
+	var s *StateDB
+	fetches := 0
+	fetcher := func(hash [32]byte) ([]byte, error) {
+		fetches++
+		if !s.mu.TryLock() {
+			t.Error("node fetched while the state is locked")
+		} else {
+			s.mu.Unlock()
+		}
+		return leaf, nil
+	}
+
+	s, err := NewStateDBWithFetcher(root, db, fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := s.GetBalance(addr); balance.Int64() != 100 {
+		t.Errorf("balance %v after fetching the lost node, expected 100", balance)
+	}
+	if err := s.Error(); err != nil {
+		t.Errorf("error %v after fetching the lost node", err)
+	}
+	if fetches != 1 {
+		t.Errorf("%d fetches, expected 1", fetches)
+	}
+
+	// Copies don't fetch, the node is stored now though
+	if balance := s.Copy().GetBalance(addr); balance.Int64() != 100 {
+		t.Errorf("copy balance %v, expected 100", balance)
+	}
+}
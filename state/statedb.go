@@ -1,4 +1,3 @@
-
 package state
 
 import (
@@ -8,26 +7,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"sync"
 )
 
 // Account represents an account in the state
 type Account struct {
-	Nonce    uint64      `json:"nonce"`
-	Balance  *big.Int    `json:"balance"`
-	CodeHash [32]byte    `json:"codeHash"`
-	Root     [32]byte    `json:"storageRoot"` // Storage trie root
+	Nonce    uint64   `json:"nonce"`
+	Balance  *big.Int `json:"balance"`
+	CodeHash [32]byte `json:"codeHash"`
+	Root     [32]byte `json:"storageRoot"` // Storage trie root
 }
 
-// StateDB manages the world state
+// StateDB manages the world state. It is safe for concurrent use: mu guards
+// the caches, which reads fill as well, so most methods take it exclusively.
+// Methods named in lower case expect the caller to hold mu.
 type StateDB struct {
-	db          database.Database
-	trie        *trie.Trie
-	accounts    map[[20]byte]*Account
-	codes       map[[32]byte][]byte
-	storage     map[[20]byte]map[[32]byte][32]byte
-	logs        []*Log
-	snapshots   []*StateSnapshot
-	dirty       map[[20]byte]bool
+	mu        sync.RWMutex
+	db        database.Database
+	trie      *trie.Trie
+	accounts  map[[20]byte]*Account
+	codes     map[[32]byte][]byte
+	storage   map[[20]byte]map[[32]byte][32]byte
+	logs      []*Log
+	snapshots []*StateSnapshot
+	dirty     map[[20]byte]bool
+	preimages *PreimageStore
+	tx        *txState
+	dbErr     error // first error hit while reading the state
+	fetcher   trie.NodeFetcher
+	missing   *trie.MissingNodeError // trie node found missing by the current read
 }
 
 // Log represents a log entry
@@ -42,15 +50,22 @@ type StateSnapshot struct {
 	accounts map[[20]byte]*Account
 	codes    map[[32]byte][]byte
 	storage  map[[20]byte]map[[32]byte][32]byte
+	dirty    map[[20]byte]bool
+	logs     int
+	tx       *txState
 }
 
+// emptyCodeHash is the hash of empty code, reported for existing accounts
+// without code
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
 // NewStateDB creates a new state database
 func NewStateDB(root [32]byte, db database.Database) (*StateDB, error) {
-	stateTrie, err := trie.NewTrie(root, db)
+	stateTrie, err := openTrie(root, db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create state trie: %v", err)
+		return nil, fmt.Errorf("failed to create state trie: %w", trieError(err))
 	}
-	
+
 	return &StateDB{
 		db:       db,
 		trie:     stateTrie,
@@ -59,19 +74,44 @@ func NewStateDB(root [32]byte, db database.Database) (*StateDB, error) {
 		storage:  make(map[[20]byte]map[[32]byte][32]byte),
 		logs:     make([]*Log, 0),
 		dirty:    make(map[[20]byte]bool),
+		tx:       newTxState(),
 	}, nil
 }
 
+// SetPreimageStore makes Commit record the preimages of written account
+// addresses and storage keys in store
+func (s *StateDB) SetPreimageStore(store *PreimageStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preimages = store
+}
+
 // GetAccount retrieves an account from the state
 func (s *StateDB) GetAccount(addr [20]byte) *Account {
+	var acc *Account
+	s.read(func() {
+		acc = s.getAccount(addr)
+	})
+	return acc
+}
+
+func (s *StateDB) getAccount(addr [20]byte) *Account {
 	// Check cache first
 	if acc, exists := s.accounts[addr]; exists {
 		return acc
 	}
-	
+
 	// Load from trie
 	data, err := s.trie.Get(addr[:])
-	if err != nil || data == nil {
+	if err != nil {
+		// Not cached, a read may fetch the node and try again
+		s.setError(err)
+		return &Account{
+			Nonce:   0,
+			Balance: big.NewInt(0),
+		}
+	}
+	if data == nil {
 		// Account doesn't exist, return empty account
 		acc := &Account{
 			Nonce:   0,
@@ -80,7 +120,7 @@ func (s *StateDB) GetAccount(addr [20]byte) *Account {
 		s.accounts[addr] = acc
 		return acc
 	}
-	
+
 	var acc Account
 	if err := json.Unmarshal(data, &acc); err != nil {
 		// Invalid data, return empty account
@@ -88,132 +128,276 @@ func (s *StateDB) GetAccount(addr [20]byte) *Account {
 			Nonce:   0,
 			Balance: big.NewInt(0),
 		}
-		s.accounts[addr] = &acc
-		return &acc
+		s.accounts[addr] = acc
+		return acc
 	}
-	
+
 	s.accounts[addr] = &acc
 	return &acc
 }
 
 // SetAccount sets an account in the state
 func (s *StateDB) SetAccount(addr [20]byte, acc *Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setAccount(addr, acc)
+}
+
+func (s *StateDB) setAccount(addr [20]byte, acc *Account) {
 	s.accounts[addr] = acc
 	s.dirty[addr] = true
 }
 
 // GetBalance gets the balance of an account
 func (s *StateDB) GetBalance(addr [20]byte) *big.Int {
-	acc := s.GetAccount(addr)
-	return new(big.Int).Set(acc.Balance)
+	var balance *big.Int
+	s.read(func() {
+		balance = new(big.Int).Set(s.getAccount(addr).Balance)
+	})
+	return balance
 }
 
 // SetBalance sets the balance of an account
 func (s *StateDB) SetBalance(addr [20]byte, balance *big.Int) {
-	acc := s.GetAccount(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := s.getAccount(addr)
 	acc.Balance = new(big.Int).Set(balance)
-	s.SetAccount(addr, acc)
+	s.setAccount(addr, acc)
+}
+
+// AddBalance adds amount to the balance of an account
+func (s *StateDB) AddBalance(addr [20]byte, amount *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := s.getAccount(addr)
+	acc.Balance = new(big.Int).Add(acc.Balance, amount)
+	s.setAccount(addr, acc)
+}
+
+// SubBalance subtracts amount from the balance of an account
+func (s *StateDB) SubBalance(addr [20]byte, amount *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := s.getAccount(addr)
+	acc.Balance = new(big.Int).Sub(acc.Balance, amount)
+	s.setAccount(addr, acc)
+}
+
+// CreateAccount creates a fresh account at addr. A balance already sent to
+// the address is kept, everything else is reset.
+func (s *StateDB) CreateAccount(addr [20]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := s.getAccount(addr)
+	s.setAccount(addr, &Account{Balance: new(big.Int).Set(acc.Balance)})
+	s.storage[addr] = nil
+	s.tx.created[addr] = true
+}
+
+// Exist reports whether an account is stored in the state or was written
+// since the last commit
+func (s *StateDB) Exist(addr [20]byte) bool {
+	var exist bool
+	s.read(func() {
+		exist = s.exist(addr)
+	})
+	return exist
+}
+
+func (s *StateDB) exist(addr [20]byte) bool {
+	if s.dirty[addr] {
+		return true
+	}
+	data, err := s.trie.Get(addr[:])
+	if err != nil {
+		s.setError(err)
+	}
+	return err == nil && data != nil
+}
+
+// Empty reports whether an account has no nonce, balance or code (EIP-161)
+func (s *StateDB) Empty(addr [20]byte) bool {
+	var empty bool
+	s.read(func() {
+		acc := s.getAccount(addr)
+		empty = acc.Nonce == 0 && acc.Balance.Sign() == 0 && acc.CodeHash == ([32]byte{})
+	})
+	return empty
 }
 
 // GetNonce gets the nonce of an account
 func (s *StateDB) GetNonce(addr [20]byte) uint64 {
-	acc := s.GetAccount(addr)
-	return acc.Nonce
+	var nonce uint64
+	s.read(func() {
+		nonce = s.getAccount(addr).Nonce
+	})
+	return nonce
 }
 
 // SetNonce sets the nonce of an account
 func (s *StateDB) SetNonce(addr [20]byte, nonce uint64) {
-	acc := s.GetAccount(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := s.getAccount(addr)
 	acc.Nonce = nonce
-	s.SetAccount(addr, acc)
+	s.setAccount(addr, acc)
 }
 
 // GetCode gets the code of an account
 func (s *StateDB) GetCode(addr [20]byte) []byte {
-	acc := s.GetAccount(addr)
-	
+	var code []byte
+	s.read(func() {
+		code = s.getCode(addr)
+	})
+	return code
+}
+
+func (s *StateDB) getCode(addr [20]byte) []byte {
+	acc := s.getAccount(addr)
+
 	// Empty code hash means no code
 	emptyHash := [32]byte{}
 	if acc.CodeHash == emptyHash {
 		return nil
 	}
-	
+
 	// Check cache first
 	if code, exists := s.codes[acc.CodeHash]; exists {
 		return code
 	}
-	
+
 	// Load from database
 	key := append([]byte("code_"), acc.CodeHash[:]...)
 	data, err := s.db.Get(key)
 	if err != nil {
 		return nil
 	}
-	
+
 	s.codes[acc.CodeHash] = data
 	return data
 }
 
+// GetCodeHash gets the code hash of an account, zero if it doesn't exist
+func (s *StateDB) GetCodeHash(addr [20]byte) [32]byte {
+	var hash [32]byte
+	s.read(func() {
+		if !s.exist(addr) {
+			hash = [32]byte{}
+			return
+		}
+		hash = s.getAccount(addr).CodeHash
+		if hash == ([32]byte{}) {
+			hash = emptyCodeHash
+		}
+	})
+	return hash
+}
+
+// GetCodeSize gets the size of the code of an account
+func (s *StateDB) GetCodeSize(addr [20]byte) int {
+	var size int
+	s.read(func() {
+		size = len(s.getCode(addr))
+	})
+	return size
+}
+
 // SetCode sets the code of an account
 func (s *StateDB) SetCode(addr [20]byte, code []byte) {
-	acc := s.GetAccount(addr)
-	
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := s.getAccount(addr)
+
 	if len(code) == 0 {
 		acc.CodeHash = [32]byte{}
 	} else {
 		hash := crypto.Keccak256Hash(code)
 		copy(acc.CodeHash[:], hash[:])
-		
+
 		// Store code in database
 		key := append([]byte("code_"), acc.CodeHash[:]...)
 		s.db.Put(key, code)
-		
+
 		// Cache code
 		s.codes[acc.CodeHash] = code
 	}
-	
-	s.SetAccount(addr, acc)
+
+	s.setAccount(addr, acc)
 }
 
 // GetState gets a storage value
 func (s *StateDB) GetState(addr [20]byte, key [32]byte) [32]byte {
+	var value [32]byte
+	s.read(func() {
+		value = s.getState(addr, key)
+	})
+	return value
+}
+
+func (s *StateDB) getState(addr [20]byte, key [32]byte) [32]byte {
 	// Check cache first
 	if storage, exists := s.storage[addr]; exists {
 		if value, exists := storage[key]; exists {
 			return value
 		}
 	}
-	
+
 	// Load from storage trie
-	acc := s.GetAccount(addr)
+	missing := s.missing
+	value := s.getCommittedState(addr, key)
+	if s.missing != missing {
+		return value // Not cached, a read may fetch the node and try again
+	}
+
+	// Cache the value
+	if s.storage[addr] == nil {
+		s.storage[addr] = make(map[[32]byte][32]byte)
+	}
+	s.storage[addr][key] = value
+
+	return value
+}
+
+// GetCommittedState gets a storage value as of the last commit, ignoring
+// writes made since
+func (s *StateDB) GetCommittedState(addr [20]byte, key [32]byte) [32]byte {
+	var value [32]byte
+	s.read(func() {
+		value = s.getCommittedState(addr, key)
+	})
+	return value
+}
+
+func (s *StateDB) getCommittedState(addr [20]byte, key [32]byte) [32]byte {
+	acc := s.getAccount(addr)
 	if acc.Root == ([32]byte{}) {
 		return [32]byte{} // Empty storage
 	}
-	
-	storageTrie, err := trie.NewTrie(acc.Root, s.db)
+
+	storageTrie, err := openTrie(acc.Root, s.db)
 	if err != nil {
+		s.setError(err)
 		return [32]byte{}
 	}
-	
+
 	data, err := storageTrie.Get(key[:])
+	if err != nil {
+		s.setError(err)
+	}
 	if err != nil || data == nil {
 		return [32]byte{}
 	}
-	
+
 	var value [32]byte
 	copy(value[:], data)
-	
-	// Cache the value
-	if s.storage[addr] == nil {
-		s.storage[addr] = make(map[[32]byte][32]byte)
-	}
-	s.storage[addr][key] = value
-	
 	return value
 }
 
 // SetState sets a storage value
 func (s *StateDB) SetState(addr [20]byte, key [32]byte, value [32]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	// Update cache
 	if s.storage[addr] == nil {
 		s.storage[addr] = make(map[[32]byte][32]byte)
@@ -224,22 +408,40 @@ func (s *StateDB) SetState(addr [20]byte, key [32]byte, value [32]byte) {
 
 // AddLog adds a log entry
 func (s *StateDB) AddLog(log *Log) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logs = append(s.logs, log)
 }
 
 // GetLogs returns all logs
 func (s *StateDB) GetLogs() []*Log {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.logs
 }
 
+// AddPreimage records preimage in the preimage store, if there is one
+func (s *StateDB) AddPreimage(preimage []byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.preimages != nil {
+		s.preimages.Add(preimage)
+	}
+}
+
 // Snapshot creates a snapshot of the current state
 func (s *StateDB) Snapshot() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	snap := &StateSnapshot{
 		accounts: make(map[[20]byte]*Account),
 		codes:    make(map[[32]byte][]byte),
 		storage:  make(map[[20]byte]map[[32]byte][32]byte),
+		dirty:    make(map[[20]byte]bool),
+		logs:     len(s.logs),
+		tx:       s.tx.copy(),
 	}
-	
+
 	// Copy accounts
 	for addr, acc := range s.accounts {
 		snap.accounts[addr] = &Account{
@@ -249,13 +451,13 @@ func (s *StateDB) Snapshot() int {
 			Root:     acc.Root,
 		}
 	}
-	
+
 	// Copy codes
 	for hash, code := range s.codes {
 		snap.codes[hash] = make([]byte, len(code))
 		copy(snap.codes[hash], code)
 	}
-	
+
 	// Copy storage
 	for addr, storage := range s.storage {
 		snap.storage[addr] = make(map[[32]byte][32]byte)
@@ -263,19 +465,26 @@ func (s *StateDB) Snapshot() int {
 			snap.storage[addr][key] = value
 		}
 	}
-	
+
+	// Copy dirty flags
+	for addr := range s.dirty {
+		snap.dirty[addr] = true
+	}
+
 	s.snapshots = append(s.snapshots, snap)
 	return len(s.snapshots) - 1
 }
 
 // RevertToSnapshot reverts state to a snapshot
 func (s *StateDB) RevertToSnapshot(snapId int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if snapId < 0 || snapId >= len(s.snapshots) {
 		return
 	}
-	
+
 	snap := s.snapshots[snapId]
-	
+
 	// Restore accounts
 	s.accounts = make(map[[20]byte]*Account)
 	for addr, acc := range snap.accounts {
@@ -286,14 +495,14 @@ func (s *StateDB) RevertToSnapshot(snapId int) {
 			Root:     acc.Root,
 		}
 	}
-	
+
 	// Restore codes
 	s.codes = make(map[[32]byte][]byte)
 	for hash, code := range snap.codes {
 		s.codes[hash] = make([]byte, len(code))
 		copy(s.codes[hash], code)
 	}
-	
+
 	// Restore storage
 	s.storage = make(map[[20]byte]map[[32]byte][32]byte)
 	for addr, storage := range snap.storage {
@@ -302,23 +511,42 @@ func (s *StateDB) RevertToSnapshot(snapId int) {
 			s.storage[addr][key] = value
 		}
 	}
-	
+
+	// Restore dirty flags, logs and transaction state
+	s.dirty = make(map[[20]byte]bool)
+	for addr := range snap.dirty {
+		s.dirty[addr] = true
+	}
+	s.logs = s.logs[:snap.logs]
+	s.tx = snap.tx
+
 	// Remove snapshots after the reverted one
 	s.snapshots = s.snapshots[:snapId]
-	
-	// Reset dirty flags
-	s.dirty = make(map[[20]byte]bool)
 }
 
 // Commit commits the state changes to the trie
 func (s *StateDB) Commit() ([32]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Refuse to build on a state that couldn't be read completely
+	if s.dbErr != nil {
+		return [32]byte{}, s.dbErr
+	}
+
 	// Update storage tries for dirty accounts
 	for addr := range s.dirty {
 		if err := s.updateStorageTrie(addr); err != nil {
 			return [32]byte{}, fmt.Errorf("failed to update storage trie for %x: %v", addr, err)
 		}
+
+		if s.preimages != nil {
+			s.preimages.Add(addr[:])
+			for key := range s.storage[addr] {
+				s.preimages.Add(key[:])
+			}
+		}
 	}
-	
+
 	// Update account data in state trie
 	for addr, acc := range s.accounts {
 		if s.dirty[addr] {
@@ -326,74 +554,79 @@ func (s *StateDB) Commit() ([32]byte, error) {
 			if err != nil {
 				return [32]byte{}, fmt.Errorf("failed to marshal account %x: %v", addr, err)
 			}
-			
+
 			if err := s.trie.Update(addr[:], data); err != nil {
 				return [32]byte{}, fmt.Errorf("failed to update account %x in trie: %v", addr, err)
 			}
 		}
 	}
-	
+
 	// Commit trie changes
 	root, err := s.trie.Commit()
 	if err != nil {
 		return [32]byte{}, fmt.Errorf("failed to commit state trie: %v", err)
 	}
-	
+
 	// Clear dirty flags
 	s.dirty = make(map[[20]byte]bool)
-	
+
 	// Clear logs
 	s.logs = make([]*Log, 0)
-	
+
 	return root, nil
 }
 
 // updateStorageTrie updates the storage trie for an account
 func (s *StateDB) updateStorageTrie(addr [20]byte) error {
-	acc := s.GetAccount(addr)
+	acc := s.getAccount(addr)
 	storage := s.storage[addr]
-	
+
 	if len(storage) == 0 {
 		// No storage, set empty root
 		acc.Root = [32]byte{}
 		return nil
 	}
-	
+
 	// Create storage trie
-	storageTrie, err := trie.NewTrie(acc.Root, s.db)
+	storageTrie, err := openTrie(acc.Root, s.db)
 	if err != nil {
-		return err
+		return trieError(err)
 	}
-	
+
 	// Update all storage values
 	for key, value := range storage {
 		if err := storageTrie.Update(key[:], value[:]); err != nil {
 			return err
 		}
 	}
-	
+
 	// Commit storage trie
 	root, err := storageTrie.Commit()
 	if err != nil {
 		return err
 	}
-	
+
 	acc.Root = root
 	return nil
 }
 
 // Copy creates a deep copy of the state
 func (s *StateDB) Copy() *StateDB {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	newState := &StateDB{
-		db:       s.db,
-		trie:     s.trie.Copy(),
-		accounts: make(map[[20]byte]*Account),
-		codes:    make(map[[32]byte][]byte),
-		storage:  make(map[[20]byte]map[[32]byte][32]byte),
-		logs:     make([]*Log, 0),
-		dirty:    make(map[[20]byte]bool),
+		db:        s.db,
+		trie:      s.trie.Copy(),
+		accounts:  make(map[[20]byte]*Account),
+		codes:     make(map[[32]byte][]byte),
+		storage:   make(map[[20]byte]map[[32]byte][32]byte),
+		logs:      make([]*Log, 0),
+		dirty:     make(map[[20]byte]bool),
+		preimages: s.preimages,
+		tx:        s.tx.copy(),
+		dbErr:     s.dbErr,
 	}
-	
+
 	// Copy accounts
 	for addr, acc := range s.accounts {
 		newState.accounts[addr] = &Account{
@@ -403,13 +636,13 @@ func (s *StateDB) Copy() *StateDB {
 			Root:     acc.Root,
 		}
 	}
-	
+
 	// Copy codes
 	for hash, code := range s.codes {
 		newState.codes[hash] = make([]byte, len(code))
 		copy(newState.codes[hash], code)
 	}
-	
+
 	// Copy storage
 	for addr, storage := range s.storage {
 		newState.storage[addr] = make(map[[32]byte][32]byte)
@@ -417,7 +650,7 @@ func (s *StateDB) Copy() *StateDB {
 			newState.storage[addr][key] = value
 		}
 	}
-	
+
 	// Copy logs
 	for _, log := range s.logs {
 		newState.logs = append(newState.logs, &Log{
@@ -427,6 +660,6 @@ func (s *StateDB) Copy() *StateDB {
 		})
 		copy(newState.logs[len(newState.logs)-1].Data, log.Data)
 	}
-	
+
 	return newState
 }
@@ -0,0 +1,48 @@
+package state
+
+import (
+	"blockchain-node/database"
+	"math/big"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentReads reads balances while blocks are committed, run with
+// -race to check the locking
+func TestConcurrentReads(t *testing.T) {
+	s, err := NewStateDB([32]byte{}, database.NewMemoryDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := [20]byte{0x01}
+	s.SetBalance(addr, big.NewInt(1))
+
+	const commits = 50
+	var wg sync.WaitGroup
+	for reader := 0; reader < 4; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < commits; i++ {
+				if balance := s.GetBalance(addr); balance.Sign() <= 0 {
+					t.Errorf("balance %v read during a commit", balance)
+					return
+				}
+				s.GetNonce(addr)
+			}
+		}()
+	}
+
+	for i := 0; i < commits; i++ {
+		s.AddBalance(addr, big.NewInt(1))
+		s.SetState(addr, [32]byte{byte(i)}, [32]byte{0x01})
+		if _, err := s.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if balance := s.GetBalance(addr); balance.Cmp(big.NewInt(commits+1)) != 0 {
+		t.Errorf("balance %v after %d commits, expected %d", balance, commits, commits+1)
+	}
+}
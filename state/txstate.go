@@ -0,0 +1,190 @@
+package state
+
+import "math/big"
+
+// txState is state that only lives for the duration of a transaction: the
+// gas refund counter, the EIP-2929 access list, EIP-1153 transient storage
+// and the accounts created or self-destructed by the transaction.
+type txState struct {
+	refund         uint64
+	accessList     map[[20]byte]map[[32]byte]bool
+	transient      map[[20]byte]map[[32]byte][32]byte
+	created        map[[20]byte]bool
+	selfDestructed map[[20]byte]bool
+}
+
+func newTxState() *txState {
+	return &txState{
+		accessList:     make(map[[20]byte]map[[32]byte]bool),
+		transient:      make(map[[20]byte]map[[32]byte][32]byte),
+		created:        make(map[[20]byte]bool),
+		selfDestructed: make(map[[20]byte]bool),
+	}
+}
+
+func (t *txState) copy() *txState {
+	cpy := newTxState()
+	cpy.refund = t.refund
+
+	for addr, slots := range t.accessList {
+		cpy.accessList[addr] = make(map[[32]byte]bool, len(slots))
+		for slot := range slots {
+			cpy.accessList[addr][slot] = true
+		}
+	}
+	for addr, storage := range t.transient {
+		cpy.transient[addr] = make(map[[32]byte][32]byte, len(storage))
+		for key, value := range storage {
+			cpy.transient[addr][key] = value
+		}
+	}
+	for addr := range t.created {
+		cpy.created[addr] = true
+	}
+	for addr := range t.selfDestructed {
+		cpy.selfDestructed[addr] = true
+	}
+
+	return cpy
+}
+
+// PrepareTx resets the transaction scoped state and warms the sender and
+// the given addresses, which are normally the destination and precompiles.
+func (s *StateDB) PrepareTx(sender [20]byte, warm ...[20]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tx = newTxState()
+	s.addAddressToAccessList(sender)
+	for _, addr := range warm {
+		s.addAddressToAccessList(addr)
+	}
+}
+
+// FinaliseTx clears the accounts self-destructed by the transaction
+func (s *StateDB) FinaliseTx() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for addr := range s.tx.selfDestructed {
+		s.setAccount(addr, &Account{Balance: big.NewInt(0)})
+		s.storage[addr] = nil
+	}
+	s.tx = newTxState()
+}
+
+// AddRefund adds gas to the refund counter
+func (s *StateDB) AddRefund(gas uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tx.refund += gas
+}
+
+// SubRefund removes gas from the refund counter
+func (s *StateDB) SubRefund(gas uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gas > s.tx.refund {
+		s.tx.refund = 0
+		return
+	}
+	s.tx.refund -= gas
+}
+
+// GetRefund returns the current value of the refund counter
+func (s *StateDB) GetRefund() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tx.refund
+}
+
+// AddressInAccessList reports whether addr is in the access list
+func (s *StateDB) AddressInAccessList(addr [20]byte) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.tx.accessList[addr]
+	return ok
+}
+
+// SlotInAccessList reports whether addr and the slot of addr are in the
+// access list
+func (s *StateDB) SlotInAccessList(addr [20]byte, slot [32]byte) (addressOk bool, slotOk bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	slots, ok := s.tx.accessList[addr]
+	if !ok {
+		return false, false
+	}
+	return true, slots[slot]
+}
+
+// AddAddressToAccessList adds addr to the access list
+func (s *StateDB) AddAddressToAccessList(addr [20]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addAddressToAccessList(addr)
+}
+
+func (s *StateDB) addAddressToAccessList(addr [20]byte) {
+	if _, ok := s.tx.accessList[addr]; !ok {
+		s.tx.accessList[addr] = make(map[[32]byte]bool)
+	}
+}
+
+// AddSlotToAccessList adds addr and the slot of addr to the access list
+func (s *StateDB) AddSlotToAccessList(addr [20]byte, slot [32]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addAddressToAccessList(addr)
+	s.tx.accessList[addr][slot] = true
+}
+
+// GetTransientState gets a transient storage value
+func (s *StateDB) GetTransientState(addr [20]byte, key [32]byte) [32]byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tx.transient[addr][key]
+}
+
+// SetTransientState sets a transient storage value
+func (s *StateDB) SetTransientState(addr [20]byte, key, value [32]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx.transient[addr] == nil {
+		s.tx.transient[addr] = make(map[[32]byte][32]byte)
+	}
+	s.tx.transient[addr][key] = value
+}
+
+// SelfDestruct marks addr for deletion at the end of the transaction and
+// clears its balance
+func (s *StateDB) SelfDestruct(addr [20]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.selfDestruct(addr)
+}
+
+func (s *StateDB) selfDestruct(addr [20]byte) {
+	if !s.exist(addr) {
+		return
+	}
+	s.tx.selfDestructed[addr] = true
+	acc := s.getAccount(addr)
+	acc.Balance = big.NewInt(0)
+	s.setAccount(addr, acc)
+}
+
+// SelfDestruct6780 self-destructs addr only if it was created in the same
+// transaction (EIP-6780)
+func (s *StateDB) SelfDestruct6780(addr [20]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx.created[addr] {
+		s.selfDestruct(addr)
+	}
+}
+
+// HasSelfDestructed reports whether addr self-destructed in this transaction
+func (s *StateDB) HasSelfDestructed(addr [20]byte) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tx.selfDestructed[addr]
+}
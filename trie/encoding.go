@@ -0,0 +1,155 @@
+package trie
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Nodes are encoded as RLP in the Merkle Patricia trie layout, so proofs can
+// be checked by standard verifiers. A leaf or extension is a list of its hex
+// prefix encoded key and its value or child, a branch a list of 16 children
+// and its value. Children are always referenced by hash, never embedded.
+
+// encodeNodeRLP encodes node, children holds the hashes of its children
+func encodeNodeRLP(node *Node, children map[byte][32]byte) ([]byte, error) {
+	var items []interface{}
+
+	switch node.Type {
+	case NodeTypeLeaf:
+		items = []interface{}{compactKey(node.Key, true), node.Value}
+
+	case NodeTypeExtension:
+		if len(children) != 1 {
+			return nil, fmt.Errorf("extension node must have exactly one child")
+		}
+		for _, hash := range children {
+			items = []interface{}{compactKey(node.Key, false), hash[:]}
+		}
+
+	case NodeTypeBranch:
+		items = make([]interface{}, 17)
+		for nibble := 0; nibble < 16; nibble++ {
+			items[nibble] = []byte{}
+			if hash, ok := children[byte(nibble)]; ok {
+				items[nibble] = hash[:]
+			}
+		}
+		items[16] = node.Value
+
+	default:
+		return nil, fmt.Errorf("unknown node type: %d", node.Type)
+	}
+
+	data, err := rlp.EncodeToBytes(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode node: %v", err)
+	}
+	return data, nil
+}
+
+// decodeNode decodes a stored node, its children are hash references. Nodes
+// written before the RLP encoding are JSON and still decoded as such.
+func decodeNode(data []byte) (*Node, error) {
+	if len(data) > 0 && data[0] == '{' {
+		var node Node
+		if err := json.Unmarshal(data, &node); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal node: %v", err)
+		}
+		return &node, nil
+	}
+
+	var items [][]byte
+	if err := rlp.DecodeBytes(data, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode node: %v", err)
+	}
+
+	switch len(items) {
+	case 2:
+		key, leaf, err := compactToNibbles(items[0])
+		if err != nil {
+			return nil, err
+		}
+		if leaf {
+			return &Node{Type: NodeTypeLeaf, Key: key, Value: items[1]}, nil
+		}
+		child, err := hashRef(items[1])
+		if err != nil || child == nil {
+			return nil, fmt.Errorf("invalid extension child reference")
+		}
+		return &Node{Type: NodeTypeExtension, Key: key, Children: map[byte]*Node{0: child}}, nil
+
+	case 17:
+		node := &Node{Type: NodeTypeBranch, Children: make(map[byte]*Node)}
+		for nibble := 0; nibble < 16; nibble++ {
+			child, err := hashRef(items[nibble])
+			if err != nil {
+				return nil, err
+			}
+			if child != nil {
+				node.Children[byte(nibble)] = child
+			}
+		}
+		if len(items[16]) > 0 {
+			node.Value = items[16]
+		}
+		return node, nil
+
+	default:
+		return nil, fmt.Errorf("invalid node with %d items", len(items))
+	}
+}
+
+// hashRef returns the hash node a child reference points to, nil for an
+// empty reference
+func hashRef(ref []byte) (*Node, error) {
+	if len(ref) == 0 {
+		return nil, nil
+	}
+	if len(ref) != 32 {
+		return nil, fmt.Errorf("invalid child reference of %d bytes", len(ref))
+	}
+	var hash [32]byte
+	copy(hash[:], ref)
+	return &Node{Hash: hash}, nil
+}
+
+// compactKey hex prefix encodes nibbles. The flag nibble marks leaves and an
+// odd number of nibbles, an even key is padded with a zero nibble.
+func compactKey(nibbles []byte, leaf bool) []byte {
+	flag := byte(0)
+	if leaf {
+		flag = 2
+	}
+
+	compact := make([]byte, len(nibbles)/2+1)
+	if len(nibbles)%2 == 1 {
+		compact[0] = (flag+1)<<4 | nibbles[0]
+		nibbles = nibbles[1:]
+	} else {
+		compact[0] = flag << 4
+	}
+	for i := 0; i < len(nibbles); i += 2 {
+		compact[i/2+1] = nibbles[i]<<4 | nibbles[i+1]
+	}
+	return compact
+}
+
+// compactToNibbles decodes a hex prefix encoded key, reporting whether it is
+// the key of a leaf
+func compactToNibbles(compact []byte) ([]byte, bool, error) {
+	if len(compact) == 0 || compact[0]>>4 > 3 {
+		return nil, false, fmt.Errorf("invalid compact key %x", compact)
+	}
+	flag := compact[0] >> 4
+
+	nibbles := make([]byte, 0, len(compact)*2)
+	if flag&1 == 1 {
+		nibbles = append(nibbles, compact[0]&0x0f)
+	} else if compact[0]&0x0f != 0 {
+		return nil, false, fmt.Errorf("invalid compact key %x", compact)
+	}
+	nibbles = append(nibbles, hexToNibbles(compact[1:])...)
+	return nibbles, flag&2 == 2, nil
+}
@@ -0,0 +1,89 @@
+package trie
+
+import (
+	"blockchain-node/crypto"
+	"blockchain-node/database"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	nodes := []*Node{
+		{Type: NodeTypeLeaf, Key: []byte{1, 2, 3}, Value: []byte("odd")},
+		{Type: NodeTypeLeaf, Key: []byte{}, Value: []byte("empty key")},
+		{Type: NodeTypeExtension, Key: []byte{4, 5}, Children: map[byte]*Node{0: {Hash: [32]byte{1}}}},
+		{Type: NodeTypeBranch, Value: []byte("value"), Children: map[byte]*Node{0: {Hash: [32]byte{2}}, 15: {Hash: [32]byte{3}}}},
+	}
+	for _, node := range nodes {
+		children := make(map[byte][32]byte)
+		for key, child := range node.Children {
+			children[key] = child.Hash
+		}
+		data, err := encodeNodeRLP(node, children)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeNode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Type != node.Type || !bytes.Equal(decoded.Key, node.Key) || !bytes.Equal(decoded.Value, node.Value) || len(decoded.Children) != len(node.Children) {
+			t.Fatalf("node %+v decoded as %+v", node, decoded)
+		}
+		for key, child := range node.Children {
+			if decoded.Children[key] == nil || decoded.Children[key].Hash != child.Hash {
+				t.Errorf("child %d of %+v decoded as %+v", key, node, decoded.Children[key])
+			}
+		}
+	}
+}
+
+// TestLegacyJSONNodes checks that a trie stored with the JSON encoding is
+// still read and keeps its root until it changes
+func TestLegacyJSONNodes(t *testing.T) {
+	db := database.NewMemoryDB()
+	leaf, err := json.Marshal(&Node{Type: NodeTypeLeaf, Key: hexToNibbles([]byte("key")), Value: []byte("value")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := crypto.Keccak256Hash(leaf)
+	if err := db.Put(append([]byte("trie_"), root[:]...), leaf); err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := NewTrie(root, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := tr.Get([]byte("key")); err != nil || string(value) != "value" {
+		t.Fatalf("legacy value %q, %v", value, err)
+	}
+	if hash, err := tr.Hash(); err != nil || hash != root {
+		t.Fatalf("unchanged legacy trie hashes to %x, expected %x", hash, root)
+	}
+	proof, err := tr.Prove([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := VerifyProof(root, []byte("key"), proof); err != nil || string(value) != "value" {
+		t.Errorf("legacy proof value %q, %v", value, err)
+	}
+
+	if err := tr.Update([]byte("other"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	newRoot, err := tr.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err = NewTrie(newRoot, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"key", "other"} {
+		if value, err := tr.Get([]byte(key)); err != nil || string(value) != "value" {
+			t.Errorf("%s after update: %q, %v", key, value, err)
+		}
+	}
+}
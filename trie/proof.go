@@ -0,0 +1,128 @@
+package trie
+
+import (
+	"blockchain-node/crypto"
+	"bytes"
+	"fmt"
+)
+
+// Prove returns the RLP encodings of the nodes on the path to key, starting at
+// the root. The proof shows the value of key, or that it is absent, against
+// the root hash and can be checked with VerifyProof. Uncommitted changes are
+// included, the proof is against the root returned by Hash.
+func (t *Trie) Prove(key []byte) ([][]byte, error) {
+	nibbles := hexToNibbles(key)
+	proof := make([][]byte, 0)
+
+	node := t.root
+	depth := 0
+	for node != nil {
+		resolved, err := t.resolve(node)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := t.nodeEncoding(resolved)
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, data)
+
+		next, consumed, err := nextNode(resolved, nibbles, depth)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return proof, nil
+		}
+		node = next
+		depth += consumed
+	}
+
+	return proof, nil
+}
+
+// VerifyProof checks a proof made by Prove against root. It returns the
+// value of key, or nil if the proof shows that key is absent.
+func VerifyProof(root [32]byte, key []byte, proof [][]byte) ([]byte, error) {
+	if root == ([32]byte{}) {
+		return nil, nil // Empty trie
+	}
+
+	nodes := make(map[[32]byte][]byte, len(proof))
+	for _, data := range proof {
+		nodes[crypto.Keccak256Hash(data)] = data
+	}
+
+	nibbles := hexToNibbles(key)
+	hash := root
+	depth := 0
+	for {
+		data, ok := nodes[hash]
+		if !ok {
+			return nil, fmt.Errorf("proof is missing node %x", hash)
+		}
+
+		node, err := decodeNode(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proof node %x: %v", hash, err)
+		}
+
+		next, consumed, err := nextNode(node, nibbles, depth)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nodeValue(node, nibbles, depth), nil
+		}
+		hash = next.Hash
+		depth += consumed
+	}
+}
+
+// nextNode returns the child of node on the path to key, with the number of
+// key nibbles it consumes, or nil if the path ends at node
+func nextNode(node *Node, key []byte, depth int) (*Node, int, error) {
+	switch node.Type {
+	case NodeTypeLeaf:
+		return nil, 0, nil
+
+	case NodeTypeExtension:
+		if len(key) < depth+len(node.Key) || !bytes.Equal(node.Key, key[depth:depth+len(node.Key)]) {
+			return nil, 0, nil
+		}
+		if len(node.Children) != 1 {
+			return nil, 0, fmt.Errorf("extension node must have exactly one child")
+		}
+		for _, child := range node.Children {
+			return child, len(node.Key), nil
+		}
+
+	case NodeTypeBranch:
+		if depth >= len(key) {
+			return nil, 0, nil
+		}
+		if child := node.Children[key[depth]]; child != nil {
+			return child, 1, nil
+		}
+		return nil, 0, nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown node type: %d", node.Type)
+}
+
+// nodeValue returns the value node holds for key when the path to key ends
+// at node
+func nodeValue(node *Node, key []byte, depth int) []byte {
+	switch node.Type {
+	case NodeTypeLeaf:
+		if bytes.Equal(node.Key, key[depth:]) {
+			return node.Value
+		}
+	case NodeTypeBranch:
+		if depth >= len(key) {
+			return node.Value
+		}
+	}
+	return nil
+}
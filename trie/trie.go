@@ -1,19 +1,17 @@
-
 package trie
 
 import (
 	"blockchain-node/crypto"
 	"blockchain-node/database"
 	"bytes"
-	"encoding/json"
 	"fmt"
 )
 
 // Node types
 const (
-	NodeTypeBranch   = 0
-	NodeTypeExtension = 1  
-	NodeTypeLeaf     = 2
+	NodeTypeBranch    = 0
+	NodeTypeExtension = 1
+	NodeTypeLeaf      = 2
 )
 
 // Trie represents a Patricia Merkle Trie
@@ -22,14 +20,28 @@ type Trie struct {
 	root *Node
 }
 
+// NodeFetcher retrieves the encoding of a node missing from the database,
+// typically from a peer
+type NodeFetcher func(hash [32]byte) ([]byte, error)
+
+// MissingNodeError is returned when a node referenced by the trie is not in
+// the database
+type MissingNodeError struct {
+	Hash [32]byte
+}
+
+func (e *MissingNodeError) Error() string {
+	return fmt.Sprintf("node not found: %x", e.Hash)
+}
+
 // Node represents a trie node
 type Node struct {
-	Type     int           `json:"type"`
-	Key      []byte        `json:"key,omitempty"`
-	Value    []byte        `json:"value,omitempty"`
+	Type     int            `json:"type"`
+	Key      []byte         `json:"key,omitempty"`
+	Value    []byte         `json:"value,omitempty"`
 	Children map[byte]*Node `json:"children,omitempty"`
-	Hash     [32]byte      `json:"hash"`
-	Dirty    bool          `json:"-"`
+	Hash     [32]byte       `json:"hash"`
+	Dirty    bool           `json:"-"`
 }
 
 // NewTrie creates a new trie
@@ -37,16 +49,16 @@ func NewTrie(root [32]byte, db database.Database) (*Trie, error) {
 	trie := &Trie{
 		db: db,
 	}
-	
+
 	// Load root node if exists
 	if root != ([32]byte{}) {
 		node, err := trie.loadNode(root)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load root node: %v", err)
+			return nil, fmt.Errorf("failed to load root node: %w", err)
 		}
 		trie.root = node
 	}
-	
+
 	return trie, nil
 }
 
@@ -55,7 +67,7 @@ func (t *Trie) Get(key []byte) ([]byte, error) {
 	if t.root == nil {
 		return nil, nil
 	}
-	
+
 	return t.get(t.root, hexToNibbles(key), 0)
 }
 
@@ -64,13 +76,13 @@ func (t *Trie) Update(key, value []byte) error {
 	if len(value) == 0 {
 		return t.Delete(key)
 	}
-	
+
 	nibbles := hexToNibbles(key)
 	newRoot, err := t.update(t.root, nibbles, 0, value)
 	if err != nil {
 		return err
 	}
-	
+
 	t.root = newRoot
 	return nil
 }
@@ -80,13 +92,13 @@ func (t *Trie) Delete(key []byte) error {
 	if t.root == nil {
 		return nil
 	}
-	
+
 	nibbles := hexToNibbles(key)
 	newRoot, err := t.delete(t.root, nibbles, 0)
 	if err != nil {
 		return err
 	}
-	
+
 	t.root = newRoot
 	return nil
 }
@@ -96,8 +108,8 @@ func (t *Trie) Commit() ([32]byte, error) {
 	if t.root == nil {
 		return [32]byte{}, nil
 	}
-	
-	return t.commitNode(t.root)
+
+	return t.commitNode(t.root, true)
 }
 
 // Copy creates a deep copy of the trie
@@ -105,27 +117,100 @@ func (t *Trie) Copy() *Trie {
 	newTrie := &Trie{
 		db: t.db,
 	}
-	
+
 	if t.root != nil {
 		newTrie.root = t.copyNode(t.root)
 	}
-	
+
 	return newTrie
 }
 
+// Iterate calls fn for every key/value pair stored in the trie
+func (t *Trie) Iterate(fn func(key, value []byte) error) error {
+	if t.root == nil {
+		return nil
+	}
+
+	return t.iterate(t.root, nil, fn)
+}
+
+// iterate walks the subtree rooted at node, path holds the nibbles leading to it
+func (t *Trie) iterate(node *Node, path []byte, fn func(key, value []byte) error) error {
+	node, err := t.resolve(node)
+	if err != nil {
+		return err
+	}
+
+	switch node.Type {
+	case NodeTypeLeaf:
+		return fn(nibblesToHex(append(path, node.Key...)), node.Value)
+
+	case NodeTypeExtension:
+		childPath := append(append([]byte{}, path...), node.Key...)
+		for _, child := range node.Children {
+			if err := t.iterate(child, childPath, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case NodeTypeBranch:
+		if node.Value != nil {
+			if err := fn(nibblesToHex(path), node.Value); err != nil {
+				return err
+			}
+		}
+
+		// Visit children in nibble order so iteration is deterministic
+		for nibble := 0; nibble < 16; nibble++ {
+			child, exists := node.Children[byte(nibble)]
+			if !exists {
+				continue
+			}
+			childPath := append(append([]byte{}, path...), byte(nibble))
+			if err := t.iterate(child, childPath, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown node type: %d", node.Type)
+	}
+}
+
+// resolve loads a child that was stored as a hash reference only
+func (t *Trie) resolve(node *Node) (*Node, error) {
+	if !isHashNode(node) {
+		return node, nil
+	}
+
+	return t.loadNode(node.Hash)
+}
+
+// isHashNode reports whether node is a reference to a stored node by hash
+func isHashNode(node *Node) bool {
+	return node.Key == nil && node.Value == nil && node.Children == nil && node.Hash != ([32]byte{})
+}
+
 // get retrieves value recursively
 func (t *Trie) get(node *Node, key []byte, depth int) ([]byte, error) {
 	if node == nil {
 		return nil, nil
 	}
-	
+
+	node, err := t.resolve(node)
+	if err != nil {
+		return nil, err
+	}
+
 	switch node.Type {
 	case NodeTypeLeaf:
 		if bytes.Equal(node.Key, key[depth:]) {
 			return node.Value, nil
 		}
 		return nil, nil
-		
+
 	case NodeTypeExtension:
 		if len(key) < depth+len(node.Key) {
 			return nil, nil
@@ -133,31 +218,31 @@ func (t *Trie) get(node *Node, key []byte, depth int) ([]byte, error) {
 		if !bytes.Equal(node.Key, key[depth:depth+len(node.Key)]) {
 			return nil, nil
 		}
-		
+
 		// Navigate to child
 		if len(node.Children) != 1 {
 			return nil, fmt.Errorf("extension node must have exactly one child")
 		}
-		
+
 		var child *Node
 		for _, c := range node.Children {
 			child = c
 			break
 		}
-		
+
 		return t.get(child, key, depth+len(node.Key))
-		
+
 	case NodeTypeBranch:
 		if depth >= len(key) {
 			// End of key, return value if exists
 			return node.Value, nil
 		}
-		
+
 		// Navigate to appropriate child
 		nextNibble := key[depth]
 		child := node.Children[nextNibble]
 		return t.get(child, key, depth+1)
-		
+
 	default:
 		return nil, fmt.Errorf("unknown node type: %d", node.Type)
 	}
@@ -174,12 +259,17 @@ func (t *Trie) update(node *Node, key []byte, depth int, value []byte) (*Node, e
 			Dirty: true,
 		}, nil
 	}
-	
+
+	node, err := t.resolve(node)
+	if err != nil {
+		return nil, err
+	}
+
 	switch node.Type {
 	case NodeTypeLeaf:
 		existingKey := node.Key
 		remainingKey := key[depth:]
-		
+
 		if bytes.Equal(existingKey, remainingKey) {
 			// Update existing leaf
 			newNode := t.copyNode(node)
@@ -187,17 +277,17 @@ func (t *Trie) update(node *Node, key []byte, depth int, value []byte) (*Node, e
 			newNode.Dirty = true
 			return newNode, nil
 		}
-		
+
 		// Split leaf node
 		commonPrefix := commonPrefixLength(existingKey, remainingKey)
-		
+
 		// Create branch node
 		branch := &Node{
 			Type:     NodeTypeBranch,
 			Children: make(map[byte]*Node),
 			Dirty:    true,
 		}
-		
+
 		// Add existing leaf
 		if commonPrefix < len(existingKey) {
 			existingLeaf := &Node{
@@ -210,7 +300,7 @@ func (t *Trie) update(node *Node, key []byte, depth int, value []byte) (*Node, e
 		} else {
 			branch.Value = node.Value
 		}
-		
+
 		// Add new value
 		if commonPrefix < len(remainingKey) {
 			newLeaf := &Node{
@@ -223,7 +313,7 @@ func (t *Trie) update(node *Node, key []byte, depth int, value []byte) (*Node, e
 		} else {
 			branch.Value = value
 		}
-		
+
 		// Add extension if needed
 		if commonPrefix > 0 {
 			extension := &Node{
@@ -234,15 +324,15 @@ func (t *Trie) update(node *Node, key []byte, depth int, value []byte) (*Node, e
 			}
 			return extension, nil
 		}
-		
+
 		return branch, nil
-		
+
 	case NodeTypeExtension:
 		extensionKey := node.Key
 		remainingKey := key[depth:]
-		
+
 		commonPrefix := commonPrefixLength(extensionKey, remainingKey)
-		
+
 		if commonPrefix == len(extensionKey) {
 			// Traverse through extension
 			var child *Node
@@ -250,32 +340,32 @@ func (t *Trie) update(node *Node, key []byte, depth int, value []byte) (*Node, e
 				child = c
 				break
 			}
-			
+
 			newChild, err := t.update(child, key, depth+len(extensionKey), value)
 			if err != nil {
 				return nil, err
 			}
-			
+
 			newNode := t.copyNode(node)
 			newNode.Children = map[byte]*Node{0: newChild}
 			newNode.Dirty = true
 			return newNode, nil
 		}
-		
+
 		// Split extension
 		branch := &Node{
 			Type:     NodeTypeBranch,
 			Children: make(map[byte]*Node),
 			Dirty:    true,
 		}
-		
+
 		// Add shortened extension or direct child
 		var child *Node
 		for _, c := range node.Children {
 			child = c
 			break
 		}
-		
+
 		if commonPrefix+1 < len(extensionKey) {
 			// Create new extension for remaining part
 			newExtension := &Node{
@@ -288,7 +378,7 @@ func (t *Trie) update(node *Node, key []byte, depth int, value []byte) (*Node, e
 		} else {
 			branch.Children[extensionKey[commonPrefix]] = child
 		}
-		
+
 		// Add new value
 		if commonPrefix+1 < len(remainingKey) {
 			newLeaf := &Node{
@@ -301,7 +391,7 @@ func (t *Trie) update(node *Node, key []byte, depth int, value []byte) (*Node, e
 		} else {
 			branch.Value = value
 		}
-		
+
 		// Add extension for common prefix if needed
 		if commonPrefix > 0 {
 			extension := &Node{
@@ -312,32 +402,32 @@ func (t *Trie) update(node *Node, key []byte, depth int, value []byte) (*Node, e
 			}
 			return extension, nil
 		}
-		
+
 		return branch, nil
-		
+
 	case NodeTypeBranch:
 		newNode := t.copyNode(node)
-		
+
 		if depth >= len(key) {
 			// Update branch value
 			newNode.Value = value
 			newNode.Dirty = true
 			return newNode, nil
 		}
-		
+
 		// Update child
 		nextNibble := key[depth]
 		child := newNode.Children[nextNibble]
-		
+
 		newChild, err := t.update(child, key, depth+1, value)
 		if err != nil {
 			return nil, err
 		}
-		
+
 		newNode.Children[nextNibble] = newChild
 		newNode.Dirty = true
 		return newNode, nil
-		
+
 	default:
 		return nil, fmt.Errorf("unknown node type: %d", node.Type)
 	}
@@ -348,14 +438,19 @@ func (t *Trie) delete(node *Node, key []byte, depth int) (*Node, error) {
 	if node == nil {
 		return nil, nil
 	}
-	
+
+	node, err := t.resolve(node)
+	if err != nil {
+		return nil, err
+	}
+
 	switch node.Type {
 	case NodeTypeLeaf:
 		if bytes.Equal(node.Key, key[depth:]) {
 			return nil, nil // Delete leaf
 		}
 		return node, nil // Key not found
-		
+
 	case NodeTypeExtension:
 		if len(key) < depth+len(node.Key) {
 			return node, nil
@@ -363,30 +458,30 @@ func (t *Trie) delete(node *Node, key []byte, depth int) (*Node, error) {
 		if !bytes.Equal(node.Key, key[depth:depth+len(node.Key)]) {
 			return node, nil
 		}
-		
+
 		var child *Node
 		for _, c := range node.Children {
 			child = c
 			break
 		}
-		
+
 		newChild, err := t.delete(child, key, depth+len(node.Key))
 		if err != nil {
 			return nil, err
 		}
-		
+
 		if newChild == nil {
 			return nil, nil // Delete extension
 		}
-		
+
 		newNode := t.copyNode(node)
 		newNode.Children = map[byte]*Node{0: newChild}
 		newNode.Dirty = true
 		return newNode, nil
-		
+
 	case NodeTypeBranch:
 		newNode := t.copyNode(node)
-		
+
 		if depth >= len(key) {
 			// Delete branch value
 			newNode.Value = nil
@@ -394,24 +489,24 @@ func (t *Trie) delete(node *Node, key []byte, depth int) (*Node, error) {
 			// Delete from child
 			nextNibble := key[depth]
 			child := newNode.Children[nextNibble]
-			
+
 			newChild, err := t.delete(child, key, depth+1)
 			if err != nil {
 				return nil, err
 			}
-			
+
 			if newChild == nil {
 				delete(newNode.Children, nextNibble)
 			} else {
 				newNode.Children[nextNibble] = newChild
 			}
 		}
-		
+
 		// Check if branch should be collapsed
 		if len(newNode.Children) == 0 && newNode.Value == nil {
 			return nil, nil
 		}
-		
+
 		if len(newNode.Children) == 1 && newNode.Value == nil {
 			// Convert to extension
 			var childKey byte
@@ -421,7 +516,7 @@ func (t *Trie) delete(node *Node, key []byte, depth int) (*Node, error) {
 				child = c
 				break
 			}
-			
+
 			extension := &Node{
 				Type:     NodeTypeExtension,
 				Key:      []byte{childKey},
@@ -430,62 +525,93 @@ func (t *Trie) delete(node *Node, key []byte, depth int) (*Node, error) {
 			}
 			return extension, nil
 		}
-		
+
 		newNode.Dirty = true
 		return newNode, nil
-		
+
 	default:
 		return nil, fmt.Errorf("unknown node type: %d", node.Type)
 	}
 }
 
-// commitNode commits a node and its children to database
-func (t *Trie) commitNode(node *Node) ([32]byte, error) {
+// Hash returns the root hash of the trie without writing anything to the
+// database, so it also works on a trie without one. An empty trie hashes to
+// zero.
+func (t *Trie) Hash() ([32]byte, error) {
+	if t.root == nil {
+		return [32]byte{}, nil
+	}
+
+	return t.commitNode(t.root, false)
+}
+
+// commitNode hashes a node and its children, storing them in the database
+// if store is set
+func (t *Trie) commitNode(node *Node, store bool) ([32]byte, error) {
 	if node == nil {
 		return [32]byte{}, nil
 	}
-	
-	// Commit children first
-	newChildren := make(map[byte]*Node)
-	for key, child := range node.Children {
-		childHash, err := t.commitNode(child)
-		if err != nil {
-			return [32]byte{}, err
-		}
-		
-		// Store child hash instead of full node
-		newChildren[key] = &Node{Hash: childHash}
-	}
-	
-	// Create node for serialization
-	serialNode := &Node{
-		Type:     node.Type,
-		Key:      node.Key,
-		Value:    node.Value,
-		Children: newChildren,
-	}
-	
-	// Serialize and hash node
-	data, err := json.Marshal(serialNode)
+
+	// A node that was never loaded or changed since is already stored under
+	// its hash, which may be of an older encoding
+	if isHashNode(node) || (!node.Dirty && node.Hash != ([32]byte{})) {
+		return node.Hash, nil
+	}
+
+	data, err := t.encodeNode(node, store)
 	if err != nil {
-		return [32]byte{}, fmt.Errorf("failed to marshal node: %v", err)
+		return [32]byte{}, err
 	}
-	
+
 	hash := crypto.Keccak256Hash(data)
-	
+	if !store {
+		return hash, nil
+	}
+
 	// Store in database
 	key := append([]byte("trie_"), hash[:]...)
 	if err := t.db.Put(key, data); err != nil {
 		return [32]byte{}, fmt.Errorf("failed to store node: %v", err)
 	}
-	
+
 	// Update node hash
 	node.Hash = hash
 	node.Dirty = false
-	
+
 	return hash, nil
 }
 
+// encodeNode serializes a node with its children replaced by their hashes,
+// committing the children first if store is set
+func (t *Trie) encodeNode(node *Node, store bool) ([]byte, error) {
+	children := make(map[byte][32]byte, len(node.Children))
+	for key, child := range node.Children {
+		childHash, err := t.commitNode(child, store)
+		if err != nil {
+			return nil, err
+		}
+		children[key] = childHash
+	}
+
+	return encodeNodeRLP(node, children)
+}
+
+// nodeEncoding returns the encoding a node is hashed with, the stored one
+// for a node that was loaded and not changed since
+func (t *Trie) nodeEncoding(node *Node) ([]byte, error) {
+	if !node.Dirty && node.Hash != ([32]byte{}) {
+		data, err := NodeData(t.db, node.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load node: %v", err)
+		}
+		if data != nil {
+			return data, nil
+		}
+	}
+
+	return t.encodeNode(node, false)
+}
+
 // loadNode loads a node from database
 func (t *Trie) loadNode(hash [32]byte) (*Node, error) {
 	key := append([]byte("trie_"), hash[:]...)
@@ -493,18 +619,41 @@ func (t *Trie) loadNode(hash [32]byte) (*Node, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load node: %v", err)
 	}
-	
+
 	if data == nil {
-		return nil, fmt.Errorf("node not found: %x", hash)
+		return nil, &MissingNodeError{Hash: hash}
 	}
-	
-	var node Node
-	if err := json.Unmarshal(data, &node); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal node: %v", err)
+
+	node, err := decodeNode(data)
+	if err != nil {
+		return nil, err
 	}
-	
+
 	node.Hash = hash
-	return &node, nil
+	return node, nil
+}
+
+// FetchNode retrieves a node missing from db with fetcher and stores it, so
+// tries find it from then on. A node that doesn't match its hash is
+// rejected.
+func FetchNode(db database.Database, fetcher NodeFetcher, hash [32]byte) error {
+	data, err := fetcher(hash)
+	if err != nil || data == nil || crypto.Keccak256Hash(data) != hash {
+		return &MissingNodeError{Hash: hash}
+	}
+
+	key := append([]byte("trie_"), hash[:]...)
+	if err := db.Put(key, data); err != nil {
+		return fmt.Errorf("failed to store node: %v", err)
+	}
+	return nil
+}
+
+// NodeData returns the encoding of the node with the given hash stored in
+// db, nil if there is none
+func NodeData(db database.Database, hash [32]byte) ([]byte, error) {
+	key := append([]byte("trie_"), hash[:]...)
+	return db.Get(key)
 }
 
 // copyNode creates a deep copy of a node
@@ -512,30 +661,30 @@ func (t *Trie) copyNode(node *Node) *Node {
 	if node == nil {
 		return nil
 	}
-	
+
 	newNode := &Node{
 		Type:  node.Type,
 		Hash:  node.Hash,
 		Dirty: node.Dirty,
 	}
-	
+
 	if node.Key != nil {
 		newNode.Key = make([]byte, len(node.Key))
 		copy(newNode.Key, node.Key)
 	}
-	
+
 	if node.Value != nil {
 		newNode.Value = make([]byte, len(node.Value))
 		copy(newNode.Value, node.Value)
 	}
-	
+
 	if node.Children != nil {
 		newNode.Children = make(map[byte]*Node)
 		for k, child := range node.Children {
 			newNode.Children[k] = child // Shallow copy for efficiency
 		}
 	}
-	
+
 	return newNode
 }
 
@@ -549,17 +698,25 @@ func hexToNibbles(hex []byte) []byte {
 	return nibbles
 }
 
+func nibblesToHex(nibbles []byte) []byte {
+	hex := make([]byte, len(nibbles)/2)
+	for i := range hex {
+		hex[i] = nibbles[i*2]*16 + nibbles[i*2+1]
+	}
+	return hex
+}
+
 func commonPrefixLength(a, b []byte) int {
 	minLen := len(a)
 	if len(b) < minLen {
 		minLen = len(b)
 	}
-	
+
 	for i := 0; i < minLen; i++ {
 		if a[i] != b[i] {
 			return i
 		}
 	}
-	
+
 	return minLen
 }
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// Hex decoding errors. Quantities and data follow the Ethereum JSON-RPC hex
+// encoding: a 0x prefix, quantities without leading zeros ("0x0" for zero),
+// data with two digits per byte.
+var (
+	ErrEmptyHex      = errors.New("empty hex string")
+	ErrMissingPrefix = errors.New("hex string without 0x prefix")
+	ErrEmptyNumber   = errors.New("hex string \"0x\"")
+	ErrLeadingZero   = errors.New("hex number with leading zero digits")
+	ErrOddLength     = errors.New("hex string of odd length")
+	ErrInvalidHex    = errors.New("invalid hex string")
+	ErrUint64Range   = errors.New("hex number > 64 bits")
+	ErrBig256Range   = errors.New("hex number > 256 bits")
+	ErrInvalidLength = errors.New("hex string has wrong length")
+)
+
+// Quantity is a number that can be hex encoded as a quantity
+type Quantity interface {
+	uint64 | *big.Int
+}
+
+// EncodeQuantity returns the hex quantity of value, e.g. 0x0 or 0x1b4. A nil
+// or negative big.Int is encoded as 0x0.
+func EncodeQuantity[T Quantity](value T) string {
+	switch v := any(value).(type) {
+	case uint64:
+		return "0x" + strconv.FormatUint(v, 16)
+	case *big.Int:
+		if v == nil || v.Sign() < 0 {
+			return "0x0"
+		}
+		return "0x" + v.Text(16)
+	}
+	return "0x0"
+}
+
+// DecodeQuantity decodes a hex quantity of at most 64 bits
+func DecodeQuantity(s string) (uint64, error) {
+	digits, err := quantityDigits(s)
+	if err != nil {
+		return 0, err
+	}
+	if len(digits) > 16 {
+		return 0, ErrUint64Range
+	}
+	value, err := strconv.ParseUint(digits, 16, 64)
+	if err != nil {
+		return 0, ErrInvalidHex
+	}
+	return value, nil
+}
+
+// DecodeBigQuantity decodes a hex quantity of at most 256 bits
+func DecodeBigQuantity(s string) (*big.Int, error) {
+	digits, err := quantityDigits(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(digits) > 64 {
+		return nil, ErrBig256Range
+	}
+	value, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return nil, ErrInvalidHex
+	}
+	return value, nil
+}
+
+// quantityDigits returns the digits of a hex quantity after checking the
+// prefix and leading zeros
+func quantityDigits(s string) (string, error) {
+	digits, err := stripPrefix(s)
+	if err != nil {
+		return "", err
+	}
+	if digits == "" {
+		return "", ErrEmptyNumber
+	}
+	if len(digits) > 1 && digits[0] == '0' {
+		return "", ErrLeadingZero
+	}
+	for _, c := range digits {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return "", ErrInvalidHex
+		}
+	}
+	return digits, nil
+}
+
+// DecodeBytes decodes 0x prefixed hex data. "0x" is empty data.
+func DecodeBytes(s string) ([]byte, error) {
+	digits, err := stripPrefix(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(digits)%2 == 1 {
+		return nil, ErrOddLength
+	}
+	data, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, ErrInvalidHex
+	}
+	return data, nil
+}
+
+// DecodeHash decodes a 0x prefixed 32 byte hash
+func DecodeHash(s string) ([32]byte, error) {
+	var hash [32]byte
+	return hash, decodeFixed(s, hash[:])
+}
+
+// DecodeAddress decodes a 0x prefixed 20 byte address. Mixed case checksums
+// are not verified.
+func DecodeAddress(s string) ([20]byte, error) {
+	var address [20]byte
+	return address, decodeFixed(s, address[:])
+}
+
+// decodeFixed decodes hex data of exactly len(out) bytes into out
+func decodeFixed(s string, out []byte) error {
+	data, err := DecodeBytes(s)
+	if err != nil {
+		return err
+	}
+	if len(data) != len(out) {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidLength, len(out), len(data))
+	}
+	copy(out, data)
+	return nil
+}
+
+func stripPrefix(s string) (string, error) {
+	if s == "" {
+		return "", ErrEmptyHex
+	}
+	if len(s) < 2 || s[0] != '0' || (s[1] != 'x' && s[1] != 'X') {
+		return "", ErrMissingPrefix
+	}
+	return s[2:], nil
+}
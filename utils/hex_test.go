@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestEncodeQuantity(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{EncodeQuantity(uint64(0)), "0x0"},
+		{EncodeQuantity(uint64(0x1b4)), "0x1b4"},
+		{EncodeQuantity(^uint64(0)), "0xffffffffffffffff"},
+		{EncodeQuantity(big.NewInt(0)), "0x0"},
+		{EncodeQuantity(new(big.Int).Lsh(big.NewInt(1), 64)), "0x10000000000000000"},
+		{EncodeQuantity((*big.Int)(nil)), "0x0"},
+		{EncodeQuantity(big.NewInt(-1)), "0x0"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("encoded as %s, expected %s", test.got, test.want)
+		}
+	}
+}
+
+func TestDecodeQuantity(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint64
+		err   error
+	}{
+		{"0x0", 0, nil},
+		{"0x1b4", 0x1b4, nil},
+		{"0X1B4", 0x1b4, nil},
+		{"0xffffffffffffffff", ^uint64(0), nil},
+		{"", 0, ErrEmptyHex},
+		{"1b4", 0, ErrMissingPrefix},
+		{"0x", 0, ErrEmptyNumber},
+		{"0x00", 0, ErrLeadingZero},
+		{"0x01b4", 0, ErrLeadingZero},
+		{"0x10000000000000000", 0, ErrUint64Range},
+		{"0xg", 0, ErrInvalidHex},
+	}
+	for _, test := range tests {
+		got, err := DecodeQuantity(test.input)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: error %v, expected %v", test.input, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: decoded %d, expected %d", test.input, got, test.want)
+		}
+	}
+}
+
+func TestDecodeBigQuantity(t *testing.T) {
+	max := "0x" + "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	got, err := DecodeBigQuantity(max)
+	if err != nil {
+		t.Fatalf("256 bit quantity rejected: %v", err)
+	}
+	if got.BitLen() != 256 {
+		t.Errorf("decoded %d bits, expected 256", got.BitLen())
+	}
+
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{"0x1" + max[2:], ErrBig256Range},
+		{"0x00", ErrLeadingZero},
+		{"0x", ErrEmptyNumber},
+	}
+	for _, test := range tests {
+		if _, err := DecodeBigQuantity(test.input); !errors.Is(err, test.err) {
+			t.Errorf("%q: error %v, expected %v", test.input, err, test.err)
+		}
+	}
+}
+
+func TestDecodeBytes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+		err   error
+	}{
+		{"0x", 0, nil},
+		{"0x00", 1, nil},
+		{"0x0001", 2, nil},
+		{"0x0", 0, ErrOddLength},
+		{"0x123", 0, ErrOddLength},
+		{"0xzz", 0, ErrInvalidHex},
+		{"0011", 0, ErrMissingPrefix},
+	}
+	for _, test := range tests {
+		got, err := DecodeBytes(test.input)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: error %v, expected %v", test.input, err, test.err)
+			continue
+		}
+		if len(got) != test.want {
+			t.Errorf("%q: decoded %d bytes, expected %d", test.input, len(got), test.want)
+		}
+	}
+}
+
+func TestDecodeAddressLength(t *testing.T) {
+	if _, err := DecodeAddress("0x742d35cc6635c0532925a3b8d5c6c1c8b1c5c6c7"); err != nil {
+		t.Errorf("valid address rejected: %v", err)
+	}
+	for _, input := range []string{"0x742d35cc6635c0532925a3b8d5c6c1c8b1c5c6", "0x742d35cc6635c0532925a3b8d5c6c1c8b1c5c6c700"} {
+		if _, err := DecodeAddress(input); !errors.Is(err, ErrInvalidLength) {
+			t.Errorf("%q: error %v, expected %v", input, err, ErrInvalidLength)
+		}
+	}
+	if _, err := DecodeHash("0x00"); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("short hash: error %v, expected %v", err, ErrInvalidLength)
+	}
+}
@@ -1,10 +1,10 @@
-
 package utils
 
 import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"runtime"
 	"strings"
 	"time"
@@ -103,8 +103,7 @@ func RetryWithBackoff(fn func() error, maxRetries int, baseDelay time.Duration)
 		if err := fn(); err != nil {
 			lastErr = err
 			if i < maxRetries-1 {
-				delay := baseDelay * time.Duration(1<<uint(i)) // Exponential backoff
-				time.Sleep(delay)
+				time.Sleep(BackoffDelay(i, baseDelay, 0))
 			}
 		} else {
 			return nil
@@ -113,6 +112,27 @@ func RetryWithBackoff(fn func() error, maxRetries int, baseDelay time.Duration)
 	return fmt.Errorf("operation failed after %d retries: %v", maxRetries, lastErr)
 }
 
+// BackoffDelay returns the exponential backoff delay before retry number
+// attempt, counted from 0: baseDelay doubled attempt times, capped at
+// maxDelay. A maxDelay of 0 or less means no cap.
+func BackoffDelay(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := 0; i < attempt; i++ {
+		if maxDelay > 0 && delay >= maxDelay {
+			break
+		}
+		if delay > math.MaxInt64/2 {
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
 // ToHex converts bytes to hex string with 0x prefix
 func ToHex(data []byte) string {
 	return "0x" + hex.EncodeToString(data)
@@ -0,0 +1,91 @@
+package validation
+
+import "errors"
+
+// Transaction validation errors
+var (
+	ErrNilTransaction     = errors.New("transaction is nil")
+	ErrTxDataTooLarge     = errors.New("transaction data too large")
+	ErrGasPriceTooLow     = errors.New("gas price too low")
+	ErrInvalidGasLimit    = errors.New("invalid gas limit")
+	ErrIntrinsicGas       = errors.New("intrinsic gas too low")
+	ErrInvalidValue       = errors.New("invalid transaction value")
+	ErrInvalidToAddress   = errors.New("invalid to address")
+	ErrMissingFrom        = errors.New("missing from address")
+	ErrInvalidFromAddress = errors.New("invalid from address")
+	ErrMissingSignature   = errors.New("missing signature components")
+	ErrTxEncoding         = errors.New("failed to serialize transaction")
+	ErrTxTooLarge         = errors.New("transaction size too large")
+	ErrInvalidSignature   = errors.New("invalid transaction signature")
+)
+
+// Block validation errors
+var (
+	ErrNilBlock            = errors.New("block is nil")
+	ErrNilHeader           = errors.New("block header is nil")
+	ErrBlockGasLimit       = errors.New("block gas limit too high")
+	ErrGasUsedExceedsLimit = errors.New("block gas used exceeds limit")
+	ErrFutureBlock         = errors.New("block timestamp too far in future")
+	ErrBlockEncoding       = errors.New("failed to serialize block")
+	ErrBlockTooLarge       = errors.New("block size too large")
+	ErrDuplicateTx         = errors.New("duplicate transaction in block")
+	ErrNonceOutOfOrder     = errors.New("transaction nonce out of order")
+	ErrGasUsedMismatch     = errors.New("block gas used mismatch")
+	ErrExtraDataTooLarge   = errors.New("block extra data too large")
+)
+
+// policyErrors are the errors caused by limits of this node rather than by
+// the transaction or block itself, which other nodes may accept. A future
+// block becomes valid once the clock catches up.
+var policyErrors = []error{
+	ErrTxDataTooLarge,
+	ErrGasPriceTooLow,
+	ErrInvalidGasLimit,
+	ErrTxTooLarge,
+	ErrBlockGasLimit,
+	ErrFutureBlock,
+	ErrBlockTooLarge,
+}
+
+// invalidErrors are the errors that make a transaction or block invalid on
+// every node
+var invalidErrors = []error{
+	ErrNilTransaction,
+	ErrIntrinsicGas,
+	ErrInvalidValue,
+	ErrInvalidToAddress,
+	ErrMissingFrom,
+	ErrInvalidFromAddress,
+	ErrMissingSignature,
+	ErrInvalidSignature,
+	ErrNilBlock,
+	ErrNilHeader,
+	ErrGasUsedExceedsLimit,
+	ErrDuplicateTx,
+	ErrNonceOutOfOrder,
+	ErrGasUsedMismatch,
+	ErrExtraDataTooLarge,
+}
+
+// IsPolicyError reports whether err is a rejection by the limits configured
+// on this node, such as the minimum gas price
+func IsPolicyError(err error) bool {
+	return matchesAny(err, policyErrors)
+}
+
+// IsInvalid reports whether err is a validation error that makes the
+// transaction or block invalid on every node, such as a bad signature. Peers
+// relaying such data are misbehaving, unlike peers whose data only fails the
+// policy of this node.
+func IsInvalid(err error) bool {
+	return matchesAny(err, invalidErrors)
+}
+
+func matchesAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package validation
+
+import "github.com/ethereum/go-ethereum/params"
+
+// IntrinsicGas returns the gas a transaction is charged before any code runs:
+// the base cost of a call or contract creation plus the cost of its calldata
+func IntrinsicGas(data []byte, isContractCreation bool) uint64 {
+	gas := params.TxGas
+	if isContractCreation {
+		gas = params.TxGasContractCreation
+	}
+	for _, b := range data {
+		if b == 0 {
+			gas += params.TxDataZeroGas
+		} else {
+			gas += params.TxDataNonZeroGasEIP2028
+		}
+	}
+	return gas
+}
@@ -1,9 +1,7 @@
-
 package validation
 
 import (
 	"blockchain-node/logger"
-	"errors"
 	"math/big"
 	"regexp"
 	"time"
@@ -11,17 +9,23 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 )
 
+var log = logger.Module("validation")
+
 type Validator struct {
-	maxTransactionSize  uint64
-	maxBlockSize        uint64
-	maxGasLimit         uint64
-	minGasPrice         *big.Int
-	addressRegex        *regexp.Regexp
+	maxTransactionSize uint64
+	maxTxDataSize      uint64
+	maxBlockSize       uint64
+	maxExtraDataSize   int
+	maxGasLimit        uint64
+	maxFutureDrift     time.Duration
+	minGasPrice        *big.Int
+	addressRegex       *regexp.Regexp
 }
 
 // Transaction interface for validation
 type Transaction interface {
 	GetHash() [32]byte
+	GetNonce() uint64
 	GetFrom() common.Address
 	GetTo() *common.Address
 	GetValue() *big.Int
@@ -42,6 +46,11 @@ type Block interface {
 	ToJSON() ([]byte, error)
 }
 
+// NonceReader provides the account nonces of the state a block builds on
+type NonceReader interface {
+	GetNonce(addr [20]byte) uint64
+}
+
 // BlockHeader interface for validation
 type BlockHeader interface {
 	GetNumber() uint64
@@ -50,150 +59,221 @@ type BlockHeader interface {
 	GetGasLimit() uint64
 	GetGasUsed() uint64
 	GetHash() [32]byte
+	GetExtraData() []byte
 }
 
 func NewValidator() *Validator {
 	return &Validator{
-		maxTransactionSize: 128 * 1024,      // 128 KB
-		maxBlockSize:       1024 * 1024,     // 1 MB
-		maxGasLimit:        10000000,        // 10M gas
+		maxTransactionSize: 128 * 1024,  // 128 KB
+		maxTxDataSize:      64 * 1024,   // 64 KB
+		maxBlockSize:       1024 * 1024, // 1 MB
+		maxExtraDataSize:   MaxExtraDataSize,
+		maxGasLimit:        10000000, // 10M gas
+		maxFutureDrift:     DefaultMaxFutureDrift,
 		minGasPrice:        big.NewInt(1000), // 1000 wei minimum
 		addressRegex:       regexp.MustCompile("^0x[a-fA-F0-9]{40}$"),
 	}
 }
 
+// MaxExtraDataSize is the maximum length of a block's extra data in bytes
+const MaxExtraDataSize = 32
+
+// DefaultMaxFutureDrift is how far ahead of the node's clock a block
+// timestamp may be unless configured otherwise
+const DefaultMaxFutureDrift = 15 * time.Minute
+
+// clockTolerance absorbs the rounding of block timestamps to whole seconds
+// when comparing them with the node's clock
+const clockTolerance = time.Second
+
+// SetMaxFutureDrift sets how far ahead of the node's clock a block timestamp
+// may be
+func (v *Validator) SetMaxFutureDrift(drift time.Duration) {
+	v.maxFutureDrift = drift
+}
+
+// SetMaxTxDataSize sets the maximum size in bytes of a transaction's data
+func (v *Validator) SetMaxTxDataSize(size uint64) {
+	v.maxTxDataSize = size
+}
+
 func (v *Validator) ValidateTransaction(tx Transaction) error {
 	if tx == nil {
-		return errors.New("transaction is nil")
+		return ErrNilTransaction
 	}
-	
+
+	// Check calldata size first, it's cheap and bounds the work below
+	if uint64(len(tx.GetData())) > v.maxTxDataSize {
+		log.Warningf("Transaction data too large: %d bytes", len(tx.GetData()))
+		return ErrTxDataTooLarge
+	}
+
 	// Validate gas price
 	gasPrice := tx.GetGasPrice()
 	if gasPrice == nil || gasPrice.Cmp(v.minGasPrice) < 0 {
-		logger.Warningf("Transaction gas price too low: %v", gasPrice)
-		return errors.New("gas price too low")
+		log.Warningf("Transaction gas price too low: %v", gasPrice)
+		return ErrGasPriceTooLow
 	}
-	
+
 	// Validate gas limit
 	gasLimit := tx.GetGasLimit()
 	if gasLimit == 0 || gasLimit > v.maxGasLimit {
-		logger.Warningf("Invalid gas limit: %d", gasLimit)
-		return errors.New("invalid gas limit")
+		log.Warningf("Invalid gas limit: %d", gasLimit)
+		return ErrInvalidGasLimit
+	}
+
+	// The gas limit must at least cover the intrinsic gas, otherwise the
+	// transaction can only fail at execution
+	if intrinsic := IntrinsicGas(tx.GetData(), tx.GetTo() == nil); gasLimit < intrinsic {
+		log.Warningf("Transaction gas limit %d below intrinsic gas %d", gasLimit, intrinsic)
+		return ErrIntrinsicGas
 	}
-	
+
 	// Validate value
 	value := tx.GetValue()
 	if value == nil || value.Sign() < 0 {
-		logger.Warningf("Invalid transaction value: %v", value)
-		return errors.New("invalid transaction value")
+		log.Warningf("Invalid transaction value: %v", value)
+		return ErrInvalidValue
 	}
-	
+
 	// Validate to address format if present
 	to := tx.GetTo()
 	if to != nil && !v.IsValidAddress(to.Hex()) {
-		logger.Warningf("Invalid to address: %s", to.Hex())
-		return errors.New("invalid to address")
+		log.Warningf("Invalid to address: %s", to.Hex())
+		return ErrInvalidToAddress
 	}
-	
+
 	// Validate from address
 	from := tx.GetFrom()
 	if from == (common.Address{}) {
-		logger.Warning("Transaction missing from address")
-		return errors.New("missing from address")
+		log.Warning("Transaction missing from address")
+		return ErrMissingFrom
 	}
-	
+
 	if !v.IsValidAddress(from.Hex()) {
-		logger.Warningf("Invalid from address: %s", from.Hex())
-		return errors.New("invalid from address")
+		log.Warningf("Invalid from address: %s", from.Hex())
+		return ErrInvalidFromAddress
 	}
-	
+
 	// Validate signature components
 	if tx.GetV() == nil || tx.GetR() == nil || tx.GetS() == nil {
-		logger.Warning("Transaction missing signature components")
-		return errors.New("missing signature components")
+		log.Warning("Transaction missing signature components")
+		return ErrMissingSignature
 	}
-	
+
 	// Validate transaction size
 	txData, err := tx.ToJSON()
 	if err != nil {
-		logger.Errorf("Failed to serialize transaction: %v", err)
-		return errors.New("failed to serialize transaction")
+		log.Errorf("Failed to serialize transaction: %v", err)
+		return ErrTxEncoding
 	}
-	
+
 	if uint64(len(txData)) > v.maxTransactionSize {
-		logger.Warningf("Transaction size too large: %d bytes", len(txData))
-		return errors.New("transaction size too large")
+		log.Warningf("Transaction size too large: %d bytes", len(txData))
+		return ErrTxTooLarge
 	}
-	
+
 	// Verify signature
 	if !tx.VerifySignature() {
-		logger.Warning("Invalid transaction signature")
-		return errors.New("invalid transaction signature")
+		log.Warning("Invalid transaction signature")
+		return ErrInvalidSignature
 	}
-	
-	logger.Debugf("Transaction validation passed: %x", tx.GetHash())
+
+	log.Debugf("Transaction validation passed: %x", tx.GetHash())
 	return nil
 }
 
-func (v *Validator) ValidateBlock(block Block) error {
+// ValidateBlock checks a block and its transactions. If state is not nil, the
+// first transaction of each sender must use the sender's nonce in state.
+func (v *Validator) ValidateBlock(block Block, state NonceReader) error {
 	if block == nil {
-		return errors.New("block is nil")
+		return ErrNilBlock
 	}
-	
+
 	header := block.GetHeader()
 	if header == nil {
-		return errors.New("block header is nil")
+		return ErrNilHeader
 	}
-	
+
 	// Validate block gas limit
 	if header.GetGasLimit() > v.maxGasLimit {
-		logger.Warningf("Block gas limit too high: %d", header.GetGasLimit())
-		return errors.New("block gas limit too high")
+		log.Warningf("Block gas limit too high: %d", header.GetGasLimit())
+		return ErrBlockGasLimit
 	}
-	
+
 	// Validate gas used doesn't exceed limit
 	if header.GetGasUsed() > header.GetGasLimit() {
-		logger.Warningf("Block gas used exceeds limit: %d > %d", header.GetGasUsed(), header.GetGasLimit())
-		return errors.New("block gas used exceeds limit")
+		log.Warningf("Block gas used exceeds limit: %d > %d", header.GetGasUsed(), header.GetGasLimit())
+		return ErrGasUsedExceedsLimit
+	}
+
+	if len(header.GetExtraData()) > v.maxExtraDataSize {
+		log.Warningf("Block extra data too large: %d bytes", len(header.GetExtraData()))
+		return ErrExtraDataTooLarge
 	}
-	
+
 	// Validate block timestamp (should not be too far in future)
-	// Allow up to 15 minutes in future
-	if header.GetTimestamp() > (getCurrentTimestamp() + 900) {
-		logger.Warningf("Block timestamp too far in future: %d", header.GetTimestamp())
-		return errors.New("block timestamp too far in future")
+	if !v.timestampAllowed(header.GetTimestamp(), time.Now()) {
+		log.Warningf("Block timestamp too far in future: %d (max drift %v)", header.GetTimestamp(), v.maxFutureDrift)
+		return ErrFutureBlock
 	}
-	
+
 	// Validate block size
 	blockData, err := block.ToJSON()
 	if err != nil {
-		logger.Errorf("Failed to serialize block: %v", err)
-		return errors.New("failed to serialize block")
+		log.Errorf("Failed to serialize block: %v", err)
+		return ErrBlockEncoding
 	}
-	
+
 	if uint64(len(blockData)) > v.maxBlockSize {
-		logger.Warningf("Block size too large: %d bytes", len(blockData))
-		return errors.New("block size too large")
+		log.Warningf("Block size too large: %d bytes", len(blockData))
+		return ErrBlockTooLarge
 	}
-	
+
 	// Validate all transactions in block
-	totalGasUsed := uint64(0)
+	intrinsicGas := uint64(0)
 	transactions := block.GetValidationTransactions()
+	seen := make(map[[32]byte]bool, len(transactions))
+	nextNonce := make(map[common.Address]uint64)
 	for i, tx := range transactions {
 		if err := v.ValidateTransaction(tx); err != nil {
-			logger.Errorf("Invalid transaction %d in block: %v", i, err)
+			log.Errorf("Invalid transaction %d in block: %v", i, err)
 			return err
 		}
-		totalGasUsed += tx.GetGasLimit()
+
+		hash := tx.GetHash()
+		if seen[hash] {
+			log.Warningf("Duplicate transaction %x in block", hash)
+			return ErrDuplicateTx
+		}
+		seen[hash] = true
+
+		// Nonces of a sender must be contiguous, starting at its state nonce
+		from := tx.GetFrom()
+		expected, exists := nextNonce[from]
+		if !exists {
+			expected = tx.GetNonce()
+			if state != nil {
+				expected = state.GetNonce(from)
+			}
+		}
+		if tx.GetNonce() != expected {
+			log.Warningf("Transaction %d from %s has nonce %d, expected %d", i, from.Hex(), tx.GetNonce(), expected)
+			return ErrNonceOutOfOrder
+		}
+		nextNonce[from] = expected + 1
+
+		intrinsicGas += IntrinsicGas(tx.GetData(), tx.GetTo() == nil)
 	}
-	
-	// Check if calculated gas matches header
-	if totalGasUsed != header.GetGasUsed() {
-		logger.Warningf("Block gas used mismatch: calculated %d, header %d", totalGasUsed, header.GetGasUsed())
-		return errors.New("block gas used mismatch")
+
+	// The exact gas used is only known after execution, the transactions
+	// use at least their intrinsic gas though
+	if header.GetGasUsed() < intrinsicGas {
+		log.Warningf("Block gas used mismatch: intrinsic gas %d, header %d", intrinsicGas, header.GetGasUsed())
+		return ErrGasUsedMismatch
 	}
-	
-	logger.Debugf("Block validation passed: %x", header.GetHash())
+
+	log.Debugf("Block validation passed: %x", header.GetHash())
 	return nil
 }
 
@@ -209,6 +289,9 @@ func (v *Validator) ValidateGasLimit(gasLimit uint64) bool {
 	return gasLimit > 0 && gasLimit <= v.maxGasLimit
 }
 
-func getCurrentTimestamp() int64 {
-	return time.Now().Unix()
+// timestampAllowed reports whether a block timestamp is at most the maximum
+// drift ahead of now
+func (v *Validator) timestampAllowed(timestamp int64, now time.Time) bool {
+	latest := now.Add(v.maxFutureDrift + clockTolerance)
+	return time.Unix(timestamp, 0).Before(latest)
 }
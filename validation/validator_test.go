@@ -0,0 +1,288 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type testTx struct {
+	hash  [32]byte
+	nonce uint64
+	from  common.Address
+	to    common.Address
+	data  []byte
+	gas   uint64 // gas limit, 0 for the intrinsic gas
+}
+
+func (tx *testTx) GetHash() [32]byte       { return tx.hash }
+func (tx *testTx) GetNonce() uint64        { return tx.nonce }
+func (tx *testTx) GetFrom() common.Address { return tx.from }
+func (tx *testTx) GetTo() *common.Address  { return &tx.to }
+func (tx *testTx) GetValue() *big.Int      { return big.NewInt(0) }
+func (tx *testTx) GetGasPrice() *big.Int   { return big.NewInt(1000) }
+func (tx *testTx) GetGasLimit() uint64 {
+	if tx.gas != 0 {
+		return tx.gas
+	}
+	return IntrinsicGas(tx.data, false)
+}
+func (tx *testTx) GetData() []byte         { return tx.data }
+func (tx *testTx) GetV() *big.Int          { return big.NewInt(27) }
+func (tx *testTx) GetR() *big.Int          { return big.NewInt(1) }
+func (tx *testTx) GetS() *big.Int          { return big.NewInt(1) }
+func (tx *testTx) VerifySignature() bool   { return true }
+func (tx *testTx) ToJSON() ([]byte, error) { return json.Marshal(tx.nonce) }
+
+type testHeader struct {
+	gasUsed   uint64
+	extraData []byte
+}
+
+func (h *testHeader) GetNumber() uint64       { return 1 }
+func (h *testHeader) GetParentHash() [32]byte { return [32]byte{} }
+func (h *testHeader) GetTimestamp() int64     { return time.Now().Unix() }
+func (h *testHeader) GetGasLimit() uint64     { return 8000000 }
+func (h *testHeader) GetGasUsed() uint64      { return h.gasUsed }
+func (h *testHeader) GetHash() [32]byte       { return [32]byte{1} }
+func (h *testHeader) GetExtraData() []byte    { return h.extraData }
+
+type testBlock struct {
+	txs       []Transaction
+	extraData []byte
+}
+
+func (b *testBlock) GetHeader() BlockHeader {
+	return &testHeader{gasUsed: uint64(len(b.txs)) * 21000, extraData: b.extraData}
+}
+func (b *testBlock) GetValidationTransactions() []Transaction { return b.txs }
+func (b *testBlock) ToJSON() ([]byte, error)                  { return []byte("{}"), nil }
+
+type testNonces map[[20]byte]uint64
+
+func (n testNonces) GetNonce(addr [20]byte) uint64 { return n[addr] }
+
+var (
+	alice = common.Address{0xa1}
+	bob   = common.Address{0xb0}
+)
+
+// newTestTx returns a transaction of from with nonce and a hash unique to both
+func newTestTx(from common.Address, nonce uint64) *testTx {
+	hash := [32]byte{from[0], byte(nonce)}
+	return &testTx{hash: hash, nonce: nonce, from: from, to: common.Address{0x01}}
+}
+
+func block(txs ...*testTx) *testBlock {
+	b := &testBlock{}
+	for _, tx := range txs {
+		b.txs = append(b.txs, tx)
+	}
+	return b
+}
+
+func TestValidateBlockContiguousNonces(t *testing.T) {
+	v := NewValidator()
+	state := testNonces{alice: 3}
+
+	b := block(newTestTx(alice, 3), newTestTx(bob, 0), newTestTx(alice, 4), newTestTx(alice, 5))
+	if err := v.ValidateBlock(b, state); err != nil {
+		t.Fatalf("valid block rejected: %v", err)
+	}
+}
+
+func TestValidateBlockDuplicateTransaction(t *testing.T) {
+	v := NewValidator()
+	tx := newTestTx(alice, 0)
+
+	err := v.ValidateBlock(block(tx, newTestTx(alice, 1), tx), testNonces{})
+	if !errors.Is(err, ErrDuplicateTx) {
+		t.Fatalf("expected ErrDuplicateTx, got %v", err)
+	}
+}
+
+func TestValidateBlockNonceOrder(t *testing.T) {
+	v := NewValidator()
+	state := testNonces{alice: 3}
+
+	tests := []struct {
+		name string
+		txs  []*testTx
+	}{
+		{"swapped", []*testTx{newTestTx(alice, 4), newTestTx(alice, 3)}},
+		{"gap", []*testTx{newTestTx(alice, 3), newTestTx(alice, 5)}},
+		{"repeated nonce", []*testTx{newTestTx(alice, 3), {hash: [32]byte{0xff}, nonce: 3, from: alice, to: common.Address{0x01}}}},
+		{"behind state", []*testTx{newTestTx(alice, 2)}},
+		{"ahead of state", []*testTx{newTestTx(alice, 4)}},
+	}
+	for _, test := range tests {
+		err := v.ValidateBlock(block(test.txs...), state)
+		if !errors.Is(err, ErrNonceOutOfOrder) {
+			t.Errorf("%s: expected ErrNonceOutOfOrder, got %v", test.name, err)
+		}
+	}
+}
+
+func TestValidateBlockExtraData(t *testing.T) {
+	v := NewValidator()
+
+	b := block()
+	b.extraData = make([]byte, MaxExtraDataSize)
+	if err := v.ValidateBlock(b, testNonces{}); err != nil {
+		t.Fatalf("block with %d bytes of extra data rejected: %v", MaxExtraDataSize, err)
+	}
+
+	b.extraData = make([]byte, MaxExtraDataSize+1)
+	if err := v.ValidateBlock(b, testNonces{}); !errors.Is(err, ErrExtraDataTooLarge) {
+		t.Errorf("expected ErrExtraDataTooLarge, got %v", err)
+	}
+}
+
+func TestValidateTransactionDataSize(t *testing.T) {
+	v := NewValidator()
+	v.SetMaxTxDataSize(100)
+
+	tx := newTestTx(alice, 0)
+	tx.data = make([]byte, 10)
+	if err := v.ValidateTransaction(tx); err != nil {
+		t.Fatalf("transaction with 10 bytes of data rejected: %v", err)
+	}
+
+	tx.data = make([]byte, 101)
+	if err := v.ValidateTransaction(tx); !errors.Is(err, ErrTxDataTooLarge) {
+		t.Errorf("expected ErrTxDataTooLarge, got %v", err)
+	}
+}
+
+func TestValidateBlockGasUsed(t *testing.T) {
+	v := NewValidator()
+
+	// The gas used of the test block covers plain transfers only
+	tx := newTestTx(alice, 0)
+	tx.data = []byte{1}
+	if err := v.ValidateBlock(block(tx), testNonces{}); !errors.Is(err, ErrGasUsedMismatch) {
+		t.Errorf("gas used below the intrinsic gas: expected ErrGasUsedMismatch, got %v", err)
+	}
+}
+
+func TestTimestampDrift(t *testing.T) {
+	v := NewValidator()
+	v.SetMaxFutureDrift(30 * time.Second)
+	now := time.Now()
+
+	tests := []struct {
+		offset  time.Duration
+		allowed bool
+	}{
+		{-time.Hour, true},
+		{0, true},
+		{30 * time.Second, true},
+		{time.Minute, false},
+		{DefaultMaxFutureDrift, false},
+	}
+	for _, test := range tests {
+		if allowed := v.timestampAllowed(now.Add(test.offset).Unix(), now); allowed != test.allowed {
+			t.Errorf("timestamp %v from now allowed %v, expected %v", test.offset, allowed, test.allowed)
+		}
+	}
+}
+
+func TestIntrinsicGas(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		creation bool
+		want     uint64
+	}{
+		{nil, false, 21000},
+		{[]byte{0, 1}, false, 21000 + 4 + 16},
+		{nil, true, 53000},
+	}
+	for _, test := range tests {
+		if gas := IntrinsicGas(test.data, test.creation); gas != test.want {
+			t.Errorf("intrinsic gas of %x (creation %v) is %d, expected %d", test.data, test.creation, gas, test.want)
+		}
+	}
+
+	v := NewValidator()
+	tx := newTestTx(alice, 0)
+	tx.data = []byte{0, 1}
+	tx.gas = 21020
+	if err := v.ValidateTransaction(tx); err != nil {
+		t.Errorf("transaction with exactly the intrinsic gas rejected: %v", err)
+	}
+	tx.gas = 21019
+	if err := v.ValidateTransaction(tx); !errors.Is(err, ErrIntrinsicGas) {
+		t.Errorf("transaction below the intrinsic gas: error %v, expected %v", err, ErrIntrinsicGas)
+	}
+}
+
+// faultyTx is a test transaction with the fields that fail validation
+// overridden
+type faultyTx struct {
+	*testTx
+	gasPrice     *big.Int
+	value        *big.Int
+	unsigned     bool
+	badSignature bool
+}
+
+func (tx *faultyTx) GetGasPrice() *big.Int {
+	if tx.gasPrice != nil {
+		return tx.gasPrice
+	}
+	return tx.testTx.GetGasPrice()
+}
+
+func (tx *faultyTx) GetValue() *big.Int {
+	if tx.value != nil {
+		return tx.value
+	}
+	return tx.testTx.GetValue()
+}
+
+func (tx *faultyTx) GetV() *big.Int {
+	if tx.unsigned {
+		return nil
+	}
+	return tx.testTx.GetV()
+}
+
+func (tx *faultyTx) VerifySignature() bool { return !tx.badSignature }
+
+func TestValidateTransactionErrors(t *testing.T) {
+	v := NewValidator()
+	tests := []struct {
+		name string
+		tx   *faultyTx
+		err  error
+	}{
+		{"valid", &faultyTx{testTx: newTestTx(alice, 0)}, nil},
+		{"low gas price", &faultyTx{testTx: newTestTx(alice, 0), gasPrice: big.NewInt(1)}, ErrGasPriceTooLow},
+		{"gas limit above maximum", &faultyTx{testTx: &testTx{from: alice, gas: 20000000}}, ErrInvalidGasLimit},
+		{"gas limit below intrinsic gas", &faultyTx{testTx: &testTx{from: alice, gas: 20000}}, ErrIntrinsicGas},
+		{"negative value", &faultyTx{testTx: newTestTx(alice, 0), value: big.NewInt(-1)}, ErrInvalidValue},
+		{"missing sender", &faultyTx{testTx: newTestTx(common.Address{}, 0)}, ErrMissingFrom},
+		{"missing signature", &faultyTx{testTx: newTestTx(alice, 0), unsigned: true}, ErrMissingSignature},
+		{"invalid signature", &faultyTx{testTx: newTestTx(alice, 0), badSignature: true}, ErrInvalidSignature},
+	}
+	for _, test := range tests {
+		err := v.ValidateTransaction(test.tx)
+		if err != test.err {
+			t.Errorf("%s: error %v, expected %v", test.name, err, test.err)
+		}
+		if err != nil && IsInvalid(err) == IsPolicyError(err) {
+			t.Errorf("%s: error %v is not classified as either invalid or policy", test.name, err)
+		}
+	}
+
+	if err := v.ValidateTransaction(nil); err != ErrNilTransaction {
+		t.Errorf("nil transaction: error %v, expected %v", err, ErrNilTransaction)
+	}
+	if !IsPolicyError(ErrGasPriceTooLow) || IsInvalid(ErrGasPriceTooLow) {
+		t.Error("a low gas price makes the transaction invalid on every node")
+	}
+}
@@ -0,0 +1,54 @@
+// Package version reports the version of the node software. The version is
+// set at build time:
+//
+//	go build -ldflags "-X blockchain-node/version.Version=1.2.0"
+//
+// Builds without it fall back to the module version and VCS revision the Go
+// toolchain records.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// ClientName is the name of the node software
+const ClientName = "blockchain-node"
+
+// Version is the release version, set with -ldflags at build time
+var Version = ""
+
+// Get returns the release version, or the build metadata recorded by the Go
+// toolchain if none was set. Unknown versions are "unknown".
+func Get() string {
+	if Version != "" {
+		return Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 8 {
+			return "dev-" + setting.Value[:8]
+		}
+	}
+	return "unknown"
+}
+
+// ClientVersion returns the full client version string, the client name and
+// version followed by the chain name if one is set, the platform and the Go
+// version, e.g. blockchain-node/1.2.0/forge-devnet/linux-amd64/go1.21.5
+func ClientVersion(chainName string) string {
+	parts := []string{ClientName, Get()}
+	if chainName != "" {
+		parts = append(parts, chainName)
+	}
+	parts = append(parts, runtime.GOOS+"-"+runtime.GOARCH, runtime.Version())
+	return strings.Join(parts, "/")
+}
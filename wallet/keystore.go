@@ -0,0 +1,430 @@
+package wallet
+
+import (
+	"blockchain-node/core"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Scrypt parameters used to derive the key file encryption key
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+
+	keyFileVersion = 1
+)
+
+// encryptedKey is the on-disk format of a key file in the wallet directory
+type encryptedKey struct {
+	Address    string `json:"address"`
+	Ciphertext string `json:"ciphertext"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Scheme     string `json:"scheme,omitempty"`
+	Version    int    `json:"version"`
+}
+
+type unlockedKey struct {
+	wallet *Wallet
+	timer  *time.Timer
+}
+
+// KeyStore manages the encrypted key files of a wallet directory and keeps
+// decrypted keys in memory only while their account is unlocked.
+type KeyStore struct {
+	dir      string
+	keys     map[[20]byte]*encryptedKey
+	files    map[[20]byte]string // key file path of each account
+	unlocked map[[20]byte]*unlockedKey
+	mu       sync.RWMutex
+}
+
+// NewKeyStore creates a key store backed by the given wallet directory
+func NewKeyStore(dir string) *KeyStore {
+	return &KeyStore{
+		dir:      dir,
+		keys:     make(map[[20]byte]*encryptedKey),
+		files:    make(map[[20]byte]string),
+		unlocked: make(map[[20]byte]*unlockedKey),
+	}
+}
+
+// Load reads every key file found in the wallet directory
+func (ks *KeyStore) Load() error {
+	if ks.dir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read wallet directory: %v", err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(ks.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read key file %s: %v", entry.Name(), err)
+		}
+
+		var key encryptedKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return fmt.Errorf("failed to parse key file %s: %v", entry.Name(), err)
+		}
+
+		// Key files without a scheme were written before it was recorded
+		if key.Scheme == "" {
+			key.Scheme = SchemeP256
+		}
+		if err := ValidateScheme(key.Scheme); err != nil {
+			return fmt.Errorf("invalid key file %s: %v", entry.Name(), err)
+		}
+
+		address, err := parseAddress(key.Address)
+		if err != nil {
+			return fmt.Errorf("invalid address in key file %s: %v", entry.Name(), err)
+		}
+
+		ks.keys[address] = &key
+		ks.files[address] = path
+	}
+
+	return nil
+}
+
+// StoreKey encrypts the wallet's private key with the password and writes it
+// to the wallet directory, returning the path of the new key file.
+func (ks *KeyStore) StoreKey(w *Wallet, password string) (string, error) {
+	key, err := encryptKey(w, password)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode key file: %v", err)
+	}
+
+	if err := os.MkdirAll(ks.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create wallet directory: %v", err)
+	}
+	path := filepath.Join(ks.dir, w.GetAddress()+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write key file: %v", err)
+	}
+
+	ks.mu.Lock()
+	ks.keys[w.GetAddressBytes()] = key
+	ks.files[w.GetAddressBytes()] = path
+	ks.mu.Unlock()
+
+	return path, nil
+}
+
+// Accounts returns the addresses of all known key files, sorted
+func (ks *KeyStore) Accounts() [][20]byte {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	accounts := make([][20]byte, 0, len(ks.keys))
+	for address := range ks.keys {
+		accounts = append(accounts, address)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i][:], accounts[j][:]) < 0
+	})
+	return accounts
+}
+
+// Delete removes the key file of address once the password decrypts it, and
+// locks the account. The key is gone for good unless it was backed up.
+func (ks *KeyStore) Delete(address [20]byte, password string) error {
+	ks.mu.RLock()
+	key, exists := ks.keys[address]
+	ks.mu.RUnlock()
+	if !exists {
+		return ErrUnknownAccount
+	}
+	if _, err := decryptKey(key, password); err != nil {
+		return err
+	}
+
+	// The key may have been deleted while decrypting it
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.keys[address] != key {
+		return ErrUnknownAccount
+	}
+
+	if err := os.Remove(ks.files[address]); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove key file: %v", err)
+	}
+
+	if unlocked, exists := ks.unlocked[address]; exists {
+		if unlocked.timer != nil {
+			unlocked.timer.Stop()
+		}
+		delete(ks.unlocked, address)
+	}
+	delete(ks.keys, address)
+	delete(ks.files, address)
+	return nil
+}
+
+// HasAccount reports whether a key file exists for the address
+func (ks *KeyStore) HasAccount(address [20]byte) bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	_, exists := ks.keys[address]
+	return exists
+}
+
+// Unlock decrypts the key for address and keeps it available for signing.
+// A positive duration relocks the account automatically once it elapses;
+// zero keeps it unlocked until Lock is called.
+func (ks *KeyStore) Unlock(address [20]byte, password string, duration time.Duration) error {
+	ks.mu.RLock()
+	key, exists := ks.keys[address]
+	ks.mu.RUnlock()
+	if !exists {
+		return ErrUnknownAccount
+	}
+
+	// Deriving the key takes a while, don't block other accounts meanwhile
+	w, err := decryptKey(key, password)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.keys[address] != key {
+		return ErrUnknownAccount
+	}
+
+	if previous, exists := ks.unlocked[address]; exists && previous.timer != nil {
+		previous.timer.Stop()
+	}
+
+	unlocked := &unlockedKey{wallet: w}
+	if duration > 0 {
+		unlocked.timer = time.AfterFunc(duration, func() {
+			ks.expire(address, unlocked)
+		})
+	}
+	ks.unlocked[address] = unlocked
+
+	return nil
+}
+
+// Lock removes the decrypted key for address from memory
+func (ks *KeyStore) Lock(address [20]byte) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, exists := ks.keys[address]; !exists {
+		return ErrUnknownAccount
+	}
+
+	if unlocked, exists := ks.unlocked[address]; exists {
+		if unlocked.timer != nil {
+			unlocked.timer.Stop()
+		}
+		delete(ks.unlocked, address)
+	}
+
+	return nil
+}
+
+// IsUnlocked reports whether the account can currently sign
+func (ks *KeyStore) IsUnlocked(address [20]byte) bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	_, exists := ks.unlocked[address]
+	return exists
+}
+
+// SignData signs data with the key of an unlocked account
+func (ks *KeyStore) SignData(address [20]byte, data []byte) ([]byte, error) {
+	w, err := ks.unlockedWallet(address)
+	if err != nil {
+		return nil, err
+	}
+	return w.SignData(data)
+}
+
+// SignTransaction signs the transaction with the key of an unlocked account
+func (ks *KeyStore) SignTransaction(address [20]byte, tx *core.Transaction, chainID uint64) error {
+	w, err := ks.unlockedWallet(address)
+	if err != nil {
+		return err
+	}
+	return w.SignTransaction(tx, chainID)
+}
+
+func (ks *KeyStore) unlockedWallet(address [20]byte) (*Wallet, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if _, exists := ks.keys[address]; !exists {
+		return nil, ErrUnknownAccount
+	}
+
+	unlocked, exists := ks.unlocked[address]
+	if !exists {
+		return nil, ErrAccountLocked
+	}
+	return unlocked.wallet, nil
+}
+
+// Migrate decrypts the key of a legacy P256 account and reports its address
+// under the secp256k1 scheme. The key file is left as it is.
+func (ks *KeyStore) Migrate(address [20]byte, password string) (*Migration, error) {
+	ks.mu.RLock()
+	key, exists := ks.keys[address]
+	ks.mu.RUnlock()
+	if !exists {
+		return nil, ErrUnknownAccount
+	}
+
+	w, err := decryptKey(key, password)
+	if err != nil {
+		return nil, err
+	}
+	return MigrateLegacyWallet(w)
+}
+
+// expire relocks the account unless it was unlocked again in the meantime
+func (ks *KeyStore) expire(address [20]byte, unlocked *unlockedKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if ks.unlocked[address] == unlocked {
+		delete(ks.unlocked, address)
+	}
+}
+
+func encryptKey(w *Wallet, password string) (*encryptedKey, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	gcm, err := newKeyCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	plaintext, err := hex.DecodeString(w.GetPrivateKeyHex())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %v", err)
+	}
+
+	return &encryptedKey{
+		Address:    "0x" + w.GetAddress(),
+		Ciphertext: hex.EncodeToString(gcm.Seal(nil, nonce, plaintext, nil)),
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Scheme:     w.Scheme(),
+		Version:    keyFileVersion,
+	}, nil
+}
+
+func decryptKey(key *encryptedKey, password string) (*Wallet, error) {
+	if key.Scheme != SchemeP256 {
+		return nil, ErrUnsupportedScheme
+	}
+
+	salt, err := hex.DecodeString(key.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file salt: %v", err)
+	}
+	nonce, err := hex.DecodeString(key.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file nonce: %v", err)
+	}
+	ciphertext, err := hex.DecodeString(key.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file ciphertext: %v", err)
+	}
+
+	gcm, err := newKeyCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid key file nonce length")
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalidPassword
+	}
+
+	return NewWalletFromPrivateKey(hex.EncodeToString(plaintext))
+}
+
+func newKeyCipher(password string, salt []byte) (cipher.AEAD, error) {
+	derivedKey, err := scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func parseAddress(address string) ([20]byte, error) {
+	var result [20]byte
+
+	address = strings.TrimPrefix(strings.TrimSpace(address), "0x")
+	decoded, err := hex.DecodeString(address)
+	if err != nil {
+		return result, err
+	}
+	if len(decoded) != 20 {
+		return result, fmt.Errorf("expected 20 bytes, got %d", len(decoded))
+	}
+
+	copy(result[:], decoded)
+	return result, nil
+}
+
+// Key store errors
+var (
+	ErrUnknownAccount  = errors.New("unknown account")
+	ErrAccountLocked   = errors.New("account is locked")
+	ErrInvalidPassword = errors.New("could not decrypt key with given password")
+)
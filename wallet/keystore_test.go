@@ -0,0 +1,75 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestKeyStore returns a key store in a temporary directory holding one
+// new account with the password "password"
+func newTestKeyStore(t *testing.T) (*KeyStore, [20]byte) {
+	t.Helper()
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := NewKeyStore(t.TempDir())
+	if _, err := ks.StoreKey(w, "password"); err != nil {
+		t.Fatal(err)
+	}
+	return ks, w.GetAddressBytes()
+}
+
+func TestUnlockLock(t *testing.T) {
+	ks, address := newTestKeyStore(t)
+
+	if _, err := ks.SignData(address, []byte("data")); err != ErrAccountLocked {
+		t.Fatalf("signing with a locked account: error %v, expected %v", err, ErrAccountLocked)
+	}
+	if err := ks.Unlock(address, "wrong", 0); err != ErrInvalidPassword {
+		t.Fatalf("unlocking with a wrong password: error %v, expected %v", err, ErrInvalidPassword)
+	}
+	if err := ks.Unlock(address, "password", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.SignData(address, []byte("data")); err != nil {
+		t.Fatalf("signing with an unlocked account failed: %v", err)
+	}
+
+	if err := ks.Lock(address); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.SignData(address, []byte("data")); err != ErrAccountLocked {
+		t.Errorf("signing after locking: error %v, expected %v", err, ErrAccountLocked)
+	}
+}
+
+func TestUnlockDuration(t *testing.T) {
+	ks, address := newTestKeyStore(t)
+
+	if err := ks.Unlock(address, "password", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if !ks.IsUnlocked(address) {
+		t.Fatal("account locked right after unlocking")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ks.IsUnlocked(address) {
+		if time.Now().After(deadline) {
+			t.Fatal("account not relocked after the duration")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUnlockDeletedAccount(t *testing.T) {
+	ks, address := newTestKeyStore(t)
+
+	if err := ks.Delete(address, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock(address, "password", 0); err != ErrUnknownAccount {
+		t.Errorf("unlocking a deleted account: error %v, expected %v", err, ErrUnknownAccount)
+	}
+}
@@ -0,0 +1,98 @@
+package wallet
+
+import (
+	"blockchain-node/crypto"
+	"errors"
+	"fmt"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// Address derivation schemes. Keys of this node are on the P256 curve, while
+// Ethereum derives addresses from secp256k1 keys, so the same private key has
+// a different address under each scheme. Key files written before the scheme
+// was recorded are P256 keys.
+const (
+	SchemeP256      = "p256"
+	SchemeSecp256k1 = "secp256k1"
+)
+
+// Derivation scheme errors
+var (
+	ErrMissingScheme     = errors.New("key derivation scheme not specified")
+	ErrUnknownScheme     = errors.New("unknown key derivation scheme")
+	ErrUnsupportedScheme = errors.New("secp256k1 keys cannot sign on this node yet")
+)
+
+// ValidateScheme checks that scheme names a known derivation scheme
+func ValidateScheme(scheme string) error {
+	switch scheme {
+	case SchemeP256, SchemeSecp256k1:
+		return nil
+	case "":
+		return ErrMissingScheme
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownScheme, scheme)
+	}
+}
+
+// DeriveAddress returns the address of a 32 byte private key under scheme
+func DeriveAddress(privateKey []byte, scheme string) ([20]byte, error) {
+	if err := ValidateScheme(scheme); err != nil {
+		return [20]byte{}, err
+	}
+
+	if scheme == SchemeSecp256k1 {
+		key, err := ethcrypto.ToECDSA(privateKey)
+		if err != nil {
+			return [20]byte{}, fmt.Errorf("invalid secp256k1 private key: %v", err)
+		}
+		return ethcrypto.PubkeyToAddress(key.PublicKey), nil
+	}
+
+	key, err := crypto.ToECDSA(privateKey)
+	if err != nil {
+		return [20]byte{}, fmt.Errorf("invalid p256 private key: %v", err)
+	}
+	return crypto.PubkeyToAddress(&key.PublicKey), nil
+}
+
+// ImportWallet creates a wallet from a hex private key of the given scheme.
+// The scheme must be given explicitly, the address of a key can't be told
+// from the key alone. Only P256 keys can be imported until the node signs
+// with secp256k1.
+func ImportWallet(privateKeyHex, scheme string) (*Wallet, error) {
+	if err := ValidateScheme(scheme); err != nil {
+		return nil, err
+	}
+	if scheme != SchemeP256 {
+		return nil, ErrUnsupportedScheme
+	}
+	return NewWalletFromPrivateKey(privateKeyHex)
+}
+
+// Migration reports the address a legacy P256 wallet's key has under the
+// secp256k1 scheme. Funds are not moved, they stay at the old address until
+// sent to the new one.
+type Migration struct {
+	OldAddress [20]byte
+	NewAddress [20]byte
+}
+
+// MigrateLegacyWallet re-derives the address of a P256 wallet's private key
+// under the secp256k1 scheme
+func MigrateLegacyWallet(w *Wallet) (*Migration, error) {
+	if w.Scheme() != SchemeP256 {
+		return nil, fmt.Errorf("wallet uses the %s scheme, only %s wallets are migrated", w.Scheme(), SchemeP256)
+	}
+
+	newAddress, err := DeriveAddress(crypto.FromECDSA(w.GetPrivateKey()), SchemeSecp256k1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migration{
+		OldAddress: w.GetAddressBytes(),
+		NewAddress: newAddress,
+	}, nil
+}
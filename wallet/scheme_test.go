@@ -0,0 +1,42 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// testKeyHex is a private key with a well known secp256k1 address
+const testKeyHex = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+func TestMigrateLegacyWallet(t *testing.T) {
+	for scheme, expected := range map[string]error{
+		"":              ErrMissingScheme,
+		"ed25519":       ErrUnknownScheme,
+		SchemeSecp256k1: ErrUnsupportedScheme,
+	} {
+		if _, err := ImportWallet(testKeyHex, scheme); !errors.Is(err, expected) {
+			t.Errorf("import with scheme %q: error %v, expected %v", scheme, err, expected)
+		}
+	}
+
+	legacy, err := ImportWallet(testKeyHex, SchemeP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Scheme() != SchemeP256 {
+		t.Fatalf("imported wallet has scheme %s", legacy.Scheme())
+	}
+
+	migration, err := MigrateLegacyWallet(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migration.OldAddress != legacy.GetAddressBytes() {
+		t.Errorf("old address %x, expected %x", migration.OldAddress, legacy.GetAddressBytes())
+	}
+	if expected := common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"); migration.NewAddress != expected {
+		t.Errorf("secp256k1 address %x, expected %x", migration.NewAddress, expected)
+	}
+}
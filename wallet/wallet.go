@@ -1,4 +1,3 @@
-
 package wallet
 
 import (
@@ -13,6 +12,7 @@ type Wallet struct {
 	privateKey *ecdsa.PrivateKey
 	publicKey  *ecdsa.PublicKey
 	address    [20]byte
+	scheme     string
 }
 
 func NewWallet() (*Wallet, error) {
@@ -27,6 +27,7 @@ func NewWallet() (*Wallet, error) {
 		privateKey: privateKey,
 		publicKey:  publicKey,
 		address:    address,
+		scheme:     SchemeP256,
 	}, nil
 }
 
@@ -48,6 +49,7 @@ func NewWalletFromPrivateKey(privateKeyHex string) (*Wallet, error) {
 		privateKey: privateKey,
 		publicKey:  publicKey,
 		address:    address,
+		scheme:     SchemeP256,
 	}, nil
 }
 
@@ -59,6 +61,11 @@ func (w *Wallet) GetAddressBytes() [20]byte {
 	return w.address
 }
 
+// Scheme returns the derivation scheme of the wallet's address
+func (w *Wallet) Scheme() string {
+	return w.scheme
+}
+
 func (w *Wallet) GetPrivateKey() *ecdsa.PrivateKey {
 	return w.privateKey
 }
@@ -80,6 +87,6 @@ func (w *Wallet) SignData(data []byte) ([]byte, error) {
 	return crypto.Sign(hash[:], crypto.FromECDSA(w.privateKey))
 }
 
-func (w *Wallet) SignTransaction(tx *core.Transaction) error {
-	return tx.Sign(crypto.FromECDSA(w.privateKey))
+func (w *Wallet) SignTransaction(tx *core.Transaction, chainID uint64) error {
+	return tx.Sign(crypto.FromECDSA(w.privateKey), chainID)
 }